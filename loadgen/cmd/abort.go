@@ -0,0 +1,77 @@
+package main
+
+import "sync"
+
+// AbortMonitor trips when the error rate over the most recent window of requests exceeds a threshold
+// It lets a run against a broken endpoint fail fast instead of hammering it for the full -n
+type AbortMonitor struct {
+	mu        sync.Mutex
+	threshold float64 // Error rate (0-1) that trips the monitor
+	window    []bool  // Ring buffer of recent outcomes; true means failed
+	next      int
+	filled    int
+	failures  int
+
+	tripped     chan struct{}
+	trippedRate float64
+}
+
+// NewAbortMonitor creates a monitor over the last window requests
+func NewAbortMonitor(threshold float64, window int) *AbortMonitor {
+	return &AbortMonitor{
+		threshold: threshold,
+		window:    make([]bool, window),
+		tripped:   make(chan struct{}),
+	}
+}
+
+// Record adds one request outcome; safe to call on a nil monitor
+// The monitor only trips once the window is full, so a few early failures can't abort the run
+func (m *AbortMonitor) Record(failed bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.filled == len(m.window) {
+		if m.window[m.next] {
+			m.failures--
+		}
+	} else {
+		m.filled++
+	}
+	m.window[m.next] = failed
+	if failed {
+		m.failures++
+	}
+	m.next = (m.next + 1) % len(m.window)
+
+	if m.filled < len(m.window) || m.Aborted() {
+		return
+	}
+	if rate := float64(m.failures) / float64(m.filled); rate > m.threshold {
+		m.trippedRate = rate
+		close(m.tripped)
+	}
+}
+
+// Aborted reports whether the monitor has tripped; a nil monitor never trips
+func (m *AbortMonitor) Aborted() bool {
+	if m == nil {
+		return false
+	}
+	select {
+	case <-m.tripped:
+		return true
+	default:
+		return false
+	}
+}
+
+// TrippedRate returns the windowed error rate that caused the abort
+func (m *AbortMonitor) TrippedRate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.trippedRate
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAbortMonitor(t *testing.T) {
+	// Outcomes: f is a failed request, s a successful one
+	tests := []struct {
+		name        string
+		threshold   float64
+		window      int
+		outcomes    string
+		wantAborted bool
+		wantRate    float64
+	}{
+		{name: "sustained failure trips", threshold: 0.5, window: 4, outcomes: "ffff", wantAborted: true, wantRate: 1},
+		{name: "not before the window fills", threshold: 0.5, window: 4, outcomes: "fff"},
+		{name: "at the threshold doesn't trip", threshold: 0.5, window: 4, outcomes: "ffss"},
+		{name: "just over the threshold trips", threshold: 0.5, window: 4, outcomes: "fffs", wantAborted: true, wantRate: 0.75},
+		{name: "early failures age out of the window", threshold: 0.5, window: 4, outcomes: "ffsssss"},
+		{name: "failures late in the run trip", threshold: 0.5, window: 4, outcomes: "ssssssfff", wantAborted: true, wantRate: 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewAbortMonitor(tt.threshold, tt.window)
+			for _, outcome := range tt.outcomes {
+				m.Record(outcome == 'f')
+			}
+			if got := m.Aborted(); got != tt.wantAborted {
+				t.Errorf("Aborted() = %v, want %v", got, tt.wantAborted)
+			}
+			if got := m.TrippedRate(); got != tt.wantRate {
+				t.Errorf("TrippedRate() = %v, want %v", got, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestRunAbortsEarlyOnErrorRate(t *testing.T) {
+	const requests = 500
+	tests := []struct {
+		name      string
+		status    int
+		abort     bool // Run with -abort-on-error-rate 0.5 over a window of 10
+		wantAbort bool
+	}{
+		{name: "failing endpoint aborts", status: http.StatusInternalServerError, abort: true, wantAbort: true},
+		{name: "healthy endpoint runs to completion", status: http.StatusOK, abort: true},
+		{name: "failing endpoint without the flag runs to completion", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			stats := &Stats{statusCode: make(map[int]int64), merchants: make(map[string]*MerchantStats)}
+			if tt.abort {
+				stats.abort = NewAbortMonitor(0.5, 10)
+			}
+			merchants, err := parseMerchants("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			runClosed(server.Client(), server.URL, merchants, false, requests, 4, 0, stats)
+
+			if got := stats.abort.Aborted(); got != tt.wantAbort {
+				t.Errorf("Aborted() = %v, want %v", got, tt.wantAbort)
+			}
+			// Workers already mid-request finish, so a few past the window are expected but nowhere near -n
+			if tt.wantAbort && sent.Load() > 20 {
+				t.Errorf("sent %d of %d requests after aborting, want the run cut short", sent.Load(), requests)
+			}
+			if !tt.wantAbort && sent.Load() != requests {
+				t.Errorf("sent %d requests, want all %d", sent.Load(), requests)
+			}
+			if stats.total != sent.Load() {
+				t.Errorf("stats total = %d, want the %d requests sent", stats.total, sent.Load())
+			}
+		})
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,42 +24,149 @@ type Stats struct {
 	timeout    int64
 	durations  []time.Duration
 	statusCode map[int]int64
+	merchants  map[string]*MerchantStats
+	abort      *AbortMonitor // nil unless -abort-on-error-rate is set
 	mu         sync.Mutex
+
+	// Successful responses to requests carrying an Idempotency-Key, split by whether the service replayed a cached result
+	idempotencyHits   int64
+	idempotencyMisses int64
+}
+
+// MerchantStats tracks outcomes for a single merchant ID
+type MerchantStats struct {
+	success int64
+	failed  int64
 }
 
-func (s *Stats) recordSuccess(duration time.Duration, statusCode int) {
+func (s *Stats) recordSuccess(merchantID string, duration time.Duration, statusCode int) {
 	atomic.AddInt64(&s.success, 1)
 	s.mu.Lock()
 	s.durations = append(s.durations, duration)
 	s.statusCode[statusCode]++
+	s.merchant(merchantID).success++
 	s.mu.Unlock()
+	s.abort.Record(false)
 }
 
-func (s *Stats) recordFailure() {
+func (s *Stats) recordFailure(merchantID string) {
 	atomic.AddInt64(&s.failed, 1)
+	s.mu.Lock()
+	s.merchant(merchantID).failed++
+	s.mu.Unlock()
+	s.abort.Record(true)
 }
 
-func (s *Stats) recordTimeout() {
+func (s *Stats) recordTimeout(merchantID string) {
 	atomic.AddInt64(&s.timeout, 1)
+	s.mu.Lock()
+	s.merchant(merchantID).failed++
+	s.mu.Unlock()
+	s.abort.Record(true)
+}
+
+// recordIdempotency counts a successful keyed response as a cache hit if the service marked it as a replay
+func (s *Stats) recordIdempotency(req *http.Request, resp *http.Response) {
+	if req.Header.Get("Idempotency-Key") == "" {
+		return
+	}
+	if resp.Header.Get("Idempotent-Replayed") == "true" {
+		atomic.AddInt64(&s.idempotencyHits, 1)
+	} else {
+		atomic.AddInt64(&s.idempotencyMisses, 1)
+	}
+}
+
+// idempotencyHitRate returns the share of keyed successes served from the idempotency store, and false if none were keyed
+func (s *Stats) idempotencyHitRate() (float64, bool) {
+	keyed := s.idempotencyHits + s.idempotencyMisses
+	if keyed == 0 {
+		return 0, false
+	}
+	return float64(s.idempotencyHits) / float64(keyed), true
+}
+
+// merchant returns the stats entry for a merchant, creating it on first use; caller holds mu
+func (s *Stats) merchant(merchantID string) *MerchantStats {
+	m, ok := s.merchants[merchantID]
+	if !ok {
+		m = &MerchantStats{}
+		s.merchants[merchantID] = m
+	}
+	return m
 }
 
 func main() {
 	targetURL := flag.String("url", "http://localhost:8080/orders", "Target URL")
 	concurrency := flag.Int("c", 10, "Number of concurrent requests")
+	rate := flag.Float64("rate", 0, "Open model: start this many requests per second regardless of responses (0 uses -c workers)")
+	rateTolerance := flag.Float64("rate-tolerance", 0.02, "Warn when the achieved -rate falls short of the target by more than this fraction")
 	requests := flag.Int("n", 100, "Total number of requests")
 	timeout := flag.Duration("t", 5*time.Second, "Request timeout")
 	idempotent := flag.Bool("idempotent", false, "Use idempotency keys")
+	merchantSpec := flag.String("merchants", "", "Merchant count (e.g. 5) or weighted list (e.g. vip:5,small:1)")
+	connectRamp := flag.Duration("connect-ramp", 0, "Spread worker startup evenly over this duration (0 starts all at once)")
+	recordFile := flag.String("record", "", "Run as a recording proxy, capturing requests to this file")
+	listen := flag.String("listen", ":9090", "Listen address for -record mode")
+	replayFile := flag.String("replay", "", "Replay requests captured with -record instead of generating orders")
+	speed := flag.Float64("speed", 1, "Replay speed multiplier (2 = twice as fast, 0 = as fast as possible)")
+	abortRate := flag.Float64("abort-on-error-rate", 0, "Stop early when the error rate over -abort-window exceeds this fraction (0 disables)")
+	abortWindow := flag.Int("abort-window", 50, "Number of most recent requests used for -abort-on-error-rate")
 	flag.Parse()
 
+	if *abortRate < 0 || *abortRate >= 1 || *abortWindow < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid -abort-on-error-rate/-abort-window: rate must be in [0, 1) and window at least 1\n")
+		os.Exit(2)
+	}
+	if *rate < 0 || *rateTolerance < 0 || *rateTolerance >= 1 {
+		fmt.Fprintf(os.Stderr, "Invalid -rate/-rate-tolerance: rate must not be negative and tolerance must be in [0, 1)\n")
+		os.Exit(2)
+	}
+
+	// -url's scheme and host are the proxy/replay target; recorded paths are kept as-is
+	if *recordFile != "" || *replayFile != "" {
+		target, err := url.Parse(*targetURL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			fmt.Fprintf(os.Stderr, "Invalid -url: expected an absolute URL\n")
+			os.Exit(2)
+		}
+		if *recordFile != "" {
+			if err := runRecord(*listen, *recordFile, target); err != nil {
+				fmt.Fprintf(os.Stderr, "Recording failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		runReplay(*replayFile, target, *speed, *concurrency, *timeout)
+		return
+	}
+
+	merchants, err := parseMerchants(*merchantSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -merchants: %v\n", err)
+		os.Exit(2)
+	}
+
 	fmt.Printf("Load Test Configuration:\n")
 	fmt.Printf("  URL: %s\n", *targetURL)
-	fmt.Printf("  Concurrency: %d\n", *concurrency)
+	if *rate > 0 {
+		fmt.Printf("  Arrival Rate: %g req/s (open model)\n", *rate)
+	} else {
+		fmt.Printf("  Concurrency: %d\n", *concurrency)
+	}
 	fmt.Printf("  Total Requests: %d\n", *requests)
 	fmt.Printf("  Timeout: %s\n", *timeout)
-	fmt.Printf("  Idempotent: %v\n\n", *idempotent)
+	fmt.Printf("  Idempotent: %v\n", *idempotent)
+	fmt.Printf("  Merchants: %d\n", len(merchants.ids))
+	fmt.Printf("  Connect Ramp: %s\n", *connectRamp)
+	fmt.Printf("  Abort On Error Rate: %g (window %d)\n\n", *abortRate, *abortWindow)
 
 	stats := &Stats{
 		statusCode: make(map[int]int64),
+		merchants:  make(map[string]*MerchantStats),
+	}
+	if *abortRate > 0 {
+		stats.abort = NewAbortMonitor(*abortRate, *abortWindow)
 	}
 
 	client := &http.Client{
@@ -64,41 +174,135 @@ func main() {
 	}
 
 	startTime := time.Now()
+	var pacer *Pacer
+	if *rate > 0 {
+		pacer = runOpen(client, *targetURL, merchants, *idempotent, *requests, *rate, stats)
+	} else {
+		runClosed(client, *targetURL, merchants, *idempotent, *requests, *concurrency, *connectRamp, stats)
+	}
+	duration := time.Since(startTime)
+
+	if stats.abort.Aborted() {
+		fmt.Printf("\nABORTED: error rate %.1f%% over the last %d requests exceeded %.1f%%; %d of %d requests sent\n",
+			stats.abort.TrippedRate()*100, *abortWindow, *abortRate*100, stats.total, *requests)
+		printResults(stats, merchants, duration)
+		printArrivalRate(pacer, *rate, *rateTolerance)
+		os.Exit(1)
+	}
 
+	// Print results
+	printResults(stats, merchants, duration)
+	printArrivalRate(pacer, *rate, *rateTolerance)
+}
+
+// runClosed sends requests from a fixed pool of workers, each starting its next request once the last one finished
+func runClosed(client *http.Client, targetURL string, merchants *MerchantPicker, idempotent bool, requests, concurrency int, connectRamp time.Duration, stats *Stats) {
 	// Create worker pool
-	jobs := make(chan int, *requests)
+	jobs := make(chan int, requests)
 	var wg sync.WaitGroup
 
-	// Start workers
-	for i := 0; i < *concurrency; i++ {
+	// Start workers, optionally staggered so connections aren't all opened in the same instant
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
-		go func() {
+		go func(delay time.Duration) {
 			defer wg.Done()
+			time.Sleep(delay)
 			for range jobs {
-				makeRequest(client, *targetURL, *idempotent, stats)
+				// Drain remaining jobs without sending once the run has been aborted
+				if stats.abort.Aborted() {
+					continue
+				}
+				atomic.AddInt64(&stats.total, 1)
+				makeRequest(client, targetURL, merchants.Pick(), idempotent, stats)
 			}
-		}()
+		}(rampDelay(i, concurrency, connectRamp))
 	}
 
 	// Send jobs
-	for i := 0; i < *requests; i++ {
-		atomic.AddInt64(&stats.total, 1)
+	for i := 0; i < requests; i++ {
 		jobs <- i
 	}
 	close(jobs)
 
 	// Wait for completion
 	wg.Wait()
-	duration := time.Since(startTime)
+}
 
-	// Print results
-	printResults(stats, duration)
+// runOpen starts requests at a fixed rate whether or not earlier ones have finished, so a slow server
+// builds up in-flight requests as real independent clients would, instead of quietly slowing the load
+// Returns the pacer so the achieved rate can be reported
+func runOpen(client *http.Client, targetURL string, merchants *MerchantPicker, idempotent bool, requests int, rate float64, stats *Stats) *Pacer {
+	var wg sync.WaitGroup
+	pacer := NewPacer(rate)
+	for i := 0; i < requests && !stats.abort.Aborted(); i++ {
+		pacer.Wait()
+		atomic.AddInt64(&stats.total, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			makeRequest(client, targetURL, merchants.Pick(), idempotent, stats)
+		}()
+	}
+	wg.Wait()
+	return pacer
 }
 
-func makeRequest(client *http.Client, url string, useIdempotency bool, stats *Stats) {
+// printArrivalRate compares the open model's achieved arrival rate with -rate; pacer is nil in the closed model
+// Falling short means the loadgen itself couldn't keep up, so the run under-drove the server
+func printArrivalRate(pacer *Pacer, target, tolerance float64) {
+	if pacer == nil {
+		return
+	}
+	achieved := pacer.Achieved()
+	fmt.Printf("\nArrival Rate:      target %.2f req/s, achieved %.2f req/s (%+.2f%%)\n",
+		target, achieved, (achieved-target)/target*100)
+	if achieved > 0 && achieved < target*(1-tolerance) {
+		fmt.Printf("WARNING: achieved rate is more than %.1f%% below target; the loadgen host may be saturated\n", tolerance*100)
+	}
+}
+
+// runReplay replays a recording against target and prints the usual results
+func runReplay(file string, target *url.URL, speed float64, concurrency int, timeout time.Duration) {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay failed: %v\n", err)
+		os.Exit(1)
+	}
+	recs, err := readRecording(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay failed: %s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Replay Configuration:\n")
+	fmt.Printf("  Recording: %s (%d requests)\n", file, len(recs))
+	fmt.Printf("  Target: %s\n", target.Host)
+	fmt.Printf("  Speed: %gx\n", speed)
+	fmt.Printf("  Concurrency: %d\n\n", concurrency)
+
+	stats := &Stats{
+		statusCode: make(map[int]int64),
+		merchants:  make(map[string]*MerchantStats),
+	}
+
+	startTime := time.Now()
+	replay(&http.Client{Timeout: timeout}, target, recs, speed, concurrency, stats)
+	printResults(stats, nil, time.Since(startTime))
+}
+
+// rampDelay returns when worker i of n should start so that startups are spread evenly across ramp
+func rampDelay(i, n int, ramp time.Duration) time.Duration {
+	if ramp <= 0 || n <= 1 {
+		return 0
+	}
+	return ramp * time.Duration(i) / time.Duration(n)
+}
+
+func makeRequest(client *http.Client, url, merchantID string, useIdempotency bool, stats *Stats) {
 	// Create request payload
 	payload := map[string]interface{}{
-		"merchant_id": "merchant_123",
+		"merchant_id": merchantID,
 		"amount":      99.99,
 		"currency":    "USD",
 	}
@@ -106,7 +310,7 @@ func makeRequest(client *http.Client, url string, useIdempotency bool, stats *St
 	body, _ := json.Marshal(payload)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		stats.recordFailure()
+		stats.recordFailure(merchantID)
 		return
 	}
 
@@ -122,7 +326,7 @@ func makeRequest(client *http.Client, url string, useIdempotency bool, stats *St
 	duration := time.Since(start)
 
 	if err != nil {
-		stats.recordTimeout()
+		stats.recordTimeout(merchantID)
 		return
 	}
 	defer resp.Body.Close()
@@ -131,16 +335,18 @@ func makeRequest(client *http.Client, url string, useIdempotency bool, stats *St
 	io.Copy(io.Discard, resp.Body)
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		stats.recordSuccess(duration, resp.StatusCode)
+		stats.recordSuccess(merchantID, duration, resp.StatusCode)
+		stats.recordIdempotency(req, resp)
 	} else {
-		stats.recordFailure()
+		stats.recordFailure(merchantID)
 		stats.mu.Lock()
 		stats.statusCode[resp.StatusCode]++
 		stats.mu.Unlock()
 	}
 }
 
-func printResults(stats *Stats, totalDuration time.Duration) {
+// printResults reports overall and per-merchant outcomes; merchants is nil when there is no expected mix (replays)
+func printResults(stats *Stats, merchants *MerchantPicker, totalDuration time.Duration) {
 	fmt.Printf("\n=== Load Test Results ===\n\n")
 	fmt.Printf("Total Requests:    %d\n", stats.total)
 	fmt.Printf("Successful:        %d\n", stats.success)
@@ -182,10 +388,34 @@ func printResults(stats *Stats, totalDuration time.Duration) {
 		fmt.Printf("  Max:      %s\n\n", durations[len(durations)-1])
 	}
 
+	if rate, ok := stats.idempotencyHitRate(); ok {
+		fmt.Printf("Idempotency Hit Rate: %.1f%% (%d replayed, %d new orders)\n\n",
+			rate*100, stats.idempotencyHits, stats.idempotencyMisses)
+	}
+
 	if len(stats.statusCode) > 0 {
 		fmt.Printf("Status Code Distribution:\n")
 		for code, count := range stats.statusCode {
 			fmt.Printf("  %d: %d (%.1f%%)\n", code, count, float64(count)/float64(stats.total)*100)
 		}
 	}
+
+	if len(stats.merchants) > 1 {
+		ids := make([]string, 0, len(stats.merchants))
+		for id := range stats.merchants {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		fmt.Printf("\nPer-Merchant Breakdown:\n")
+		for _, id := range ids {
+			m := stats.merchants[id]
+			requests := m.success + m.failed
+			share := fmt.Sprintf("%.1f%%", float64(requests)/float64(stats.total)*100)
+			if merchants != nil {
+				share += fmt.Sprintf(", expected %.1f%%", merchants.Share(id)*100)
+			}
+			fmt.Printf("  %-20s requests: %d (%s)  success: %d  failed: %d\n", id, requests, share, m.success, m.failed)
+		}
+	}
 }
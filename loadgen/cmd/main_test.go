@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRampDelay(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		ramp time.Duration
+		want []time.Duration
+	}{
+		{name: "no ramp", n: 3, want: []time.Duration{0, 0, 0}},
+		{name: "single worker", n: 1, ramp: time.Second, want: []time.Duration{0}},
+		{name: "spread evenly", n: 4, ramp: time.Second, want: []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := rampDelay(i, tt.n, tt.ramp); got != want {
+					t.Errorf("rampDelay(%d, %d, %v) = %v, want %v", i, tt.n, tt.ramp, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunClosedConnectRamp(t *testing.T) {
+	const workers = 5
+	tests := []struct {
+		name       string
+		ramp       time.Duration
+		wantSpread time.Duration // Least time between the first and last worker's first request
+		maxSpread  time.Duration
+	}{
+		{name: "all at once", maxSpread: 50 * time.Millisecond},
+		{name: "ramped", ramp: 200 * time.Millisecond, wantSpread: 140 * time.Millisecond, maxSpread: 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each request outlasts the ramp, so every worker sends exactly one and arrivals mark worker startups
+			var mu sync.Mutex
+			var arrivals []time.Time
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				arrivals = append(arrivals, time.Now())
+				mu.Unlock()
+				time.Sleep(tt.ramp + 50*time.Millisecond)
+			}))
+			defer server.Close()
+
+			stats := &Stats{statusCode: make(map[int]int64), merchants: make(map[string]*MerchantStats)}
+			merchants, err := parseMerchants("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			runClosed(server.Client(), server.URL, merchants, false, workers, workers, tt.ramp, stats)
+
+			if len(arrivals) != workers {
+				t.Fatalf("server saw %d requests, want %d", len(arrivals), workers)
+			}
+			slices.SortFunc(arrivals, func(a, b time.Time) int { return a.Compare(b) })
+			spread := arrivals[workers-1].Sub(arrivals[0])
+			if spread < tt.wantSpread || spread > tt.maxSpread {
+				t.Errorf("worker startups spread over %v, want between %v and %v", spread, tt.wantSpread, tt.maxSpread)
+			}
+			for i := 1; i < workers && tt.ramp > 0; i++ {
+				if gap := arrivals[i].Sub(arrivals[i-1]); gap < tt.ramp/workers/2 {
+					t.Errorf("workers %d and %d started %v apart, want about %v", i-1, i, gap, tt.ramp/workers)
+				}
+			}
+		})
+	}
+}
+
+// replayOutcome is how the stub service answers one request
+type replayOutcome struct {
+	status   int
+	replayed bool
+}
+
+func TestIdempotencyHitRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		idempotent bool
+		outcomes   []replayOutcome
+		wantRate   float64
+		wantOK     bool
+	}{
+		{name: "no keyed requests", idempotent: false, outcomes: []replayOutcome{{201, false}, {201, true}}, wantOK: false},
+		{name: "all new orders", idempotent: true, outcomes: []replayOutcome{{201, false}, {201, false}}, wantRate: 0, wantOK: true},
+		{name: "one replay in four", idempotent: true, outcomes: []replayOutcome{{201, false}, {200, true}, {201, false}, {201, false}}, wantRate: 0.25, wantOK: true},
+		{name: "all replayed", idempotent: true, outcomes: []replayOutcome{{200, true}, {200, true}, {200, true}}, wantRate: 1, wantOK: true},
+		{name: "failures aren't counted", idempotent: true, outcomes: []replayOutcome{{200, true}, {500, false}, {201, false}, {503, false}}, wantRate: 0.5, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			next := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				outcome := tt.outcomes[next]
+				next++
+				mu.Unlock()
+				if outcome.replayed {
+					w.Header().Set("Idempotent-Replayed", "true")
+				}
+				w.WriteHeader(outcome.status)
+			}))
+			defer server.Close()
+
+			stats := &Stats{statusCode: make(map[int]int64), merchants: make(map[string]*MerchantStats)}
+			for range tt.outcomes {
+				makeRequest(server.Client(), server.URL, "merchant_1", tt.idempotent, stats)
+			}
+
+			rate, ok := stats.idempotencyHitRate()
+			if ok != tt.wantOK || rate != tt.wantRate {
+				t.Errorf("idempotencyHitRate() = %v, %v, want %v, %v", rate, ok, tt.wantRate, tt.wantOK)
+			}
+		})
+	}
+}
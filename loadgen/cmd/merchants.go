@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultMerchant is used when -merchants is not set, matching the original single-merchant load
+const defaultMerchant = "merchant_123"
+
+// MerchantPicker selects a merchant ID per request according to configured weights
+type MerchantPicker struct {
+	ids         []string
+	cumulative  []int // Running weight totals for binary search
+	totalWeight int
+}
+
+// parseMerchants builds a picker from a -merchants spec:
+//   - ""                      → always defaultMerchant
+//   - "5"                     → merchant_1..merchant_5 with equal weight
+//   - "vip:5,small:1,other"   → weighted list; entries without a weight count as 1
+func parseMerchants(spec string) (*MerchantPicker, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return newMerchantPicker([]string{defaultMerchant}, []int{1}), nil
+	}
+
+	if count, err := strconv.Atoi(spec); err == nil {
+		if count < 1 {
+			return nil, fmt.Errorf("merchant count must be at least 1, got %d", count)
+		}
+		ids := make([]string, count)
+		weights := make([]int, count)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("merchant_%d", i+1)
+			weights[i] = 1
+		}
+		return newMerchantPicker(ids, weights), nil
+	}
+
+	var ids []string
+	var weights []int
+	for _, entry := range strings.Split(spec, ",") {
+		id, weightStr, hasWeight := strings.Cut(strings.TrimSpace(entry), ":")
+		if id == "" {
+			return nil, fmt.Errorf("empty merchant ID in %q", spec)
+		}
+		weight := 1
+		if hasWeight {
+			w, err := strconv.Atoi(weightStr)
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight %q for merchant %s", weightStr, id)
+			}
+			weight = w
+		}
+		ids = append(ids, id)
+		weights = append(weights, weight)
+	}
+	return newMerchantPicker(ids, weights), nil
+}
+
+func newMerchantPicker(ids []string, weights []int) *MerchantPicker {
+	p := &MerchantPicker{ids: ids, cumulative: make([]int, len(weights))}
+	for i, w := range weights {
+		p.totalWeight += w
+		p.cumulative[i] = p.totalWeight
+	}
+	return p
+}
+
+// Pick returns a merchant ID with probability proportional to its weight
+func (p *MerchantPicker) Pick() string {
+	n := rand.Intn(p.totalWeight)
+	i := sort.SearchInts(p.cumulative, n+1)
+	return p.ids[i]
+}
+
+// Share returns the expected fraction of requests for each merchant
+func (p *MerchantPicker) Share(id string) float64 {
+	prev := 0
+	for i, m := range p.ids {
+		if m == id {
+			return float64(p.cumulative[i]-prev) / float64(p.totalWeight)
+		}
+		prev = p.cumulative[i]
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMerchantDistribution(t *testing.T) {
+	const picks = 100000
+
+	tests := []struct {
+		spec      string
+		wantShare map[string]float64
+	}{
+		{spec: "", wantShare: map[string]float64{"merchant_123": 1}},
+		{spec: "4", wantShare: map[string]float64{"merchant_1": 0.25, "merchant_2": 0.25, "merchant_3": 0.25, "merchant_4": 0.25}},
+		{spec: "vip:5,small:1,other", wantShare: map[string]float64{"vip": 5.0 / 7, "small": 1.0 / 7, "other": 1.0 / 7}},
+		{spec: " heavy:9 , light:1 ", wantShare: map[string]float64{"heavy": 0.9, "light": 0.1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			picker, err := parseMerchants(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts := make(map[string]int)
+			for i := 0; i < picks; i++ {
+				counts[picker.Pick()]++
+			}
+			for id, count := range counts {
+				if _, ok := tt.wantShare[id]; !ok {
+					t.Errorf("picked unconfigured merchant %q %d times", id, count)
+				}
+			}
+			for id, want := range tt.wantShare {
+				if got := picker.Share(id); math.Abs(got-want) > 1e-9 {
+					t.Errorf("Share(%q) = %v, want %v", id, got, want)
+				}
+				// Well over 5 standard deviations at 100k picks
+				if got := float64(counts[id]) / picks; math.Abs(got-want) > 0.01 {
+					t.Errorf("%q picked %.3f of the time, want %.3f", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMerchantsRejectsBadSpecs(t *testing.T) {
+	for _, spec := range []string{"0", "-2", "vip:0", "vip:x", "vip:5,,small", ":3"} {
+		if _, err := parseMerchants(spec); err == nil {
+			t.Errorf("parseMerchants(%q) succeeded, want an error", spec)
+		}
+	}
+}
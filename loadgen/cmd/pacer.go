@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// Pacer spaces open-model arrivals at a fixed rate
+// Each arrival is due at start + i/rate rather than one interval after the previous one, so oversleeping
+// and scheduling jitter are made up on the next arrival instead of accumulating into a lower achieved rate
+type Pacer struct {
+	rate  float64 // Target arrivals per second
+	start time.Time
+	sent  int64
+	last  time.Time // When the most recent arrival was released
+}
+
+// NewPacer creates a pacer releasing rate arrivals per second, starting now
+func NewPacer(rate float64) *Pacer {
+	return &Pacer{rate: rate, start: time.Now()}
+}
+
+// Wait blocks until the next arrival is due; a pacer that has fallen behind returns at once to catch up
+func (p *Pacer) Wait() {
+	due := p.start.Add(time.Duration(float64(p.sent) / p.rate * float64(time.Second)))
+	p.sent++
+	if delay := time.Until(due); delay > 0 {
+		time.Sleep(delay)
+	}
+	p.last = time.Now()
+}
+
+// Achieved returns the arrival rate actually delivered, measured from the first arrival to the last
+// It's 0 until two arrivals have been released
+func (p *Pacer) Achieved() float64 {
+	if p.sent < 2 {
+		return 0
+	}
+	return float64(p.sent-1) / p.last.Sub(p.start).Seconds()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPacerAchievesTargetRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		arrivals  int
+		tolerance float64 // Allowed fractional difference between achieved and target
+		busy      time.Duration
+	}{
+		{name: "moderate rate", rate: 200, arrivals: 100, tolerance: 0.05},
+		{name: "sub-millisecond interval", rate: 2000, arrivals: 400, tolerance: 0.05},
+		// Work between arrivals eats into each interval; due times absorb it rather than adding it on
+		{name: "caller busy between arrivals", rate: 200, arrivals: 100, tolerance: 0.05, busy: 2 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pacer := NewPacer(tt.rate)
+			if got := pacer.Achieved(); got != 0 {
+				t.Errorf("Achieved() before any arrival = %v, want 0", got)
+			}
+			for i := 0; i < tt.arrivals; i++ {
+				pacer.Wait()
+				time.Sleep(tt.busy)
+			}
+			if got := pacer.Achieved(); math.Abs(got-tt.rate)/tt.rate > tt.tolerance {
+				t.Errorf("Achieved() = %.1f req/s, want within %.0f%% of %v", got, tt.tolerance*100, tt.rate)
+			}
+		})
+	}
+}
+
+func TestRunOpenIgnoresSlowResponses(t *testing.T) {
+	const rate, requests = 100.0, 40
+	tests := []struct {
+		name    string
+		latency time.Duration
+	}{
+		{name: "fast server"},
+		// Each response outlasts many arrival intervals, which would throttle a closed model
+		{name: "slow server", latency: 150 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var arrivals []time.Time
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				arrivals = append(arrivals, time.Now())
+				mu.Unlock()
+				time.Sleep(tt.latency)
+			}))
+			defer server.Close()
+
+			stats := &Stats{statusCode: make(map[int]int64), merchants: make(map[string]*MerchantStats)}
+			merchants, err := parseMerchants("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pacer := runOpen(server.Client(), server.URL, merchants, false, requests, rate, stats)
+
+			if len(arrivals) != requests {
+				t.Fatalf("server saw %d requests, want %d", len(arrivals), requests)
+			}
+			slices.SortFunc(arrivals, func(a, b time.Time) int { return a.Compare(b) })
+			observed := float64(requests-1) / arrivals[requests-1].Sub(arrivals[0]).Seconds()
+			for what, got := range map[string]float64{"achieved": pacer.Achieved(), "server-observed": observed} {
+				if math.Abs(got-rate)/rate > 0.1 {
+					t.Errorf("%s rate = %.1f req/s, want within 10%% of %v", what, got, rate)
+				}
+			}
+		})
+	}
+}
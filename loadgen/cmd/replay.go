@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// maxRecordedLineBytes bounds a single recorded request when reading a recording back
+const maxRecordedLineBytes = 1 << 20
+
+// RecordedRequest is one captured request, stored one JSON object per line
+type RecordedRequest struct {
+	OffsetMS int64       `json:"offset_ms"` // Time since recording started
+	Method   string      `json:"method"`
+	Path     string      `json:"path"` // Path including query string
+	Header   http.Header `json:"header"`
+	Body     string      `json:"body,omitempty"`
+}
+
+// hopHeaders are connection-specific and must not be recorded or replayed
+var hopHeaders = []string{"Connection", "Content-Length", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade"}
+
+// Recorder is a reverse proxy that forwards traffic to the target while appending each request to a file
+type Recorder struct {
+	proxy *httputil.ReverseProxy
+	start time.Time
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	n   int64
+}
+
+// NewRecorder creates a recorder forwarding to target and writing captured requests to w
+func NewRecorder(target *url.URL, w io.Writer) *Recorder {
+	return &Recorder{
+		proxy: httputil.NewSingleHostReverseProxy(target),
+		start: time.Now(),
+		enc:   json.NewEncoder(w),
+	}
+}
+
+// ServeHTTP captures the request, then proxies it unchanged
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := req.Header.Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+
+	r.mu.Lock()
+	err = r.enc.Encode(RecordedRequest{
+		OffsetMS: time.Since(r.start).Milliseconds(),
+		Method:   req.Method,
+		Path:     req.URL.RequestURI(),
+		Header:   header,
+		Body:     string(body),
+	})
+	r.n++
+	r.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to record request: %v", err)
+	}
+
+	r.proxy.ServeHTTP(w, req)
+}
+
+// Recorded returns the number of requests captured so far
+func (r *Recorder) Recorded() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// runRecord serves the recording proxy on listen until interrupted
+func runRecord(listen, file string, target *url.URL) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	recorder := NewRecorder(target, f)
+	srv := &http.Server{Addr: listen, Handler: recorder}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		srv.Close()
+	}()
+
+	fmt.Printf("Recording traffic on %s -> %s into %s (Ctrl+C to stop)\n", listen, target, file)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	fmt.Printf("Recorded %d requests\n", recorder.Recorded())
+	return nil
+}
+
+// readRecording loads every captured request from a recording file
+func readRecording(r io.Reader) ([]RecordedRequest, error) {
+	var recs []RecordedRequest
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRecordedLineBytes)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec RecordedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, scanner.Err()
+}
+
+// replay sends recorded requests to target, preserving their relative timing scaled by speed
+// A speed of 2 replays twice as fast; 0 sends as fast as the concurrency allows
+func replay(client *http.Client, target *url.URL, recs []RecordedRequest, speed float64, concurrency int, stats *Stats) {
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for _, rec := range recs {
+		if speed > 0 {
+			due := time.Duration(float64(time.Duration(rec.OffsetMS)*time.Millisecond) / speed)
+			time.Sleep(time.Until(start.Add(due)))
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		atomic.AddInt64(&stats.total, 1)
+		go func(rec RecordedRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			sendRecorded(client, target, rec, stats)
+		}(rec)
+	}
+	wg.Wait()
+}
+
+// sendRecorded issues one recorded request and records the outcome like makeRequest
+func sendRecorded(client *http.Client, target *url.URL, rec RecordedRequest, stats *Stats) {
+	merchantID := merchantFromBody(rec.Body)
+
+	req, err := http.NewRequest(rec.Method, target.Scheme+"://"+target.Host+rec.Path, bytes.NewBufferString(rec.Body))
+	if err != nil {
+		stats.recordFailure(merchantID)
+		return
+	}
+	req.Header = rec.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	duration := time.Since(start)
+
+	if err != nil {
+		stats.recordTimeout(merchantID)
+		return
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		stats.recordSuccess(merchantID, duration, resp.StatusCode)
+		stats.recordIdempotency(req, resp)
+	} else {
+		stats.recordFailure(merchantID)
+		stats.mu.Lock()
+		stats.statusCode[resp.StatusCode]++
+		stats.mu.Unlock()
+	}
+}
+
+// merchantFromBody extracts merchant_id from an order payload so replays keep the per-merchant breakdown
+func merchantFromBody(body string) string {
+	var payload struct {
+		MerchantID string `json:"merchant_id"`
+	}
+	if json.Unmarshal([]byte(body), &payload) != nil || payload.MerchantID == "" {
+		return "unknown"
+	}
+	return payload.MerchantID
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// capturedRequest is what a stub target saw of one request
+type capturedRequest struct {
+	method, path, body, key, contentType string
+}
+
+// captureServer records every request it receives
+func captureServer(t *testing.T) (*httptest.Server, func() []capturedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, capturedRequest{r.Method, r.URL.RequestURI(), string(body), r.Header.Get("Idempotency-Key"), r.Header.Get("Content-Type")})
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedRequest(nil), seen...)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	// Synthetic traffic, sent 100ms apart
+	traffic := []capturedRequest{
+		{method: http.MethodPost, path: "/orders", body: `{"merchant_id":"vip","amount":10,"currency":"USD"}`, key: "key-1", contentType: "application/json"},
+		{method: http.MethodGet, path: "/orders/order-1?verbose=1"},
+		{method: http.MethodPost, path: "/orders", body: `{"merchant_id":"small","amount":2.5,"currency":"EUR"}`, key: "key-2", contentType: "application/json"},
+	}
+	const gap = 100 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		speed   float64
+		wantMin time.Duration // Bounds on how long the replay takes
+		wantMax time.Duration
+	}{
+		{name: "real time", speed: 1, wantMin: 180 * time.Millisecond, wantMax: 400 * time.Millisecond},
+		{name: "double speed", speed: 2, wantMin: 80 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "as fast as possible", speed: 0, wantMax: 80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, _ := captureServer(t)
+			target, _ := url.Parse(original.URL)
+			var recording bytes.Buffer
+			proxy := httptest.NewServer(NewRecorder(target, &recording))
+			defer proxy.Close()
+
+			for i, r := range traffic {
+				if i > 0 {
+					time.Sleep(gap)
+				}
+				req, _ := http.NewRequest(r.method, proxy.URL+r.path, strings.NewReader(r.body))
+				if r.key != "" {
+					req.Header.Set("Idempotency-Key", r.key)
+					req.Header.Set("Content-Type", r.contentType)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+
+			recs, err := readRecording(&recording)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != len(traffic) {
+				t.Fatalf("recorded %d requests, want %d", len(recs), len(traffic))
+			}
+			for i, rec := range recs {
+				if rec.Header.Get("Content-Length") != "" {
+					t.Errorf("request %d recorded hop-by-hop header Content-Length", i)
+				}
+			}
+
+			replayed, seen := captureServer(t)
+			replayTarget, _ := url.Parse(replayed.URL)
+			stats := &Stats{statusCode: make(map[int]int64), merchants: make(map[string]*MerchantStats)}
+			start := time.Now()
+			replay(replayed.Client(), replayTarget, recs, tt.speed, 1, stats)
+			elapsed := time.Since(start)
+
+			got := seen()
+			if len(got) != len(traffic) {
+				t.Fatalf("replay sent %d requests, want %d", len(got), len(traffic))
+			}
+			// One request at a time, so they arrive in recorded order
+			for i, want := range traffic {
+				if got[i] != want {
+					t.Errorf("replayed request %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+			if elapsed < tt.wantMin || elapsed > tt.wantMax {
+				t.Errorf("replay took %v, want between %v and %v", elapsed, tt.wantMin, tt.wantMax)
+			}
+			if stats.total != int64(len(traffic)) || stats.success != int64(len(traffic)) {
+				t.Errorf("stats total %d success %d, want %d each", stats.total, stats.success, len(traffic))
+			}
+		})
+	}
+}
+
+func TestReadRecording(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{name: "blank lines skipped", input: `{"method":"GET","path":"/a"}` + "\n\n" + `{"method":"GET","path":"/b"}` + "\n", want: 2},
+		{name: "malformed line", input: `{"method":"GET","path":"/a"}` + "\n" + `{"method":` + "\n", wantErr: "line 2"},
+		{name: "empty", input: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs, err := readRecording(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(recs) != tt.want {
+				t.Errorf("readRecording() = %d requests, %v; want %d", len(recs), err, tt.want)
+			}
+		})
+	}
+}
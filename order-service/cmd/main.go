@@ -3,23 +3,44 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/demo/order-service/internal/config"
 	"github.com/demo/order-service/internal/handler"
+	"github.com/demo/order-service/internal/reliability"
 	"github.com/demo/order-service/internal/service"
 	"github.com/demo/order-service/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func main() {
+	// Load configuration from environment
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Optionally keep recent reliability decisions in memory for GET /admin/reliability/log
+	var decisionLog *reliability.DecisionLog
+	var processors []sdktrace.SpanProcessor
+	if cfg.DecisionLogSize > 0 {
+		decisionLog = reliability.NewDecisionLog(cfg.DecisionLogSize)
+		processors = append(processors, decisionLog.SpanProcessor())
+	}
+
 	// Initialize OpenTelemetry tracing
-	collectorEndpoint := getEnv("OTEL_COLLECTOR_ENDPOINT", "otel-collector:4317")
-	shutdown, err := tracing.InitTracer("order-service", collectorEndpoint)
+	collectorEndpoint := cfg.CollectorEndpoint
+	shutdown, err := tracing.InitTracerOrNoop(cfg.TracingFailOpen, func() (func(context.Context) error, error) {
+		return tracing.InitTracer("order-service", collectorEndpoint, cfg.Tracing, processors...)
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
@@ -31,6 +52,15 @@ func main() {
 
 	log.Println("OpenTelemetry initialized, sending traces to", collectorEndpoint)
 
+	// Optionally prove the reliability wiring works before taking traffic, rather than finding out under load
+	if cfg.SelfTest {
+		retryPolicies := reliability.RetryPolicies{Default: cfg.Retry, Endpoints: cfg.RetryEndpoints}
+		if err := reliability.SelfTest(context.Background(), retryPolicies, cfg.CircuitBreaker, cfg.Bulkhead); err != nil {
+			log.Fatalf("Reliability self-test failed: %v", err)
+		}
+		log.Println("Reliability self-test passed")
+	}
+
 	// Create Gin router with OpenTelemetry middleware
 	router := gin.Default()
 
@@ -38,26 +68,86 @@ func main() {
 	// This creates server spans named "HTTP {method} {route}" for each request
 	router.Use(otelgin.Middleware("order-service"))
 
+	// Count in-flight requests so a shutdown that times out reports how many were cut off
+	inFlight := handler.NewInFlightTracker()
+	router.Use(inFlight.Middleware())
+
+	// Optionally log full bodies of a sample of requests, with sensitive fields redacted, for debugging client payloads
+	if cfg.BodyCaptureSampleRate > 0 {
+		capture := handler.NewBodyCapture(cfg.BodyCaptureSampleRate, cfg.BodyCaptureMaxBytes, cfg.BodyCaptureRedactFields,
+			slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+		router.Use(capture.Middleware())
+	}
+
 	// Initialize service and handlers
-	paymentURL := getEnv("PAYMENT_SERVICE_URL", "http://payment-service:8081")
-	orderService := service.NewOrderService(paymentURL)
-	orderHandler := handler.NewOrderHandler(orderService)
+	auditLog, err := service.OpenAuditLog(cfg.AuditLog)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	orderService := service.NewOrderService(cfg, auditLog)
+	if cfg.OrderSeedFile != "" {
+		seeded, err := orderService.SeedOrders(cfg.OrderSeedFile)
+		if err != nil {
+			log.Fatalf("Failed to seed orders: %v", err)
+		}
+		log.Printf("Seeded %d orders from %s", seeded, cfg.OrderSeedFile)
+	}
+	orderHandler, err := handler.NewOrderHandler(orderService, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize order handler: %v", err)
+	}
 
-	// Register routes
-	router.POST("/orders", orderHandler.CreateOrder)
+	// Register routes; orders stuck in a client's retry queue past MAX_REQUEST_AGE_MS are refused
+	orders := router.Group("/orders", handler.RejectStale(cfg.MaxRequestAge))
+	jsonOnly := handler.RequireJSON(cfg.StrictContentType)
+	orders.POST("", handler.RequireContentType(cfg.StrictContentType, gin.MIMEJSON, binding.MIMEMSGPACK, binding.MIMEMSGPACK2), orderHandler.CreateOrder)
+	orders.POST("/stream", orderHandler.StreamOrders) // NDJSON, not application/json
+	orders.POST("/batch", jsonOnly, orderHandler.BatchOrders)
+	orders.POST("/:id/confirm", jsonOnly, orderHandler.ConfirmOrder)
+	orders.POST("/:id/cancel", orderHandler.CancelOrder)
+	orders.GET("", orderHandler.ListOrders)
+	orders.GET("/:id", orderHandler.GetOrder)
 	router.GET("/health", orderHandler.Health)
+	router.GET("/version", handler.Version("order-service"))
+	router.GET("/ready", orderHandler.Ready)
+	router.GET("/slo", orderHandler.SLO)
+
+	// Admin endpoints expose internals and are opt-in
+	if cfg.AdminEnabled {
+		adminHandler := handler.NewAdminHandler(cfg, decisionLog, orderService)
+		admin := router.Group("/admin")
+		admin.GET("/config", adminHandler.Config)
+		admin.GET("/reliability/log", adminHandler.ReliabilityLog)
+		admin.GET("/idempotency", adminHandler.Idempotency)
+		admin.GET("/retry/budget", adminHandler.RetryBudget)
+		admin.DELETE("/orders/:id/idempotency", handler.RequireAdminToken(cfg.AdminToken), adminHandler.ExpireIdempotency)
+	}
 
 	// Start HTTP server with graceful shutdown
-	port := getEnv("PORT", "8080")
+	port := cfg.Port
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: router,
+
+		// Bound slow or idle clients so they can't tie up connections indefinitely
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 
+	// Cap simultaneously open connections so a flood can't exhaust file descriptors
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on port %s: %v", port, err)
+	}
+	connLimit := handler.NewConnLimiter(cfg.Server.MaxConnections, cfg.Server.ConnectionWait)
+	listener = connLimit.Wrap(listener)
+
 	// Start server in goroutine
 	go func() {
 		log.Printf("Starting order-service on port %s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -67,22 +157,16 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	log.Printf("Shutting down server (%d requests in flight, %d connections rejected over MAX_CONNECTIONS, timeout %s)...",
+		inFlight.Count(), connLimit.Rejected(), cfg.ShutdownTimeout)
 
-	// Graceful shutdown with 5 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Graceful shutdown, waiting up to SHUTDOWN_TIMEOUT_SECONDS for in-flight requests to drain
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown with %d requests still in flight: %v", inFlight.Count(), err)
 	}
 
 	log.Println("Server exited")
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
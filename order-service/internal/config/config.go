@@ -0,0 +1,698 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/demo/order-service/internal/features"
+	"github.com/demo/order-service/internal/reliability"
+)
+
+// Config holds the effective runtime configuration for the order service
+type Config struct {
+	Port              string `json:"port"`
+	CollectorEndpoint string `json:"otel_collector_endpoint"`
+	TracingFailOpen   bool   `json:"tracing_fail_open"` // Start with a no-op tracer if tracing init fails
+	AdminEnabled      bool   `json:"admin_enabled"`
+	DecisionLogSize   int    `json:"decision_log_size"` // Reliability decisions kept for GET /admin/reliability/log; 0 disables
+	SelfTest          bool   `json:"selftest"`          // Exercise retry, breaker and bulkhead with a stub call at startup
+
+	// Presented as X-Admin-Token to mark ops requests, admitted from the bulkhead's admin pool; empty disables admin marking
+	AdminToken string `json:"admin_token" redact:"true"`
+
+	// Echo X-Retry-Count, X-CB-State and X-Bulkhead-Queued on order responses, for client-side debugging
+	DebugHeaders bool `json:"debug_headers"`
+
+	// Return at once from requests whose context is already cancelled on arrival, e.g. the client hung up while queued
+	SkipCancelled bool `json:"skip_cancelled"`
+
+	// How long shutdown waits for in-flight requests to drain before forcing connections closed
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
+	Server          ServerConfig  `json:"server"`
+
+	StrictSchemaValidation bool   `json:"strict_schema_validation"`
+	StrictContentType      bool   `json:"strict_content_type"` // Reject JSON endpoints' requests not sent as application/json
+	OrderSchemaFile        string `json:"order_schema_file"`   // Empty uses the embedded schema
+	StreamConcurrency      int    `json:"stream_concurrency"`  // Parallel orders per POST /orders/stream request
+
+	BatchMaxConcurrency int `json:"batch_max_concurrency"` // Parallel orders per POST /orders/batch request, whatever the batch size
+
+	Payment        PaymentConfig                      `json:"payment"`
+	Retry          reliability.RetryConfig            `json:"retry"`
+	RetryEndpoints map[string]reliability.RetryConfig `json:"retry_endpoints"` // Per-endpoint overrides of Retry
+	RetryPolicies  map[string]reliability.RetryConfig `json:"retry_policies"`  // Named overrides of Retry, assigned to merchants
+	AdaptiveRetry  reliability.AdaptiveRetryConfig    `json:"adaptive_retry"`  // Turns retries off while the payment success rate is very low
+	RetryBudget    reliability.RetryBudgetConfig      `json:"retry_budget"`    // Caps retries at a fraction of payment calls
+	OrderRetry     reliability.OperationRetryConfig   `json:"order_retry"`     // Retries of the whole order after a transient failure
+	CircuitBreaker reliability.CircuitBreakerConfig   `json:"circuit_breaker"`
+	Bulkhead       reliability.BulkheadConfig         `json:"bulkhead"`
+	Hedging        reliability.HedgingConfig          `json:"hedging"`
+
+	PriorityMerchants []string `json:"priority_merchants"` // Merchants admitted as high priority
+
+	// Merchant ID → name of the RetryPolicies entry used for its charges, e.g. more attempts for a flaky downstream
+	RetryPolicyByMerchant map[string]string `json:"retry_policy_by_merchant"`
+
+	// Currencies the settlement backend accepts; empty accepts any. Merchants flagged currency_fallback have
+	// others converted to FallbackCurrency at ExchangeRates instead of being rejected
+	SupportedCurrencies []string           `json:"supported_currencies"`
+	FallbackCurrency    string             `json:"fallback_currency"`
+	ExchangeRates       map[string]float64 `json:"exchange_rates"` // Units of FallbackCurrency per unit of each currency
+
+	// What happens to amounts with more than AmountDecimals decimal places: allow, reject, round_half_even or truncate
+	// Both services must agree so an amount isn't rounded one way here and rejected or rounded another way downstream
+	AmountPrecisionMode string `json:"amount_precision_mode"`
+	AmountDecimals      int    `json:"amount_decimals"`
+
+	IdempotencyHeaders []string      `json:"idempotency_headers"`  // Headers checked in order for the client's idempotency key
+	IdempotencyMaxTTL  time.Duration `json:"idempotency_max_ttl"`  // Cap on per-request Idempotency-TTL overrides
+	IdempotencyMaxKeys int           `json:"idempotency_max_keys"` // Stored idempotency keys per merchant before its oldest are evicted; 0 disables
+	MaxRequestAge      time.Duration `json:"max_request_age"`      // Reject requests whose X-Request-Timestamp is older; 0 disables
+
+	// Bytes per stored key assumed by the idempotency store's size estimate; 0 uses the built-in estimate
+	IdempotencyEntryBytes int `json:"idempotency_entry_bytes"`
+	// Replays of a single key tolerated before alerting on a likely client retry storm; 0 disables
+	IdempotencyReplayAlertThreshold int `json:"idempotency_replay_alert_threshold"`
+
+	AuditLog string `json:"audit_log"` // Where security audit events go: "stdout", "stderr" or a file path; empty discards them
+
+	// Debug logging of full request and response bodies for a sampled fraction of requests
+	BodyCaptureSampleRate   float64  `json:"body_capture_sample_rate"`   // Fraction of requests captured (0-1); 0 disables
+	BodyCaptureMaxBytes     int      `json:"body_capture_max_bytes"`     // Each body is truncated to this many bytes
+	BodyCaptureRedactFields []string `json:"body_capture_redact_fields"` // JSON fields masked before logging, at any depth
+
+	StepUpThreshold    float64       `json:"stepup_threshold"`     // Orders above this amount need step-up confirmation; 0 disables
+	StepUpChallengeTTL time.Duration `json:"stepup_challenge_ttl"` // How long a step-up challenge token stays valid
+
+	CancelledOrderRetention time.Duration `json:"cancelled_order_retention"` // How long cancelled orders are kept as tombstones for audit
+
+	// JSON array of orders loaded into the order store at startup, for demos; empty seeds nothing
+	OrderSeedFile string `json:"order_seed_file"`
+
+	Readiness   ReadinessConfig   `json:"readiness"`
+	Persistence PersistenceConfig `json:"persistence"`
+	Webhook     WebhookConfig     `json:"webhook"`
+	Tracing     TracingConfig     `json:"tracing"`
+
+	SLOTarget    float64                    `json:"slo_target"`
+	MetricsSink  string                     `json:"metrics_sink"` // Where reliability events go: "none" or "otel"
+	FeatureFlags map[string][]features.Flag `json:"feature_flags"`
+}
+
+// PaymentConfig holds settings for calls to the payment service
+type PaymentConfig struct {
+	URLs          []string          `json:"urls" redact:"url"`            // Primary first, then fallbacks
+	URLByCurrency map[string]string `json:"url_by_currency" redact:"url"` // Currency-specific backends; others use URLs
+	ClientTimeout time.Duration     `json:"client_timeout"`               // Overall HTTP client timeout
+	CallTimeout   time.Duration     `json:"call_timeout"`                 // Budget for the whole payment call including retries
+
+	MaxErrorBodyBytes int64 `json:"max_error_body_bytes"` // Cap on error response bytes read into memory
+
+	// A downstream can answer headers promptly and then stall mid-body, so each phase has its own bound within the call budget
+	ResponseHeaderTimeout time.Duration `json:"response_header_timeout"` // Wait for response headers after the request is written; 0 for no limit
+	BodyReadTimeout       time.Duration `json:"body_read_timeout"`       // Longest gap between body chunks before the read aborts; 0 for no limit
+
+	// HTTP/2 multiplexes requests over one connection, so in-flight calls are bounded by connections × the server's stream limit
+	MaxConnsPerHost   int  `json:"max_conns_per_host"`  // Connections per payment host; 0 for no limit
+	StrictStreamLimit bool `json:"strict_stream_limit"` // Queue at the server's HTTP/2 stream limit instead of dialing more connections
+
+	TLS TLSConfig `json:"tls"` // Applied to https payment URLs
+}
+
+// ReadinessConfig controls how often readiness probes re-check the payment service
+type ReadinessConfig struct {
+	CacheTTL       time.Duration `json:"cache_ttl"`
+	JitterFraction float64       `json:"jitter_fraction"` // Randomizes refresh by ±fraction of the TTL
+}
+
+// WebhookConfig controls order completion webhooks sent to an order's callback_url
+type WebhookConfig struct {
+	Secret      string        `json:"secret" redact:"true"` // HMAC-SHA256 signing key; empty disables callbacks
+	Timeout     time.Duration `json:"timeout"`              // Per delivery attempt
+	MaxAttempts int           `json:"max_attempts"`         // Initial delivery plus retries
+	Backoff     time.Duration `json:"backoff"`              // Wait before the first retry, doubling each time
+}
+
+// TracingConfig sizes the span export queue and decides what happens when it fills under heavy span volume
+type TracingConfig struct {
+	QueueSize   int     `json:"queue_size"`   // Finished spans buffered for export
+	Overflow    string  `json:"overflow"`     // When the queue is full: "drop" the span (counted) or "block" the request until there's room
+	SampleRatio float64 `json:"sample_ratio"` // Share of new traces recorded (0-1); continued traces follow the caller's decision
+}
+
+// PersistenceConfig holds settings for persisting charged orders
+type PersistenceConfig struct {
+	ErrorPercentage    float64       `json:"error_pct"`            // Simulated persistence failures (0-100) for fault injection
+	WriteBehind        bool          `json:"write_behind"`         // Queue charged orders whose persistence failed instead of failing them
+	WriteBehindQueue   int           `json:"write_behind_queue"`   // Orders queued at most; further failures are shed
+	WriteBehindBackoff time.Duration `json:"write_behind_backoff"` // Wait between flush attempts while persistence is down
+}
+
+// ServerConfig bounds how long a client may hold an HTTP connection, so slow or idle clients can't exhaust it
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout"` // Closes connections that never finish their headers (slowloris)
+	ReadTimeout       time.Duration `json:"read_timeout"`        // Whole request including body
+	WriteTimeout      time.Duration `json:"write_timeout"`       // From end of request headers to end of response
+	IdleTimeout       time.Duration `json:"idle_timeout"`        // Keep-alive connections waiting for the next request
+
+	// Caps simultaneously open TCP connections; excess connections wait ConnectionWait for a slot, then are closed
+	MaxConnections int           `json:"max_connections"` // 0 disables
+	ConnectionWait time.Duration `json:"connection_wait"`
+}
+
+// Default returns the configuration used when no environment overrides are set
+func Default() *Config {
+	return &Config{
+		Port:              "8080",
+		ShutdownTimeout:   5 * time.Second,
+		CollectorEndpoint: "otel-collector:4317",
+		StreamConcurrency: 4,
+
+		BatchMaxConcurrency: 4,
+		Server: ServerConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+
+			ConnectionWait: 1 * time.Second,
+		},
+		Payment: PaymentConfig{
+			URLs:          []string{"http://payment-service:8081"},
+			ClientTimeout: 2 * time.Second,
+			CallTimeout:   500 * time.Millisecond,
+
+			MaxErrorBodyBytes: 64 << 10, // 64KB
+
+			BodyReadTimeout: 200 * time.Millisecond,
+
+			StrictStreamLimit: true,
+
+			TLS: TLSConfig{MinVersion: "1.2"},
+		},
+		Retry:              reliability.DefaultRetryConfig(),
+		AdaptiveRetry:      reliability.DefaultAdaptiveRetryConfig(),
+		RetryBudget:        reliability.DefaultRetryBudgetConfig(),
+		OrderRetry:         reliability.DefaultOperationRetryConfig(),
+		CircuitBreaker:     reliability.DefaultCircuitBreakerConfig(),
+		Bulkhead:           reliability.DefaultBulkheadConfig(),
+		Hedging:            reliability.DefaultHedgingConfig(),
+		IdempotencyHeaders: []string{"Idempotency-Key"},
+		IdempotencyMaxTTL:  7 * 24 * time.Hour,
+		IdempotencyMaxKeys: 10000,
+
+		IdempotencyReplayAlertThreshold: 20,
+
+		StepUpChallengeTTL: 10 * time.Minute,
+		Readiness: ReadinessConfig{
+			CacheTTL:       5 * time.Second,
+			JitterFraction: 0.1,
+		},
+		Persistence: PersistenceConfig{
+			WriteBehindQueue:   1000,
+			WriteBehindBackoff: 1 * time.Second,
+		},
+		Webhook: WebhookConfig{
+			Timeout:     5 * time.Second,
+			MaxAttempts: 5,
+			Backoff:     1 * time.Second,
+		},
+		Tracing: TracingConfig{
+			QueueSize:   2048, // The SDK's default
+			Overflow:    "drop",
+			SampleRatio: 1,
+		},
+		CancelledOrderRetention: 30 * 24 * time.Hour,
+
+		SkipCancelled: true,
+
+		BodyCaptureMaxBytes:     4096,
+		BodyCaptureRedactFields: []string{"challenge_token", "callback_url", "card_number", "cvv", "password", "secret", "token"},
+
+		SLOTarget:    0.999,
+		MetricsSink:  "none",
+		FeatureFlags: make(map[string][]features.Flag),
+
+		AmountPrecisionMode: "allow",
+		AmountDecimals:      2,
+	}
+}
+
+// Load reads configuration from environment variables over the defaults and validates it
+// Malformed values are reported as errors rather than silently falling back to zero
+func Load() (*Config, error) {
+	cfg := Default()
+	env := &envLoader{}
+
+	cfg.Port = env.string("PORT", cfg.Port)
+	cfg.CollectorEndpoint = env.string("OTEL_COLLECTOR_ENDPOINT", cfg.CollectorEndpoint)
+	cfg.TracingFailOpen = env.bool("TRACING_FAIL_OPEN", cfg.TracingFailOpen)
+	cfg.Tracing.QueueSize = env.int("TRACE_QUEUE_SIZE", cfg.Tracing.QueueSize)
+	cfg.Tracing.Overflow = env.string("TRACE_QUEUE_OVERFLOW", cfg.Tracing.Overflow)
+	cfg.Tracing.SampleRatio = env.float("TRACE_SAMPLE_RATIO", cfg.Tracing.SampleRatio)
+	cfg.AdminEnabled = env.bool("ADMIN_ENDPOINTS_ENABLED", cfg.AdminEnabled)
+	cfg.DecisionLogSize = env.int("RELIABILITY_LOG_SIZE", cfg.DecisionLogSize)
+	cfg.SelfTest = env.bool("RELIABILITY_SELFTEST", cfg.SelfTest)
+	cfg.DebugHeaders = env.bool("DEBUG_HEADERS_ENABLED", cfg.DebugHeaders)
+	cfg.ShutdownTimeout = env.seconds("SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout)
+	cfg.Server.ReadHeaderTimeout = env.millis("SERVER_READ_HEADER_TIMEOUT_MS", cfg.Server.ReadHeaderTimeout)
+	cfg.Server.ReadTimeout = env.millis("SERVER_READ_TIMEOUT_MS", cfg.Server.ReadTimeout)
+	cfg.Server.WriteTimeout = env.millis("SERVER_WRITE_TIMEOUT_MS", cfg.Server.WriteTimeout)
+	cfg.Server.IdleTimeout = env.millis("SERVER_IDLE_TIMEOUT_MS", cfg.Server.IdleTimeout)
+	cfg.Server.MaxConnections = env.int("MAX_CONNECTIONS", cfg.Server.MaxConnections)
+	cfg.Server.ConnectionWait = env.millis("MAX_CONNECTIONS_WAIT_MS", cfg.Server.ConnectionWait)
+
+	cfg.StrictSchemaValidation = env.bool("STRICT_SCHEMA_VALIDATION", cfg.StrictSchemaValidation)
+	cfg.StrictContentType = env.bool("STRICT_CONTENT_TYPE", cfg.StrictContentType)
+	cfg.OrderSchemaFile = env.string("ORDER_SCHEMA_FILE", cfg.OrderSchemaFile)
+	cfg.StreamConcurrency = env.int("ORDER_STREAM_CONCURRENCY", cfg.StreamConcurrency)
+	cfg.BatchMaxConcurrency = env.int("BATCH_MAX_CONCURRENCY", cfg.BatchMaxConcurrency)
+	cfg.SkipCancelled = env.bool("SKIP_CANCELLED_REQUESTS", cfg.SkipCancelled)
+
+	// PAYMENT_SERVICE_URLS lists zone-redundant instances; PAYMENT_SERVICE_URL remains for single-instance setups
+	cfg.Payment.URLs = env.list("PAYMENT_SERVICE_URLS", []string{env.string("PAYMENT_SERVICE_URL", cfg.Payment.URLs[0])})
+	// Currency-specific payment backends as JSON: {"EUR": "http://payment-eu:8081"}
+	if spec := os.Getenv("PAYMENT_URL_BY_CURRENCY"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &cfg.Payment.URLByCurrency); err != nil {
+			env.errs = append(env.errs, fmt.Errorf("PAYMENT_URL_BY_CURRENCY: %w", err))
+		}
+	}
+	cfg.Payment.ClientTimeout = env.millis("PAYMENT_CLIENT_TIMEOUT_MS", cfg.Payment.ClientTimeout)
+	cfg.Payment.CallTimeout = env.millis("PAYMENT_TIMEOUT_MS", cfg.Payment.CallTimeout)
+	cfg.Payment.MaxErrorBodyBytes = int64(env.int("PAYMENT_MAX_ERROR_BODY_BYTES", int(cfg.Payment.MaxErrorBodyBytes)))
+	cfg.Payment.ResponseHeaderTimeout = env.millis("PAYMENT_RESPONSE_HEADER_TIMEOUT_MS", cfg.Payment.ResponseHeaderTimeout)
+	cfg.Payment.BodyReadTimeout = env.millis("PAYMENT_BODY_READ_TIMEOUT_MS", cfg.Payment.BodyReadTimeout)
+	cfg.Payment.MaxConnsPerHost = env.int("PAYMENT_MAX_CONNS_PER_HOST", cfg.Payment.MaxConnsPerHost)
+	cfg.Payment.StrictStreamLimit = env.bool("PAYMENT_STRICT_STREAM_LIMIT", cfg.Payment.StrictStreamLimit)
+	cfg.Payment.TLS.MinVersion = env.string("TLS_MIN_VERSION", cfg.Payment.TLS.MinVersion)
+	cfg.Payment.TLS.CipherSuites = env.list("TLS_CIPHER_SUITES", cfg.Payment.TLS.CipherSuites)
+
+	// The attempt count and backoff shape are read by the reliability package, so tools reusing it tune retries alike;
+	// unlike other variables, a malformed one keeps its default with a warning rather than failing startup
+	if retry, err := reliability.LoadRetryConfigFromEnv(); err != nil {
+		env.errs = append(env.errs, err)
+	} else {
+		cfg.Retry.MaxAttempts = retry.MaxAttempts
+		cfg.Retry.InitialBackoff = retry.InitialBackoff
+		cfg.Retry.MaxBackoff = retry.MaxBackoff
+		cfg.Retry.BackoffMultiple = retry.BackoffMultiple
+		cfg.Retry.JitterFraction = retry.JitterFraction
+	}
+	cfg.Retry.MaxRetryAfter = env.millis("MAX_RETRY_AFTER_MS", cfg.Retry.MaxRetryAfter)
+	cfg.Retry.SafeMethods = env.list("RETRY_SAFE_METHODS", cfg.Retry.SafeMethods)
+	cfg.Retry.MaxPlausibleRetryAfter = env.millis("RETRY_AFTER_MAX_PLAUSIBLE_MS", cfg.Retry.MaxPlausibleRetryAfter)
+	cfg.Retry.MaxElapsedTime = env.millis("RETRY_MAX_ELAPSED_MS", cfg.Retry.MaxElapsedTime)
+	// Per-endpoint retry policies as JSON over the default policy: {"charge": {"max_attempts": 2}}
+	if spec := os.Getenv("RETRY_POLICY_BY_ENDPOINT"); spec != "" {
+		endpoints, err := parseRetryOverrides(spec, cfg.Retry)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("RETRY_POLICY_BY_ENDPOINT: %w", err))
+		}
+		cfg.RetryEndpoints = endpoints
+	}
+	// Named retry policies over the default policy, assigned to merchants by RETRY_POLICY_BY_MERCHANT:
+	// {"aggressive": {"max_attempts": 5}, "fail_fast": {"max_attempts": 1}}
+	if spec := os.Getenv("RETRY_POLICIES"); spec != "" {
+		policies, err := parseRetryOverrides(spec, cfg.Retry)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("RETRY_POLICIES: %w", err))
+		}
+		cfg.RetryPolicies = policies
+	}
+	// Merchant ID to named retry policy: {"merchant_flaky": "aggressive"}
+	if spec := os.Getenv("RETRY_POLICY_BY_MERCHANT"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &cfg.RetryPolicyByMerchant); err != nil {
+			env.errs = append(env.errs, fmt.Errorf("RETRY_POLICY_BY_MERCHANT: %w", err))
+		}
+	}
+	cfg.AdaptiveRetry.Enabled = env.bool("ADAPTIVE_RETRY_ENABLED", cfg.AdaptiveRetry.Enabled)
+	cfg.AdaptiveRetry.Window = env.millis("ADAPTIVE_RETRY_WINDOW_MS", cfg.AdaptiveRetry.Window)
+	cfg.AdaptiveRetry.MinRequests = int64(env.int("ADAPTIVE_RETRY_MIN_REQUESTS", int(cfg.AdaptiveRetry.MinRequests)))
+	cfg.AdaptiveRetry.DisableBelow = env.float("ADAPTIVE_RETRY_DISABLE_BELOW", cfg.AdaptiveRetry.DisableBelow)
+	cfg.AdaptiveRetry.EnableAbove = env.float("ADAPTIVE_RETRY_ENABLE_ABOVE", cfg.AdaptiveRetry.EnableAbove)
+	cfg.RetryBudget.Enabled = env.bool("RETRY_BUDGET_ENABLED", cfg.RetryBudget.Enabled)
+	cfg.RetryBudget.Ratio = env.float("RETRY_BUDGET_RATIO", cfg.RetryBudget.Ratio)
+	cfg.RetryBudget.MinPerSecond = env.float("RETRY_BUDGET_MIN_PER_SECOND", cfg.RetryBudget.MinPerSecond)
+	cfg.RetryBudget.MaxTokens = env.float("RETRY_BUDGET_MAX_TOKENS", cfg.RetryBudget.MaxTokens)
+	cfg.OrderRetry.MaxAttempts = env.int("ORDER_MAX_ATTEMPTS", cfg.OrderRetry.MaxAttempts)
+	cfg.OrderRetry.Backoff = env.millis("ORDER_RETRY_BACKOFF_MS", cfg.OrderRetry.Backoff)
+
+	cfg.Bulkhead.MaxConcurrent = int64(env.int("BULKHEAD_MAX_CONCURRENT", int(cfg.Bulkhead.MaxConcurrent)))
+	cfg.Bulkhead.ReservedFraction = env.float("BULKHEAD_RESERVED_FRACTION", cfg.Bulkhead.ReservedFraction)
+	cfg.Bulkhead.MinRetryAfter = env.millis("BULKHEAD_MIN_RETRY_AFTER_MS", cfg.Bulkhead.MinRetryAfter)
+	cfg.Bulkhead.OverflowSlots = int64(env.int("BULKHEAD_OVERFLOW_SLOTS", int(cfg.Bulkhead.OverflowSlots)))
+	cfg.Bulkhead.AdminSlots = int64(env.int("BULKHEAD_ADMIN_SLOTS", int(cfg.Bulkhead.AdminSlots)))
+	cfg.Bulkhead.PriorityAging = env.millis("BULKHEAD_PRIORITY_AGING_MS", cfg.Bulkhead.PriorityAging)
+	cfg.AdminToken = env.string("ADMIN_TOKEN", cfg.AdminToken)
+	cfg.PriorityMerchants = env.list("PRIORITY_MERCHANTS", cfg.PriorityMerchants)
+
+	cfg.IdempotencyHeaders = env.list("IDEMPOTENCY_HEADER_NAMES", cfg.IdempotencyHeaders)
+	cfg.IdempotencyMaxTTL = env.millis("IDEMPOTENCY_MAX_TTL_MS", cfg.IdempotencyMaxTTL)
+	cfg.IdempotencyMaxKeys = env.int("IDEMPOTENCY_MAX_KEYS_PER_MERCHANT", cfg.IdempotencyMaxKeys)
+	cfg.IdempotencyEntryBytes = env.int("IDEMPOTENCY_ENTRY_BYTES", cfg.IdempotencyEntryBytes)
+	cfg.IdempotencyReplayAlertThreshold = env.int("IDEMPOTENCY_REPLAY_ALERT_THRESHOLD", cfg.IdempotencyReplayAlertThreshold)
+	cfg.AuditLog = env.string("AUDIT_LOG", cfg.AuditLog)
+	cfg.BodyCaptureSampleRate = env.float("BODY_CAPTURE_SAMPLE_RATE", cfg.BodyCaptureSampleRate)
+	cfg.BodyCaptureMaxBytes = env.int("BODY_CAPTURE_MAX_BYTES", cfg.BodyCaptureMaxBytes)
+	cfg.BodyCaptureRedactFields = env.list("BODY_CAPTURE_REDACT_FIELDS", cfg.BodyCaptureRedactFields)
+	cfg.MaxRequestAge = env.millis("MAX_REQUEST_AGE_MS", cfg.MaxRequestAge)
+
+	cfg.StepUpThreshold = env.float("STEPUP_THRESHOLD", cfg.StepUpThreshold)
+	cfg.StepUpChallengeTTL = env.millis("STEPUP_CHALLENGE_TTL_MS", cfg.StepUpChallengeTTL)
+
+	cfg.CancelledOrderRetention = env.millis("CANCELLED_ORDER_RETENTION_MS", cfg.CancelledOrderRetention)
+	cfg.OrderSeedFile = env.string("ORDER_SEED_FILE", cfg.OrderSeedFile)
+
+	cfg.Hedging.Enabled = env.bool("HEDGING_ENABLED", cfg.Hedging.Enabled)
+	cfg.Hedging.Delay = env.millis("HEDGE_DELAY_MS", cfg.Hedging.Delay)
+
+	cfg.CircuitBreaker.MaxRequests = env.uint32("CB_MAX_REQUESTS", cfg.CircuitBreaker.MaxRequests)
+	cfg.CircuitBreaker.Interval = env.millis("CB_INTERVAL_MS", cfg.CircuitBreaker.Interval)
+	cfg.CircuitBreaker.Timeout = env.millis("CB_TIMEOUT_MS", cfg.CircuitBreaker.Timeout)
+	cfg.CircuitBreaker.ConsecutiveFailures = env.uint32("CB_CONSECUTIVE_FAILURES", cfg.CircuitBreaker.ConsecutiveFailures)
+	cfg.CircuitBreaker.FailureRatio = env.float("CB_FAILURE_RATIO", cfg.CircuitBreaker.FailureRatio)
+	cfg.CircuitBreaker.MinRequests = env.uint32("CB_MIN_REQUESTS", cfg.CircuitBreaker.MinRequests)
+	cfg.CircuitBreaker.WebhookURL = env.string("CB_WEBHOOK_URL", cfg.CircuitBreaker.WebhookURL)
+	cfg.CircuitBreaker.WebhookMinInterval = env.millis("CB_WEBHOOK_MIN_INTERVAL_MS", cfg.CircuitBreaker.WebhookMinInterval)
+	cfg.CircuitBreaker.TimeoutJitter = env.float("CB_TIMEOUT_JITTER", cfg.CircuitBreaker.TimeoutJitter)
+	cfg.CircuitBreaker.ConsecutiveTimeouts = env.uint32("CB_CONSECUTIVE_TIMEOUTS", cfg.CircuitBreaker.ConsecutiveTimeouts)
+	cfg.CircuitBreaker.ConsecutiveErrors = env.uint32("CB_CONSECUTIVE_ERRORS", cfg.CircuitBreaker.ConsecutiveErrors)
+
+	cfg.Readiness.CacheTTL = env.millis("READINESS_CACHE_TTL_MS", cfg.Readiness.CacheTTL)
+	cfg.Readiness.JitterFraction = env.float("READINESS_JITTER_FRACTION", cfg.Readiness.JitterFraction)
+
+	cfg.Persistence.ErrorPercentage = env.float("PERSIST_ERROR_PCT", cfg.Persistence.ErrorPercentage)
+	cfg.Persistence.WriteBehind = env.bool("WRITE_BEHIND_ENABLED", cfg.Persistence.WriteBehind)
+	cfg.Persistence.WriteBehindQueue = env.int("WRITE_BEHIND_QUEUE_SIZE", cfg.Persistence.WriteBehindQueue)
+	cfg.Persistence.WriteBehindBackoff = env.millis("WRITE_BEHIND_BACKOFF_MS", cfg.Persistence.WriteBehindBackoff)
+	cfg.Webhook.Secret = env.string("WEBHOOK_SECRET", cfg.Webhook.Secret)
+	cfg.Webhook.Timeout = env.millis("WEBHOOK_TIMEOUT_MS", cfg.Webhook.Timeout)
+	cfg.Webhook.MaxAttempts = env.int("WEBHOOK_MAX_ATTEMPTS", cfg.Webhook.MaxAttempts)
+	cfg.Webhook.Backoff = env.millis("WEBHOOK_BACKOFF_MS", cfg.Webhook.Backoff)
+
+	// Availability target for error-budget burn rate, e.g. 0.999 allows 0.1% errors
+	cfg.SLOTarget = env.float("SLO_TARGET", cfg.SLOTarget)
+	cfg.MetricsSink = env.string("METRICS_SINK", cfg.MetricsSink)
+
+	cfg.SupportedCurrencies = env.list("SUPPORTED_CURRENCIES", cfg.SupportedCurrencies)
+	cfg.FallbackCurrency = env.string("FALLBACK_CURRENCY", cfg.FallbackCurrency)
+	// Rates into the fallback currency as JSON: {"GBP": 1.27, "JPY": 0.0067}
+	if spec := os.Getenv("EXCHANGE_RATES"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &cfg.ExchangeRates); err != nil {
+			env.errs = append(env.errs, fmt.Errorf("EXCHANGE_RATES: %w", err))
+		}
+	}
+	cfg.AmountPrecisionMode = env.string("AMOUNT_PRECISION_MODE", cfg.AmountPrecisionMode)
+	cfg.AmountDecimals = env.int("AMOUNT_DECIMALS", cfg.AmountDecimals)
+
+	// Per-merchant feature flags as JSON: {"merchant_123": ["disable_retries"]}
+	if spec := os.Getenv("MERCHANT_FEATURE_FLAGS"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &cfg.FeatureFlags); err != nil {
+			env.errs = append(env.errs, fmt.Errorf("MERCHANT_FEATURE_FLAGS: %w", err))
+		}
+	}
+
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that all values are within usable ranges
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT_SECONDS must be positive"))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 || c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_READ_HEADER_TIMEOUT_MS, SERVER_READ_TIMEOUT_MS, SERVER_WRITE_TIMEOUT_MS and SERVER_IDLE_TIMEOUT_MS must be positive"))
+	}
+	if c.Server.MaxConnections < 0 || c.Server.ConnectionWait < 0 {
+		errs = append(errs, errors.New("MAX_CONNECTIONS and MAX_CONNECTIONS_WAIT_MS must not be negative"))
+	}
+	if len(c.Payment.URLs) == 0 {
+		errs = append(errs, errors.New("at least one payment service URL is required"))
+	}
+	for _, raw := range c.Payment.URLs {
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("payment service URL %q: expected an absolute URL", raw))
+		}
+	}
+	if c.StreamConcurrency < 1 {
+		errs = append(errs, errors.New("ORDER_STREAM_CONCURRENCY must be at least 1"))
+	}
+	if c.BatchMaxConcurrency < 1 {
+		errs = append(errs, errors.New("BATCH_MAX_CONCURRENCY must be at least 1"))
+	}
+	for currency, raw := range c.Payment.URLByCurrency {
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("PAYMENT_URL_BY_CURRENCY[%s]: expected an absolute URL", currency))
+		}
+	}
+	if c.FallbackCurrency != "" && !slices.Contains(c.SupportedCurrencies, c.FallbackCurrency) {
+		errs = append(errs, errors.New("FALLBACK_CURRENCY must be one of SUPPORTED_CURRENCIES"))
+	}
+	switch c.AmountPrecisionMode {
+	case "allow", "reject", "round_half_even", "truncate":
+	default:
+		errs = append(errs, fmt.Errorf("AMOUNT_PRECISION_MODE must be allow, reject, round_half_even or truncate, got %q", c.AmountPrecisionMode))
+	}
+	if c.AmountDecimals < 0 || c.AmountDecimals > 8 {
+		errs = append(errs, errors.New("AMOUNT_DECIMALS must be between 0 and 8"))
+	}
+	for currency, rate := range c.ExchangeRates {
+		if rate <= 0 {
+			errs = append(errs, fmt.Errorf("EXCHANGE_RATES[%s]: rate must be positive", currency))
+		}
+	}
+	if c.Payment.ClientTimeout <= 0 {
+		errs = append(errs, errors.New("PAYMENT_CLIENT_TIMEOUT_MS must be positive"))
+	}
+	if c.Payment.CallTimeout <= 0 {
+		errs = append(errs, errors.New("PAYMENT_TIMEOUT_MS must be positive"))
+	}
+	if c.Payment.MaxErrorBodyBytes < 0 {
+		errs = append(errs, errors.New("PAYMENT_MAX_ERROR_BODY_BYTES must not be negative"))
+	}
+	if c.Payment.ResponseHeaderTimeout < 0 {
+		errs = append(errs, errors.New("PAYMENT_RESPONSE_HEADER_TIMEOUT_MS must not be negative"))
+	}
+	if c.Payment.BodyReadTimeout < 0 {
+		errs = append(errs, errors.New("PAYMENT_BODY_READ_TIMEOUT_MS must not be negative"))
+	}
+	if c.Payment.MaxConnsPerHost < 0 {
+		errs = append(errs, errors.New("PAYMENT_MAX_CONNS_PER_HOST must not be negative"))
+	}
+	if _, err := c.Payment.TLS.Config(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.AdaptiveRetry.Enabled {
+		if c.AdaptiveRetry.Window < time.Second {
+			errs = append(errs, errors.New("ADAPTIVE_RETRY_WINDOW_MS must be at least 1000"))
+		}
+		if c.AdaptiveRetry.MinRequests < 1 {
+			errs = append(errs, errors.New("ADAPTIVE_RETRY_MIN_REQUESTS must be positive"))
+		}
+		if !(c.AdaptiveRetry.DisableBelow > 0 && c.AdaptiveRetry.DisableBelow < c.AdaptiveRetry.EnableAbove && c.AdaptiveRetry.EnableAbove <= 1) {
+			errs = append(errs, errors.New("ADAPTIVE_RETRY_DISABLE_BELOW and ADAPTIVE_RETRY_ENABLE_ABOVE must satisfy 0 < disable below < enable above <= 1"))
+		}
+	}
+	if c.RetryBudget.Enabled {
+		if c.RetryBudget.Ratio < 0 || c.RetryBudget.Ratio > 1 {
+			errs = append(errs, errors.New("RETRY_BUDGET_RATIO must be in [0, 1]"))
+		}
+		if c.RetryBudget.MinPerSecond < 0 {
+			errs = append(errs, errors.New("RETRY_BUDGET_MIN_PER_SECOND must not be negative"))
+		}
+		if c.RetryBudget.MaxTokens < 1 {
+			errs = append(errs, errors.New("RETRY_BUDGET_MAX_TOKENS must be at least 1"))
+		}
+	}
+	if c.OrderRetry.MaxAttempts < 1 || c.OrderRetry.MaxAttempts > 5 {
+		errs = append(errs, errors.New("ORDER_MAX_ATTEMPTS must be between 1 and 5"))
+	}
+	if c.OrderRetry.Backoff < 0 {
+		errs = append(errs, errors.New("ORDER_RETRY_BACKOFF_MS must not be negative"))
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, errors.New("RETRY_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.Retry.InitialBackoff < 0 || c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		errs = append(errs, errors.New("RETRY_INITIAL_BACKOFF_MS and RETRY_MAX_BACKOFF_MS must satisfy 0 <= initial <= max"))
+	}
+	if !(c.Retry.BackoffMultiple >= 1) || math.IsInf(c.Retry.BackoffMultiple, 1) {
+		errs = append(errs, errors.New("RETRY_BACKOFF_MULTIPLE must be a finite number of at least 1"))
+	}
+	if !(c.Retry.JitterFraction >= 0 && c.Retry.JitterFraction <= 1) {
+		errs = append(errs, errors.New("RETRY_JITTER_FRACTION must be in [0, 1]"))
+	}
+	if c.Retry.MaxRetryAfter < c.Retry.MaxBackoff {
+		errs = append(errs, errors.New("MAX_RETRY_AFTER_MS must be at least the retry max backoff"))
+	}
+	if c.Retry.MaxElapsedTime < 0 {
+		errs = append(errs, errors.New("RETRY_MAX_ELAPSED_MS must not be negative"))
+	}
+	// Below the ceiling, delays the service would otherwise honor would be discarded as malformed
+	if c.Retry.MaxPlausibleRetryAfter != 0 && c.Retry.MaxPlausibleRetryAfter < c.Retry.MaxRetryAfter {
+		errs = append(errs, errors.New("RETRY_AFTER_MAX_PLAUSIBLE_MS must be 0 or at least MAX_RETRY_AFTER_MS"))
+	}
+	for _, method := range c.Retry.SafeMethods {
+		if !slices.Contains(httpMethods, strings.ToUpper(method)) {
+			errs = append(errs, fmt.Errorf("RETRY_SAFE_METHODS: unknown HTTP method %q", method))
+		}
+	}
+	for endpoint, policy := range c.RetryEndpoints {
+		if !slices.Contains(RetryEndpoints, endpoint) {
+			errs = append(errs, fmt.Errorf("RETRY_POLICY_BY_ENDPOINT[%s]: unknown endpoint, expected one of %v", endpoint, RetryEndpoints))
+		}
+		errs = append(errs, retryPolicyErrors(fmt.Sprintf("RETRY_POLICY_BY_ENDPOINT[%s]", endpoint), policy)...)
+	}
+	for name, policy := range c.RetryPolicies {
+		errs = append(errs, retryPolicyErrors(fmt.Sprintf("RETRY_POLICIES[%s]", name), policy)...)
+	}
+	for merchantID, name := range c.RetryPolicyByMerchant {
+		if _, ok := c.RetryPolicies[name]; !ok {
+			errs = append(errs, fmt.Errorf("RETRY_POLICY_BY_MERCHANT[%s]: unknown policy %q, expected one defined in RETRY_POLICIES", merchantID, name))
+		}
+	}
+	if c.Tracing.QueueSize < 1 {
+		errs = append(errs, errors.New("TRACE_QUEUE_SIZE must be at least 1"))
+	}
+	if c.Tracing.Overflow != "drop" && c.Tracing.Overflow != "block" {
+		errs = append(errs, fmt.Errorf("TRACE_QUEUE_OVERFLOW must be drop or block, got %q", c.Tracing.Overflow))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACE_SAMPLE_RATIO must be in [0, 1]"))
+	}
+	if c.Bulkhead.MaxConcurrent < 1 {
+		errs = append(errs, errors.New("BULKHEAD_MAX_CONCURRENT must be at least 1"))
+	}
+	if c.Bulkhead.ReservedFraction < 0 || c.Bulkhead.ReservedFraction >= 1 {
+		errs = append(errs, errors.New("BULKHEAD_RESERVED_FRACTION must be in [0, 1)"))
+	}
+	if c.Bulkhead.MinRetryAfter < 0 {
+		errs = append(errs, errors.New("BULKHEAD_MIN_RETRY_AFTER_MS must not be negative"))
+	}
+	if c.Bulkhead.OverflowSlots < 0 {
+		errs = append(errs, errors.New("BULKHEAD_OVERFLOW_SLOTS must not be negative"))
+	}
+	if c.Bulkhead.AdminSlots < 0 {
+		errs = append(errs, errors.New("BULKHEAD_ADMIN_SLOTS must not be negative"))
+	}
+	if c.Bulkhead.PriorityAging < 0 {
+		errs = append(errs, errors.New("BULKHEAD_PRIORITY_AGING_MS must not be negative"))
+	}
+	if len(c.IdempotencyHeaders) == 0 || slices.Contains(c.IdempotencyHeaders, "") {
+		errs = append(errs, errors.New("IDEMPOTENCY_HEADER_NAMES must list at least one header name, with no empty entries"))
+	}
+	if c.IdempotencyMaxTTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_MAX_TTL_MS must be positive"))
+	}
+	if c.DecisionLogSize < 0 {
+		errs = append(errs, errors.New("RELIABILITY_LOG_SIZE must not be negative"))
+	}
+	if c.BodyCaptureSampleRate < 0 || c.BodyCaptureSampleRate > 1 {
+		errs = append(errs, errors.New("BODY_CAPTURE_SAMPLE_RATE must be in [0, 1]"))
+	}
+	if c.BodyCaptureMaxBytes < 1 {
+		errs = append(errs, errors.New("BODY_CAPTURE_MAX_BYTES must be at least 1"))
+	}
+	if c.IdempotencyReplayAlertThreshold < 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_REPLAY_ALERT_THRESHOLD must not be negative"))
+	}
+	if c.IdempotencyEntryBytes < 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_ENTRY_BYTES must not be negative"))
+	}
+	if c.IdempotencyMaxKeys < 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_MAX_KEYS_PER_MERCHANT must not be negative"))
+	}
+	if c.MaxRequestAge < 0 {
+		errs = append(errs, errors.New("MAX_REQUEST_AGE_MS must not be negative"))
+	}
+	if c.StepUpThreshold < 0 || math.IsNaN(c.StepUpThreshold) {
+		errs = append(errs, errors.New("STEPUP_THRESHOLD must not be negative"))
+	}
+	if c.StepUpChallengeTTL <= 0 {
+		errs = append(errs, errors.New("STEPUP_CHALLENGE_TTL_MS must be positive"))
+	}
+	if c.CancelledOrderRetention <= 0 {
+		errs = append(errs, errors.New("CANCELLED_ORDER_RETENTION_MS must be positive"))
+	}
+	if c.Hedging.Enabled && (c.Hedging.Delay <= 0 || c.Hedging.Delay >= c.Payment.CallTimeout) {
+		errs = append(errs, errors.New("HEDGE_DELAY_MS must be positive and below PAYMENT_TIMEOUT_MS"))
+	}
+	if c.CircuitBreaker.MaxRequests < 1 {
+		errs = append(errs, errors.New("CB_MAX_REQUESTS must be at least 1"))
+	}
+	if c.CircuitBreaker.Interval < 0 {
+		errs = append(errs, errors.New("CB_INTERVAL_MS must not be negative"))
+	}
+	if c.CircuitBreaker.Timeout <= 0 {
+		errs = append(errs, errors.New("CB_TIMEOUT_MS must be positive"))
+	}
+	if c.CircuitBreaker.ConsecutiveFailures < 1 {
+		errs = append(errs, errors.New("CB_CONSECUTIVE_FAILURES must be at least 1"))
+	}
+	if c.CircuitBreaker.FailureRatio <= 0 || c.CircuitBreaker.FailureRatio > 1 {
+		errs = append(errs, errors.New("CB_FAILURE_RATIO must be in (0, 1]"))
+	}
+	if raw := c.CircuitBreaker.WebhookURL; raw != "" {
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.New("CB_WEBHOOK_URL must be an absolute URL"))
+		}
+	}
+	if c.CircuitBreaker.TimeoutJitter < 0 || c.CircuitBreaker.TimeoutJitter >= 1 {
+		errs = append(errs, errors.New("CB_TIMEOUT_JITTER must be in [0, 1)"))
+	}
+	if c.CircuitBreaker.WebhookMinInterval < 0 {
+		errs = append(errs, errors.New("CB_WEBHOOK_MIN_INTERVAL_MS must not be negative"))
+	}
+	if c.Readiness.CacheTTL < 0 {
+		errs = append(errs, errors.New("READINESS_CACHE_TTL_MS must not be negative"))
+	}
+	if c.Readiness.JitterFraction < 0 || c.Readiness.JitterFraction > 1 {
+		errs = append(errs, errors.New("READINESS_JITTER_FRACTION must be in [0, 1]"))
+	}
+	if c.Persistence.ErrorPercentage < 0 || c.Persistence.ErrorPercentage > 100 || math.IsNaN(c.Persistence.ErrorPercentage) {
+		errs = append(errs, errors.New("PERSIST_ERROR_PCT must be between 0 and 100"))
+	}
+	if c.Persistence.WriteBehindQueue < 1 {
+		errs = append(errs, errors.New("WRITE_BEHIND_QUEUE_SIZE must be at least 1"))
+	}
+	if c.Persistence.WriteBehindBackoff <= 0 {
+		errs = append(errs, errors.New("WRITE_BEHIND_BACKOFF_MS must be positive"))
+	}
+	if c.Webhook.Timeout <= 0 {
+		errs = append(errs, errors.New("WEBHOOK_TIMEOUT_MS must be positive"))
+	}
+	if c.Webhook.MaxAttempts < 1 {
+		errs = append(errs, errors.New("WEBHOOK_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.Webhook.Backoff < 0 {
+		errs = append(errs, errors.New("WEBHOOK_BACKOFF_MS must not be negative"))
+	}
+	if c.MetricsSink != "none" && c.MetricsSink != "otel" {
+		errs = append(errs, errors.New("METRICS_SINK must be none or otel"))
+	}
+	if c.SLOTarget <= 0 || c.SLOTarget >= 1 {
+		errs = append(errs, errors.New("SLO_TARGET must be in (0, 1)"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns the configuration as a JSON-friendly map with secrets masked
+func (c *Config) Redacted() map[string]any {
+	return export(c)
+}
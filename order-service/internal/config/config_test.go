@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/reliability"
+)
+
+func TestLoadRetryEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string // Substring of the error; empty expects success
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults when unset",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Retry.MaxAttempts != 3 || cfg.Retry.InitialBackoff != 50*time.Millisecond || cfg.Retry.JitterFraction != 0.3 {
+					t.Errorf("Retry = %+v, want the defaults", cfg.Retry)
+				}
+			},
+		},
+		{
+			name: "overrides apply",
+			env: map[string]string{
+				"RETRY_MAX_ATTEMPTS":       "5",
+				"RETRY_INITIAL_BACKOFF_MS": "10",
+				"RETRY_MAX_BACKOFF_MS":     "400",
+				"RETRY_BACKOFF_MULTIPLE":   "3",
+				"RETRY_JITTER_FRACTION":    "0",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				r := cfg.Retry
+				if r.MaxAttempts != 5 || r.InitialBackoff != 10*time.Millisecond || r.MaxBackoff != 400*time.Millisecond ||
+					r.BackoffMultiple != 3 || r.JitterFraction != 0 {
+					t.Errorf("Retry = %+v, want the overrides", r)
+				}
+			},
+		},
+		{
+			name: "malformed values keep their defaults",
+			env: map[string]string{
+				"RETRY_MAX_ATTEMPTS":       "three",
+				"RETRY_INITIAL_BACKOFF_MS": "50ms",
+				"RETRY_MAX_BACKOFF_MS":     "1s",
+				"RETRY_BACKOFF_MULTIPLE":   "x2",
+				"RETRY_JITTER_FRACTION":    "NaN",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				r, want := cfg.Retry, reliability.DefaultRetryConfig()
+				if r.MaxAttempts != want.MaxAttempts || r.InitialBackoff != want.InitialBackoff || r.MaxBackoff != want.MaxBackoff ||
+					r.BackoffMultiple != want.BackoffMultiple || r.JitterFraction != want.JitterFraction {
+					t.Errorf("Retry = %+v, want the defaults", r)
+				}
+			},
+		},
+		{name: "one attempt disables retries", env: map[string]string{"RETRY_MAX_ATTEMPTS": "1"}, check: func(t *testing.T, cfg *Config) {
+			if cfg.Retry.MaxAttempts != 1 {
+				t.Errorf("MaxAttempts = %d, want 1", cfg.Retry.MaxAttempts)
+			}
+		}},
+		{name: "zero attempts", env: map[string]string{"RETRY_MAX_ATTEMPTS": "0"}, wantErr: "RETRY_MAX_ATTEMPTS must be at least 1"},
+		{name: "initial above max", env: map[string]string{"RETRY_INITIAL_BACKOFF_MS": "2000"}, wantErr: "RETRY_INITIAL_BACKOFF_MS and RETRY_MAX_BACKOFF_MS"},
+		{name: "shrinking multiple", env: map[string]string{"RETRY_BACKOFF_MULTIPLE": "0.5"}, wantErr: "RETRY_BACKOFF_MULTIPLE must be"},
+		{name: "negative jitter", env: map[string]string{"RETRY_JITTER_FRACTION": "-0.1"}, wantErr: "RETRY_JITTER_FRACTION must be in [0, 1]"},
+		{name: "jitter above 1", env: map[string]string{"RETRY_JITTER_FRACTION": "1.5"}, wantErr: "RETRY_JITTER_FRACTION must be in [0, 1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string // Substring of the error; empty expects the config to be valid
+	}{
+		{name: "defaults are valid", modify: func(cfg *Config) {}},
+		{name: "no bulkhead slots", modify: func(cfg *Config) { cfg.Bulkhead.MaxConcurrent = 0 },
+			wantErr: "BULKHEAD_MAX_CONCURRENT must be at least 1"},
+		{name: "relative payment URL", modify: func(cfg *Config) { cfg.Payment.URLs = []string{"payment-service:8081"} },
+			wantErr: `payment service URL "payment-service:8081"`},
+		{name: "zero payment timeout", modify: func(cfg *Config) { cfg.Payment.CallTimeout = 0 },
+			wantErr: "PAYMENT_TIMEOUT_MS must be positive"},
+		{name: "unknown precision mode", modify: func(cfg *Config) { cfg.AmountPrecisionMode = "ceil" },
+			wantErr: `AMOUNT_PRECISION_MODE must be allow, reject, round_half_even or truncate, got "ceil"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryBadVariable(t *testing.T) {
+	t.Setenv("BULKHEAD_MAX_CONCURRENT", "ten")
+	t.Setenv("ADMIN_ENDPOINTS_ENABLED", "on")
+	t.Setenv("PAYMENT_TIMEOUT_MS", "0.5s")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load() succeeded with malformed variables")
+	}
+	for _, want := range []string{`BULKHEAD_MAX_CONCURRENT="ten"`, `ADMIN_ENDPOINTS_ENABLED="on"`, `PAYMENT_TIMEOUT_MS="0.5s"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestServerTimeoutsCloseSlowClients(t *testing.T) {
+	cfg := Default().Server
+	cfg.ReadHeaderTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		send         func(conn net.Conn) // Writes the request, however slowly
+		wantResponse bool
+	}{
+		{name: "complete request served", wantResponse: true, send: func(conn net.Conn) {
+			io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		}},
+		{name: "headers never finished", send: func(conn net.Conn) {
+			io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n")
+		}},
+		{name: "headers trickled past the timeout", send: func(conn net.Conn) {
+			for _, line := range []string{"GET /health HTTP/1.1\r\n", "Host: localhost\r\n", "X-Slow: 1\r\n", "X-Slow: 2\r\n", "X-Slow: 3\r\n"} {
+				if _, err := io.WriteString(conn, line); err != nil {
+					return
+				}
+				time.Sleep(40 * time.Millisecond)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Configured the way cmd/main.go configures the real server
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+			server.Config.ReadTimeout = cfg.ReadTimeout
+			server.Config.WriteTimeout = cfg.WriteTimeout
+			server.Config.IdleTimeout = cfg.IdleTimeout
+			server.Start()
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			tt.send(conn)
+
+			// Without the timeout the server would hold the connection open until the deadline below
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			start := time.Now()
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if tt.wantResponse {
+				if err != nil {
+					t.Fatalf("reading response: %v", err)
+				}
+				resp.Body.Close()
+				return
+			}
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("got %s to an unfinished request", resp.Status)
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatalf("connection still open after %s, want it closed by the %s header timeout", time.Since(start), cfg.ReadHeaderTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envLoader reads typed values from the environment, collecting parse errors
+// so startup can report every bad variable at once instead of failing on the first
+type envLoader struct {
+	errs []error
+}
+
+func (l *envLoader) string(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// list reads a comma-separated list, trimming whitespace and dropping empty entries
+func (l *envLoader) list(key string, defaultValue []string) []string {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func (l *envLoader) bool(key string, defaultValue bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected true or false", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+func (l *envLoader) int(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected an integer", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+func (l *envLoader) uint32(key string, defaultValue uint32) uint32 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected a non-negative integer", key, raw))
+		return defaultValue
+	}
+	return uint32(value)
+}
+
+func (l *envLoader) float(key string, defaultValue float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected a number", key, raw))
+		return defaultValue
+	}
+	return value
+}
+
+// millis reads an integer number of milliseconds as a duration
+func (l *envLoader) millis(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected milliseconds as an integer", key, raw))
+		return defaultValue
+	}
+	return time.Duration(value) * time.Millisecond
+}
+
+// seconds reads an integer number of seconds as a duration
+func (l *envLoader) seconds(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: expected seconds as an integer", key, raw))
+		return defaultValue
+	}
+	return time.Duration(value) * time.Second
+}
+
+func (l *envLoader) err() error {
+	return errors.Join(l.errs...)
+}
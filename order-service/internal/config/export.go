@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secret values in exported config
+const redactedValue = "[REDACTED]"
+
+// export converts a config struct into a JSON-friendly map for the admin endpoint
+// Field names come from json tags; durations render as strings ("500ms") and func fields are skipped
+// Fields tagged `redact:"true"` are masked entirely; `redact:"url"` masks only URL credentials
+// Redaction also applies to each element of string slices and string-valued maps
+func export(v any) map[string]any {
+	return exportStruct(reflect.Indirect(reflect.ValueOf(v)))
+}
+
+func exportStruct(v reflect.Value) map[string]any {
+	out := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if value, ok := exportValue(v.Field(i), field.Tag.Get("redact")); ok {
+			out[name] = value
+		}
+	}
+	return out
+}
+
+func exportValue(v reflect.Value, redact string) (any, bool) {
+	switch {
+	case v.Kind() == reflect.Func || v.Kind() == reflect.Chan:
+		return nil, false
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(v.Int()).String(), true
+	case v.Kind() == reflect.Struct:
+		return exportStruct(v), true
+	case v.Kind() == reflect.String && redact == "true":
+		if v.String() == "" {
+			return "", true
+		}
+		return redactedValue, true
+	case v.Kind() == reflect.String && redact == "url":
+		return redactURL(v.String()), true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String && redact != "":
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i], _ = exportValue(v.Index(i), redact)
+		}
+		return values, true
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String && redact != "":
+		values := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			values[fmt.Sprint(iter.Key().Interface())], _ = exportValue(iter.Value(), redact)
+		}
+		return values, true
+	default:
+		return v.Interface(), true
+	}
+}
+
+// redactURL masks the password in a URL's userinfo, leaving the rest readable
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
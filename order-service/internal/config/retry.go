@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/demo/order-service/internal/reliability"
+)
+
+// Downstream endpoints that can be given their own retry policy
+const (
+	RetryEndpointCharge = "charge" // POST /charge on the payment service; side-effecting, deduplicated by idempotency key
+	RetryEndpointHealth = "health" // GET /health on the payment service; a cheap, safe lookup
+)
+
+// RetryEndpoints lists the endpoint names accepted in RETRY_POLICY_BY_ENDPOINT
+var RetryEndpoints = []string{RetryEndpointCharge, RetryEndpointHealth}
+
+// httpMethods lists the methods accepted in RETRY_SAFE_METHODS
+var httpMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE", "POST", "PATCH"}
+
+// retryOverride is the JSON form of one endpoint's or named retry policy; omitted fields keep the default policy's value
+type retryOverride struct {
+	MaxAttempts      *int     `json:"max_attempts"`
+	InitialBackoffMS *int64   `json:"initial_backoff_ms"`
+	MaxBackoffMS     *int64   `json:"max_backoff_ms"`
+	BackoffMultiple  *float64 `json:"backoff_multiple"`
+	JitterFraction   *float64 `json:"jitter_fraction"`
+	MaxRetryAfterMS  *int64   `json:"max_retry_after_ms"`
+	MaxElapsedMS     *int64   `json:"max_elapsed_ms"`
+}
+
+// parseRetryOverrides decodes retry overrides keyed by endpoint or policy name and applies each over base
+func parseRetryOverrides(spec string, base reliability.RetryConfig) (map[string]reliability.RetryConfig, error) {
+	var overrides map[string]retryOverride
+	if err := json.Unmarshal([]byte(spec), &overrides); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]reliability.RetryConfig, len(overrides))
+	for key, o := range overrides {
+		policy := base
+		if o.MaxAttempts != nil {
+			policy.MaxAttempts = *o.MaxAttempts
+		}
+		if o.InitialBackoffMS != nil {
+			policy.InitialBackoff = time.Duration(*o.InitialBackoffMS) * time.Millisecond
+		}
+		if o.MaxBackoffMS != nil {
+			policy.MaxBackoff = time.Duration(*o.MaxBackoffMS) * time.Millisecond
+		}
+		if o.BackoffMultiple != nil {
+			policy.BackoffMultiple = *o.BackoffMultiple
+		}
+		if o.JitterFraction != nil {
+			policy.JitterFraction = *o.JitterFraction
+		}
+		if o.MaxRetryAfterMS != nil {
+			policy.MaxRetryAfter = time.Duration(*o.MaxRetryAfterMS) * time.Millisecond
+		}
+		if o.MaxElapsedMS != nil {
+			policy.MaxElapsedTime = time.Duration(*o.MaxElapsedMS) * time.Millisecond
+		}
+		policies[key] = policy
+	}
+	return policies, nil
+}
+
+// retryPolicyErrors checks one endpoint's or named retry policy, prefixing each problem with label
+func retryPolicyErrors(label string, policy reliability.RetryConfig) []error {
+	var errs []error
+	if policy.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("%s: max_attempts must be at least 1", label))
+	}
+	if policy.InitialBackoff < 0 || policy.MaxBackoff < policy.InitialBackoff {
+		errs = append(errs, fmt.Errorf("%s: backoffs must satisfy 0 <= initial_backoff_ms <= max_backoff_ms", label))
+	}
+	if policy.BackoffMultiple < 1 {
+		errs = append(errs, fmt.Errorf("%s: backoff_multiple must be at least 1", label))
+	}
+	if policy.JitterFraction < 0 || policy.JitterFraction > 1 {
+		errs = append(errs, fmt.Errorf("%s: jitter_fraction must be in [0, 1]", label))
+	}
+	if policy.MaxRetryAfter < policy.MaxBackoff {
+		errs = append(errs, fmt.Errorf("%s: max_retry_after_ms must be at least max_backoff_ms", label))
+	}
+	if policy.MaxElapsedTime < 0 {
+		errs = append(errs, fmt.Errorf("%s: max_elapsed_ms must not be negative", label))
+	}
+	if policy.MaxPlausibleRetryAfter != 0 && policy.MaxPlausibleRetryAfter < policy.MaxRetryAfter {
+		errs = append(errs, fmt.Errorf("%s: max_retry_after_ms must not exceed RETRY_AFTER_MAX_PLAUSIBLE_MS", label))
+	}
+	return errs
+}
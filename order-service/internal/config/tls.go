@@ -0,0 +1,49 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// tlsVersions maps TLS_MIN_VERSION values to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig pins the TLS version and cipher suites used for inter-service connections
+type TLSConfig struct {
+	MinVersion   string   `json:"min_version"`   // "1.0" through "1.3"
+	CipherSuites []string `json:"cipher_suites"` // IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; empty uses Go's defaults
+}
+
+// Config builds a crypto/tls config enforcing the minimum version and cipher allowlist
+// Cipher suites only constrain TLS 1.2 and below; TLS 1.3 suites are not configurable in Go
+func (c TLSConfig) Config() (*tls.Config, error) {
+	version, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("TLS_MIN_VERSION=%q: expected one of 1.0, 1.1, 1.2, 1.3", c.MinVersion)
+	}
+
+	cfg := &tls.Config{MinVersion: version}
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("TLS_CIPHER_SUITES: unknown or insecure cipher suite %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+	return cfg, nil
+}
+
+// cipherSuiteID looks up a secure cipher suite by name; insecure suites are deliberately not accepted
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
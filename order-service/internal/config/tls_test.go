@@ -0,0 +1,43 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersionRefusesOldServers(t *testing.T) {
+	tests := []struct {
+		name          string
+		minVersion    string
+		serverMax     uint16
+		wantHandshake bool
+	}{
+		{name: "TLS 1.1 server below a 1.2 minimum", minVersion: "1.2", serverMax: tls.VersionTLS11},
+		{name: "TLS 1.2 server at a 1.2 minimum", minVersion: "1.2", serverMax: tls.VersionTLS12, wantHandshake: true},
+		{name: "TLS 1.2 server below a 1.3 minimum", minVersion: "1.3", serverMax: tls.VersionTLS12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tt.serverMax}
+			server.StartTLS()
+			defer server.Close()
+
+			clientTLS, err := TLSConfig{MinVersion: tt.minVersion}.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientTLS.InsecureSkipVerify = true // httptest's self-signed certificate
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if handshake := err == nil; handshake != tt.wantHandshake {
+				t.Errorf("handshake succeeded = %v, want %v (err %v)", handshake, tt.wantHandshake, err)
+			}
+		})
+	}
+}
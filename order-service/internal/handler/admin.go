@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/reliability"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operational endpoints, registered only when ADMIN_ENDPOINTS_ENABLED=true
+type AdminHandler struct {
+	cfg       *config.Config
+	decisions *reliability.DecisionLog // nil when RELIABILITY_LOG_SIZE is 0
+	orders    *service.OrderService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(cfg *config.Config, decisions *reliability.DecisionLog, orders *service.OrderService) *AdminHandler {
+	return &AdminHandler{
+		cfg:       cfg,
+		decisions: decisions,
+		orders:    orders,
+	}
+}
+
+// RequireAdminToken refuses requests whose X-Admin-Token doesn't match token with 401, guarding admin routes that
+// change state; with token empty every request is refused, so those routes stay closed until ADMIN_TOKEN is set
+func RequireAdminToken(token string) gin.HandlerFunc {
+	want := []byte(token)
+	return func(c *gin.Context) {
+		if !adminTokenMatches(c.GetHeader("X-Admin-Token"), want) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid X-Admin-Token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Config handles GET /admin/config, returning the effective configuration with secrets redacted
+func (h *AdminHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cfg.Redacted())
+}
+
+// ReliabilityLog handles GET /admin/reliability/log, returning the most recent reliability decisions, oldest first
+func (h *AdminHandler) ReliabilityLog(c *gin.Context) {
+	if h.decisions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reliability log disabled; set RELIABILITY_LOG_SIZE to enable it"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"capacity":  h.decisions.Capacity(),
+		"decisions": h.decisions.Entries(),
+	})
+}
+
+// RetryBudget handles GET /admin/retry/budget, reporting how many retries the shared retry budget allows right now
+// and how fast it refills; a disabled budget reports "enabled": false
+func (h *AdminHandler) RetryBudget(c *gin.Context) {
+	c.JSON(http.StatusOK, h.orders.RetryBudgetStatus())
+}
+
+// ExpireIdempotency handles DELETE /admin/orders/:id/idempotency, removing the order's idempotency entry so a client
+// may resubmit it as a new order, e.g. after a confirmed failure; 404 if there's no entry for the order
+func (h *AdminHandler) ExpireIdempotency(c *gin.Context) {
+	orderID := c.Param("id")
+	removed := h.orders.ExpireIdempotency(orderID)
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no idempotency entry for order " + orderID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order_id": orderID, "removed": removed})
+}
+
+// Idempotency handles GET /admin/idempotency, reporting the idempotency store's entry count and estimated memory footprint
+func (h *AdminHandler) Idempotency(c *gin.Context) {
+	c.JSON(http.StatusOK, h.orders.IdempotencyStats())
+}
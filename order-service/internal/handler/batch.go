@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchOrders bounds a POST /orders/batch request, since unlike the stream it's held in memory whole
+const maxBatchOrders = 1000
+
+// BatchResult is one order's outcome in the POST /orders/batch response, at the order's index in the request
+type BatchResult struct {
+	Index          int    `json:"index"`
+	OrderID        string `json:"order_id,omitempty"`
+	Status         string `json:"status"` // "completed", "stepup_required" or "error"
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// BatchOrders handles POST /orders/batch, creating each order of a JSON array and answering with their results in
+// request order once all are done. At most BATCH_MAX_CONCURRENCY orders are in flight at once, separately from the
+// payment bulkhead: that many workers each take the next order as they finish one, so however large the batch it
+// never holds more bulkhead slots or queue places than that. Invalid orders are reported individually
+func (h *OrderHandler) BatchOrders(c *gin.Context) {
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected a JSON array of orders: " + err.Error()})
+		return
+	}
+	if len(items) > maxBatchOrders {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("batch has %d orders, maximum is %d", len(items), maxBatchOrders)})
+		return
+	}
+
+	results := make([]BatchResult, len(items))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	ctx := c.Request.Context()
+	for w := 0; w < min(h.batchConcurrency, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = BatchResult{Index: i, Status: "error"}
+				req, err := decodeStreamOrder(items[i])
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				resp, err := h.orderService.CreateOrder(ctx, req, "")
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				results[i] = BatchResult{Index: i, OrderID: resp.OrderID, Status: resp.Status, ChallengeToken: resp.ChallengeToken}
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBatchOrdersBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		size  int
+	}{
+		{name: "sequential", limit: 1, size: 10},
+		{name: "large batch", limit: 3, size: 60},
+		{name: "batch smaller than limit", limit: 8, size: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, peak, charges atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				charges.Add(1)
+				time.Sleep(5 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.BatchMaxConcurrency = tt.limit
+			cfg.Bulkhead.MaxConcurrent = 50 // Far above the limit, so only the batch bound applies
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders/batch", h.BatchOrders)
+
+			items := make([]string, tt.size)
+			for i := range items {
+				items[i] = `{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/orders/batch", strings.NewReader("["+strings.Join(items, ",")+"]"))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			var body struct {
+				Results []BatchResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("POST /orders/batch = %d %q", rec.Code, rec.Body.String())
+			}
+			for i, result := range body.Results {
+				if result.Index != i || result.Status != "completed" {
+					t.Errorf("result %d = %+v, want completed at index %d", i, result, i)
+				}
+			}
+			if got := charges.Load(); int(got) != tt.size {
+				t.Errorf("charges = %d, want %d", got, tt.size)
+			}
+			if got := peak.Load(); int(got) > tt.limit {
+				t.Errorf("peak concurrent charges = %d, want at most %d", got, tt.limit)
+			}
+		})
+	}
+}
+
+func TestBatchOrdersReportsInvalidItems(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErrors []bool // Per index, whether the result is an error
+	}{
+		{name: "mixed", body: `[{"merchant_id":"m","amount":10,"currency":"USD"},{"merchant_id":"m","amount":-1,"currency":"USD"},{"amount":5}]`,
+			wantStatus: http.StatusOK, wantErrors: []bool{false, true, true}},
+		{name: "empty batch", body: `[]`, wantStatus: http.StatusOK, wantErrors: []bool{}},
+		{name: "not an array", body: `{"merchant_id":"m"}`, wantStatus: http.StatusBadRequest},
+		{name: "too many", body: "[" + strings.Repeat(`{},`, maxBatchOrders) + `{}]`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders/batch", h.BatchOrders)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("POST /orders/batch = %d %q, want %d", rec.Code, rec.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Results []BatchResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Results) != len(tt.wantErrors) {
+				t.Fatalf("got %d results, want %d", len(body.Results), len(tt.wantErrors))
+			}
+			for i, wantErr := range tt.wantErrors {
+				if gotErr := body.Results[i].Status == "error"; gotErr != wantErr {
+					t.Errorf("result %d = %+v, want error %v", i, body.Results[i], wantErr)
+				}
+			}
+		})
+	}
+}
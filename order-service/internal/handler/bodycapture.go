@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedValue replaces the value of every redacted field in a captured body
+const redactedValue = "[REDACTED]"
+
+// BodyCapture logs full request and response bodies for a sampled fraction of requests, for debugging client payloads
+// Bodies are capped at maxBytes and configured fields are redacted before anything is logged
+type BodyCapture struct {
+	rate     float64
+	maxBytes int
+	redact   map[string]bool // Lowercased field names
+	pattern  *regexp.Regexp  // Matches redacted fields in bodies that aren't valid JSON, e.g. truncated ones
+	logger   *slog.Logger
+	sample   func() float64 // Replaceable for deterministic sampling
+}
+
+// NewBodyCapture creates a capture sampling rate (0-1) of requests and logging to logger
+// Field names in redact match JSON object keys at any depth, case-insensitively
+func NewBodyCapture(rate float64, maxBytes int, redact []string, logger *slog.Logger) *BodyCapture {
+	b := &BodyCapture{
+		rate:     rate,
+		maxBytes: maxBytes,
+		redact:   make(map[string]bool, len(redact)),
+		logger:   logger,
+		sample:   rand.Float64,
+	}
+	quoted := make([]string, 0, len(redact))
+	for _, field := range redact {
+		b.redact[strings.ToLower(field)] = true
+		quoted = append(quoted, regexp.QuoteMeta(field))
+	}
+	if len(quoted) > 0 {
+		b.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	}
+	return b
+}
+
+// Middleware tees the bodies of sampled requests as they stream through, so the handler still reads the full request
+func (b *BodyCapture) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if b.rate <= 0 || b.sample() >= b.rate {
+			c.Next()
+			return
+		}
+
+		reqBody := &cappedBuffer{max: b.maxBytes}
+		if c.Request.Body != nil {
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(c.Request.Body, reqBody), c.Request.Body}
+		}
+		respBody := &cappedBuffer{max: b.maxBytes}
+		c.Writer = &capturingWriter{ResponseWriter: c.Writer, body: respBody}
+
+		c.Next()
+
+		b.logger.LogAttrs(c.Request.Context(), slog.LevelInfo, "body_capture",
+			slog.String("trace_id", trace.SpanContextFromContext(c.Request.Context()).TraceID().String()),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.String("request_body", b.redactBody(reqBody.buf.Bytes())),
+			slog.Bool("request_truncated", reqBody.truncated),
+			slog.String("response_body", b.redactBody(respBody.buf.Bytes())),
+			slog.Bool("response_truncated", respBody.truncated),
+		)
+	}
+}
+
+// redactBody masks redacted fields, structurally for JSON and by pattern for anything else
+func (b *BodyCapture) redactBody(body []byte) string {
+	if len(b.redact) == 0 || len(body) == 0 {
+		return string(body)
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err == nil {
+		if out, err := json.Marshal(b.redactValue(doc)); err == nil {
+			return string(out)
+		}
+	}
+	return b.pattern.ReplaceAllString(string(body), `${1}"`+redactedValue+`"`)
+}
+
+// redactValue walks a decoded JSON document replacing the values of redacted keys
+func (b *BodyCapture) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if b.redact[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = b.redactValue(inner)
+			}
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = b.redactValue(inner)
+		}
+	}
+	return v
+}
+
+// cappedBuffer keeps the first max bytes written to it and notes whether more were dropped
+// Writes always report success so the tee never fails the handler's read
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (w *cappedBuffer) Write(p []byte) (int, error) {
+	if room := w.max - w.buf.Len(); room < len(p) {
+		w.truncated = true
+		if room > 0 {
+			w.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	w.buf.Write(p)
+	return len(p), nil
+}
+
+// capturingWriter copies the response body into a cappedBuffer as it is written to the client
+type capturingWriter struct {
+	gin.ResponseWriter
+	body *cappedBuffer
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestBodyCaptureSampledAndRedacted(t *testing.T) {
+	const payload = `{"card_number":"4111111111111111","merchant_id":"merchant_123","payer":{"CVV":"123","name":"Ada"}}`
+
+	tests := []struct {
+		name          string
+		draw          float64 // Sampling draw against a rate of 0.5
+		maxBytes      int
+		wantLogged    bool
+		wantTruncated bool
+		wantRequest   string // Captured bodies, if logged
+		wantResponse  string
+	}{
+		{name: "sampled request is redacted at any depth", draw: 0.2, maxBytes: 4096, wantLogged: true,
+			wantRequest:  `{"card_number":"[REDACTED]","merchant_id":"merchant_123","payer":{"CVV":"[REDACTED]","name":"Ada"}}`,
+			wantResponse: `{"order_id":"order-1","token":"[REDACTED]"}`},
+		{name: "unsampled request isn't logged", draw: 0.7, maxBytes: 4096},
+		{name: "truncated body is still redacted", draw: 0.2, maxBytes: 24, wantLogged: true, wantTruncated: true,
+			wantRequest: `{"card_number":"[REDACTED]"`, wantResponse: `{"order_id":"order-1","t`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			capture := NewBodyCapture(0.5, tt.maxBytes, []string{"card_number", "cvv", "token"}, slog.New(slog.NewJSONHandler(&logs, nil)))
+			capture.sample = func() float64 { return tt.draw }
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			// Stands in for the tracing middleware ahead of capture in main
+			var traceID string
+			tracer := sdktrace.NewTracerProvider().Tracer("test")
+			router.Use(func(c *gin.Context) {
+				ctx, span := tracer.Start(c.Request.Context(), c.FullPath())
+				defer span.End()
+				traceID = span.SpanContext().TraceID().String()
+				c.Request = c.Request.WithContext(ctx)
+				c.Next()
+			})
+			router.Use(capture.Middleware())
+			var handlerSaw string
+			router.POST("/orders", func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				handlerSaw = string(body)
+				c.JSON(http.StatusCreated, gin.H{"order_id": "order-1", "token": "tok_secret"})
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			resp, err := http.Post(server.URL+"/orders", "application/json", strings.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			// Capture must never change what the handler reads or the client receives
+			if handlerSaw != payload {
+				t.Errorf("handler read %q, want the full body", handlerSaw)
+			}
+			if !strings.Contains(string(respBody), "tok_secret") {
+				t.Errorf("client got %q, want the unredacted response", respBody)
+			}
+
+			if !tt.wantLogged {
+				if logs.Len() > 0 {
+					t.Errorf("logged %q for an unsampled request", logs.String())
+				}
+				return
+			}
+			var record struct {
+				Msg               string `json:"msg"`
+				TraceID           string `json:"trace_id"`
+				Status            int    `json:"status"`
+				RequestBody       string `json:"request_body"`
+				RequestTruncated  bool   `json:"request_truncated"`
+				ResponseBody      string `json:"response_body"`
+				ResponseTruncated bool   `json:"response_truncated"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+				t.Fatalf("decoding %q: %v", logs.String(), err)
+			}
+			if record.Msg != "body_capture" || record.Status != http.StatusCreated || record.TraceID != traceID {
+				t.Errorf("record = %+v, want a body_capture of the 201 in trace %s", record, traceID)
+			}
+			if record.RequestBody != tt.wantRequest || record.RequestTruncated != tt.wantTruncated {
+				t.Errorf("request_body = %q (truncated %v), want %q (truncated %v)",
+					record.RequestBody, record.RequestTruncated, tt.wantRequest, tt.wantTruncated)
+			}
+			if record.ResponseBody != tt.wantResponse || record.ResponseTruncated != tt.wantTruncated {
+				t.Errorf("response_body = %q (truncated %v), want %q (truncated %v)",
+					record.ResponseBody, record.ResponseTruncated, tt.wantResponse, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// isMsgPack reports whether a media type is one of the msgpack variants
+func isMsgPack(mediaType string) bool {
+	return mediaType == binding.MIMEMSGPACK || mediaType == binding.MIMEMSGPACK2
+}
+
+// bindBody decodes the request body as msgpack or JSON according to its Content-Type; JSON is the default
+// Both share the struct's json tags, so field names and validation are identical
+func bindBody(c *gin.Context, obj any) error {
+	if isMsgPack(c.ContentType()) {
+		return c.ShouldBindWith(obj, binding.MsgPack)
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+// respond encodes obj as msgpack when the client asks for it via Accept, or sent msgpack without an Accept preference
+func respond(c *gin.Context, code int, obj any) {
+	if wantsMsgPack(c) {
+		c.Render(code, render.MsgPack{Data: obj})
+		return
+	}
+	c.JSON(code, obj)
+}
+
+func wantsMsgPack(c *gin.Context) bool {
+	if accept := c.GetHeader("Accept"); accept != "" && accept != "*/*" {
+		return isMsgPack(c.NegotiateFormat(gin.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK))
+	}
+	return isMsgPack(c.ContentType())
+}
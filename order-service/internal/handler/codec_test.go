@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// orderReply holds either outcome of POST /orders, decoded from JSON or msgpack alike
+type orderReply struct {
+	OrderID    string                    `json:"order_id"`
+	Status     string                    `json:"status"`
+	CreatedAt  string                    `json:"created_at"`
+	Adjustment *service.AmountAdjustment `json:"amount_adjustment"`
+	Error      string                    `json:"error"`
+}
+
+func TestCreateOrderMsgPackParity(t *testing.T) {
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer payment.Close()
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	cfg.AmountPrecisionMode = "round_half_even" // So responses carry a nested amount_adjustment
+	h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/orders", h.CreateOrder)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// post sends order encoded as contentType and decodes the reply by the Content-Type it came back in
+	post := func(t *testing.T, order service.CreateOrderRequest, contentType, accept string) (int, string, orderReply) {
+		t.Helper()
+		var err error
+		encoded := httptest.NewRecorder()
+		if contentType == binding.MIMEMSGPACK {
+			err = render.WriteMsgPack(encoded, order)
+		} else {
+			err = json.NewEncoder(encoded).Encode(order)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", encoded.Body)
+		req.Header.Set("Content-Type", contentType)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+
+		var got orderReply
+		replyType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if isMsgPack(replyType) {
+			err = binding.MsgPack.BindBody(raw, &got)
+		} else {
+			err = json.Unmarshal(raw, &got)
+		}
+		if err != nil {
+			t.Fatalf("decoding %s reply %q: %v", replyType, raw, err)
+		}
+		return resp.StatusCode, replyType, got
+	}
+
+	orders := []struct {
+		name  string
+		order service.CreateOrderRequest
+	}{
+		{name: "created", order: service.CreateOrderRequest{MerchantID: "merchant_123", Amount: 10.555, Currency: "USD"}},
+		{name: "rejected", order: service.CreateOrderRequest{Amount: 10, Currency: "USD"}},
+	}
+	encodings := []struct {
+		name        string
+		contentType string
+		accept      string
+		wantMsgPack bool
+	}{
+		{name: "msgpack both ways", contentType: binding.MIMEMSGPACK, wantMsgPack: true},
+		{name: "msgpack in, JSON out", contentType: binding.MIMEMSGPACK, accept: gin.MIMEJSON},
+		{name: "JSON in, msgpack out", contentType: gin.MIMEJSON, accept: binding.MIMEMSGPACK, wantMsgPack: true},
+	}
+	for _, o := range orders {
+		wantStatus, _, want := post(t, o.order, gin.MIMEJSON, "")
+		want.OrderID, want.CreatedAt = "", "" // Differ between any two orders
+		for _, e := range encodings {
+			t.Run(o.name+"/"+e.name, func(t *testing.T) {
+				status, replyType, got := post(t, o.order, e.contentType, e.accept)
+				if isMsgPack(replyType) != e.wantMsgPack {
+					t.Errorf("reply Content-Type = %q, want msgpack %v", replyType, e.wantMsgPack)
+				}
+				if status != wantStatus {
+					t.Errorf("status = %d, want %d as for JSON", status, wantStatus)
+				}
+				if wantStatus == http.StatusOK && (got.OrderID == "" || got.CreatedAt == "") {
+					t.Errorf("reply %+v lacks order_id or created_at", got)
+				}
+				got.OrderID, got.CreatedAt = "", ""
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("reply = %+v, want %+v as for JSON", got, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnLimiter caps how many TCP connections the server holds open at once, so a flood can't exhaust file descriptors
+// Over the cap, a newly accepted connection waits for another to close, then is closed if none does in time
+type ConnLimiter struct {
+	slots    chan struct{} // nil when unlimited
+	wait     time.Duration
+	rejected atomic.Int64
+}
+
+// NewConnLimiter creates a limiter allowing max open connections (0 for no limit),
+// holding excess connections up to wait for a free slot
+func NewConnLimiter(max int, wait time.Duration) *ConnLimiter {
+	l := &ConnLimiter{wait: wait}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// Wrap returns a listener whose accepted connections count against the limit; unlimited limiters return l unchanged
+func (l *ConnLimiter) Wrap(ln net.Listener) net.Listener {
+	if l.slots == nil {
+		return ln
+	}
+	return &limitListener{Listener: ln, limiter: l}
+}
+
+// Rejected returns the number of connections closed because no slot freed up in time
+func (l *ConnLimiter) Rejected() int64 {
+	return l.rejected.Load()
+}
+
+// acquire takes a slot, waiting up to l.wait for one to free up
+func (l *ConnLimiter) acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// limitListener is a net.Listener that admits connections through a ConnLimiter
+type limitListener struct {
+	net.Listener
+	limiter *ConnLimiter
+}
+
+// Accept returns the next connection that gets a slot; connections that don't are closed and skipped
+// While one waits for a slot, later connections stay in the kernel's accept backlog
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.limiter.acquire() {
+			return &limitConn{Conn: conn, release: func() { <-l.limiter.slots }}, nil
+		}
+		l.limiter.rejected.Add(1)
+		conn.Close()
+	}
+}
+
+// limitConn frees its slot when closed; the server may close a connection more than once
+type limitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
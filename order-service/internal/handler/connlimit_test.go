@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterCapsOpenConnections(t *testing.T) {
+	const max = 2
+	tests := []struct {
+		name         string
+		wait         time.Duration
+		freeAfter    time.Duration // When one of the held connections closes; 0 keeps them all open
+		wantServed   bool          // The connection over the cap is eventually served
+		wantRejected int64
+	}{
+		{name: "excess closed at once without a wait", wantRejected: 1},
+		{name: "excess closed when no slot frees in time", wait: 50 * time.Millisecond, wantRejected: 1},
+		{name: "excess waits for a slot to free", wait: time.Second, freeAfter: 50 * time.Millisecond, wantServed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewConnLimiter(max, tt.wait)
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Listener = limiter.Wrap(server.Listener)
+			server.Start()
+			defer server.Close()
+
+			// get sends a request on a fresh connection and reports whether it was answered; the connection stays open
+			get := func() (net.Conn, bool) {
+				conn, err := net.Dial("tcp", server.Listener.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				if err := req.Write(conn); err != nil {
+					return conn, false
+				}
+				resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+				if err != nil {
+					return conn, false
+				}
+				resp.Body.Close()
+				return conn, resp.StatusCode == http.StatusOK
+			}
+
+			var held []net.Conn
+			for i := 0; i < max; i++ {
+				conn, served := get()
+				defer conn.Close()
+				if !served {
+					t.Fatalf("connection %d within the cap wasn't served", i+1)
+				}
+				held = append(held, conn)
+			}
+			if tt.freeAfter > 0 {
+				time.AfterFunc(tt.freeAfter, func() { held[0].Close() })
+			}
+
+			start := time.Now()
+			conn, served := get()
+			defer conn.Close()
+			if served != tt.wantServed {
+				t.Errorf("connection over the cap served = %v, want %v", served, tt.wantServed)
+			}
+			if tt.wantServed && time.Since(start) < tt.freeAfter {
+				t.Errorf("connection over the cap served after %v, before a slot freed at %v", time.Since(start), tt.freeAfter)
+			}
+			if got := limiter.Rejected(); got != tt.wantRejected {
+				t.Errorf("Rejected() = %d, want %d", got, tt.wantRejected)
+			}
+		})
+	}
+}
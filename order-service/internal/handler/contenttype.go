@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireJSON rejects requests whose Content-Type isn't application/json with 415 Unsupported Media Type
+// Parameters such as charset are allowed; when strict is false every request passes through
+func RequireJSON(strict bool) gin.HandlerFunc {
+	return RequireContentType(strict, gin.MIMEJSON)
+}
+
+// RequireContentType is RequireJSON for endpoints that accept several media types, e.g. JSON or msgpack
+func RequireContentType(strict bool, allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strict || slices.Contains(allowed, c.ContentType()) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": fmt.Sprintf("Content-Type must be one of %s, got %q", strings.Join(allowed, ", "), c.GetHeader("Content-Type")),
+		})
+	}
+}
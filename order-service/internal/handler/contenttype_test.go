@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		allowed     []string // Empty uses RequireJSON
+		contentType string
+		wantStatus  int
+	}{
+		{name: "JSON accepted", strict: true, contentType: "application/json", wantStatus: http.StatusOK},
+		{name: "JSON with charset accepted", strict: true, contentType: "application/json; charset=utf-8", wantStatus: http.StatusOK},
+		{name: "form rejected", strict: true, contentType: "application/x-www-form-urlencoded", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "plain text rejected", strict: true, contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "missing content type rejected", strict: true, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "msgpack accepted where allowed", strict: true, allowed: []string{gin.MIMEJSON, "application/msgpack"},
+			contentType: "application/msgpack", wantStatus: http.StatusOK},
+		{name: "msgpack rejected on a JSON-only route", strict: true, contentType: "application/msgpack", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "anything passes when not strict", contentType: "text/plain", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := RequireJSON(tt.strict)
+			if len(tt.allowed) > 0 {
+				middleware = RequireContentType(tt.strict, tt.allowed...)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", middleware, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusUnsupportedMediaType && !strings.Contains(rec.Body.String(), "Content-Type must be") {
+				t.Errorf("415 body %s doesn't explain the required Content-Type", rec.Body)
+			}
+		})
+	}
+}
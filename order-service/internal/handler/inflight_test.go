@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInFlightReportedAtShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		slow         int           // Requests still being handled when shutdown starts
+		handlerTime  time.Duration // How long each takes
+		timeout      time.Duration
+		wantTimedOut bool
+		wantInFlight int64 // Count reported when Shutdown returns
+	}{
+		{name: "timeout cuts off slow requests", slow: 3, handlerTime: 500 * time.Millisecond, timeout: 50 * time.Millisecond,
+			wantTimedOut: true, wantInFlight: 3},
+		{name: "requests drain within the timeout", slow: 3, handlerTime: 50 * time.Millisecond, timeout: time.Second},
+		{name: "idle server", timeout: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inFlight := NewInFlightTracker()
+			arrived := make(chan struct{}, tt.slow)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(inFlight.Middleware())
+			router.GET("/slow", func(c *gin.Context) {
+				arrived <- struct{}{}
+				time.Sleep(tt.handlerTime)
+				c.Status(http.StatusOK)
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.slow; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if resp, err := http.Get(server.URL + "/slow"); err == nil {
+						resp.Body.Close()
+					}
+				}()
+			}
+			for i := 0; i < tt.slow; i++ {
+				<-arrived
+			}
+			if got := inFlight.Count(); got != int64(tt.slow) {
+				t.Errorf("in flight before shutdown = %d, want %d", got, tt.slow)
+			}
+
+			// As main does: shut down within the timeout and report what was still in flight
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := server.Config.Shutdown(ctx)
+			reported := inFlight.Count()
+
+			if timedOut := errors.Is(err, context.DeadlineExceeded); timedOut != tt.wantTimedOut {
+				t.Errorf("Shutdown() error = %v, want timed out %v", err, tt.wantTimedOut)
+			}
+			if reported != tt.wantInFlight {
+				t.Errorf("in flight at shutdown = %d, want %d", reported, tt.wantInFlight)
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -1,39 +1,214 @@
 package handler
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/reliability"
 	"github.com/demo/order-service/internal/service"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // OrderHandler handles HTTP requests for orders
 type OrderHandler struct {
-	orderService *service.OrderService
+	orderService       *service.OrderService
+	schemaValidator    *SchemaValidator // nil unless STRICT_SCHEMA_VALIDATION=true
+	streamConcurrency  int              // Orders processed in parallel per /orders/stream request
+	maxIdempotencyTTL  time.Duration    // Upper bound for the Idempotency-TTL header
+	idempotencyHeaders []string         // Header names checked in order for the idempotency key
+	adminToken         []byte           // X-Admin-Token value marking ops requests; empty disables admin marking
+	debugHeaders       bool             // Echo X-Retry-Count, X-CB-State and X-Bulkhead-Queued on POST /orders
+	batchConcurrency   int              // Orders processed in parallel per /orders/batch request
 }
 
 // NewOrderHandler creates a new order handler
-func NewOrderHandler(orderService *service.OrderService) *OrderHandler {
-	return &OrderHandler{
-		orderService: orderService,
+func NewOrderHandler(orderService *service.OrderService, cfg *config.Config) (*OrderHandler, error) {
+	h := &OrderHandler{
+		orderService:       orderService,
+		streamConcurrency:  cfg.StreamConcurrency,
+		maxIdempotencyTTL:  cfg.IdempotencyMaxTTL,
+		idempotencyHeaders: cfg.IdempotencyHeaders,
+		adminToken:         []byte(cfg.AdminToken),
+		debugHeaders:       cfg.DebugHeaders,
+		batchConcurrency:   cfg.BatchMaxConcurrency,
 	}
+
+	if cfg.StrictSchemaValidation {
+		validator, err := NewSchemaValidator(cfg.OrderSchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		h.schemaValidator = validator
+	}
+
+	return h, nil
+}
+
+// validAdminToken reports whether token matches the configured admin token, in constant time
+func (h *OrderHandler) validAdminToken(token string) bool {
+	return adminTokenMatches(token, h.adminToken)
+}
+
+// adminTokenMatches reports whether token equals want in constant time; an empty want matches nothing
+func adminTokenMatches(token string, want []byte) bool {
+	return len(want) > 0 && subtle.ConstantTimeCompare([]byte(token), want) == 1
 }
 
 // CreateOrder handles POST /orders
-// Expects Idempotency-Key header for safe retries
+// Expects an idempotency key header (Idempotency-Key by default) for safe retries; Idempotency-TTL (seconds) extends retention for that key
+// Replays carry Idempotent-Replayed and X-Original-Created-At headers
+// Accepts application/msgpack bodies as well as JSON and answers in the format negotiated by respond
+// Responds with a Server-Timing header breaking down where the latency budget went, and with DEBUG_HEADERS_ENABLED
+// X-Retry-Count, X-CB-State and X-Bulkhead-Queued summarizing the reliability decisions taken
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	timer := reliability.NewStageTimer()
+	stopValidation := timer.Time("validation")
+
+	// Strict schema validation runs on the raw body, before binding drops unknown fields
+	// The schema describes JSON, so msgpack bodies can't be checked against it and are refused rather than let through
+	if h.schemaValidator != nil {
+		if isMsgPack(c.ContentType()) {
+			respond(c, http.StatusUnsupportedMediaType, gin.H{"error": "strict schema validation requires application/json"})
+			return
+		}
+		if !h.validateSchema(c) {
+			return
+		}
+	}
+
 	var req service.CreateOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindBody(c, &req); err != nil {
+		// Negative zero and NaN fail gt=0 too, but get a dedicated 422 so the cause is clear
+		if !rejectInvalidAmount(c, req.Amount) {
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
+	if rejectInvalidAmount(c, req.Amount) {
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := service.ValidateCallbackURL(req.CallbackURL); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	stopValidation()
 
 	// Extract idempotency key from header
-	idempotencyKey := c.GetHeader("Idempotency-Key")
+	idempotencyKey := h.idempotencyKey(c)
+
+	// Optional per-key retention override, bounded so clients can't pin entries in memory indefinitely
+	var idempotencyTTL time.Duration
+	if raw := c.GetHeader("Idempotency-TTL"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Idempotency-TTL: expected a positive number of seconds, got %q", raw)})
+			return
+		}
+		idempotencyTTL = min(time.Duration(seconds)*time.Second, h.maxIdempotencyTTL)
+	}
+
+	ctx := reliability.WithStageTimer(c.Request.Context(), timer)
+	var summary *reliability.DecisionSummary
+	if h.debugHeaders {
+		summary = reliability.NewDecisionSummary()
+		ctx = reliability.WithDecisionSummary(ctx, summary)
+	}
+	if idempotencyKey != "" {
+		ctx = reliability.WithIdempotencyKey(ctx, idempotencyKey)
+	}
+	if idempotencyTTL > 0 {
+		ctx = reliability.WithIdempotencyTTL(ctx, idempotencyTTL)
+	}
+
+	// Authenticated ops requests use the bulkhead's admin pool, so they get through while user traffic is shed
+	admin := false
+	if token := c.GetHeader("X-Admin-Token"); token != "" {
+		if !h.validAdminToken(token) {
+			respond(c, http.StatusUnauthorized, gin.H{"error": "invalid X-Admin-Token"})
+			return
+		}
+		ctx = reliability.WithAdmin(ctx)
+		admin = true
+	}
+
+	// Requests marked high priority may use reserved bulkhead capacity, but any client can set the header, so it only
+	// counts alongside a valid admin token; other callers are prioritized by PRIORITY_MERCHANTS alone
+	if strings.EqualFold(c.GetHeader("X-Priority"), "high") {
+		if admin {
+			ctx = reliability.WithPriority(ctx, reliability.PriorityHigh)
+		} else {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("priority.header_ignored", true))
+		}
+	}
 
 	// Create order with all reliability patterns applied
-	resp, err := h.orderService.CreateOrder(c.Request.Context(), req, idempotencyKey)
+	resp, err := h.orderService.CreateOrder(ctx, req, idempotencyKey)
+	c.Header("Server-Timing", timer.ServerTiming())
+	for name, value := range summary.Headers() {
+		c.Header(name, value)
+	}
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedCurrency), errors.Is(err, service.ErrIdempotencyConflict), errors.Is(err, service.ErrAmountPrecision),
+			errors.Is(err, service.ErrCallbacksDisabled):
+			respond(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case !respondOverCapacity(c, err):
+			respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Let clients reconciling retries tell a replay apart and see when the order was really created
+	if resp.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.Header("X-Original-Created-At", resp.CreatedAt)
+	}
+
+	respond(c, http.StatusOK, resp)
+}
+
+// ConfirmOrderRequest carries the challenge token issued with a stepup_required response
+type ConfirmOrderRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// ConfirmOrder handles POST /orders/:id/confirm, charging an order held for step-up authentication
+// Responds 404 if no challenge is pending (unknown, expired or already confirmed), 403 on a wrong token
+// and 409 if the order can no longer be charged
+func (h *OrderHandler) ConfirmOrder(c *gin.Context) {
+	var req ConfirmOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.orderService.ConfirmOrder(c.Request.Context(), c.Param("id"), req.ChallengeToken)
+	switch {
+	case errors.Is(err, service.ErrStepUpNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrStepUpInvalidToken):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case respondOverCapacity(c, err):
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -41,7 +216,155 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// validateSchema checks the raw body against the JSON Schema and restores it for binding
+// Responds with 400 and the full list of violations on failure
+func (h *OrderHandler) validateSchema(c *gin.Context) bool {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	violations, err := h.schemaValidator.Validate(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "request does not match schema",
+			"violations": violations,
+		})
+		return false
+	}
+	return true
+}
+
+const (
+	defaultListLimit = 20  // Orders per page when ?limit is omitted
+	maxListLimit     = 100 // Upper bound for ?limit so one page can't copy the whole store
+)
+
+// ListOrdersResponse is one page of GET /orders
+type ListOrdersResponse struct {
+	Orders     []service.Order `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Pass as ?cursor for the next page; absent on the last page
+}
+
+// ListOrders handles GET /orders?limit=&cursor=, returning recent orders newest first with cursor pagination
+// Responds 400 on a non-positive limit or a cursor it didn't issue; limits above maxListLimit are capped
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	limit := defaultListLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(n, maxListLimit)
+	}
+
+	orders, next, err := h.orderService.ListOrders(limit, c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ListOrdersResponse{Orders: orders, NextCursor: next})
+}
+
+// GetOrder handles GET /orders/:id, returning the order's current lifecycle state or 404
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	order, err := h.orderService.GetOrder(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder handles POST /orders/:id/cancel, cancelling an order that hasn't been charged yet
+// Responds with the tombstoned order, 404 for an unknown order and 409 once charging has begun
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	order, err := h.orderService.CancelOrder(c.Request.Context(), c.Param("id"))
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// SLO handles GET /slo, reporting error-budget burn rate for SRE dashboards
+func (h *OrderHandler) SLO(c *gin.Context) {
+	c.JSON(http.StatusOK, h.orderService.SLOStatus())
+}
+
 // Health handles GET /health for health checks
 func (h *OrderHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 }
+
+// Ready handles GET /ready, reporting ready only when the payment service is reachable
+// The downstream result is cached, so frequent probes don't hammer the payment service
+func (h *OrderHandler) Ready(c *gin.Context) {
+	payment := h.orderService.PaymentHealth(c.Request.Context())
+
+	status := http.StatusOK
+	if !payment.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"ready":   payment.Healthy,
+		"payment": payment,
+	})
+}
+
+// rejectInvalidAmount responds 422 if the amount is NaN, infinite or negative zero
+func rejectInvalidAmount(c *gin.Context, amount float64) bool {
+	if err := service.ValidateAmount(amount); err != nil {
+		respond(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// idempotencyKey returns the value of the first configured idempotency header present on the request
+// Clients disagree on the name (Idempotency-Key, X-Idempotency-Key, Idempotency-ID), so the list is ordered by precedence
+func (h *OrderHandler) idempotencyKey(c *gin.Context) string {
+	for _, name := range h.idempotencyHeaders {
+		if key := c.GetHeader(name); key != "" {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("idempotency.header", name))
+			return key
+		}
+	}
+	return ""
+}
+
+// respondOverCapacity answers 503 when the bulkhead shed the request, telling the client when to retry
+// and, if it was queued, where it stood, so it can decide between waiting and going elsewhere
+func respondOverCapacity(c *gin.Context, err error) bool {
+	var overCapacity *reliability.OverCapacityError
+	if !errors.As(err, &overCapacity) {
+		return false
+	}
+
+	body := gin.H{
+		"error":          "over capacity",
+		"retry_after_ms": overCapacity.RetryAfter.Milliseconds(),
+		"queued":         overCapacity.Queued,
+		"queue_depth":    overCapacity.Depth,
+	}
+	if overCapacity.Queued {
+		body["queue_position"] = overCapacity.Position
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(overCapacity.RetryAfter.Seconds()))))
+	respond(c, http.StatusServiceUnavailable, body)
+	return true
+}
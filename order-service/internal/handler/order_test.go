@@ -0,0 +1,973 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/features"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// newCancelRouter serves the order routes with orders above 100 held for step-up, so they stay uncharged
+func newCancelRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"status":"success"}`)
+	}))
+	t.Cleanup(payment.Close)
+
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	cfg.StepUpThreshold = 100
+	h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/orders", h.CreateOrder)
+	router.POST("/orders/:id/cancel", h.CancelOrder)
+	router.GET("/orders", h.ListOrders)
+	router.GET("/orders/:id", h.GetOrder)
+	return router
+}
+
+func serveJSON(t *testing.T, router *gin.Engine, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     float64 // Of the order created first; above 100 it's held uncharged
+		cancelID   string  // Order to cancel; empty cancels the created order
+		cancels    int     // Times the order is cancelled
+		wantStatus int     // Of the last cancel
+		wantOrder  service.OrderStatus
+	}{
+		{name: "held order becomes a tombstone", amount: 500, cancels: 1, wantStatus: http.StatusOK, wantOrder: service.OrderCancelled},
+		{name: "second cancel conflicts", amount: 500, cancels: 2, wantStatus: http.StatusConflict, wantOrder: service.OrderCancelled},
+		{name: "charged order can't be cancelled", amount: 50, cancels: 1, wantStatus: http.StatusConflict, wantOrder: service.OrderCompleted},
+		{name: "unknown order", amount: 500, cancelID: "missing", cancels: 1, wantStatus: http.StatusNotFound, wantOrder: service.OrderCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCancelRouter(t)
+
+			var created service.CreateOrderResponse
+			body := `{"merchant_id":"merchant_123","amount":` + strconv.FormatFloat(tt.amount, 'f', -1, 64) + `,"currency":"USD"}`
+			if code := serveJSON(t, router, http.MethodPost, "/orders", body, &created); code != http.StatusOK && code != http.StatusCreated && code != http.StatusAccepted {
+				t.Fatalf("POST /orders = %d", code)
+			}
+			cancelID := tt.cancelID
+			if cancelID == "" {
+				cancelID = created.OrderID
+			}
+
+			var code int
+			for i := 0; i < tt.cancels; i++ {
+				code = serveJSON(t, router, http.MethodPost, "/orders/"+cancelID+"/cancel", "", nil)
+			}
+			if code != tt.wantStatus {
+				t.Errorf("POST /orders/%s/cancel = %d, want %d", cancelID, code, tt.wantStatus)
+			}
+
+			var order service.Order
+			if code := serveJSON(t, router, http.MethodGet, "/orders/"+created.OrderID, "", &order); code != http.StatusOK {
+				t.Fatalf("GET /orders/%s = %d", created.OrderID, code)
+			}
+			if order.Status != tt.wantOrder {
+				t.Errorf("status = %q, want %q", order.Status, tt.wantOrder)
+			}
+			if (order.PurgeAt != nil) != (tt.wantOrder == service.OrderCancelled) {
+				t.Errorf("purge_at = %v, want it set only on the tombstone", order.PurgeAt)
+			}
+		})
+	}
+}
+
+// msgpackOrder encodes an order whose amount is the given float64 bits, which JSON can't express for NaN and ±Inf
+func msgpackOrder(amountBits uint64) []byte {
+	buf := []byte{0x83} // Map of 3 entries
+	for _, s := range []string{"merchant_id", "merchant_123", "currency", "USD", "amount"} {
+		buf = append(buf, 0xa0|byte(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = append(buf, 0xcb) // float64
+	return binary.BigEndian.AppendUint64(buf, amountBits)
+}
+
+func TestCreateOrderRejectsNonFiniteAmounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+	}{
+		{name: "negative zero", contentType: "application/json",
+			body: []byte(`{"merchant_id":"merchant_123","amount":-0,"currency":"USD"}`), wantStatus: http.StatusUnprocessableEntity},
+		{name: "negative zero with decimals", contentType: "application/json",
+			body: []byte(`{"merchant_id":"merchant_123","amount":-0.00,"currency":"USD"}`), wantStatus: http.StatusUnprocessableEntity},
+		{name: "NaN string", contentType: "application/json",
+			body: []byte(`{"merchant_id":"merchant_123","amount":"NaN","currency":"USD"}`), wantStatus: http.StatusBadRequest},
+		{name: "bare NaN", contentType: "application/json",
+			body: []byte(`{"merchant_id":"merchant_123","amount":NaN,"currency":"USD"}`), wantStatus: http.StatusBadRequest},
+		// encoding/json reports the overflow but still stores +Inf, which gt=0 would pass
+		{name: "overflowing exponent", contentType: "application/json",
+			body: []byte(`{"merchant_id":"merchant_123","amount":1e400,"currency":"USD"}`), wantStatus: http.StatusUnprocessableEntity},
+		{name: "msgpack NaN", contentType: "application/msgpack",
+			body: msgpackOrder(math.Float64bits(math.NaN())), wantStatus: http.StatusUnprocessableEntity},
+		{name: "msgpack +Inf", contentType: "application/msgpack",
+			body: msgpackOrder(math.Float64bits(math.Inf(1))), wantStatus: http.StatusUnprocessableEntity},
+		{name: "finite amount accepted", contentType: "application/msgpack",
+			body: msgpackOrder(math.Float64bits(12.5)), wantStatus: http.StatusOK},
+	}
+	router := newCancelRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+// serverTiming parses a Server-Timing header into milliseconds per metric name
+func serverTiming(t *testing.T, header string) map[string]float64 {
+	t.Helper()
+	timings := make(map[string]float64)
+	for _, part := range strings.Split(header, ", ") {
+		name, dur, ok := strings.Cut(part, ";dur=")
+		ms, err := strconv.ParseFloat(dur, 64)
+		if !ok || err != nil {
+			t.Fatalf("malformed Server-Timing entry %q in %q", part, header)
+		}
+		timings[name] = ms
+	}
+	return timings
+}
+
+func TestCreateOrderServerTiming(t *testing.T) {
+	tests := []struct {
+		name       string
+		failFirst  bool // Payment answers the first attempt with a 503
+		wantStages []string
+	}{
+		{name: "single attempt", wantStages: []string{"validation", "bulkhead_wait", "attempt_1", "persist"}},
+		{name: "retried", failFirst: true, wantStages: []string{"validation", "bulkhead_wait", "attempt_1", "retry_backoff", "attempt_2", "persist"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 && tt.failFirst {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				time.Sleep(20 * time.Millisecond) // So the attempt dominates and the stages must add up to most of the total
+				io.WriteString(w, `{"status":"success"}`)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", h.CreateOrder)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":25,"currency":"USD"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+			}
+
+			timings := serverTiming(t, rec.Header().Get("Server-Timing"))
+			total, ok := timings["total"]
+			if !ok {
+				t.Fatalf("Server-Timing %q has no total", rec.Header().Get("Server-Timing"))
+			}
+			sum := 0.0
+			for _, stage := range tt.wantStages {
+				ms, ok := timings[stage]
+				if !ok {
+					t.Errorf("stage %s not recorded in %q", stage, rec.Header().Get("Server-Timing"))
+				}
+				sum += ms
+			}
+			if len(timings) != len(tt.wantStages)+1 {
+				t.Errorf("Server-Timing %q has stages beyond %v", rec.Header().Get("Server-Timing"), tt.wantStages)
+			}
+
+			// Each figure is rounded to 0.1ms, and handler work between stages is left unaccounted
+			slack := 0.05 * float64(len(timings))
+			if sum > total+slack || sum < 0.8*total {
+				t.Errorf("stages sum to %.1fms, want roughly the %.1fms total", sum, total)
+			}
+		})
+	}
+}
+
+func TestReplayKeepsOriginalCreatedAt(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		wantReplayed bool
+	}{
+		{name: "replay reports the original creation time", key: "client-key-1", wantReplayed: true},
+		{name: "no key creates a new order", wantReplayed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", h.CreateOrder)
+
+			// post creates the order, or replays it when sent with the same key
+			post := func() (*httptest.ResponseRecorder, service.CreateOrderResponse) {
+				req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`))
+				req.Header.Set("Content-Type", "application/json")
+				if tt.key != "" {
+					req.Header.Set("Idempotency-Key", tt.key)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				var resp service.CreateOrderResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+					t.Fatalf("POST /orders = %d %s", rec.Code, rec.Body)
+				}
+				return rec, resp
+			}
+
+			_, original := post()
+			// created_at has second resolution, so a replay stamped with its own time would differ
+			if tt.wantReplayed {
+				time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(1100 * time.Millisecond)))
+			}
+			rec, second := post()
+
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("Idempotent-Replayed = %q, want replayed %v", rec.Header().Get("Idempotent-Replayed"), tt.wantReplayed)
+			}
+			if !tt.wantReplayed {
+				if second.OrderID == original.OrderID || rec.Header().Get("X-Original-Created-At") != "" {
+					t.Errorf("unkeyed repeat = %+v with X-Original-Created-At %q, want a new order", second, rec.Header().Get("X-Original-Created-At"))
+				}
+				return
+			}
+			if second.OrderID != original.OrderID {
+				t.Errorf("replayed order %s, want %s", second.OrderID, original.OrderID)
+			}
+			if second.CreatedAt != original.CreatedAt {
+				t.Errorf("replayed created_at = %s, want the original %s", second.CreatedAt, original.CreatedAt)
+			}
+			if got := rec.Header().Get("X-Original-Created-At"); got != original.CreatedAt {
+				t.Errorf("X-Original-Created-At = %q, want %q", got, original.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestIdempotencyHeaderNames(t *testing.T) {
+	alternates := []string{"Idempotency-Key", "X-Idempotency-Key", "Idempotency-ID"}
+	tests := []struct {
+		name          string
+		headerNames   []string
+		first, second map[string]string // Headers on two otherwise identical requests
+		wantReplayed  bool
+	}{
+		{name: "Idempotency-Key honored", headerNames: alternates,
+			first: map[string]string{"Idempotency-Key": "k1"}, second: map[string]string{"Idempotency-Key": "k1"}, wantReplayed: true},
+		{name: "X-Idempotency-Key honored", headerNames: alternates,
+			first: map[string]string{"X-Idempotency-Key": "k1"}, second: map[string]string{"X-Idempotency-Key": "k1"}, wantReplayed: true},
+		{name: "Idempotency-ID honored", headerNames: alternates,
+			first: map[string]string{"Idempotency-ID": "k1"}, second: map[string]string{"Idempotency-ID": "k1"}, wantReplayed: true},
+		{name: "same key under another name is the same key", headerNames: alternates,
+			first: map[string]string{"Idempotency-ID": "k1"}, second: map[string]string{"Idempotency-Key": "k1"}, wantReplayed: true},
+		{name: "first listed header wins", headerNames: alternates,
+			first:  map[string]string{"Idempotency-Key": "k1", "X-Idempotency-Key": "k2"},
+			second: map[string]string{"X-Idempotency-Key": "k1"}, wantReplayed: true},
+		{name: "later header ignored when an earlier one is present", headerNames: alternates,
+			first:  map[string]string{"Idempotency-Key": "k1", "X-Idempotency-Key": "k2"},
+			second: map[string]string{"X-Idempotency-Key": "k2"}, wantReplayed: false},
+		{name: "unlisted header ignored by default", headerNames: []string{"Idempotency-Key"},
+			first: map[string]string{"X-Idempotency-Key": "k1"}, second: map[string]string{"X-Idempotency-Key": "k1"}, wantReplayed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.IdempotencyHeaders = tt.headerNames
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", h.CreateOrder)
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			post := func(headers map[string]string) (string, bool) {
+				req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`))
+				req.Header.Set("Content-Type", "application/json")
+				for name, value := range headers {
+					req.Header.Set(name, value)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				var order service.CreateOrderResponse
+				if err := json.NewDecoder(resp.Body).Decode(&order); err != nil || resp.StatusCode != http.StatusOK {
+					t.Fatalf("POST /orders = %d, %v", resp.StatusCode, err)
+				}
+				return order.OrderID, resp.Header.Get("Idempotent-Replayed") == "true"
+			}
+
+			firstID, _ := post(tt.first)
+			secondID, replayed := post(tt.second)
+			if replayed != tt.wantReplayed || (secondID == firstID) != tt.wantReplayed {
+				t.Errorf("second order %s replayed %v (first %s), want replayed %v", secondID, replayed, firstID, tt.wantReplayed)
+			}
+		})
+	}
+}
+
+func TestCreateOrderOverCapacityBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		queuedAhead  int           // Requests left waiting for the slot ahead of the shed one
+		deadline     time.Duration // How long the shed request may wait; 0 has given up before arriving
+		wantQueued   bool
+		wantPosition int64
+	}{
+		{name: "shed without queuing", deadline: 0},
+		{name: "shed from the head of the queue", deadline: 50 * time.Millisecond, wantQueued: true, wantPosition: 1},
+		{name: "shed from behind another waiter", queuedAhead: 1, deadline: 50 * time.Millisecond, wantQueued: true, wantPosition: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first charge holds the only bulkhead slot until the test ends
+			holding, release := make(chan struct{}), make(chan struct{})
+			var charges atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if charges.Add(1) == 1 {
+					close(holding)
+					<-release
+				}
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.CallTimeout = 5 * time.Second
+			cfg.Payment.ClientTimeout = 5 * time.Second
+			cfg.Bulkhead.MaxConcurrent = 1
+			cfg.Bulkhead.MinRetryAfter = 250 * time.Millisecond
+			cfg.SkipCancelled = false // So a request that has already given up reaches the bulkhead
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			// Stands in for a client deadline, which is what ends a wait in the bulkhead queue
+			router.Use(func(c *gin.Context) {
+				if raw := c.GetHeader("X-Test-Deadline-Ms"); raw != "" {
+					ms, _ := strconv.Atoi(raw)
+					ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(ms)*time.Millisecond)
+					defer cancel()
+					c.Request = c.Request.WithContext(ctx)
+				}
+				c.Next()
+			})
+			router.POST("/orders", h.CreateOrder)
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			post := func(deadline time.Duration) *http.Response {
+				req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Test-Deadline-Ms", strconv.Itoa(int(deadline.Milliseconds())))
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Error(err)
+					return nil
+				}
+				return resp
+			}
+
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			defer close(release)
+			wg.Add(1 + tt.queuedAhead)
+			go func() {
+				defer wg.Done()
+				if resp := post(10 * time.Second); resp != nil {
+					resp.Body.Close()
+				}
+			}()
+			<-holding
+			for i := 0; i < tt.queuedAhead; i++ {
+				go func() {
+					defer wg.Done()
+					if resp := post(10 * time.Second); resp != nil {
+						resp.Body.Close()
+					}
+				}()
+			}
+			time.Sleep(100 * time.Millisecond) // Lets the waiters ahead join the queue
+
+			resp := post(tt.deadline)
+			if resp == nil {
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want 503", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Retry-After"); got != "1" {
+				t.Errorf("Retry-After = %q, want 1 (250ms rounded up)", got)
+			}
+			var body struct {
+				Error         string `json:"error"`
+				RetryAfterMs  int64  `json:"retry_after_ms"`
+				Queued        bool   `json:"queued"`
+				QueueDepth    *int64 `json:"queue_depth"`
+				QueuePosition *int64 `json:"queue_position"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != "over capacity" || body.RetryAfterMs < 250 {
+				t.Errorf("error %q retry_after_ms %d, want over capacity after at least 250ms", body.Error, body.RetryAfterMs)
+			}
+			if body.Queued != tt.wantQueued {
+				t.Errorf("queued = %v, want %v", body.Queued, tt.wantQueued)
+			}
+			if body.QueueDepth == nil || *body.QueueDepth != int64(tt.queuedAhead) {
+				t.Errorf("queue_depth = %v, want %d still waiting", body.QueueDepth, tt.queuedAhead)
+			}
+			switch {
+			case !tt.wantQueued && body.QueuePosition != nil:
+				t.Errorf("queue_position = %d, want it absent when never queued", *body.QueuePosition)
+			case tt.wantQueued && (body.QueuePosition == nil || *body.QueuePosition != tt.wantPosition):
+				t.Errorf("queue_position = %v, want %d", body.QueuePosition, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestCreateOrderCurrencyFallbackStatus(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		wantStatus       int
+		wantSubstitution bool
+	}{
+		{name: "supported", body: `{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`, wantStatus: http.StatusOK},
+		{name: "converted to the fallback", body: `{"merchant_id":"fallback_ok","amount":10,"currency":"GBP"}`,
+			wantStatus: http.StatusOK, wantSubstitution: true},
+		{name: "unsupported and not opted in", body: `{"merchant_id":"merchant_123","amount":10,"currency":"GBP"}`,
+			wantStatus: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.SupportedCurrencies = []string{"USD"}
+			cfg.FallbackCurrency = "USD"
+			cfg.ExchangeRates = map[string]float64{"GBP": 1.27}
+			cfg.FeatureFlags = map[string][]features.Flag{"fallback_ok": {features.CurrencyFallback}}
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", h.CreateOrder)
+
+			var order service.CreateOrderResponse
+			if status := serveJSON(t, router, http.MethodPost, "/orders", tt.body, &order); status != tt.wantStatus {
+				t.Fatalf("POST /orders = %d, want %d", status, tt.wantStatus)
+			}
+			if (order.Substitution != nil) != tt.wantSubstitution {
+				t.Errorf("currency_substitution = %+v, want present %v", order.Substitution, tt.wantSubstitution)
+			}
+		})
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedFile := func(t *testing.T, ids ...int) string {
+		t.Helper()
+		var records []map[string]any
+		for _, i := range ids {
+			records = append(records, map[string]any{
+				"order_id": fmt.Sprintf("o%d", i), "merchant_id": "merchant_123", "amount": 10, "currency": "USD",
+				"status": "completed", "created_at": created.Add(time.Duration(i) * time.Minute),
+			})
+		}
+		data, _ := json.Marshal(records)
+		path := filepath.Join(t.TempDir(), "orders.json")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name          string
+		seed          []int // Orders created i minutes after the start
+		limit         string
+		insertBetween int // Order seeded after the first page; 0 for none
+		wantPages     [][]string
+	}{
+		{name: "empty store", limit: "2", wantPages: [][]string{{}}},
+		{name: "first page then the rest by cursor", seed: []int{1, 2, 3, 4, 5}, limit: "2",
+			wantPages: [][]string{{"o5", "o4"}, {"o3", "o2"}, {"o1"}}},
+		{name: "one page holds everything", seed: []int{1, 2, 3}, limit: "10", wantPages: [][]string{{"o3", "o2", "o1"}}},
+		{name: "default limit", seed: []int{1, 2}, wantPages: [][]string{{"o2", "o1"}}},
+		{name: "newer order inserted between pages doesn't shift them", seed: []int{1, 2, 3, 4, 5}, limit: "2", insertBetween: 6,
+			wantPages: [][]string{{"o5", "o4"}, {"o3", "o2"}, {"o1"}}},
+		{name: "older order inserted between pages shows up in order", seed: []int{2, 3, 4, 5}, limit: "2", insertBetween: 1,
+			wantPages: [][]string{{"o5", "o4"}, {"o3", "o2"}, {"o1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			svc := service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard))
+			if len(tt.seed) > 0 {
+				if _, err := svc.SeedOrders(seedFile(t, tt.seed...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h, err := NewOrderHandler(svc, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/orders", h.ListOrders)
+
+			cursor := ""
+			for i, want := range tt.wantPages {
+				query := url.Values{}
+				if tt.limit != "" {
+					query.Set("limit", tt.limit)
+				}
+				if cursor != "" {
+					query.Set("cursor", cursor)
+				}
+				var page ListOrdersResponse
+				if status := serveJSON(t, router, http.MethodGet, "/orders?"+query.Encode(), "", &page); status != http.StatusOK {
+					t.Fatalf("page %d: GET /orders = %d, want 200", i+1, status)
+				}
+				got := []string{}
+				for _, order := range page.Orders {
+					got = append(got, order.ID)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("page %d = %v, want %v", i+1, got, want)
+				}
+				if last := i == len(tt.wantPages)-1; (page.NextCursor == "") != last {
+					t.Fatalf("page %d next_cursor = %q, want one only before the last page", i+1, page.NextCursor)
+				}
+				cursor = page.NextCursor
+
+				if i == 0 && tt.insertBetween != 0 {
+					if _, err := svc.SeedOrders(seedFile(t, tt.insertBetween)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestListOrdersRejectsBadParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "zero limit", query: "limit=0"},
+		{name: "negative limit", query: "limit=-3"},
+		{name: "non-numeric limit", query: "limit=ten"},
+		{name: "cursor that isn't base64", query: "cursor=***"},
+		{name: "cursor without a position", query: "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("o1"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCancelRouter(t)
+			if status := serveJSON(t, router, http.MethodGet, "/orders?"+tt.query, "", nil); status != http.StatusBadRequest {
+				t.Errorf("GET /orders?%s = %d, want 400", tt.query, status)
+			}
+		})
+	}
+}
+
+func TestAdminBypassesSaturatedBulkhead(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminSlots int64
+		token      string // X-Admin-Token sent with the order
+		wantStatus int
+	}{
+		{name: "user traffic is shed", adminSlots: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "admin request proceeds", adminSlots: 1, token: "ops-token", wantStatus: http.StatusOK},
+		{name: "wrong token is refused", adminSlots: 1, token: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "no admin pool sheds admin too", token: "ops-token", wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first charge holds the only user slot until the test ends
+			release := make(chan struct{})
+			holding := make(chan struct{})
+			var calls atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					close(holding)
+					<-release
+				}
+			}))
+			defer payment.Close()
+			defer close(release)
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.ClientTimeout = 10 * time.Second
+			cfg.Payment.CallTimeout = 10 * time.Second
+			cfg.Bulkhead.MaxConcurrent = 1
+			cfg.Bulkhead.AdminSlots = tt.adminSlots
+			cfg.AdminToken = "ops-token"
+			orders := service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard))
+			h, err := NewOrderHandler(orders, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go orders.CreateOrder(context.Background(), service.CreateOrderRequest{MerchantID: "merchant_456", Amount: 25, Currency: "USD"}, "")
+			<-holding
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			// Queued requests wait out their deadline before being shed; keep it short
+			router.Use(func(c *gin.Context) {
+				ctx, cancel := context.WithTimeout(c.Request.Context(), 200*time.Millisecond)
+				defer cancel()
+				c.Request = c.Request.WithContext(ctx)
+				c.Next()
+			})
+			router.POST("/orders", h.CreateOrder)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":25,"currency":"USD"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("X-Admin-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("POST /orders = %d %q, want %d", rec.Code, rec.Body.String(), tt.wantStatus)
+			}
+			if got := calls.Load(); tt.wantStatus == http.StatusOK && got != 2 {
+				t.Errorf("payment calls = %d, want the admin charge alongside the held one", got)
+			}
+		})
+	}
+}
+
+func TestDebugHeadersSummarizeDecisions(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		failFirst   int32 // Payment attempts answered 503 before it recovers
+		breakAfter  uint32
+		holdSlot    bool              // Another charge holds the only bulkhead slot briefly, so the order queues
+		wantHeaders map[string]string // Missing from the response when ""
+	}{
+		{name: "disabled", failFirst: 2,
+			wantHeaders: map[string]string{"X-Retry-Count": "", "X-CB-State": "", "X-Bulkhead-Queued": ""}},
+		{name: "retries counted", enabled: true, failFirst: 2,
+			wantHeaders: map[string]string{"X-Retry-Count": "2", "X-CB-State": "closed", "X-Bulkhead-Queued": "0"}},
+		{name: "clean first attempt", enabled: true,
+			wantHeaders: map[string]string{"X-Retry-Count": "0", "X-CB-State": "closed", "X-Bulkhead-Queued": "0"}},
+		{name: "open breaker reported", enabled: true, failFirst: 100, breakAfter: 1,
+			wantHeaders: map[string]string{"X-Retry-Count": "0", "X-CB-State": "open", "X-Bulkhead-Queued": "0"}},
+		{name: "bulkhead wait counted", enabled: true, holdSlot: true,
+			wantHeaders: map[string]string{"X-Retry-Count": "0", "X-CB-State": "closed", "X-Bulkhead-Queued": "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			held := make(chan struct{})
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Idempotency-Key") == "order:held" {
+					close(held)
+					time.Sleep(50 * time.Millisecond)
+					return
+				}
+				if attempts.Add(1) <= tt.failFirst {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.DebugHeaders = tt.enabled
+			cfg.Retry.MaxAttempts = 3
+			cfg.Retry.InitialBackoff = time.Millisecond
+			cfg.Retry.MaxBackoff = time.Millisecond
+			cfg.Bulkhead.MaxConcurrent = 1
+			if tt.breakAfter > 0 {
+				cfg.CircuitBreaker.ConsecutiveFailures = tt.breakAfter
+			}
+			orders := service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard))
+			h, err := NewOrderHandler(orders, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.breakAfter > 0 {
+				orders.CreateOrder(context.Background(), service.CreateOrderRequest{MerchantID: "merchant_456", Amount: 25, Currency: "USD"}, "")
+			}
+			if tt.holdSlot {
+				go orders.CreateOrder(context.Background(), service.CreateOrderRequest{MerchantID: "merchant_456", Amount: 25, Currency: "USD"}, "held")
+				<-held
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", h.CreateOrder)
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"merchant_id":"merchant_123","amount":25,"currency":"USD"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			for name, want := range tt.wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeededOrdersRetrievable(t *testing.T) {
+	const seed = `[
+		{"order_id": "seed-created", "merchant_id": "merchant_123", "amount": 12.5, "currency": "USD"},
+		{"order_id": "seed-done", "merchant_id": "merchant_456", "amount": 99, "currency": "EUR", "status": "completed",
+			"created_at": "2024-03-01T10:00:00Z"},
+		{"order_id": "seed-no-merchant", "amount": 5, "currency": "USD"},
+		{"order_id": "seed-negative", "merchant_id": "merchant_123", "amount": -5, "currency": "USD"},
+		{"order_id": "seed-charging", "merchant_id": "merchant_123", "amount": 5, "currency": "USD", "status": "payment_pending"},
+		{"order_id": "seed-done", "merchant_id": "merchant_789", "amount": 1, "currency": "USD"},
+		"not an order",
+		{"order_id": 42, "merchant_id": "merchant_123", "amount": 5, "currency": "USD"}
+	]`
+	path := filepath.Join(t.TempDir(), "orders.json")
+	if err := os.WriteFile(path, []byte(seed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer payment.Close()
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	svc := service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard))
+	if n, err := svc.SeedOrders(path); err != nil || n != 2 {
+		t.Fatalf("SeedOrders() = %d, %v; want the 2 valid records", n, err)
+	}
+	// Only a file that isn't an array of records fails outright
+	notArray := filepath.Join(t.TempDir(), "order.json")
+	if err := os.WriteFile(notArray, []byte(`{"order_id": "seed-lone"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SeedOrders(notArray); err == nil {
+		t.Error("SeedOrders() accepted a file that isn't a JSON array")
+	}
+	h, err := NewOrderHandler(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders/:id", h.GetOrder)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tests := []struct {
+		id         string
+		wantStatus int
+		want       service.Order // Compared on ID, merchant, amount, currency and status
+		wantAt     string        // created_at, if the record set one
+	}{
+		{id: "seed-created", wantStatus: http.StatusOK,
+			want: service.Order{ID: "seed-created", MerchantID: "merchant_123", Amount: 12.5, Currency: "USD", Status: service.OrderCreated}},
+		{id: "seed-done", wantStatus: http.StatusOK, wantAt: "2024-03-01T10:00:00Z",
+			want: service.Order{ID: "seed-done", MerchantID: "merchant_456", Amount: 99, Currency: "EUR", Status: service.OrderCompleted}},
+		{id: "seed-no-merchant", wantStatus: http.StatusNotFound},
+		{id: "seed-negative", wantStatus: http.StatusNotFound},
+		{id: "seed-charging", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/orders/" + tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("GET /orders/%s = %d, want %d", tt.id, resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got service.Order
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != tt.want.ID || got.MerchantID != tt.want.MerchantID || got.Amount != tt.want.Amount ||
+				got.Currency != tt.want.Currency || got.Status != tt.want.Status {
+				t.Errorf("GET /orders/%s = %+v, want %+v", tt.id, got, tt.want)
+			}
+			if tt.wantAt != "" && got.CreatedAt.Format(time.RFC3339) != tt.wantAt {
+				t.Errorf("created_at = %v, want %s from the seed file", got.CreatedAt, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestPriorityHeaderRequiresTrust(t *testing.T) {
+	tests := []struct {
+		name       string
+		merchantID string
+		priority   string // X-Priority header
+		token      string // X-Admin-Token header
+		wantStatus int
+	}{
+		{name: "self-declared high priority is shed", merchantID: "merchant_123", priority: "high", wantStatus: http.StatusServiceUnavailable},
+		{name: "high priority with an admin token takes a reserved slot", merchantID: "merchant_123", priority: "high", token: "ops-token",
+			wantStatus: http.StatusOK},
+		{name: "priority merchant takes a reserved slot", merchantID: "merchant_vip", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first charge holds the only shared slot until the test ends, leaving just the reserved one
+			release := make(chan struct{})
+			holding := make(chan struct{})
+			var calls atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					close(holding)
+					<-release
+				}
+			}))
+			defer payment.Close()
+			defer close(release)
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.ClientTimeout = 10 * time.Second
+			cfg.Payment.CallTimeout = 10 * time.Second
+			cfg.Bulkhead.MaxConcurrent = 2
+			cfg.Bulkhead.ReservedFraction = 0.5
+			cfg.Bulkhead.AdminSlots = 0 // So an admin request competes for the user pools
+			cfg.AdminToken = "ops-token"
+			cfg.PriorityMerchants = []string{"merchant_vip"}
+			orders := service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard))
+			h, err := NewOrderHandler(orders, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go orders.CreateOrder(context.Background(), service.CreateOrderRequest{MerchantID: "merchant_456", Amount: 25, Currency: "USD"}, "")
+			<-holding
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			// Queued requests wait out their deadline before being shed; keep it short
+			router.Use(func(c *gin.Context) {
+				ctx, cancel := context.WithTimeout(c.Request.Context(), 200*time.Millisecond)
+				defer cancel()
+				c.Request = c.Request.WithContext(ctx)
+				c.Next()
+			})
+			router.POST("/orders", h.CreateOrder)
+
+			body := `{"merchant_id":"` + tt.merchantID + `","amount":25,"currency":"USD"}`
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.priority != "" {
+				req.Header.Set("X-Priority", tt.priority)
+			}
+			if tt.token != "" {
+				req.Header.Set("X-Admin-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("POST /orders = %d %q, want %d", rec.Code, rec.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+}
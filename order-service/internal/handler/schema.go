@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// defaultOrderSchema is used when no schema file is configured
+//
+//go:embed schemas/create_order.schema.json
+var defaultOrderSchema string
+
+// SchemaValidator applies strict JSON Schema validation to raw request bodies
+// Unlike struct binding, it can reject unknown fields and enforce formats
+type SchemaValidator struct {
+	schema *jsonschema.Schema
+}
+
+// SchemaViolation describes a single failed schema constraint
+type SchemaViolation struct {
+	Field   string `json:"field"`   // JSON pointer to the offending value, e.g. "/currency"
+	Keyword string `json:"keyword"` // Schema location of the failed keyword
+	Message string `json:"message"`
+}
+
+// NewSchemaValidator compiles the schema at path, or the embedded order schema if path is empty
+func NewSchemaValidator(path string) (*SchemaValidator, error) {
+	source := defaultOrderSchema
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		source = string(data)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	if err := compiler.AddResource("order.schema.json", bytes.NewReader([]byte(source))); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	schema, err := compiler.Compile("order.schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return &SchemaValidator{schema: schema}, nil
+}
+
+// Validate checks body against the schema, returning every violated constraint
+func (v *SchemaValidator) Validate(body []byte) ([]SchemaViolation, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Preserve number precision for schema checks
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	err := v.schema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	collectViolations(validationErr, &violations)
+	return violations, nil
+}
+
+// collectViolations flattens the error tree into its leaf causes, which name the actual failures
+func collectViolations(err *jsonschema.ValidationError, out *[]SchemaViolation) {
+	if len(err.Causes) == 0 {
+		*out = append(*out, SchemaViolation{
+			Field:   err.InstanceLocation,
+			Keyword: err.KeywordLocation,
+			Message: err.Message,
+		})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectViolations(cause, out)
+	}
+}
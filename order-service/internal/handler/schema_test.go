@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStrictSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantStatus    int
+		wantViolation string // Field of a reported violation; the root object's is ""
+	}{
+		{name: "valid payload", body: `{"merchant_id":"merchant_123","amount":25.5,"currency":"USD"}`, wantStatus: http.StatusOK},
+		{name: "extra field", body: `{"merchant_id":"merchant_123","amount":25.5,"currency":"USD","discount":5}`,
+			wantStatus: http.StatusBadRequest, wantViolation: ""},
+		{name: "lowercase currency", body: `{"merchant_id":"merchant_123","amount":25.5,"currency":"usd"}`,
+			wantStatus: http.StatusBadRequest, wantViolation: "/currency"},
+		{name: "plain http callback", body: `{"merchant_id":"merchant_123","amount":25.5,"currency":"USD","callback_url":"http://example.com"}`,
+			wantStatus: http.StatusBadRequest, wantViolation: "/callback_url"},
+	}
+
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status":"approved"}`)
+	}))
+	defer payment.Close()
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	cfg.StrictSchemaValidation = true
+	h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/orders", h.CreateOrder)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+			var resp struct {
+				Violations []SchemaViolation `json:"violations"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range resp.Violations {
+				if v.Field == tt.wantViolation {
+					return
+				}
+			}
+			t.Errorf("violations = %+v, want one at %q", resp.Violations, tt.wantViolation)
+		})
+	}
+}
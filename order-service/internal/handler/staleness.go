@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RejectStale refuses requests whose X-Request-Timestamp is older than maxAge with 410 Gone,
+// e.g. orders that sat in a client's retry queue until their context no longer makes sense
+// Requests without the header, and all requests when maxAge is 0, pass through
+// The timestamp may be Unix milliseconds or RFC 3339; a malformed value is rejected with 400
+func RejectStale(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader("X-Request-Timestamp")
+		if maxAge <= 0 || raw == "" {
+			c.Next()
+			return
+		}
+
+		sent, err := parseRequestTimestamp(raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		span := trace.SpanFromContext(c.Request.Context())
+		age := time.Since(sent)
+		span.SetAttributes(attribute.Int64("request.age_ms", age.Milliseconds()))
+
+		if age > maxAge {
+			span.SetAttributes(attribute.Bool("request.stale", true))
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{
+				"error": fmt.Sprintf("request too old: sent %s ago, maximum age is %s", age.Round(time.Millisecond), maxAge),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// parseRequestTimestamp accepts Unix milliseconds or an RFC 3339 time
+func parseRequestTimestamp(raw string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("X-Request-Timestamp: expected Unix milliseconds or RFC 3339, got %q", raw)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRejectStale(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		maxAge      time.Duration
+		timestamp   string
+		wantStatus  int
+		wantHandled bool
+	}{
+		{name: "fresh Unix milliseconds", maxAge: time.Minute, timestamp: strconv.FormatInt(now.Add(-time.Second).UnixMilli(), 10), wantStatus: http.StatusOK, wantHandled: true},
+		{name: "fresh RFC 3339", maxAge: time.Minute, timestamp: now.Add(-time.Second).Format(time.RFC3339Nano), wantStatus: http.StatusOK, wantHandled: true},
+		{name: "stale Unix milliseconds", maxAge: time.Minute, timestamp: strconv.FormatInt(now.Add(-2*time.Minute).UnixMilli(), 10), wantStatus: http.StatusGone},
+		{name: "stale RFC 3339", maxAge: time.Minute, timestamp: now.Add(-time.Hour).Format(time.RFC3339), wantStatus: http.StatusGone},
+		{name: "no header", maxAge: time.Minute, wantStatus: http.StatusOK, wantHandled: true},
+		{name: "check disabled", timestamp: strconv.FormatInt(now.Add(-time.Hour).UnixMilli(), 10), wantStatus: http.StatusOK, wantHandled: true},
+		{name: "malformed timestamp", maxAge: time.Minute, timestamp: "yesterday", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders", RejectStale(tt.maxAge), func(c *gin.Context) {
+				handled = true
+				c.Status(http.StatusOK)
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", nil)
+			if tt.timestamp != "" {
+				req.Header.Set("X-Request-Timestamp", tt.timestamp)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handler ran = %v, want %v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
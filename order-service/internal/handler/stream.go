@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxStreamLineBytes bounds a single NDJSON line so one oversized record can't exhaust memory
+const maxStreamLineBytes = 64 << 10
+
+// StreamResult is the per-line outcome written back by POST /orders/stream
+type StreamResult struct {
+	Line           int    `json:"line"`
+	OrderID        string `json:"order_id,omitempty"`
+	Status         string `json:"status"` // "completed", "stepup_required" or "error"
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// StreamOrders handles POST /orders/stream for bulk ingestion of newline-delimited JSON orders
+// Orders are processed as they arrive with bounded concurrency and results are streamed back as NDJSON,
+// so memory stays flat regardless of batch size. Results may arrive out of order; match them by line
+// Malformed lines are reported individually and don't stop the stream
+func (h *OrderHandler) StreamOrders(c *gin.Context) {
+	// HTTP/1.x servers stop reading the request body once the response starts unless full duplex is enabled
+	_ = http.NewResponseController(c.Writer).EnableFullDuplex()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	results := make(chan StreamResult)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		enc := json.NewEncoder(c.Writer)
+		for result := range results {
+			_ = enc.Encode(result)
+			c.Writer.Flush()
+		}
+	}()
+
+	// Acquiring a slot before reading the next line applies backpressure to the client
+	slots := make(chan struct{}, h.streamConcurrency)
+	var wg sync.WaitGroup
+
+	ctx := c.Request.Context()
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamLineBytes)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		req, err := decodeStreamOrder(raw)
+		if err != nil {
+			results <- StreamResult{Line: line, Status: "error", Error: err.Error()}
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(line int, req service.CreateOrderRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			resp, err := h.orderService.CreateOrder(ctx, req, "")
+			if err != nil {
+				results <- StreamResult{Line: line, Status: "error", Error: err.Error()}
+				return
+			}
+			results <- StreamResult{Line: line, OrderID: resp.OrderID, Status: resp.Status, ChallengeToken: resp.ChallengeToken}
+		}(line, req)
+	}
+
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		// Oversized line or broken connection: nothing after this point can be read
+		results <- StreamResult{Line: line + 1, Status: "error", Error: fmt.Sprintf("reading stream: %v", err)}
+	}
+	close(results)
+	<-written
+}
+
+// decodeStreamOrder parses and validates one NDJSON line with the same rules as POST /orders
+func decodeStreamOrder(raw []byte) (service.CreateOrderRequest, error) {
+	var req service.CreateOrderRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		if service.ValidateAmount(req.Amount) != nil {
+			return req, service.ErrInvalidAmount
+		}
+		return req, err
+	}
+	if err := service.ValidateAmount(req.Amount); err != nil {
+		return req, err
+	}
+	if req.CallbackURL != "" {
+		if err := service.ValidateCallbackURL(req.CallbackURL); err != nil {
+			return req, err
+		}
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
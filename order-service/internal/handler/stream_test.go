@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamOrders(t *testing.T) {
+	const order = `{"merchant_id":"merchant_123","amount":10,"currency":"USD"}`
+	tests := []struct {
+		name        string
+		lines       []string
+		want        map[int]string // Line number → result status; blank lines get no result
+		wantCharges int32
+	}{
+		{
+			name:        "malformed line reported, rest processed",
+			lines:       []string{order, order, `{"merchant_id":"merchant_123",`, order, order},
+			want:        map[int]string{1: "completed", 2: "completed", 3: "error", 4: "completed", 5: "completed"},
+			wantCharges: 4,
+		},
+		{
+			name:        "invalid orders reported",
+			lines:       []string{`{"merchant_id":"merchant_123","amount":-0,"currency":"USD"}`, `{"amount":5}`, order},
+			want:        map[int]string{1: "error", 2: "error", 3: "completed"},
+			wantCharges: 1,
+		},
+		{
+			name:        "blank lines skipped",
+			lines:       []string{order, "", "   ", order},
+			want:        map[int]string{1: "completed", 4: "completed"},
+			wantCharges: 2,
+		},
+		{
+			name:        "oversized line ends the stream",
+			lines:       []string{order, `{"merchant_id":"` + strings.Repeat("m", maxStreamLineBytes) + `"}`, order},
+			want:        map[int]string{1: "completed", 2: "error"},
+			wantCharges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var charges atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				charges.Add(1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.StreamConcurrency = 2
+			h, err := NewOrderHandler(service.NewOrderService(cfg, service.NewJSONAuditLogger(io.Discard)), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/orders/stream", h.StreamOrders)
+			// A real server, since streaming relies on reading the body while the response is written
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			resp, err := http.Post(server.URL+"/orders/stream", "application/x-ndjson", strings.NewReader(strings.Join(tt.lines, "\n")+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+				t.Fatalf("POST /orders/stream = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			got := make(map[int]StreamResult)
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var result StreamResult
+				if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+					t.Fatalf("decoding result %q: %v", scanner.Text(), err)
+				}
+				if _, dup := got[result.Line]; dup {
+					t.Errorf("line %d reported twice", result.Line)
+				}
+				got[result.Line] = result
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("got results for %d lines, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for line, status := range tt.want {
+				result := got[line]
+				if result.Status != status {
+					t.Errorf("line %d = %+v, want status %s", line, result, status)
+				}
+				if status == "error" && result.Error == "" {
+					t.Errorf("line %d error result has no message", line)
+				}
+				if status == "completed" && result.OrderID == "" {
+					t.Errorf("line %d completed without an order ID", line)
+				}
+			}
+			if got := charges.Load(); got != tt.wantCharges {
+				t.Errorf("charges = %d, want %d", got, tt.wantCharges)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/demo/order-service/internal/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name                       string
+		version, commit, buildTime string // Values stamped via ldflags; empty leaves the defaults
+		want                       buildinfo.Info
+	}{
+		{
+			name: "unstamped build",
+			want: buildinfo.Info{Service: "order-service", Version: "dev", Commit: "unknown", BuildTime: "unknown", GoVersion: runtime.Version()},
+		},
+		{
+			name:    "stamped build",
+			version: "1.4.0", commit: "0cdfb71", buildTime: "2026-10-16T09:30:00Z",
+			want: buildinfo.Info{Service: "order-service", Version: "1.4.0", Commit: "0cdfb71", BuildTime: "2026-10-16T09:30:00Z", GoVersion: runtime.Version()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.version != "" {
+				defer func(v, c, b string) { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = v, c, b }(buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime)
+				buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = tt.version, tt.commit, tt.buildTime
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/version", Version("order-service"))
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/version")
+			if err != nil {
+				t.Fatalf("GET /version: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			var got map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			want := map[string]string{
+				"service":    tt.want.Service,
+				"version":    tt.want.Version,
+				"commit":     tt.want.Commit,
+				"build_time": tt.want.BuildTime,
+				"go_version": tt.want.GoVersion,
+			}
+			for field, value := range want {
+				if got[field] != value {
+					t.Errorf("%s = %q, want %q", field, got[field], value)
+				}
+			}
+			if len(got) != len(want) {
+				t.Errorf("body has fields %v, want exactly %v", got, want)
+			}
+		})
+	}
+}
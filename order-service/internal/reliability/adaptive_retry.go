@@ -0,0 +1,114 @@
+package reliability
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// adaptiveBucketSize is the granularity of the adaptive retry window
+const adaptiveBucketSize = 1 * time.Second
+
+// AdaptiveRetryConfig turns retries off while the downstream is clearly down, since they only amplify load then
+// It works on the overall success rate, independent of any per-endpoint circuit breaker
+type AdaptiveRetryConfig struct {
+	Enabled      bool          `json:"enabled"`
+	Window       time.Duration `json:"window"`        // Rolling window the success rate is measured over
+	MinRequests  int64         `json:"min_requests"`  // Fewer attempts in the window never disable retries
+	DisableBelow float64       `json:"disable_below"` // Success rate under which retries are disabled
+	EnableAbove  float64       `json:"enable_above"`  // Success rate at which retries come back; above DisableBelow so the state doesn't flap
+}
+
+// DefaultAdaptiveRetryConfig returns adaptive disablement off, with thresholds suited to a clearly failing downstream
+func DefaultAdaptiveRetryConfig() AdaptiveRetryConfig {
+	return AdaptiveRetryConfig{
+		Enabled:      false,
+		Window:       30 * time.Second,
+		MinRequests:  20,
+		DisableBelow: 0.2,
+		EnableAbove:  0.5,
+	}
+}
+
+// AdaptiveRetry tracks attempt outcomes over a rolling window and decides whether retries are currently worthwhile
+// All methods are safe on a nil receiver, which always allows retries
+type AdaptiveRetry struct {
+	mu       sync.Mutex
+	cfg      AdaptiveRetryConfig
+	buckets  []sloBucket
+	disabled bool
+	now      func() time.Time
+}
+
+// NewAdaptiveRetry creates a tracker from cfg, or returns nil when adaptive disablement is off
+func NewAdaptiveRetry(cfg AdaptiveRetryConfig) *AdaptiveRetry {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &AdaptiveRetry{
+		cfg:     cfg,
+		buckets: make([]sloBucket, int(cfg.Window/adaptiveBucketSize)+1),
+		now:     time.Now,
+	}
+}
+
+// Record adds one attempt outcome and re-evaluates whether retries are disabled
+// healthy is false only for transient downstream failures, the ones a retry would be trying to ride out
+func (a *AdaptiveRetry) Record(healthy bool) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	epoch := a.now().UnixNano() / int64(adaptiveBucketSize)
+	b := &a.buckets[epoch%int64(len(a.buckets))]
+	if b.epoch != epoch {
+		// Bucket belongs to an older rotation of the ring; reset it
+		*b = sloBucket{epoch: epoch}
+	}
+	if healthy {
+		b.success++
+	} else {
+		b.errors++
+	}
+
+	requests, rate := a.successRate(epoch)
+	switch {
+	case !a.disabled && requests >= a.cfg.MinRequests && rate < a.cfg.DisableBelow:
+		a.disabled = true
+		log.Printf("Adaptive retry: disabling retries, success rate %.2f over the last %s", rate, a.cfg.Window)
+	case a.disabled && (requests < a.cfg.MinRequests || rate >= a.cfg.EnableAbove):
+		a.disabled = false
+		log.Printf("Adaptive retry: re-enabling retries, success rate %.2f over the last %s", rate, a.cfg.Window)
+	}
+}
+
+// State reports whether retries are disabled and the success rate they were judged on
+func (a *AdaptiveRetry) State() (disabled bool, successRate float64) {
+	if a == nil {
+		return false, 1
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, rate := a.successRate(a.now().UnixNano() / int64(adaptiveBucketSize))
+	return a.disabled, rate
+}
+
+// successRate sums the buckets inside the window ending at current; an empty window counts as fully healthy
+// Callers must hold mu
+func (a *AdaptiveRetry) successRate(current int64) (int64, float64) {
+	span := int64(a.cfg.Window / adaptiveBucketSize)
+	var success, errors int64
+	for _, b := range a.buckets {
+		if b.epoch > current-span && b.epoch <= current {
+			success += b.success
+			errors += b.errors
+		}
+	}
+	if success+errors == 0 {
+		return 0, 1
+	}
+	return success + errors, float64(success) / float64(success+errors)
+}
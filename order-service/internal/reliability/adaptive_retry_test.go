@@ -0,0 +1,84 @@
+package reliability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRetryDisablesOnLowSuccessRate(t *testing.T) {
+	type outcomes struct{ healthy, failed int }
+	tests := []struct {
+		name         string
+		before       outcomes      // Recorded first
+		elapsed      time.Duration // Clock moved on after before
+		after        outcomes      // Recorded once the clock has moved
+		wantDisabled bool          // State going into the call
+		wantAttempts int32
+	}{
+		{name: "low success rate disables retries", before: outcomes{healthy: 1, failed: 19}, wantDisabled: true, wantAttempts: 1},
+		{name: "healthy rate keeps retrying", before: outcomes{healthy: 18, failed: 2}, wantAttempts: 3},
+		{name: "too few requests to judge", before: outcomes{failed: 5}, wantAttempts: 3},
+		{name: "between the thresholds stays disabled", before: outcomes{healthy: 1, failed: 19}, after: outcomes{healthy: 8},
+			wantDisabled: true, wantAttempts: 1},
+		{name: "recovered rate re-enables retries", before: outcomes{healthy: 1, failed: 19}, after: outcomes{healthy: 30}, wantAttempts: 3},
+		{name: "failures aged out of the window", before: outcomes{healthy: 1, failed: 19}, elapsed: 11 * time.Second,
+			wantDisabled: true, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			now := time.Unix(1000, 0)
+			adaptive := NewAdaptiveRetry(AdaptiveRetryConfig{Enabled: true, Window: 10 * time.Second, MinRequests: 10, DisableBelow: 0.2, EnableAbove: 0.5})
+			adaptive.now = func() time.Time { return now }
+			record := func(o outcomes) {
+				for i := 0; i < o.healthy; i++ {
+					adaptive.Record(true)
+				}
+				for i := 0; i < o.failed; i++ {
+					adaptive.Record(false)
+				}
+			}
+			record(tt.before)
+			now = now.Add(tt.elapsed)
+			record(tt.after)
+
+			// Only Record re-evaluates, so an aged-out window still reads disabled until the next attempt
+			if disabled, _ := adaptive.State(); disabled != tt.wantDisabled {
+				t.Errorf("disabled before the call = %v, want %v", disabled, tt.wantDisabled)
+			}
+
+			span, attrs := recordedSpan(t)
+			cfg := RetryConfig{MaxAttempts: 3, Deterministic: true, SafeMethods: []string{http.MethodGet}, Adaptive: adaptive}
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			if resp != nil {
+				resp.Body.Close()
+				t.Errorf("got a %d response, want only an error once the call gives up", resp.StatusCode)
+			}
+			if err == nil || !strings.Contains(err.Error(), "downstream returned 503") {
+				t.Errorf("error = %v, want one carrying the last 503", err)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			recorded := attrs()
+			if got := recorded["retry.adaptive.disabled"].AsBool(); got != tt.wantDisabled {
+				t.Errorf("retry.adaptive.disabled = %v, want %v", got, tt.wantDisabled)
+			}
+			if got := recorded["retry.adaptive.skipped"].AsBool(); got != (tt.wantAttempts == 1) {
+				t.Errorf("retry.adaptive.skipped = %v, want %v", got, tt.wantAttempts == 1)
+			}
+		})
+	}
+}
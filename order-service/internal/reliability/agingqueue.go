@@ -0,0 +1,93 @@
+package reliability
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// agingQueue admits requests waiting for a slot in priority order rather than arrival order
+// A waiting request gains one priority level for every aging interval it has waited, so under sustained
+// high-priority load a normal request is still admitted once it has waited long enough
+type agingQueue struct {
+	pool  *semaphore.Weighted
+	aging time.Duration
+
+	mu      sync.Mutex
+	waiters []*agingWaiter // In arrival order
+}
+
+// agingWaiter is one request queued for a slot
+type agingWaiter struct {
+	priority Priority
+	enqueued time.Time
+	granted  chan struct{} // Closed once a slot has been handed to the waiter
+}
+
+// newAgingQueue creates a queue in front of pool; while anyone is queued, freed slots are handed over directly
+// instead of going back to pool, so arrivals taking pool's fast path can't barge ahead of the queue
+func newAgingQueue(pool *semaphore.Weighted, aging time.Duration) *agingQueue {
+	return &agingQueue{pool: pool, aging: aging}
+}
+
+// acquire takes a slot, queuing until one is handed over or ctx is done
+func (q *agingQueue) acquire(ctx context.Context, priority Priority) error {
+	q.mu.Lock()
+	// Checked under the lock so a slot released since the caller's fast path isn't missed
+	if q.pool.TryAcquire(1) {
+		q.mu.Unlock()
+		return nil
+	}
+	w := &agingWaiter{priority: priority, enqueued: time.Now(), granted: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-w.granted:
+			// Handed a slot just as we gave up: pass it on rather than leaking it
+			q.releaseLocked()
+		default:
+			q.waiters = slices.DeleteFunc(q.waiters, func(other *agingWaiter) bool { return other == w })
+		}
+		return ctx.Err()
+	}
+}
+
+// release hands a freed slot to the waiter with the highest effective priority, or returns it to the pool
+func (q *agingQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+func (q *agingQueue) releaseLocked() {
+	if len(q.waiters) == 0 {
+		q.pool.Release(1)
+		return
+	}
+	// Waiters are in arrival order, so a strict comparison favors the longest-waiting among equals
+	now := time.Now()
+	best := 0
+	for i := 1; i < len(q.waiters); i++ {
+		if q.effective(q.waiters[i], now) > q.effective(q.waiters[best], now) {
+			best = i
+		}
+	}
+	w := q.waiters[best]
+	q.waiters = slices.Delete(q.waiters, best, best+1)
+	close(w.granted)
+}
+
+// effective returns a waiter's priority raised by one level per aging interval waited
+func (q *agingQueue) effective(w *agingWaiter, now time.Time) float64 {
+	return float64(w.priority) + float64(now.Sub(w.enqueued))/float64(q.aging)
+}
@@ -0,0 +1,73 @@
+package reliability
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPriorityAgingAdmitsLongWaiters(t *testing.T) {
+	tests := []struct {
+		name      string
+		aging     time.Duration // 0 keeps arrival order
+		waitFirst time.Duration // How long the normal request has queued when the high-priority ones arrive
+		want      []string      // Admission order once the held slot frees up
+	}{
+		{name: "aged normal request beats fresh high priority", aging: 20 * time.Millisecond, waitFirst: 100 * time.Millisecond,
+			want: []string{"normal", "high-1", "high-2"}},
+		{name: "briefly waiting normal request yields", aging: time.Hour, waitFirst: 100 * time.Millisecond,
+			want: []string{"high-1", "high-2", "normal"}},
+		{name: "aging disabled keeps arrival order", waitFirst: 10 * time.Millisecond,
+			want: []string{"normal", "high-1", "high-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, PriorityAging: tt.aging}, nil)
+			span := trace.SpanFromContext(context.Background())
+
+			holding, release := make(chan struct{}), make(chan struct{})
+			go bulkhead.Execute(context.Background(), span, func(context.Context) error {
+				close(holding)
+				<-release
+				return nil
+			})
+			<-holding
+
+			var mu sync.Mutex
+			var admitted []string
+			var wg sync.WaitGroup
+			// enqueue queues a request and waits until the bulkhead counts it as waiting
+			enqueue := func(name string, priority Priority) {
+				queued := bulkhead.waiters.Load()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bulkhead.Execute(WithPriority(context.Background(), priority), span, func(context.Context) error {
+						mu.Lock()
+						admitted = append(admitted, name)
+						mu.Unlock()
+						return nil
+					})
+				}()
+				for bulkhead.waiters.Load() == queued {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			enqueue("normal", PriorityNormal)
+			time.Sleep(tt.waitFirst)
+			enqueue("high-1", PriorityHigh)
+			enqueue("high-2", PriorityHigh)
+			close(release)
+			wg.Wait()
+
+			if !slices.Equal(admitted, tt.want) {
+				t.Errorf("admitted %v, want %v", admitted, tt.want)
+			}
+		})
+	}
+}
@@ -3,43 +3,294 @@ package reliability
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
 )
 
+// BulkheadConfig holds bulkhead sizing
+type BulkheadConfig struct {
+	MaxConcurrent    int64         `json:"max_concurrent"`
+	ReservedFraction float64       `json:"reserved_fraction"` // Share of slots held back for high-priority requests
+	MinRetryAfter    time.Duration `json:"min_retry_after"`   // Floor on the retry-after suggested to rejected requests
+	OverflowSlots    int64         `json:"overflow_slots"`    // Spillover slots used once the primary slots are full, before queuing
+
+	// Slots only admin requests use, so operational calls still get through while user traffic is shed; 0 treats admin requests as any other
+	AdminSlots int64 `json:"admin_slots"`
+
+	// When set, requests queued for a primary slot are admitted by priority instead of arrival order, each gaining
+	// one priority level per PriorityAging waited so normal traffic can't starve; 0 keeps arrival order
+	PriorityAging time.Duration `json:"priority_aging"`
+}
+
+// DefaultBulkheadConfig returns sensible defaults for payment calls
+func DefaultBulkheadConfig() BulkheadConfig {
+	return BulkheadConfig{
+		MaxConcurrent:    10, // Max 10 concurrent payment calls
+		ReservedFraction: 0,  // No reservation: all requests share every slot
+		MinRetryAfter:    100 * time.Millisecond,
+		OverflowSlots:    0, // No overflow pool: excess requests queue for a primary slot
+		AdminSlots:       2,
+	}
+}
+
 // Bulkhead limits concurrent requests to prevent resource exhaustion
 // If payment service is slow, this prevents all goroutines from being blocked
 // on payment calls, keeping the service responsive for other operations
 type Bulkhead struct {
-	sem *semaphore.Weighted
-	max int64
+	shared   *semaphore.Weighted
+	reserved *semaphore.Weighted // nil when no slots are reserved
+	overflow *semaphore.Weighted // nil when there is no overflow pool
+	admin    *semaphore.Weighted // nil when admin requests share the user pools
+	queue    *agingQueue         // Orders waiters for a shared slot by aged priority; nil queues them in arrival order
+	max      int64               // Primary plus overflow slots; admin slots are outside the capacity usage is measured against
+	waiters  atomic.Int64
+	inUse    atomic.Int64
+	metrics  MetricsSink
+
+	minRetryAfter time.Duration
+	holdMu        sync.Mutex
+	avgHold       time.Duration // Moving average of how long a slot is held, used to estimate retry-after
+
+	rejections   metric.Int64Counter
+	waitersGauge metric.Int64UpDownCounter
 }
 
-// NewBulkhead creates a bulkhead with max concurrent operations
-func NewBulkhead(maxConcurrent int64) *Bulkhead {
-	return &Bulkhead{
-		sem: semaphore.NewWeighted(maxConcurrent),
-		max: maxConcurrent,
+// NewBulkhead creates a bulkhead with max concurrent operations, reporting slot usage to metrics (nil discards it)
+// A fraction of slots can be reserved so high-priority requests are admitted after normal ones are shed,
+// and a separate overflow pool can absorb spillover so requests are only shed once both pools are full
+func NewBulkhead(cfg BulkheadConfig, metrics MetricsSink) *Bulkhead {
+	meter := otel.Meter("order-service")
+	rejections, _ := meter.Int64Counter("bulkhead.rejections",
+		metric.WithDescription("Bulkhead admissions that failed, by reason (immediate or timeout)"))
+	waitersGauge, _ := meter.Int64UpDownCounter("bulkhead.waiters",
+		metric.WithDescription("Requests currently waiting for a bulkhead slot"))
+
+	// Always leave at least one shared slot so normal traffic isn't starved entirely
+	reserved := int64(float64(cfg.MaxConcurrent) * cfg.ReservedFraction)
+	if reserved > cfg.MaxConcurrent-1 {
+		reserved = cfg.MaxConcurrent - 1
+	}
+
+	b := &Bulkhead{
+		shared:        semaphore.NewWeighted(cfg.MaxConcurrent - reserved),
+		max:           cfg.MaxConcurrent + max(cfg.OverflowSlots, 0),
+		metrics:       metricsOrNoop(metrics),
+		minRetryAfter: cfg.MinRetryAfter,
+		rejections:    rejections,
+		waitersGauge:  waitersGauge,
+	}
+	if reserved > 0 {
+		b.reserved = semaphore.NewWeighted(reserved)
+	}
+	if cfg.OverflowSlots > 0 {
+		b.overflow = semaphore.NewWeighted(cfg.OverflowSlots)
+	}
+	if cfg.AdminSlots > 0 {
+		b.admin = semaphore.NewWeighted(cfg.AdminSlots)
+	}
+	if cfg.PriorityAging > 0 {
+		b.queue = newAgingQueue(b.shared, cfg.PriorityAging)
 	}
+	return b
 }
 
 // Execute runs the function within the bulkhead's concurrency limit
 // If the limit is reached, it blocks until a slot becomes available or context expires
 func (b *Bulkhead) Execute(ctx context.Context, span trace.Span, fn func(context.Context) error) error {
-	// Try to acquire a semaphore slot
-	if err := b.sem.Acquire(ctx, 1); err != nil {
-		span.SetStatus(codes.Error, "bulkhead acquire failed")
-		span.SetAttributes(attribute.Bool("bulkhead.rejected", true))
-		return fmt.Errorf("bulkhead limit reached: %w", err)
+	stop := StageTimerFromContext(ctx).Time("bulkhead_wait")
+	pool, err := b.acquire(ctx, span)
+	stop()
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("bulkhead.pool", b.poolName(pool)))
+	if pool == b.admin {
+		defer pool.Release(1)
+	} else {
+		b.metrics.RecordBulkheadUsage(b.inUse.Add(1), b.max)
+		defer func() {
+			b.release(pool)
+			b.metrics.RecordBulkheadUsage(b.inUse.Add(-1), b.max)
+		}()
 	}
-	defer b.sem.Release(1)
 
 	// Record bulkhead usage for capacity planning
-	// In production, you'd export this as a gauge metric
 	span.SetAttributes(attribute.Int64("bulkhead.max", b.max))
 
-	return fn(ctx)
+	// A panicking fn becomes an error so the slot is always released and the caller can handle it
+	start := time.Now()
+	defer func() { b.recordHold(time.Since(start)) }()
+	return recoverPanic(span, func() error { return fn(ctx) })
+}
+
+// acquire takes a slot, distinguishing requests rejected outright from those that timed out waiting
+// Returns the pool the slot was taken from so it can be released to the same pool
+func (b *Bulkhead) acquire(ctx context.Context, span trace.Span) (*semaphore.Weighted, error) {
+	// Admin requests bypass the user pools entirely, queuing only behind other admin requests
+	if b.admin != nil && IsAdmin(ctx) {
+		span.SetAttributes(attribute.Bool("bulkhead.admin_bypass", true))
+		return b.acquireAdmin(ctx, span)
+	}
+
+	priority := PriorityFromContext(ctx)
+	span.SetAttributes(attribute.String("bulkhead.priority", priority.String()))
+
+	// Fast path: a free slot means no queuing at all
+	if b.shared.TryAcquire(1) {
+		recordDecision(span, PatternBulkhead, DecisionAdmit, "slot_free")
+		return b.shared, nil
+	}
+
+	// High-priority requests spill into the reserved pool instead of queuing behind normal traffic
+	pool := b.shared
+	if priority == PriorityHigh && b.reserved != nil {
+		pool = b.reserved
+		span.SetAttributes(attribute.Bool("bulkhead.reserved", true))
+		if pool.TryAcquire(1) {
+			recordDecision(span, PatternBulkhead, DecisionAdmit, "reserved_slot")
+			return pool, nil
+		}
+	}
+
+	// Spill into the overflow pool before queuing; a request queued for a primary slot doesn't move to it later
+	if b.overflow != nil && b.overflow.TryAcquire(1) {
+		recordDecision(span, PatternBulkhead, DecisionAdmit, "overflow_slot")
+		return b.overflow, nil
+	}
+
+	// Context already done: reject immediately rather than joining the queue
+	if err := ctx.Err(); err != nil {
+		b.reject(ctx, span, "immediate")
+		return nil, b.overCapacity(err, 0)
+	}
+
+	waiting := b.waiters.Add(1)
+	b.waitersGauge.Add(ctx, 1)
+	span.SetAttributes(
+		attribute.Bool("bulkhead.queued", true),
+		attribute.Int64("bulkhead.waiters", waiting),
+	)
+	DecisionSummaryFromContext(ctx).AddQueued()
+
+	var err error
+	if pool == b.shared && b.queue != nil {
+		span.SetAttributes(attribute.Bool("bulkhead.priority_aging", true))
+		err = b.queue.acquire(ctx, priority)
+	} else {
+		err = pool.Acquire(ctx, 1)
+	}
+
+	b.waiters.Add(-1)
+	b.waitersGauge.Add(context.WithoutCancel(ctx), -1)
+
+	if err != nil {
+		b.reject(ctx, span, "timeout")
+		return nil, b.overCapacity(err, waiting)
+	}
+	recordDecision(span, PatternBulkhead, DecisionAdmit, "queued")
+	return pool, nil
+}
+
+// acquireAdmin takes a slot from the admin pool, waiting for one if every admin slot is busy
+func (b *Bulkhead) acquireAdmin(ctx context.Context, span trace.Span) (*semaphore.Weighted, error) {
+	if err := b.admin.Acquire(ctx, 1); err != nil {
+		b.reject(ctx, span, "admin_timeout")
+		return nil, b.overCapacity(err, 0)
+	}
+	recordDecision(span, PatternBulkhead, DecisionAdmit, "admin_slot")
+	return b.admin, nil
+}
+
+// release returns a slot to its pool, handing a shared slot straight to the next queued request under priority aging
+func (b *Bulkhead) release(pool *semaphore.Weighted) {
+	if pool == b.shared && b.queue != nil {
+		b.queue.release()
+		return
+	}
+	pool.Release(1)
+}
+
+// poolName names the pool a slot was taken from, for the bulkhead.pool span attribute
+func (b *Bulkhead) poolName(pool *semaphore.Weighted) string {
+	switch pool {
+	case b.overflow:
+		return "overflow"
+	case b.reserved:
+		return "reserved"
+	case b.admin:
+		return "admin"
+	default:
+		return "primary"
+	}
+}
+
+// reject records a failed admission on the span and in metrics
+func (b *Bulkhead) reject(ctx context.Context, span trace.Span, reason string) {
+	span.SetStatus(codes.Error, "bulkhead acquire failed")
+	recordDecision(span, PatternBulkhead, DecisionReject, reason)
+	span.SetAttributes(
+		attribute.Bool("bulkhead.rejected", true),
+		attribute.String("bulkhead.rejection_reason", reason),
+	)
+	b.rejections.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+// recordHold folds one slot hold time into the moving average
+func (b *Bulkhead) recordHold(d time.Duration) {
+	b.holdMu.Lock()
+	defer b.holdMu.Unlock()
+	if b.avgHold == 0 {
+		b.avgHold = d
+		return
+	}
+	b.avgHold += (d - b.avgHold) / 8
+}
+
+// overCapacity builds the rejection for a request that couldn't get a slot
+// position is where the request joined the queue, or 0 if it was rejected without queuing
+func (b *Bulkhead) overCapacity(err error, position int64) *OverCapacityError {
+	depth := b.waiters.Load()
+
+	// Everyone queued ahead drains at max slots per average hold time
+	b.holdMu.Lock()
+	retryAfter := time.Duration(depth/b.max+1) * b.avgHold
+	b.holdMu.Unlock()
+
+	return &OverCapacityError{
+		Queued:     position > 0,
+		Position:   position,
+		Depth:      depth,
+		RetryAfter: max(retryAfter, b.minRetryAfter),
+		err:        err,
+	}
+}
+
+// OverCapacityError is returned when the bulkhead sheds a request, with enough detail for clients to back off sensibly
+type OverCapacityError struct {
+	Queued     bool          // The request waited in the queue before being shed
+	Position   int64         // Queue position when the request joined, if queued
+	Depth      int64         // Requests still queued when this one was shed
+	RetryAfter time.Duration // Estimated wait until a slot frees up
+	err        error
+}
+
+func (e *OverCapacityError) Error() string {
+	return fmt.Sprintf("bulkhead limit reached: %v", e.err)
+}
+
+func (e *OverCapacityError) Unwrap() error {
+	return e.err
+}
+
+// Waiters returns the number of requests currently queued for a slot
+func (b *Bulkhead) Waiters() int64 {
+	return b.waiters.Load()
 }
@@ -0,0 +1,267 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingMeter sums what is added to its counters, keyed by instrument name and attributes, e.g.
+// "bulkhead.rejections{reason=timeout}"; other instruments are no-ops
+type recordingMeter struct {
+	noop.Meter
+	mu     sync.Mutex
+	totals map[string]int64
+}
+
+func (m *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return recordingCounter{meter: m, name: name}, nil
+}
+
+func (m *recordingMeter) Int64UpDownCounter(name string, _ ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	return recordingUpDownCounter{meter: m, name: name}, nil
+}
+
+func (m *recordingMeter) add(name string, attrs attribute.Set, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totals[name+"{"+attrs.Encoded(attribute.DefaultEncoder())+"}"] += n
+}
+
+func (m *recordingMeter) total(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.totals[key]
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+	meter *recordingMeter
+	name  string
+}
+
+func (c recordingCounter) Add(_ context.Context, n int64, opts ...metric.AddOption) {
+	c.meter.add(c.name, metric.NewAddConfig(opts).Attributes(), n)
+}
+
+type recordingUpDownCounter struct {
+	noop.Int64UpDownCounter
+	meter *recordingMeter
+	name  string
+}
+
+func (c recordingUpDownCounter) Add(_ context.Context, n int64, opts ...metric.AddOption) {
+	c.meter.add(c.name, metric.NewAddConfig(opts).Attributes(), n)
+}
+
+type recordingMeterProvider struct {
+	noop.MeterProvider
+	meter *recordingMeter
+}
+
+func (p recordingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+// useRecordingMeter installs a recording meter as the global meter provider for the rest of the test
+// Instruments are created in constructors, so call it before constructing what's being measured
+func useRecordingMeter(t *testing.T) *recordingMeter {
+	t.Helper()
+	meter := &recordingMeter{totals: make(map[string]int64)}
+	otel.SetMeterProvider(recordingMeterProvider{meter: meter})
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+	return meter
+}
+
+func TestBulkheadRejectionReasons(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        func() (context.Context, context.CancelFunc)
+		wantReason string
+		wantQueued bool
+	}{
+		{name: "waiter times out in the queue", ctx: func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, wantReason: "timeout", wantQueued: true},
+		{name: "expired request is rejected at acquire", ctx: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, wantReason: "immediate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := useRecordingMeter(t)
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, MinRetryAfter: time.Millisecond}, nil)
+			span := trace.SpanFromContext(context.Background())
+
+			// Fill the only slot until the waiter has given up
+			holding, done := make(chan struct{}), make(chan struct{})
+			go bulkhead.Execute(context.Background(), span, func(context.Context) error {
+				close(holding)
+				<-done
+				return nil
+			})
+			<-holding
+			defer close(done)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			err := bulkhead.Execute(ctx, span, func(context.Context) error {
+				t.Error("fn ran without a free slot")
+				return nil
+			})
+
+			var overCapacity *OverCapacityError
+			if !errors.As(err, &overCapacity) {
+				t.Fatalf("Execute() error = %v, want an OverCapacityError", err)
+			}
+			if overCapacity.Queued != tt.wantQueued {
+				t.Errorf("Queued = %v, want %v", overCapacity.Queued, tt.wantQueued)
+			}
+			for _, reason := range []string{"timeout", "immediate"} {
+				want := int64(0)
+				if reason == tt.wantReason {
+					want = 1
+				}
+				if got := meter.total("bulkhead.rejections{reason=" + reason + "}"); got != want {
+					t.Errorf("bulkhead.rejections{reason=%s} = %d, want %d", reason, got, want)
+				}
+			}
+			if got := meter.total("bulkhead.waiters{}"); got != 0 || bulkhead.Waiters() != 0 {
+				t.Errorf("waiters after rejection = %d (gauge %d), want 0", bulkhead.Waiters(), got)
+			}
+		})
+	}
+}
+
+func TestBulkheadReservedSlotsForHighPriority(t *testing.T) {
+	tests := []struct {
+		name      string
+		priority  Priority
+		holdHigh  int // High-priority requests already holding reserved slots
+		wantAdmit bool
+		wantPool  string
+	}{
+		{name: "normal request is shed", priority: PriorityNormal},
+		{name: "high priority uses a reserved slot", priority: PriorityHigh, wantAdmit: true, wantPool: "reserved"},
+		{name: "high priority shed once the reserve is used up", priority: PriorityHigh, holdHigh: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 4 slots, half reserved: 2 shared slots for everyone, 2 only high priority may use
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 4, ReservedFraction: 0.5, MinRetryAfter: time.Millisecond}, nil)
+			done := make(chan struct{})
+			defer close(done)
+			hold := func(ctx context.Context) {
+				held := make(chan struct{})
+				go bulkhead.Execute(ctx, trace.SpanFromContext(ctx), func(context.Context) error {
+					close(held)
+					<-done
+					return nil
+				})
+				<-held
+			}
+			for i := 0; i < 2; i++ {
+				hold(context.Background())
+			}
+			for i := 0; i < tt.holdHigh; i++ {
+				hold(WithPriority(context.Background(), PriorityHigh))
+			}
+
+			ctx, cancel := context.WithTimeout(WithPriority(context.Background(), tt.priority), 20*time.Millisecond)
+			defer cancel()
+			span, attrs := recordedSpan(t)
+			admitted := false
+			err := bulkhead.Execute(ctx, span, func(context.Context) error {
+				admitted = true
+				return nil
+			})
+
+			if admitted != tt.wantAdmit {
+				t.Fatalf("admitted = %v (error %v), want %v", admitted, err, tt.wantAdmit)
+			}
+			var overCapacity *OverCapacityError
+			if !tt.wantAdmit && !errors.As(err, &overCapacity) {
+				t.Errorf("error = %v, want an OverCapacityError", err)
+			}
+			if pool := attrs()["bulkhead.pool"].AsString(); pool != tt.wantPool {
+				t.Errorf("bulkhead.pool = %q, want %q", pool, tt.wantPool)
+			}
+		})
+	}
+}
+
+func TestBulkheadOverflowPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		overflow  int64
+		held      int // Requests already holding slots, primary first
+		wantAdmit bool
+		wantPool  string
+	}{
+		{name: "free primary slot", overflow: 2, wantAdmit: true, wantPool: "primary"},
+		{name: "primary full spills into overflow", overflow: 2, held: 2, wantAdmit: true, wantPool: "overflow"},
+		{name: "last overflow slot", overflow: 2, held: 3, wantAdmit: true, wantPool: "overflow"},
+		{name: "both pools full is shed", overflow: 2, held: 4},
+		{name: "no overflow pool queues and is shed", held: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 2, OverflowSlots: tt.overflow, MinRetryAfter: time.Millisecond}, nil)
+			release := make(chan struct{})
+			var wg sync.WaitGroup
+			defer func() {
+				close(release)
+				wg.Wait()
+			}()
+			for i := 0; i < tt.held; i++ {
+				admitted := make(chan struct{})
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bulkhead.Execute(context.Background(), trace.SpanFromContext(context.Background()), func(context.Context) error {
+						close(admitted)
+						<-release
+						return nil
+					})
+				}()
+				<-admitted
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			span, attrs := recordedSpan(t)
+			admitted := false
+			err := bulkhead.Execute(ctx, span, func(context.Context) error {
+				admitted = true
+				return nil
+			})
+
+			if admitted != tt.wantAdmit {
+				t.Fatalf("admitted = %v (error %v), want %v", admitted, err, tt.wantAdmit)
+			}
+			var overCapacity *OverCapacityError
+			if !tt.wantAdmit && !errors.As(err, &overCapacity) {
+				t.Errorf("error = %v, want an OverCapacityError", err)
+			}
+			recorded := attrs()
+			if pool := recorded["bulkhead.pool"].AsString(); pool != tt.wantPool {
+				t.Errorf("bulkhead.pool = %q, want %q", pool, tt.wantPool)
+			}
+			if tt.wantAdmit {
+				if got, want := recorded["bulkhead.max"].AsInt64(), 2+tt.overflow; got != want {
+					t.Errorf("bulkhead.max = %d, want %d", got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package reliability
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -14,26 +21,155 @@ import (
 // When the payment service is consistently failing, the circuit opens to prevent
 // wasting resources on requests that will likely fail, giving the downstream service time to recover
 type CircuitBreaker struct {
-	cb *gobreaker.CircuitBreaker
+	cb      *gobreaker.TwoStepCircuitBreaker
+	name    string
+	metrics MetricsSink
+	timeout time.Duration // Open duration after jitter, fixed for this breaker's lifetime
+
+	// Failures of each class in gobreaker's current run of consecutive failures, for the per-class trip thresholds
+	// Only ReadyToTrip updates them, so failures gobreaker discards (e.g. from before a state change) are never counted;
+	// classMu is held while an outcome is reported so ReadyToTrip knows the class of the failure it's counting
+	classMu      sync.Mutex
+	pendingClass string
+	timeoutRun   uint32
+	errorRun     uint32
+
+	// Half-open trial outcomes, used to tune MaxRequests and Timeout
+	trialsAllowed    atomic.Int64
+	trialsSucceeded  atomic.Int64
+	trialsFailed     atomic.Int64
+	trialsRejected   atomic.Int64 // Turned away because MaxRequests trials were already running
+	halfOpenToClosed atomic.Int64
+	halfOpenToOpen   atomic.Int64
+	trials           metric.Int64Counter
+	halfOpenOutcomes metric.Int64Counter
+}
+
+// HalfOpenStats counts half-open trial requests and the transitions they led to
+type HalfOpenStats struct {
+	Allowed   int64 `json:"allowed"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	Rejected  int64 `json:"rejected"`
+	Closed    int64 `json:"closed"`   // Half-open periods that ended with the circuit closing
+	Reopened  int64 `json:"reopened"` // Half-open periods that ended with the circuit reopening
+}
+
+// CircuitBreakerConfig holds circuit breaker thresholds
+type CircuitBreakerConfig struct {
+	Name                string        `json:"name"`
+	MaxRequests         uint32        `json:"max_requests"`              // Requests allowed in half-open state
+	Interval            time.Duration `json:"interval"`                  // Rolling window for failure counting
+	Timeout             time.Duration `json:"timeout"`                   // Open duration before probing recovery
+	ConsecutiveFailures uint32        `json:"consecutive_failures"`      // Consecutive failures that trip the circuit
+	FailureRatio        float64       `json:"failure_ratio"`             // Failure ratio that trips the circuit
+	MinRequests         uint32        `json:"min_requests"`              // Minimum requests before FailureRatio applies
+	WebhookURL          string        `json:"webhook_url" redact:"true"` // Optional alerting webhook for open/close transitions
+	WebhookMinInterval  time.Duration `json:"webhook_min_interval"`      // Transitions closer together than this are coalesced
+
+	// Randomizes Timeout by ±fraction per breaker, so replicas whose breakers opened together don't all probe at once
+	TimeoutJitter float64 `json:"timeout_jitter"`
+
+	// Per-class trip thresholds, e.g. tolerating more timeouts (slow downstream) than errors (failing downstream)
+	// When either is set, consecutive failures trip by class instead of ConsecutiveFailures: each class counts its
+	// failures since the last success, and a class left at 0 uses ConsecutiveFailures as its threshold
+	ConsecutiveTimeouts uint32 `json:"consecutive_timeouts"`
+	ConsecutiveErrors   uint32 `json:"consecutive_errors"`
+}
+
+// DefaultCircuitBreakerConfig returns sensible defaults for payment calls
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Name:                "payment-service",
+		MaxRequests:         3,                // Allow 3 requests in half-open state to test recovery
+		Interval:            10 * time.Second, // Rolling window for failure counting
+		Timeout:             30 * time.Second, // Time to wait before attempting to close circuit
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.6,
+		MinRequests:         10,
+		WebhookMinInterval:  10 * time.Second,
+
+		TimeoutJitter: 0.1,
+	}
+}
+
+// jitteredTimeout returns cfg.Timeout ± cfg.TimeoutJitter*cfg.Timeout
+func jitteredTimeout(cfg CircuitBreakerConfig) time.Duration {
+	jitterRange := float64(cfg.Timeout) * cfg.TimeoutJitter
+	jitter := (rand.Float64() * 2 * jitterRange) - jitterRange
+	return cfg.Timeout + time.Duration(jitter)
 }
 
-// NewCircuitBreaker creates a circuit breaker with sensible defaults for payment calls
-func NewCircuitBreaker() *CircuitBreaker {
+// NewCircuitBreaker creates a circuit breaker from the given thresholds, reporting state changes to metrics (nil discards them)
+func NewCircuitBreaker(cfg CircuitBreakerConfig, metrics MetricsSink) *CircuitBreaker {
+	meter := otel.Meter("order-service")
+	trials, _ := meter.Int64Counter("cb.halfopen.trials",
+		metric.WithDescription("Half-open trial requests, by outcome (succeeded, failed or rejected)"))
+	halfOpenOutcomes, _ := meter.Int64Counter("cb.halfopen.transitions",
+		metric.WithDescription("Half-open periods that ended, by resulting state (closed or open)"))
+	c := &CircuitBreaker{
+		name:             cfg.Name,
+		metrics:          metricsOrNoop(metrics),
+		trials:           trials,
+		halfOpenOutcomes: halfOpenOutcomes,
+		timeout:          jitteredTimeout(cfg),
+	}
+
+	byClass := cfg.ConsecutiveTimeouts > 0 || cfg.ConsecutiveErrors > 0
+	timeoutLimit, errorLimit := cfg.ConsecutiveTimeouts, cfg.ConsecutiveErrors
+	if timeoutLimit == 0 {
+		timeoutLimit = cfg.ConsecutiveFailures
+	}
+	if errorLimit == 0 {
+		errorLimit = cfg.ConsecutiveFailures
+	}
+
 	settings := gobreaker.Settings{
-		Name:        "payment-service",
-		MaxRequests: 3,                // Allow 3 requests in half-open state to test recovery
-		Interval:    10 * time.Second, // Rolling window for failure counting
-		Timeout:     30 * time.Second, // Time to wait before attempting to close circuit
+		Name:        cfg.Name,
+		MaxRequests: cfg.MaxRequests,
+		Interval:    cfg.Interval,
+		Timeout:     c.timeout,
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			// Open circuit after 5 consecutive failures or 60% failure rate with at least 10 requests
+			// Called for each failure counted while closed; the first of a run means a success or a new generation
+			// cleared gobreaker's counts, so the class runs start over with it
+			if counts.ConsecutiveFailures == 1 {
+				c.timeoutRun, c.errorRun = 0, 0
+			}
+			if c.pendingClass == failureClassTimeout {
+				c.timeoutRun++
+			} else {
+				c.errorRun++
+			}
+
+			// Open circuit after N consecutive failures (of one class, with class thresholds), or a high failure rate over enough requests
+			consecutive := counts.ConsecutiveFailures >= cfg.ConsecutiveFailures
+			if byClass {
+				consecutive = c.timeoutRun >= timeoutLimit || c.errorRun >= errorLimit
+			}
 			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			return counts.ConsecutiveFailures >= 5 || (counts.Requests >= 10 && failureRatio >= 0.6)
+			return consecutive || (counts.Requests >= cfg.MinRequests && failureRatio >= cfg.FailureRatio)
 		},
 	}
-
-	return &CircuitBreaker{
-		cb: gobreaker.NewCircuitBreaker(settings),
+	var notify func(name string, from, to gobreaker.State)
+	if cfg.WebhookURL != "" {
+		notify = NewStateChangeNotifier(cfg.WebhookURL, "order-service", cfg.WebhookMinInterval).OnStateChange
 	}
+	settings.OnStateChange = func(name string, from, to gobreaker.State) {
+		c.metrics.RecordBreakerState(name, to.String())
+		c.recordHalfOpenExit(from, to)
+		if notify != nil {
+			notify(name, from, to)
+		}
+	}
+
+	c.cb = gobreaker.NewTwoStepCircuitBreaker(settings)
+	c.metrics.RecordBreakerState(cfg.Name, c.cb.State().String())
+	return c
+}
+
+// OpenTimeout returns how long this breaker stays open before probing, after jitter
+func (c *CircuitBreaker) OpenTimeout() time.Duration {
+	return c.timeout
 }
 
 // Execute runs the function through the circuit breaker
@@ -42,12 +178,33 @@ func (c *CircuitBreaker) Execute(span trace.Span, fn func() error) error {
 	state := c.cb.State()
 	span.SetAttributes(attribute.String("cb.state", state.String()))
 
-	_, err := c.cb.Execute(func() (interface{}, error) {
-		return nil, fn()
-	})
+	// Recovering inside the breaker means a panic counts as a failure instead of escaping to the caller
+	// The state is re-read once admitted, since the open timeout may have elapsed since the read above
+	trial := false
+	done, err := c.cb.Allow()
+	if err == nil {
+		admitted := c.cb.State()
+		if admitted == gobreaker.StateHalfOpen {
+			trial = true
+			c.trialsAllowed.Add(1)
+		}
+		recordDecision(span, PatternCircuitBreaker, DecisionAllow, admitted.String())
+		err = recoverPanic(span, fn)
+		c.report(span, done, err)
+	}
+
+	// gobreaker only turns requests away as too many while half-open
+	if trial || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		c.recordTrial(span, err)
+	}
+
+	if errors.Is(err, gobreaker.ErrTooManyRequests) {
+		recordDecision(span, PatternCircuitBreaker, DecisionReject, "half_open_limit")
+	}
 
 	if err != nil {
 		if errors.Is(err, gobreaker.ErrOpenState) {
+			recordDecision(span, PatternCircuitBreaker, DecisionReject, "open")
 			span.SetAttributes(attribute.Bool("cb.open", true))
 			return fmt.Errorf("circuit breaker open: %w", err)
 		}
@@ -57,7 +214,91 @@ func (c *CircuitBreaker) Execute(span trace.Span, fn func() error) error {
 	return nil
 }
 
+// Failure classes with their own trip thresholds
+const (
+	failureClassTimeout = "timeout" // The downstream was too slow
+	failureClassError   = "error"   // The downstream failed
+)
+
+// report hands an admitted call's outcome to gobreaker, recording a failure's class for ReadyToTrip
+func (c *CircuitBreaker) report(span trace.Span, done func(success bool), err error) {
+	class := ""
+	if err != nil {
+		class = failureClassError
+		if isTimeout(err) {
+			class = failureClassTimeout
+		}
+		span.SetAttributes(attribute.String("cb.failure_class", class))
+	}
+
+	c.classMu.Lock()
+	defer c.classMu.Unlock()
+	c.pendingClass = class
+	done(err == nil)
+}
+
+// isTimeout reports whether err means the downstream was too slow rather than that it failed
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
 // State returns the current circuit breaker state
 func (c *CircuitBreaker) State() gobreaker.State {
 	return c.cb.State()
 }
+
+// HalfOpenStats returns cumulative half-open trial counts
+func (c *CircuitBreaker) HalfOpenStats() HalfOpenStats {
+	return HalfOpenStats{
+		Allowed:   c.trialsAllowed.Load(),
+		Succeeded: c.trialsSucceeded.Load(),
+		Failed:    c.trialsFailed.Load(),
+		Rejected:  c.trialsRejected.Load(),
+		Closed:    c.halfOpenToClosed.Load(),
+		Reopened:  c.halfOpenToOpen.Load(),
+	}
+}
+
+// recordTrial records the outcome of a call made or turned away while the circuit was half-open
+func (c *CircuitBreaker) recordTrial(span trace.Span, err error) {
+	var outcome string
+	switch {
+	case errors.Is(err, gobreaker.ErrTooManyRequests):
+		outcome = "rejected"
+		c.trialsRejected.Add(1)
+	case err != nil:
+		outcome = "failed"
+		c.trialsFailed.Add(1)
+	default:
+		outcome = "succeeded"
+		c.trialsSucceeded.Add(1)
+	}
+
+	after := c.cb.State()
+	span.AddEvent("cb_halfopen_trial", trace.WithAttributes(
+		attribute.String("cb.trial.outcome", outcome),
+		attribute.String("cb.state_after", after.String()),
+	))
+	c.trials.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("breaker", c.name),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// recordHalfOpenExit counts how a half-open period ended
+func (c *CircuitBreaker) recordHalfOpenExit(from, to gobreaker.State) {
+	if from != gobreaker.StateHalfOpen {
+		return
+	}
+	switch to {
+	case gobreaker.StateClosed:
+		c.halfOpenToClosed.Add(1)
+	case gobreaker.StateOpen:
+		c.halfOpenToOpen.Add(1)
+	}
+	c.halfOpenOutcomes.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("breaker", c.name),
+		attribute.String("to", to.String()),
+	))
+}
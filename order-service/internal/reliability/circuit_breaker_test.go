@@ -0,0 +1,219 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCircuitBreakerClassThresholds(t *testing.T) {
+	errDownstream := errors.New("payment service returned 500")
+
+	// Outcomes: e is an error, t a timeout, s a success, w waits out Interval (or, while open, Timeout)
+	tests := []struct {
+		name     string
+		timeouts uint32
+		errors   uint32
+		interval time.Duration
+		outcomes string
+		want     gobreaker.State
+	}{
+		{name: "errors trip at their threshold", timeouts: 8, errors: 3, outcomes: "eee", want: gobreaker.StateOpen},
+		{name: "errors below threshold", timeouts: 8, errors: 3, outcomes: "ee", want: gobreaker.StateClosed},
+		{name: "timeouts tolerated past the overall count", timeouts: 8, errors: 3, outcomes: "ttttttt", want: gobreaker.StateClosed},
+		{name: "timeouts trip at their threshold", timeouts: 8, errors: 3, outcomes: "tttttttt", want: gobreaker.StateOpen},
+		{name: "other class doesn't end a run", timeouts: 8, errors: 3, outcomes: "etttettte", want: gobreaker.StateOpen},
+		{name: "mixed failures below both thresholds", timeouts: 8, errors: 3, outcomes: "ettttttte", want: gobreaker.StateClosed},
+		{name: "unset class uses the overall count", errors: 3, outcomes: "ttttt", want: gobreaker.StateOpen},
+		{name: "without class thresholds any five trip", outcomes: "etete", want: gobreaker.StateOpen},
+		{name: "success resets the runs", timeouts: 8, errors: 3, outcomes: "eesee", want: gobreaker.StateClosed},
+		{name: "new interval resets the runs", timeouts: 8, errors: 3, interval: 20 * time.Millisecond, outcomes: "eewe", want: gobreaker.StateClosed},
+		{name: "closing again resets the runs", timeouts: 8, errors: 3, outcomes: "eeewsee", want: gobreaker.StateClosed},
+		{name: "runs count again after closing", timeouts: 8, errors: 3, outcomes: "eeewseee", want: gobreaker.StateOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCircuitBreaker(CircuitBreakerConfig{
+				Name:                "test",
+				MaxRequests:         1,
+				Interval:            tt.interval,
+				Timeout:             20 * time.Millisecond,
+				ConsecutiveFailures: 5,
+				FailureRatio:        1,
+				MinRequests:         100,
+				ConsecutiveTimeouts: tt.timeouts,
+				ConsecutiveErrors:   tt.errors,
+			}, nil)
+			span := trace.SpanFromContext(context.Background())
+
+			for i, outcome := range tt.outcomes {
+				var err error
+				switch outcome {
+				case 'w':
+					time.Sleep(30 * time.Millisecond)
+					continue
+				case 'e':
+					err = errDownstream
+				case 't':
+					err = context.DeadlineExceeded
+				}
+				if got := cb.Execute(span, func() error { return err }); !errors.Is(got, err) {
+					t.Fatalf("outcome %d (%c): Execute() = %v, want %v", i, outcome, got, err)
+				}
+			}
+			if got := cb.State(); got != tt.want {
+				t.Errorf("state after %q = %v, want %v", tt.outcomes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenTrials(t *testing.T) {
+	errDownstream := errors.New("payment service returned 500")
+
+	// Outcomes: e is an error, s a success, w waits out the open timeout, p runs a trial while a second call is
+	// turned away for exceeding MaxRequests
+	tests := []struct {
+		name        string
+		maxRequests uint32
+		outcomes    string
+		want        HalfOpenStats
+		wantState   gobreaker.State
+		wantEvents  []string // Outcomes of the cb_halfopen_trial span events
+	}{
+		{name: "trials close the circuit", maxRequests: 2, outcomes: "ewss",
+			want:      HalfOpenStats{Allowed: 2, Succeeded: 2, Closed: 1},
+			wantState: gobreaker.StateClosed, wantEvents: []string{"succeeded", "succeeded"}},
+		{name: "failed trial reopens the circuit", maxRequests: 2, outcomes: "ewe",
+			want:      HalfOpenStats{Allowed: 1, Failed: 1, Reopened: 1},
+			wantState: gobreaker.StateOpen, wantEvents: []string{"failed"}},
+		{name: "reopened then closed", maxRequests: 1, outcomes: "ewews",
+			want:      HalfOpenStats{Allowed: 2, Succeeded: 1, Failed: 1, Closed: 1, Reopened: 1},
+			wantState: gobreaker.StateClosed, wantEvents: []string{"failed", "succeeded"}},
+		{name: "trials beyond MaxRequests rejected", maxRequests: 1, outcomes: "ewp",
+			want:      HalfOpenStats{Allowed: 1, Succeeded: 1, Rejected: 1, Closed: 1},
+			wantState: gobreaker.StateClosed, wantEvents: []string{"rejected", "succeeded"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := useRecordingMeter(t)
+			cb := NewCircuitBreaker(CircuitBreakerConfig{
+				Name:                "payment",
+				MaxRequests:         tt.maxRequests,
+				Timeout:             20 * time.Millisecond,
+				ConsecutiveFailures: 1,
+				FailureRatio:        1,
+				MinRequests:         100,
+			}, nil)
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+
+			for _, outcome := range tt.outcomes {
+				switch outcome {
+				case 'w':
+					time.Sleep(30 * time.Millisecond)
+				case 'e':
+					cb.Execute(span, func() error { return errDownstream })
+				case 's':
+					cb.Execute(span, func() error { return nil })
+				case 'p':
+					inTrial, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+					go func() {
+						defer close(done)
+						cb.Execute(span, func() error {
+							close(inTrial)
+							<-release
+							return nil
+						})
+					}()
+					<-inTrial
+					if err := cb.Execute(span, func() error { return nil }); !errors.Is(err, gobreaker.ErrTooManyRequests) {
+						t.Errorf("call beside a running trial = %v, want ErrTooManyRequests", err)
+					}
+					close(release)
+					<-done
+				}
+			}
+			span.End()
+
+			if got := cb.HalfOpenStats(); got != tt.want {
+				t.Errorf("HalfOpenStats() = %+v, want %+v", got, tt.want)
+			}
+			if got := cb.State(); got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+
+			wantMetrics := map[string]int64{
+				"cb.halfopen.trials{breaker=payment,outcome=succeeded}": tt.want.Succeeded,
+				"cb.halfopen.trials{breaker=payment,outcome=failed}":    tt.want.Failed,
+				"cb.halfopen.trials{breaker=payment,outcome=rejected}":  tt.want.Rejected,
+				"cb.halfopen.transitions{breaker=payment,to=closed}":    tt.want.Closed,
+				"cb.halfopen.transitions{breaker=payment,to=open}":      tt.want.Reopened,
+			}
+			for key, want := range wantMetrics {
+				if got := meter.total(key); got != want {
+					t.Errorf("%s = %d, want %d", key, got, want)
+				}
+			}
+
+			var events []string
+			for _, event := range recorder.Ended()[0].Events() {
+				for _, kv := range event.Attributes {
+					if event.Name == "cb_halfopen_trial" && kv.Key == "cb.trial.outcome" {
+						events = append(events, kv.Value.AsString())
+					}
+				}
+			}
+			if !slices.Equal(events, tt.wantEvents) {
+				t.Errorf("trial events = %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerTimeoutJitter(t *testing.T) {
+	const timeout = 30 * time.Second
+	tests := []struct {
+		name   string
+		jitter float64
+	}{
+		{name: "no jitter", jitter: 0},
+		{name: "default tenth", jitter: 0.1},
+		{name: "wide", jitter: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo := timeout - time.Duration(float64(timeout)*tt.jitter)
+			hi := timeout + time.Duration(float64(timeout)*tt.jitter)
+
+			// Each breaker stands in for one replica's
+			var timeouts []time.Duration
+			for i := 0; i < 200; i++ {
+				cb := NewCircuitBreaker(CircuitBreakerConfig{Name: "payment", Timeout: timeout, TimeoutJitter: tt.jitter}, nil)
+				timeouts = append(timeouts, cb.OpenTimeout())
+			}
+			shortest, longest := slices.Min(timeouts), slices.Max(timeouts)
+			if shortest < lo || longest > hi {
+				t.Fatalf("open timeouts span [%v, %v], want within [%v, %v]", shortest, longest, lo, hi)
+			}
+			if tt.jitter == 0 {
+				if shortest != timeout || longest != timeout {
+					t.Errorf("open timeouts span [%v, %v], want exactly %v", shortest, longest, timeout)
+				}
+				return
+			}
+			// Spread over most of the range, both above and below the configured timeout
+			halfRange := time.Duration(float64(timeout) * tt.jitter / 2)
+			if shortest > timeout-halfRange || longest < timeout+halfRange {
+				t.Errorf("open timeouts span [%v, %v], want spread across [%v, %v]", shortest, longest, lo, hi)
+			}
+		})
+	}
+}
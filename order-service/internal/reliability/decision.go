@@ -0,0 +1,35 @@
+package reliability
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DecisionEvent is the span event recorded for every reliability pattern decision
+// All patterns share one schema so traces can be queried uniformly, e.g. every request the bulkhead rejected
+const DecisionEvent = "reliability.decision"
+
+// Patterns recorded in the decision event's pattern attribute
+const (
+	PatternBulkhead       = "bulkhead"
+	PatternCircuitBreaker = "circuit_breaker"
+	PatternRetry          = "retry"
+)
+
+// Outcomes recorded in the decision event's outcome attribute
+const (
+	DecisionAdmit   = "admit"   // Bulkhead granted a slot
+	DecisionAllow   = "allow"   // Circuit breaker let the call through
+	DecisionReject  = "reject"  // Bulkhead or circuit breaker turned the call away
+	DecisionAttempt = "attempt" // Retry is about to run another attempt
+	DecisionExhaust = "exhaust" // Retry gave up
+)
+
+// recordDecision adds a reliability.decision event to the span
+func recordDecision(span trace.Span, pattern, outcome, reason string) {
+	span.AddEvent(DecisionEvent, trace.WithAttributes(
+		attribute.String("pattern", pattern),
+		attribute.String("outcome", outcome),
+		attribute.String("reason", reason),
+	))
+}
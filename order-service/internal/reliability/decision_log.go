@@ -0,0 +1,100 @@
+package reliability
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DecisionRecord is one reliability decision kept by a DecisionLog
+type DecisionRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"` // Trace ID of the request the decision was made for
+	Pattern   string    `json:"pattern"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason"`
+}
+
+// DecisionLog keeps the most recent reliability decisions in a fixed-size ring, as an audit trail for post-incident analysis
+// It's fed from reliability.decision span events, so it works without a trace backend but not with a no-op tracer
+type DecisionLog struct {
+	mu      sync.Mutex
+	entries []DecisionRecord
+	next    int  // Slot the next record is written to
+	full    bool // The ring has wrapped, so every slot holds a record
+}
+
+// NewDecisionLog creates a log holding the last size decisions
+func NewDecisionLog(size int) *DecisionLog {
+	return &DecisionLog{entries: make([]DecisionRecord, size)}
+}
+
+// Record adds a decision, overwriting the oldest once the log is full
+func (l *DecisionLog) Record(rec DecisionRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = rec
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries returns the retained decisions, oldest first
+func (l *DecisionLog) Entries() []DecisionRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]DecisionRecord(nil), l.entries[:l.next]...)
+	}
+	return append(append([]DecisionRecord(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// Capacity returns how many decisions the log retains
+func (l *DecisionLog) Capacity() int {
+	return len(l.entries)
+}
+
+// SpanProcessor returns a span processor that copies reliability.decision events into the log as their spans end
+// Decisions are therefore logged in the order their spans finished, which may differ slightly from when they were made
+func (l *DecisionLog) SpanProcessor() sdktrace.SpanProcessor {
+	return decisionLogProcessor{log: l}
+}
+
+// decisionLogProcessor feeds a DecisionLog from finished spans
+type decisionLogProcessor struct {
+	log *DecisionLog
+}
+
+func (p decisionLogProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p decisionLogProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	for _, event := range s.Events() {
+		if event.Name != DecisionEvent {
+			continue
+		}
+		rec := DecisionRecord{
+			Timestamp: event.Time,
+			RequestID: s.SpanContext().TraceID().String(),
+		}
+		for _, kv := range event.Attributes {
+			switch kv.Key {
+			case "pattern":
+				rec.Pattern = kv.Value.AsString()
+			case "outcome":
+				rec.Outcome = kv.Value.AsString()
+			case "reason":
+				rec.Reason = kv.Value.AsString()
+			}
+		}
+		p.log.Record(rec)
+	}
+}
+
+func (p decisionLogProcessor) Shutdown(context.Context) error { return nil }
+
+func (p decisionLogProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,62 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestDecisionLogWrapsAtCapacity(t *testing.T) {
+	const capacity = 3
+	tests := []struct {
+		name        string
+		requests    int // One request per decision, each its own trace
+		wantReasons []string
+	}{
+		{name: "empty"},
+		{name: "partly filled", requests: 2, wantReasons: []string{"reason-0", "reason-1"}},
+		{name: "exactly full", requests: 3, wantReasons: []string{"reason-0", "reason-1", "reason-2"}},
+		{name: "wrapped keeps the newest", requests: 5, wantReasons: []string{"reason-2", "reason-3", "reason-4"}},
+		{name: "wrapped twice", requests: 7, wantReasons: []string{"reason-4", "reason-5", "reason-6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := NewDecisionLog(capacity)
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(log.SpanProcessor())).Tracer("test")
+
+			traceIDs := make(map[string]string) // Reason to the trace it was recorded on
+			for i := 0; i < tt.requests; i++ {
+				_, span := tracer.Start(context.Background(), "request")
+				reason := fmt.Sprintf("reason-%d", i)
+				recordDecision(span, PatternRetry, DecisionExhaust, reason)
+				span.AddEvent("unrelated") // Only decision events are logged
+				span.End()
+				traceIDs[reason] = span.SpanContext().TraceID().String()
+			}
+
+			entries := log.Entries()
+			var reasons []string
+			for _, e := range entries {
+				reasons = append(reasons, e.Reason)
+				if e.Pattern != PatternRetry || e.Outcome != DecisionExhaust {
+					t.Errorf("%s: pattern/outcome = %s/%s, want %s/%s", e.Reason, e.Pattern, e.Outcome, PatternRetry, DecisionExhaust)
+				}
+				if e.RequestID != traceIDs[e.Reason] {
+					t.Errorf("%s: request_id = %s, want its trace ID %s", e.Reason, e.RequestID, traceIDs[e.Reason])
+				}
+				if e.Timestamp.IsZero() {
+					t.Errorf("%s: timestamp not set", e.Reason)
+				}
+			}
+			if !slices.Equal(reasons, tt.wantReasons) {
+				t.Errorf("Entries() reasons = %v, want %v", reasons, tt.wantReasons)
+			}
+			if got := log.Capacity(); got != capacity {
+				t.Errorf("Capacity() = %d, want %d", got, capacity)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDecisionEvents(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	retry := RetryConfig{
+		MaxAttempts:     2,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		BackoffMultiple: 2,
+		MaxRetryAfter:   time.Second,
+		Deterministic:   true,
+		SafeMethods:     []string{http.MethodGet},
+	}
+	// call runs the retry policy against the failing server with the given method
+	call := func(span trace.Span, method string) {
+		resp, err := RetryableHTTPCall(context.Background(), span, retry, RetryRequest{Method: method}, func(ctx context.Context) (*http.Response, error) {
+			req, _ := http.NewRequestWithContext(ctx, method, failing.URL, nil)
+			return http.DefaultClient.Do(req)
+		})
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	newBreaker := func() *CircuitBreaker {
+		return NewCircuitBreaker(CircuitBreakerConfig{Name: "payment", MaxRequests: 1, Timeout: time.Minute, ConsecutiveFailures: 1, FailureRatio: 1, MinRequests: 100}, nil)
+	}
+
+	tests := []struct {
+		name string
+		run  func(span trace.Span)
+		want []string // pattern/outcome/reason of each event, in order
+	}{
+		{name: "bulkhead admits and breaker allows", run: func(span trace.Span) {
+			NewBulkhead(BulkheadConfig{MaxConcurrent: 1}, nil).Execute(context.Background(), span, func(context.Context) error {
+				return newBreaker().Execute(span, func() error { return nil })
+			})
+		}, want: []string{"bulkhead/admit/slot_free", "circuit_breaker/allow/closed"}},
+		{name: "bulkhead rejects a request that already gave up", run: func(span trace.Span) {
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 1}, nil)
+			noop := trace.SpanFromContext(context.Background())
+			holding, done := make(chan struct{}), make(chan struct{})
+			go bulkhead.Execute(context.Background(), noop, func(context.Context) error {
+				close(holding)
+				<-done
+				return nil
+			})
+			<-holding
+			defer close(done)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			bulkhead.Execute(ctx, span, func(context.Context) error { return nil })
+		}, want: []string{"bulkhead/reject/immediate"}},
+		{name: "open breaker rejects", run: func(span trace.Span) {
+			cb := newBreaker()
+			cb.Execute(span, func() error { return errors.New("payment service returned 500") })
+			cb.Execute(span, func() error { return nil })
+		}, want: []string{"circuit_breaker/allow/closed", "circuit_breaker/reject/open"}},
+		{name: "retry attempts then exhausts", run: func(span trace.Span) { call(span, http.MethodGet) },
+			want: []string{"retry/attempt/status_503", "retry/exhaust/max_attempts"}},
+		{name: "retry refuses an unsafe method", run: func(span trace.Span) { call(span, http.MethodPost) },
+			want: []string{"retry/exhaust/unsafe_method"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+			tt.run(span)
+			span.End()
+
+			var got []string
+			for _, event := range recorder.Ended()[0].Events() {
+				if event.Name != DecisionEvent {
+					continue
+				}
+				// Every decision carries exactly the three string attributes of the schema
+				attrs := make(map[string]string)
+				for _, kv := range event.Attributes {
+					attrs[string(kv.Key)] = kv.Value.AsString()
+				}
+				if len(event.Attributes) != 3 || attrs["pattern"] == "" || attrs["outcome"] == "" || attrs["reason"] == "" {
+					t.Errorf("decision event attributes = %v, want pattern, outcome and reason", event.Attributes)
+				}
+				got = append(got, attrs["pattern"]+"/"+attrs["outcome"]+"/"+attrs["reason"])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("decisions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package reliability
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// HealthChecker caches the result of a downstream health check for a TTL
+// Readiness probes from kubelets and load balancers can fire every second per replica;
+// caching keeps that from turning into a steady stream of calls to the downstream
+type HealthChecker struct {
+	mu             sync.Mutex
+	check          func(context.Context) error
+	ttl            time.Duration
+	jitterFraction float64
+	status         HealthStatus
+	nextCheck      time.Time
+	now            func() time.Time
+}
+
+// HealthStatus is the most recent downstream health check result
+type HealthStatus struct {
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// NewHealthChecker creates a cached checker that re-probes at most once per ttl
+// jitterFraction randomizes each refresh by ±fraction of ttl so replicas don't probe in lockstep
+func NewHealthChecker(check func(context.Context) error, ttl time.Duration, jitterFraction float64) *HealthChecker {
+	return &HealthChecker{
+		check:          check,
+		ttl:            ttl,
+		jitterFraction: jitterFraction,
+		now:            time.Now,
+	}
+}
+
+// Check returns the cached status, probing the downstream only when the cache has expired
+// The lock is held across the probe so concurrent callers share a single check
+func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	if !h.status.CheckedAt.IsZero() && now.Before(h.nextCheck) {
+		return h.status
+	}
+
+	status := HealthStatus{Healthy: true, CheckedAt: now}
+	if err := h.check(ctx); err != nil {
+		status.Healthy = false
+		status.Error = err.Error()
+	}
+
+	h.status = status
+	h.nextCheck = now.Add(h.jitteredTTL())
+	return status
+}
+
+// jitteredTTL returns ttl ± jitterFraction*ttl
+func (h *HealthChecker) jitteredTTL() time.Duration {
+	jitterRange := float64(h.ttl) * h.jitterFraction
+	jitter := (rand.Float64() * 2 * jitterRange) - jitterRange
+	return h.ttl + time.Duration(jitter)
+}
@@ -0,0 +1,92 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerProbesOncePerTTL(t *testing.T) {
+	const ttl = 10 * time.Second
+
+	tests := []struct {
+		name       string
+		checks     []time.Duration // Offsets from the first check at which Check is called
+		wantProbes int32
+	}{
+		{name: "single check", checks: []time.Duration{0}, wantProbes: 1},
+		{name: "checks within the jittered TTL are cached", checks: []time.Duration{0, time.Second, 5 * time.Second, 7 * time.Second}, wantProbes: 1},
+		{name: "check past the jittered TTL re-probes", checks: []time.Duration{0, 7 * time.Second, 13 * time.Second}, wantProbes: 2},
+		{name: "one probe per window", checks: []time.Duration{0, 13 * time.Second, 14 * time.Second, 26 * time.Second, 27 * time.Second}, wantProbes: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var probes atomic.Int32
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				probes.Add(1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer downstream.Close()
+
+			checker := NewHealthChecker(probeURL(downstream.URL), ttl, 0.2)
+			start := time.Now()
+			for _, offset := range tt.checks {
+				checker.now = func() time.Time { return start.Add(offset) }
+				if status := checker.Check(context.Background()); !status.Healthy {
+					t.Fatalf("status at +%v = %+v, want healthy", offset, status)
+				}
+			}
+
+			if got := probes.Load(); got != tt.wantProbes {
+				t.Errorf("downstream probed %d times, want %d", got, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerSharesConcurrentProbe(t *testing.T) {
+	var probes atomic.Int32
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer downstream.Close()
+
+	checker := NewHealthChecker(probeURL(downstream.URL), time.Minute, 0.1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status := checker.Check(context.Background()); status.Healthy || status.Error == "" {
+				t.Errorf("status = %+v, want the unhealthy result", status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := probes.Load(); got != 1 {
+		t.Errorf("downstream probed %d times by concurrent readiness checks, want 1", got)
+	}
+}
+
+// probeURL returns a health check that fails unless url answers 200
+func probeURL(url string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		resp, err := getCall(url)(ctx)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("health check returned %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
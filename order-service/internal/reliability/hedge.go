@@ -0,0 +1,137 @@
+package reliability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HedgingConfig controls request hedging for tail-latency reduction
+// Hedging is only safe because charges carry a stable idempotency key and are deduplicated downstream
+type HedgingConfig struct {
+	Enabled bool          `json:"enabled"`
+	Delay   time.Duration `json:"delay"` // Wait before firing the hedge; ~p95 latency of the downstream
+}
+
+// DefaultHedgingConfig returns hedging disabled with a delay suited to the 500ms payment budget
+func DefaultHedgingConfig() HedgingConfig {
+	return HedgingConfig{
+		Enabled: false,
+		Delay:   100 * time.Millisecond,
+	}
+}
+
+// hedgeBothReached counts hedged calls where both attempts were written to the downstream,
+// i.e. calls that relied on downstream idempotency to avoid a duplicate side effect
+var hedgeBothReached, _ = otel.Meter("order-service").Int64Counter("hedge.both_reached",
+	metric.WithDescription("Hedged calls where both the primary and the hedge reached the downstream"))
+
+// hedgeResult is the outcome of one racing attempt
+type hedgeResult struct {
+	hedge bool
+	resp  *http.Response
+	err   error
+}
+
+// HedgedHTTPCall runs fn and, if it hasn't returned within cfg.Delay, races a second identical call
+// The first successful result wins and the other attempt is cancelled; if both fail, the last failure is returned
+// A primary that fails before the delay is returned immediately so the retry policy can handle it
+// Both attempts may reach the downstream even though the loser is cancelled, so fn must send the same idempotency key every time
+func HedgedHTTPCall(ctx context.Context, span trace.Span, cfg HedgingConfig, fn func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	if !cfg.Enabled {
+		return fn(ctx)
+	}
+
+	// Buffered so the losing attempt can finish without a reader
+	results := make(chan hedgeResult, 2)
+	launch := func(hedge bool, reached *atomic.Bool) context.CancelFunc {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		// Once the request is written the downstream may act on it, whether or not we cancel afterwards
+		attemptCtx = httptrace.WithClientTrace(attemptCtx, &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err == nil {
+					reached.Store(true)
+				}
+			},
+		})
+		go func() {
+			// Attempts run on their own goroutine, where an unrecovered panic would crash the process
+			var resp *http.Response
+			err := recoverPanic(span, func() error {
+				var err error
+				resp, err = fn(attemptCtx)
+				return err
+			})
+			results <- hedgeResult{hedge: hedge, resp: resp, err: err}
+		}()
+		return cancel
+	}
+
+	var primaryReached, hedgeReached atomic.Bool
+	cancelPrimary := launch(false, &primaryReached)
+	defer cancelPrimary()
+
+	timer := time.NewTimer(cfg.Delay)
+	defer timer.Stop()
+
+	var cancelHedge context.CancelFunc
+	defer func() {
+		if cancelHedge != nil {
+			cancelHedge()
+		}
+	}()
+
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			span.AddEvent("hedge_fired", trace.WithAttributes(
+				attribute.Int64("hedge.delay_ms", cfg.Delay.Milliseconds()),
+			))
+			span.SetAttributes(attribute.Bool("hedge.fired", true))
+			cancelHedge = launch(true, &hedgeReached)
+			pending++
+
+		case r := <-results:
+			pending--
+			// Keep waiting on the other attempt if it may still succeed
+			if r.err != nil && pending > 0 {
+				continue
+			}
+			if cancelHedge != nil {
+				winner, cancelLoser := "primary", cancelHedge
+				if r.hedge {
+					winner, cancelLoser = "hedge", cancelPrimary
+				}
+				span.SetAttributes(attribute.String("hedge.winner", winner))
+				if pending > 0 {
+					// Cancel the loser now rather than on return, and close its response if it still produces one
+					cancelLoser()
+					span.AddEvent("hedge_loser_cancelled")
+					go func() {
+						if loser := <-results; loser.resp != nil && loser.resp.Body != nil {
+							loser.resp.Body.Close()
+						}
+					}()
+				}
+
+				bothReached := primaryReached.Load() && hedgeReached.Load()
+				span.SetAttributes(attribute.Bool("hedge.both_reached", bothReached))
+				if bothReached {
+					hedgeBothReached.Add(context.WithoutCancel(ctx), 1)
+				}
+			}
+			return r.resp, r.err
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
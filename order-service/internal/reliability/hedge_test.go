@@ -0,0 +1,91 @@
+package reliability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedHTTPCall(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		primaryDelay time.Duration // How long the first request takes to answer; later ones answer at once
+		primaryFails bool          // The first request answers with a 500 instead of a 200
+		wantStatus   int
+		wantCalls    int32
+		wantFired    bool
+		wantWinner   string
+		maxElapsed   time.Duration
+	}{
+		{name: "slow primary beaten by the hedge", enabled: true, primaryDelay: 500 * time.Millisecond,
+			wantStatus: http.StatusOK, wantCalls: 2, wantFired: true, wantWinner: "hedge", maxElapsed: 300 * time.Millisecond},
+		{name: "fast primary needs no hedge", enabled: true,
+			wantStatus: http.StatusOK, wantCalls: 1, maxElapsed: 100 * time.Millisecond},
+		{name: "early failure returned for retry", enabled: true, primaryFails: true,
+			wantStatus: http.StatusInternalServerError, wantCalls: 1, maxElapsed: 100 * time.Millisecond},
+		{name: "disabled waits out the slow primary", primaryDelay: 300 * time.Millisecond,
+			wantStatus: http.StatusOK, wantCalls: 1, maxElapsed: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			primaryCancelled := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) > 1 {
+					return
+				}
+				select {
+				case <-time.After(tt.primaryDelay):
+				case <-r.Context().Done():
+					close(primaryCancelled)
+					return
+				}
+				if tt.primaryFails {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer server.Close()
+
+			span, attrs := recordedSpan(t)
+			start := time.Now()
+			resp, err := HedgedHTTPCall(context.Background(), span, HedgingConfig{Enabled: tt.enabled, Delay: 50 * time.Millisecond}, getCall(server.URL))
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("call took %v, want at most %v", elapsed, tt.maxElapsed)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("downstream calls = %d, want %d", got, tt.wantCalls)
+			}
+			recorded := attrs()
+			if got := recorded["hedge.fired"].AsBool(); got != tt.wantFired {
+				t.Errorf("hedge.fired = %v, want %v", got, tt.wantFired)
+			}
+			if got := recorded["hedge.winner"].AsString(); got != tt.wantWinner {
+				t.Errorf("hedge.winner = %q, want %q", got, tt.wantWinner)
+			}
+			if tt.wantWinner == "hedge" {
+				// The losing primary is cancelled rather than left to run out its time
+				select {
+				case <-primaryCancelled:
+				case <-time.After(time.Second):
+					t.Error("slow primary wasn't cancelled after the hedge won")
+				}
+				if !recorded["hedge.both_reached"].AsBool() {
+					t.Error("hedge.both_reached = false, want true with both requests written")
+				}
+			}
+		})
+	}
+}
@@ -1,30 +1,111 @@
 package reliability
 
 import (
+	"container/list"
+	"context"
+	"hash/maphash"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// DefaultIdempotencyTTL is how long entries are retained unless a request asks for longer
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Approximate heap bytes held per entry, for capacity planning rather than accounting:
+// the map slot and key (a 36-byte UUID-sized string), the IdempotentResponse with its strings, and GC slack
+// With a per-merchant cap, each key is also held in the merchant's eviction list and index
+const (
+	idempotencyEntryBytes       = 400
+	idempotencyMerchantKeyBytes = 120
+)
+
+// idempotencyShards is the number of lock-striped buckets; a power of two so the hash can be masked
+const idempotencyShards = 32
+
 // IdempotencyStore tracks request idempotency keys to prevent duplicate processing
+// Keys are hashed into lock-striped shards so concurrent requests for different keys rarely contend
 // In production, use Redis or a database for distributed idempotency
 // This in-memory implementation is for demo purposes
 type IdempotencyStore struct {
+	seed   maphash.Seed
+	shards [idempotencyShards]idempotencyShard
+
+	// Per-merchant cap so one misbehaving merchant can't fill the store; 0 disables it
+	// merchantMu is always taken before a shard lock and held across the shard update so tracking stays in step with entries
+	maxPerMerchant int
+	merchantMu     sync.Mutex
+	merchants      map[string]*merchantKeys
+	evictions      metric.Int64Counter
+
+	entryBytes int // Estimated bytes per entry used by EstimatedBytes
+}
+
+// merchantKeys tracks one merchant's stored keys, oldest first, so the cap evicts in insertion order
+type merchantKeys struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+// idempotencyShard is one bucket of the store with its own lock
+type idempotencyShard struct {
 	mu      sync.RWMutex
 	entries map[string]*IdempotentResponse
 }
 
 // IdempotentResponse stores the cached response for an idempotency key
 type IdempotentResponse struct {
-	OrderID   string
-	Status    string
-	CreatedAt time.Time
+	OrderID    string
+	MerchantID string // Owner of the key, for the per-merchant cap
+	Status     string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // Set by the store from the entry's TTL
+
+	Fingerprint string // Digest of the request the key was used for; empty matches any request
+
+	replays int // Times the entry has been replayed; guarded by its shard's lock
 }
 
-// NewIdempotencyStore creates an in-memory idempotency store
-func NewIdempotencyStore() *IdempotencyStore {
+// NewIdempotencyStore creates an in-memory idempotency store holding at most maxPerMerchant keys per merchant (0 for no cap)
+// A merchant over its cap loses its own oldest keys; other merchants' entries are never evicted on its behalf
+// entryBytes overrides the built-in per-entry size estimate, e.g. after measuring real payloads; 0 keeps the default
+func NewIdempotencyStore(maxPerMerchant, entryBytes int) *IdempotencyStore {
+	meter := otel.Meter("order-service")
+	evictions, _ := meter.Int64Counter("idempotency.merchant_evictions",
+		metric.WithDescription("Idempotency keys evicted because their merchant exceeded its key cap"))
+	if entryBytes <= 0 {
+		entryBytes = idempotencyEntryBytes
+		if maxPerMerchant > 0 {
+			entryBytes += idempotencyMerchantKeyBytes
+		}
+	}
 	store := &IdempotencyStore{
-		entries: make(map[string]*IdempotentResponse),
+		seed:           maphash.MakeSeed(),
+		maxPerMerchant: maxPerMerchant,
+		merchants:      make(map[string]*merchantKeys),
+		evictions:      evictions,
+		entryBytes:     entryBytes,
 	}
+	for i := range store.shards {
+		store.shards[i].entries = make(map[string]*IdempotentResponse)
+	}
+
+	// Report size on each metrics collection so instances can be sized before moving to a shared store
+	meter.Int64ObservableGauge("idempotency.entries",
+		metric.WithDescription("Entries held by the in-memory idempotency store, including expired ones awaiting cleanup"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(store.Len()))
+			return nil
+		}))
+	meter.Int64ObservableGauge("idempotency.estimated_bytes",
+		metric.WithDescription("Estimated memory held by the in-memory idempotency store"),
+		metric.WithUnit("By"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(store.EstimatedBytes())
+			return nil
+		}))
 
 	// Start background cleanup goroutine to prevent memory leaks
 	go store.cleanup()
@@ -32,36 +113,245 @@ func NewIdempotencyStore() *IdempotencyStore {
 	return store
 }
 
+// shard returns the bucket responsible for key
+func (s *IdempotencyStore) shard(key string) *idempotencyShard {
+	return &s.shards[maphash.String(s.seed, key)&(idempotencyShards-1)]
+}
+
 // Get retrieves a cached response for an idempotency key
+// Expired entries are treated as missing even before cleanup removes them
 func (s *IdempotencyStore) Get(key string) (*IdempotentResponse, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	shard := s.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
 
-	resp, exists := s.entries[key]
+	resp, exists := shard.entries[key]
+	if exists && !time.Now().Before(resp.ExpiresAt) {
+		return nil, false
+	}
 	return resp, exists
 }
 
-// Set stores a response for an idempotency key
+// RecordReplay counts one more replay of the key's stored response and returns the new total
+// Returns 0 if the key isn't stored, e.g. it expired since it was read
+func (s *IdempotencyStore) RecordReplay(key string) int {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	resp, exists := shard.entries[key]
+	if !exists {
+		return 0
+	}
+	resp.replays++
+	return resp.replays
+}
+
+// Set stores a response for an idempotency key with the default TTL
 func (s *IdempotencyStore) Set(key string, resp *IdempotentResponse) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.SetWithTTL(key, resp, DefaultIdempotencyTTL)
+}
+
+// SetWithTTL stores a response that expires ttl after it was created
+func (s *IdempotencyStore) SetWithTTL(key string, resp *IdempotentResponse, ttl time.Duration) {
+	resp.ExpiresAt = resp.CreatedAt.Add(ttl)
+
+	shard := s.shard(key)
+	if s.maxPerMerchant <= 0 {
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+		shard.entries[key] = resp
+		return
+	}
+
+	s.merchantMu.Lock()
+	defer s.merchantMu.Unlock()
+
+	shard.mu.Lock()
+	prev := shard.entries[key]
+	shard.entries[key] = resp
+	shard.mu.Unlock()
+
+	// A key reused by another merchant now counts against the new owner only
+	if prev != nil && prev.MerchantID != resp.MerchantID {
+		s.untrack(prev.MerchantID, key)
+	}
+	evicted := s.track(resp.MerchantID, key)
+	for _, old := range evicted {
+		victim := s.shard(old)
+		victim.mu.Lock()
+		delete(victim.entries, old)
+		victim.mu.Unlock()
+	}
+	if len(evicted) > 0 {
+		s.evictions.Add(context.Background(), int64(len(evicted)))
+	}
+}
+
+// DeleteByOrderID removes every entry recording the given order, so its keys are treated as new, and returns how many were removed
+// Entries aren't indexed by order, so this scans every shard; it's meant for rare manual overrides, not the request path
+func (s *IdempotencyStore) DeleteByOrderID(orderID string) int {
+	if s.maxPerMerchant > 0 {
+		s.merchantMu.Lock()
+		defer s.merchantMu.Unlock()
+	}
+	removed := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if entry.OrderID == orderID {
+				delete(shard.entries, key)
+				if s.maxPerMerchant > 0 {
+					s.untrack(entry.MerchantID, key)
+				}
+				removed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return removed
+}
+
+// Len returns the number of stored entries, including expired ones not yet removed by cleanup
+func (s *IdempotencyStore) Len() int {
+	n := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		n += len(shard.entries)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// EstimatedBytes approximates the memory the store holds as entry count × estimated bytes per entry
+// It's a sizing aid, not an exact measurement: real usage varies with key and merchant ID lengths
+func (s *IdempotencyStore) EstimatedBytes() int64 {
+	return int64(s.Len()) * int64(s.entryBytes)
+}
+
+// IdempotencyStats is a point-in-time size report of the store
+type IdempotencyStats struct {
+	Entries        int   `json:"entries"`
+	BytesPerEntry  int   `json:"bytes_per_entry"`
+	EstimatedBytes int64 `json:"estimated_bytes"`
+}
+
+// Stats returns the store's current entry count and estimated footprint
+func (s *IdempotencyStore) Stats() IdempotencyStats {
+	n := s.Len()
+	return IdempotencyStats{
+		Entries:        n,
+		BytesPerEntry:  s.entryBytes,
+		EstimatedBytes: int64(n) * int64(s.entryBytes),
+	}
+}
+
+// MerchantKeys returns how many keys the store holds for a merchant; always 0 when the cap is disabled
+func (s *IdempotencyStore) MerchantKeys(merchantID string) int {
+	s.merchantMu.Lock()
+	defer s.merchantMu.Unlock()
+	if m, ok := s.merchants[merchantID]; ok {
+		return m.order.Len()
+	}
+	return 0
+}
 
-	s.entries[key] = resp
+// track records key for the merchant and returns the merchant's oldest keys that now exceed the cap
+// Callers must hold merchantMu
+func (s *IdempotencyStore) track(merchantID, key string) []string {
+	m, ok := s.merchants[merchantID]
+	if !ok {
+		m = &merchantKeys{order: list.New(), elems: make(map[string]*list.Element)}
+		s.merchants[merchantID] = m
+	}
+	if _, exists := m.elems[key]; !exists {
+		m.elems[key] = m.order.PushBack(key)
+	}
+
+	var evicted []string
+	for m.order.Len() > s.maxPerMerchant {
+		oldest := m.order.Remove(m.order.Front()).(string)
+		delete(m.elems, oldest)
+		evicted = append(evicted, oldest)
+	}
+	return evicted
 }
 
-// cleanup removes entries older than 24 hours to prevent unbounded growth
+// untrack forgets key for the merchant
+// Callers must hold merchantMu
+func (s *IdempotencyStore) untrack(merchantID, key string) {
+	m, ok := s.merchants[merchantID]
+	if !ok {
+		return
+	}
+	if elem, exists := m.elems[key]; exists {
+		m.order.Remove(elem)
+		delete(m.elems, key)
+	}
+	if m.order.Len() == 0 {
+		delete(s.merchants, merchantID)
+	}
+}
+
+// cleanup removes expired entries to prevent unbounded growth
+// Each entry carries its own expiry, so custom-TTL entries are removed on their own schedule
 func (s *IdempotencyStore) cleanup() {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		s.mu.Lock()
-		cutoff := time.Now().Add(-24 * time.Hour)
-		for key, entry := range s.entries {
-			if entry.CreatedAt.Before(cutoff) {
-				delete(s.entries, key)
+		s.removeExpired(time.Now())
+	}
+}
+
+// removeExpired deletes every entry whose expiry is at or before now
+// Shards are swept one at a time so lookups only ever wait on a single bucket; with a per-merchant cap, writes wait for the whole sweep
+func (s *IdempotencyStore) removeExpired(now time.Time) {
+	if s.maxPerMerchant > 0 {
+		s.merchantMu.Lock()
+		defer s.merchantMu.Unlock()
+	}
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if !now.Before(entry.ExpiresAt) {
+				delete(shard.entries, key)
+				if s.maxPerMerchant > 0 {
+					s.untrack(entry.MerchantID, key)
+				}
 			}
 		}
-		s.mu.Unlock()
+		shard.mu.Unlock()
+	}
+}
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey returns a context carrying the client's idempotency key, for layers below the handler
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the request's idempotency key, or "" if the client didn't send one
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	return key
+}
+
+type idempotencyTTLKey struct{}
+
+// WithIdempotencyTTL returns a context carrying a per-request idempotency retention override
+func WithIdempotencyTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, idempotencyTTLKey{}, ttl)
+}
+
+// IdempotencyTTLFromContext returns the request's retention override, defaulting to DefaultIdempotencyTTL
+func IdempotencyTTLFromContext(ctx context.Context) time.Duration {
+	if ttl, ok := ctx.Value(idempotencyTTLKey{}).(time.Duration); ok && ttl > 0 {
+		return ttl
 	}
+	return DefaultIdempotencyTTL
 }
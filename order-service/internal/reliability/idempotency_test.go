@@ -0,0 +1,354 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyPerEntryTTL(t *testing.T) {
+	created := time.Now()
+	entries := []struct {
+		key string
+		ttl time.Duration // 0 stores with the default TTL
+	}{
+		{key: "short", ttl: time.Hour},
+		{key: "default"},
+		{key: "long", ttl: 72 * time.Hour},
+	}
+
+	tests := []struct {
+		name     string
+		sweepAt  time.Duration // How long after the entries were created they're read and swept
+		wantKept []string
+	}{
+		{name: "before any expiry", sweepAt: 30 * time.Minute, wantKept: []string{"default", "long", "short"}},
+		{name: "custom TTL expires on its own schedule", sweepAt: 2 * time.Hour, wantKept: []string{"default", "long"}},
+		{name: "default TTL reached", sweepAt: DefaultIdempotencyTTL, wantKept: []string{"long"}},
+		{name: "extended TTL outlives the default", sweepAt: 48 * time.Hour, wantKept: []string{"long"}},
+		{name: "everything expired", sweepAt: 72 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(0, 0)
+			for _, e := range entries {
+				resp := &IdempotentResponse{OrderID: "order-" + e.key, MerchantID: "merchant_123", CreatedAt: created.Add(-tt.sweepAt)}
+				if e.ttl == 0 {
+					store.Set(e.key, resp)
+				} else {
+					store.SetWithTTL(e.key, resp, e.ttl)
+				}
+			}
+
+			// Created sweepAt ago, so reads now see exactly what a sweep at sweepAt would keep
+			var found []string
+			for _, e := range entries {
+				if _, ok := store.Get(e.key); ok {
+					found = append(found, e.key)
+				}
+			}
+			slices.Sort(found)
+			if !slices.Equal(found, tt.wantKept) {
+				t.Errorf("Get() finds %v, want %v", found, tt.wantKept)
+			}
+
+			store.removeExpired(time.Now())
+			if got := store.Len(); got != len(tt.wantKept) {
+				t.Errorf("after cleanup Len() = %d, want %d", got, len(tt.wantKept))
+			}
+		})
+	}
+}
+
+func TestIdempotencyTTLFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want time.Duration
+	}{
+		{name: "no override", ctx: context.Background(), want: DefaultIdempotencyTTL},
+		{name: "override", ctx: WithIdempotencyTTL(context.Background(), 48*time.Hour), want: 48 * time.Hour},
+		{name: "zero override ignored", ctx: WithIdempotencyTTL(context.Background(), 0), want: DefaultIdempotencyTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IdempotencyTTLFromContext(tt.ctx); got != tt.want {
+				t.Errorf("IdempotencyTTLFromContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyPerMerchantCap(t *testing.T) {
+	type write struct{ merchant, key string }
+	tests := []struct {
+		name      string
+		cap       int
+		writes    []write // Applied in order
+		wantKept  []string
+		wantCount map[string]int // MerchantKeys per merchant afterwards
+	}{
+		{
+			name:      "overflow evicts the merchant's own oldest",
+			cap:       2,
+			writes:    []write{{"noisy", "n1"}, {"quiet", "q1"}, {"noisy", "n2"}, {"noisy", "n3"}, {"noisy", "n4"}},
+			wantKept:  []string{"n3", "n4", "q1"},
+			wantCount: map[string]int{"noisy": 2, "quiet": 1},
+		},
+		{
+			name:      "both merchants at the cap",
+			cap:       2,
+			writes:    []write{{"quiet", "q1"}, {"quiet", "q2"}, {"noisy", "n1"}, {"noisy", "n2"}, {"noisy", "n3"}},
+			wantKept:  []string{"n2", "n3", "q1", "q2"},
+			wantCount: map[string]int{"noisy": 2, "quiet": 2},
+		},
+		{
+			name:      "rewriting a key doesn't count twice",
+			cap:       2,
+			writes:    []write{{"noisy", "n1"}, {"noisy", "n1"}, {"noisy", "n2"}},
+			wantKept:  []string{"n1", "n2"},
+			wantCount: map[string]int{"noisy": 2},
+		},
+		{
+			name:      "key taken over by another merchant moves its count",
+			cap:       2,
+			writes:    []write{{"quiet", "shared"}, {"noisy", "shared"}, {"noisy", "n1"}, {"noisy", "n2"}},
+			wantKept:  []string{"n1", "n2"},
+			wantCount: map[string]int{"noisy": 2, "quiet": 0},
+		},
+		{
+			name:     "no cap",
+			writes:   []write{{"noisy", "n1"}, {"noisy", "n2"}, {"noisy", "n3"}, {"quiet", "q1"}},
+			wantKept: []string{"n1", "n2", "n3", "q1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(tt.cap, 0)
+			var keys []string
+			for _, w := range tt.writes {
+				store.Set(w.key, &IdempotentResponse{OrderID: "order-" + w.key, MerchantID: w.merchant, CreatedAt: time.Now()})
+				if !slices.Contains(keys, w.key) {
+					keys = append(keys, w.key)
+				}
+			}
+
+			var kept []string
+			for _, key := range keys {
+				if _, ok := store.Get(key); ok {
+					kept = append(kept, key)
+				}
+			}
+			slices.Sort(kept)
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("stored keys = %v, want %v", kept, tt.wantKept)
+			}
+			for merchant, want := range tt.wantCount {
+				if got := store.MerchantKeys(merchant); got != want {
+					t.Errorf("MerchantKeys(%s) = %d, want %d", merchant, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreConcurrentAccess(t *testing.T) {
+	const workers, keysPerWorker = 16, 200
+	tests := []struct {
+		name           string
+		maxPerMerchant int
+	}{
+		{name: "uncapped"},
+		{name: "per-merchant cap", maxPerMerchant: workers * keysPerWorker}, // Takes merchantMu on every write without evicting
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(tt.maxPerMerchant, 0)
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < keysPerWorker; i++ {
+						key := fmt.Sprintf("key-%d-%d", w, i)
+						store.Set(key, &IdempotentResponse{OrderID: key, MerchantID: "merchant_123", CreatedAt: time.Now()})
+						// Every key is also read and replayed by the neighbouring worker, so shards see mixed traffic
+						if got, ok := store.Get(key); !ok || got.OrderID != key {
+							t.Errorf("Get(%s) = %+v, %v right after Set", key, got, ok)
+						}
+						store.RecordReplay(fmt.Sprintf("key-%d-%d", (w+1)%workers, i))
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			if got := store.Len(); got != workers*keysPerWorker {
+				t.Errorf("Len() = %d, want %d", got, workers*keysPerWorker)
+			}
+			if tt.maxPerMerchant > 0 {
+				if got := store.MerchantKeys("merchant_123"); got != workers*keysPerWorker {
+					t.Errorf("MerchantKeys() = %d, want %d", got, workers*keysPerWorker)
+				}
+			}
+			// Replays raced with the neighbour's Set, so each key saw at most one before this
+			for w := 0; w < workers; w++ {
+				key := fmt.Sprintf("key-%d-%d", w, keysPerWorker-1)
+				if got := store.RecordReplay(key); got < 1 || got > 2 {
+					t.Errorf("RecordReplay(%s) = %d, want 1 or 2", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyShardsLockIndependently(t *testing.T) {
+	store := NewIdempotencyStore(0, 0)
+	const held = "held-key"
+	var sameShard, otherShard string
+	for i := 0; sameShard == "" || otherShard == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if store.shard(key) == store.shard(held) {
+			sameShard = key
+		} else {
+			otherShard = key
+		}
+	}
+
+	tests := []struct {
+		name        string
+		key         string
+		wantBlocked bool
+	}{
+		{name: "key in another shard proceeds", key: otherShard},
+		{name: "key in the held shard waits", key: sameShard, wantBlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Stands in for a slow writer holding one bucket
+			shard := store.shard(held)
+			shard.mu.Lock()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				store.Set(tt.key, &IdempotentResponse{OrderID: tt.key, CreatedAt: time.Now()})
+				store.Get(tt.key)
+			}()
+
+			select {
+			case <-done:
+				if tt.wantBlocked {
+					t.Error("access completed while its shard was locked")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !tt.wantBlocked {
+					t.Error("access blocked on another shard's lock")
+				}
+			}
+			shard.mu.Unlock()
+			<-done
+		})
+	}
+}
+
+// singleLockStore is the store as it was before sharding, one RWMutex over one map, as a benchmark baseline
+type singleLockStore struct {
+	mu      sync.RWMutex
+	entries map[string]*IdempotentResponse
+}
+
+func (s *singleLockStore) Get(key string) (*IdempotentResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	resp, exists := s.entries[key]
+	if exists && !time.Now().Before(resp.ExpiresAt) {
+		return nil, false
+	}
+	return resp, exists
+}
+
+func (s *singleLockStore) Set(key string, resp *IdempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp.ExpiresAt = resp.CreatedAt.Add(DefaultIdempotencyTTL)
+	s.entries[key] = resp
+}
+
+// BenchmarkIdempotencyStore compares the sharded store with a single lock under parallel lookups and writes,
+// one write per ten lookups as when most requests carry fresh keys but retries replay
+// Run with -cpu 1,4,16 to see the single lock stop scaling
+func BenchmarkIdempotencyStore(b *testing.B) {
+	const keys = 10000
+	stores := []struct {
+		name  string
+		store interface {
+			Get(string) (*IdempotentResponse, bool)
+			Set(string, *IdempotentResponse)
+		}
+	}{
+		{name: "single_lock", store: &singleLockStore{entries: make(map[string]*IdempotentResponse)}},
+		{name: "sharded", store: NewIdempotencyStore(0, 0)},
+	}
+	for _, bb := range stores {
+		b.Run(bb.name, func(b *testing.B) {
+			names := make([]string, keys)
+			for i := range names {
+				names[i] = fmt.Sprintf("key-%d", i)
+				bb.store.Set(names[i], &IdempotentResponse{OrderID: names[i], CreatedAt: time.Now()})
+			}
+			var worker atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				// Each goroutine walks the keys from its own offset, so the only shared state is the store
+				n := worker.Add(1) * 7919
+				for pb.Next() {
+					n++
+					key := names[n%keys]
+					if n%10 == 0 {
+						bb.store.Set(key, &IdempotentResponse{OrderID: key, CreatedAt: time.Now()})
+					} else {
+						bb.store.Get(key)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestIdempotencyEstimatedBytes(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxPerMerchant int
+		entryBytes     int
+		wantPerEntry   int
+	}{
+		{name: "built-in estimate", wantPerEntry: idempotencyEntryBytes},
+		{name: "merchant cap adds its index", maxPerMerchant: 1000, wantPerEntry: idempotencyEntryBytes + idempotencyMerchantKeyBytes},
+		{name: "measured override", maxPerMerchant: 1000, entryBytes: 1024, wantPerEntry: 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(tt.maxPerMerchant, tt.entryBytes)
+			if got := store.EstimatedBytes(); got != 0 {
+				t.Errorf("empty store EstimatedBytes() = %d, want 0", got)
+			}
+			// Grow the store in steps; the estimate must track the entry count exactly
+			written := 0
+			for _, n := range []int{1, 10, 250} {
+				for ; written < n; written++ {
+					store.Set(fmt.Sprintf("key-%d", written), &IdempotentResponse{OrderID: fmt.Sprintf("order-%d", written), MerchantID: "merchant_123"})
+				}
+				want := int64(n * tt.wantPerEntry)
+				if got := store.EstimatedBytes(); got != want {
+					t.Errorf("EstimatedBytes() with %d entries = %d, want %d", n, got, want)
+				}
+				if got := store.Stats(); got != (IdempotencyStats{Entries: n, BytesPerEntry: tt.wantPerEntry, EstimatedBytes: want}) {
+					t.Errorf("Stats() with %d entries = %+v", n, got)
+				}
+			}
+		})
+	}
+}
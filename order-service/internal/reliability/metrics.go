@@ -0,0 +1,92 @@
+package reliability
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MetricsSink receives reliability events, keeping the retry, breaker and bulkhead logic independent of any metrics library
+// Implementations must be safe for concurrent use
+type MetricsSink interface {
+	IncRetry(reason string)                         // A failed attempt will be retried; reason is "error" or "status"
+	ObserveBackoff(d time.Duration)                 // Time slept before a retry
+	RecordBreakerState(breaker, state string)       // A breaker entered state ("closed", "half-open" or "open")
+	RecordBulkheadUsage(inUse, maxConcurrent int64) // Slots in use after a request acquired or released one
+	IncMalformedRetryAfter(reason string)           // A Retry-After header was ignored; reason is "non_numeric", "negative" or "implausible"
+}
+
+// NoopMetricsSink discards every event; used when no sink is configured
+type NoopMetricsSink struct{}
+
+func (NoopMetricsSink) IncRetry(string)                   {}
+func (NoopMetricsSink) ObserveBackoff(time.Duration)      {}
+func (NoopMetricsSink) RecordBreakerState(string, string) {}
+func (NoopMetricsSink) RecordBulkheadUsage(int64, int64)  {}
+func (NoopMetricsSink) IncMalformedRetryAfter(string)     {}
+
+// metricsOrNoop substitutes the no-op sink for nil so callers never need to check
+func metricsOrNoop(sink MetricsSink) MetricsSink {
+	if sink == nil {
+		return NoopMetricsSink{}
+	}
+	return sink
+}
+
+// OTelMetricsSink records reliability events as OpenTelemetry instruments
+// Export to Prometheus, StatsD or elsewhere is then a matter of collector configuration
+type OTelMetricsSink struct {
+	retries       metric.Int64Counter
+	backoff       metric.Float64Histogram
+	breakerStates metric.Int64Counter
+	bulkheadInUse metric.Int64Histogram
+
+	malformedRetryAfter metric.Int64Counter
+}
+
+// NewOTelMetricsSink creates a sink whose instruments are registered on meter
+func NewOTelMetricsSink(meter metric.Meter) *OTelMetricsSink {
+	retries, _ := meter.Int64Counter("retry.retries",
+		metric.WithDescription("Attempts that failed and were retried, by reason (error or status)"))
+	backoff, _ := meter.Float64Histogram("retry.backoff",
+		metric.WithDescription("Time slept before a retry"), metric.WithUnit("ms"))
+	breakerStates, _ := meter.Int64Counter("cb.state_changes",
+		metric.WithDescription("Circuit breaker state entries, by breaker and state"))
+	bulkheadInUse, _ := meter.Int64Histogram("bulkhead.in_use",
+		metric.WithDescription("Bulkhead slots in use, sampled on every acquire and release"))
+	malformedRetryAfter, _ := meter.Int64Counter("retry.malformed_retry_after",
+		metric.WithDescription("Retry-After headers ignored as malformed, by reason"))
+	return &OTelMetricsSink{
+		retries:       retries,
+		backoff:       backoff,
+		breakerStates: breakerStates,
+		bulkheadInUse: bulkheadInUse,
+
+		malformedRetryAfter: malformedRetryAfter,
+	}
+}
+
+func (s *OTelMetricsSink) IncRetry(reason string) {
+	s.retries.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+func (s *OTelMetricsSink) ObserveBackoff(d time.Duration) {
+	s.backoff.Record(context.Background(), float64(d)/float64(time.Millisecond))
+}
+
+func (s *OTelMetricsSink) RecordBreakerState(breaker, state string) {
+	s.breakerStates.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("breaker", breaker),
+		attribute.String("state", state),
+	))
+}
+
+func (s *OTelMetricsSink) RecordBulkheadUsage(inUse, maxConcurrent int64) {
+	s.bulkheadInUse.Record(context.Background(), inUse, metric.WithAttributes(attribute.Int64("max", maxConcurrent)))
+}
+
+func (s *OTelMetricsSink) IncMalformedRetryAfter(reason string) {
+	s.malformedRetryAfter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
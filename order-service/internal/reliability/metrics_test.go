@@ -0,0 +1,109 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeSink records each event it receives, e.g. "retry:status" or "breaker:payment:open"
+type fakeSink struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *fakeSink) record(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *fakeSink) IncRetry(reason string)             { s.record("retry:" + reason) }
+func (s *fakeSink) ObserveBackoff(time.Duration)       { s.record("backoff") }
+func (s *fakeSink) RecordBreakerState(b, state string) { s.record("breaker:" + b + ":" + state) }
+func (s *fakeSink) RecordBulkheadUsage(inUse, maxConcurrent int64) {
+	s.record(fmt.Sprintf("bulkhead:%d/%d", inUse, maxConcurrent))
+}
+func (s *fakeSink) IncMalformedRetryAfter(reason string) { s.record("malformed_retry_after:" + reason) }
+
+func TestMetricsSinkEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		failFirst int32 // Attempts answered with 503 before the downstream recovers
+		calls     int
+		want      []string
+	}{
+		{name: "retried until success", failFirst: 2, calls: 1, want: []string{
+			"breaker:payment:closed",
+			"bulkhead:1/2", "retry:status", "backoff", "retry:status", "backoff", "bulkhead:0/2",
+		}},
+		{name: "exhausted retries trip the breaker", failFirst: 100, calls: 3, want: []string{
+			"breaker:payment:closed",
+			"bulkhead:1/2", "retry:status", "backoff", "retry:status", "backoff", "bulkhead:0/2",
+			"bulkhead:1/2", "retry:status", "backoff", "retry:status", "backoff", "breaker:payment:open", "bulkhead:0/2",
+			// The open breaker turns the third call away without an attempt
+			"bulkhead:1/2", "bulkhead:0/2",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= tt.failFirst {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+
+			sink := &fakeSink{}
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 2}, sink)
+			cb := NewCircuitBreaker(CircuitBreakerConfig{
+				Name:                "payment",
+				MaxRequests:         1,
+				Timeout:             time.Minute,
+				ConsecutiveFailures: 2,
+				FailureRatio:        1,
+				MinRequests:         100,
+			}, sink)
+			retry := RetryConfig{
+				MaxAttempts:     3,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      time.Millisecond,
+				BackoffMultiple: 2,
+				MaxRetryAfter:   time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+				Metrics:         sink,
+			}
+			span := trace.SpanFromContext(context.Background())
+
+			for i := 0; i < tt.calls; i++ {
+				bulkhead.Execute(context.Background(), span, func(ctx context.Context) error {
+					return cb.Execute(span, func() error {
+						resp, err := RetryableHTTPCall(ctx, span, retry, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+						if err != nil {
+							return err
+						}
+						resp.Body.Close()
+						if resp.StatusCode >= 500 {
+							return fmt.Errorf("downstream returned %d", resp.StatusCode)
+						}
+						return nil
+					})
+				})
+			}
+
+			if !slices.Equal(sink.events, tt.want) {
+				t.Errorf("events =\n%v\nwant\n%v", sink.events, tt.want)
+			}
+		})
+	}
+}
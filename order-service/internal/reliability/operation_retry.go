@@ -0,0 +1,54 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OperationRetryConfig bounds retries of a whole multi-step operation, on top of any per-call retries inside it
+type OperationRetryConfig struct {
+	MaxAttempts int           `json:"max_attempts"` // 1 disables operation-level retries
+	Backoff     time.Duration `json:"backoff"`      // Fixed wait between attempts
+}
+
+// DefaultOperationRetryConfig returns operation-level retries disabled
+func DefaultOperationRetryConfig() OperationRetryConfig {
+	return OperationRetryConfig{
+		MaxAttempts: 1,
+		Backoff:     100 * time.Millisecond,
+	}
+}
+
+// RetryOperation runs fn until it succeeds, retryable reports false, attempts run out or ctx is done
+// fn must be safe to repeat, e.g. because every side effect it triggers is deduplicated downstream
+func RetryOperation(ctx context.Context, span trace.Span, cfg OperationRetryConfig, retryable func(error) bool, fn func(context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attribute.Int("operation_retry.attempt", attempt))
+
+		err = fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				span.SetAttributes(attribute.Bool("operation_retry.succeeded", true))
+			}
+			return nil
+		}
+		if attempt >= cfg.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		span.AddEvent("operation_retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		select {
+		case <-time.After(cfg.Backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("operation retry cancelled: %w (last error: %v)", ctx.Err(), err)
+		}
+	}
+}
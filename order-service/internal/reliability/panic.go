@@ -0,0 +1,35 @@
+package reliability
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PanicError is returned in place of a panic raised by a function run under a reliability pattern
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic runs fn and converts a panic into a *PanicError, recorded on the span
+// Used inside pattern wrappers so a panicking fn still releases bulkhead slots and counts as a breaker failure
+func recoverPanic(span trace.Span, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			span.RecordError(panicErr, trace.WithAttributes(attribute.String("exception.stacktrace", string(panicErr.Stack))))
+			span.SetAttributes(attribute.Bool("panic.recovered", true))
+			span.SetStatus(codes.Error, panicErr.Error())
+			err = panicErr
+		}
+	}()
+	return fn()
+}
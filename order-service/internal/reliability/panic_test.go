@@ -0,0 +1,76 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPanicsBecomeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// run calls a panicking fn through the pattern under test, then checks the pattern is still usable
+		run func(t *testing.T, span trace.Span) error
+	}{
+		{name: "bulkhead releases the slot", run: func(t *testing.T, span trace.Span) error {
+			bulkhead := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, MinRetryAfter: time.Millisecond}, nil)
+			err := bulkhead.Execute(context.Background(), span, func(context.Context) error { panic("boom") })
+
+			// With the only slot leaked this would wait out the deadline
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if next := bulkhead.Execute(ctx, trace.SpanFromContext(ctx), func(context.Context) error { return nil }); next != nil {
+				t.Errorf("call after the panic: %v, want the slot released", next)
+			}
+			return err
+		}},
+		{name: "circuit breaker counts a failure", run: func(t *testing.T, span trace.Span) error {
+			cb := NewCircuitBreaker(CircuitBreakerConfig{Name: "test", MaxRequests: 1, Timeout: time.Minute,
+				ConsecutiveFailures: 1, FailureRatio: 1, MinRequests: 100}, nil)
+			err := cb.Execute(span, func() error { panic("boom") })
+			if cb.State() != gobreaker.StateOpen {
+				t.Errorf("breaker state = %s, want open after a panic at a threshold of 1", cb.State())
+			}
+			return err
+		}},
+		{name: "retry doesn't repeat a panic", run: func(t *testing.T, span trace.Span) error {
+			attempts := 0
+			cfg := DefaultRetryConfig()
+			cfg.MaxAttempts = 3
+			cfg.InitialBackoff = time.Millisecond
+			_, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, func(ctx context.Context) (*http.Response, error) {
+				attempts++
+				return nil, recoverPanic(span, func() error { panic("boom") })
+			})
+			if attempts != 1 {
+				t.Errorf("attempts = %d, want 1", attempts)
+			}
+			return err
+		}},
+		{name: "hedged attempt on its own goroutine", run: func(t *testing.T, span trace.Span) error {
+			_, err := HedgedHTTPCall(context.Background(), span, HedgingConfig{Enabled: true, Delay: time.Second}, func(context.Context) (*http.Response, error) {
+				panic("boom")
+			})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, attrs := recordedSpan(t)
+			err := tt.run(t, span)
+
+			var panicErr *PanicError
+			if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+				t.Fatalf("err = %v, want a *PanicError carrying the value and stack", err)
+			}
+			if !attrs()["panic.recovered"].AsBool() {
+				t.Error("panic.recovered not recorded on the span")
+			}
+		})
+	}
+}
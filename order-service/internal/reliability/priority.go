@@ -0,0 +1,48 @@
+package reliability
+
+import "context"
+
+// Priority classifies a request for admission control
+// High-priority requests may use the bulkhead's reserved slots when the shared pool is saturated
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+// String returns the priority name for span attributes
+func (p Priority) String() string {
+	if p == PriorityHigh {
+		return "high"
+	}
+	return "normal"
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context carrying the request's admission priority
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+type adminKey struct{}
+
+// WithAdmin marks the request as authenticated admin traffic, admitted from the bulkhead's admin pool
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// IsAdmin reports whether the request was marked as admin traffic
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// PriorityFromContext returns the request's priority, defaulting to normal
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
@@ -1,11 +1,18 @@
 package reliability
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"math"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -15,11 +22,49 @@ import (
 
 // RetryConfig holds retry policy configuration
 type RetryConfig struct {
-	MaxAttempts     int
-	InitialBackoff  time.Duration
-	MaxBackoff      time.Duration
-	BackoffMultiple float64
-	JitterFraction  float64
+	MaxAttempts     int           `json:"max_attempts"`
+	InitialBackoff  time.Duration `json:"initial_backoff"`
+	MaxBackoff      time.Duration `json:"max_backoff"`
+	BackoffMultiple float64       `json:"backoff_multiple"`
+	JitterFraction  float64       `json:"jitter_fraction"`
+	MaxRetryAfter   time.Duration `json:"max_retry_after"` // Retry-After beyond this fails fast; shorter ones wait at most MaxBackoff
+	Deterministic   bool          `json:"deterministic"`   // Skip jitter so backoffs are exact; for tests only, production should keep jitter on
+	Metrics         MetricsSink   `json:"-"`               // Receives retry and backoff events; nil discards them
+
+	// HTTP methods safe to send more than once; a request carrying an idempotency key is retried whatever its method
+	SafeMethods []string `json:"safe_methods"`
+
+	// Retry-After values beyond this are metered as malformed and fail fast, never slept on or retried soon; 0 trusts any value
+	MaxPlausibleRetryAfter time.Duration `json:"max_plausible_retry_after"`
+
+	// Total time from the first attempt within which every attempt must finish: each attempt's context ends there, and
+	// a retry whose backoff would end past it is skipped, so attempts and backoffs together stay within the caller's
+	// budget. 0 leaves only MaxAttempts
+	MaxElapsedTime time.Duration `json:"max_elapsed_time"`
+
+	Adaptive *AdaptiveRetry `json:"-"` // Disables retries while the downstream is clearly down; nil always retries
+	Budget   *RetryBudget   `json:"-"` // Caps retries at a fraction of calls, shared by every call; nil always retries
+
+	// Checked between attempts for the request's idempotency key, so a retry stops once a concurrent request succeeded; nil never checks
+	Idempotency *IdempotencyStore `json:"-"`
+
+	// Decides whether an attempt's outcome is transient, e.g. to retry a downstream's 400 with a "temporary_hold" code;
+	// nil uses DefaultIsRetryable. It may read resp.Body freely: it gets the first classifyBodyLimit bytes, buffered,
+	// and the caller still receives the whole body
+	IsRetryable func(resp *http.Response, err error) bool `json:"-"`
+}
+
+// ErrRetryAfterExceeded is returned when the server asks us to wait longer than MaxRetryAfter
+var ErrRetryAfterExceeded = errors.New("retry-after exceeds ceiling")
+
+// CompletedElsewhereError is returned when a retry stops because a concurrent request with the same idempotency key
+// already completed; Response is that request's cached result
+type CompletedElsewhereError struct {
+	Response *IdempotentResponse
+}
+
+func (e *CompletedElsewhereError) Error() string {
+	return "completed by a concurrent request with the same idempotency key"
 }
 
 // DefaultRetryConfig returns sensible defaults for payment service retries
@@ -30,32 +75,235 @@ func DefaultRetryConfig() RetryConfig {
 		MaxBackoff:      1 * time.Second,
 		BackoffMultiple: 2.0,
 		JitterFraction:  0.3, // ±30% jitter to avoid thundering herd
+		MaxRetryAfter:   5 * time.Second,
+
+		SafeMethods: []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete},
+
+		MaxPlausibleRetryAfter: 24 * time.Hour,
+	}
+}
+
+// LoadRetryConfigFromEnv returns DefaultRetryConfig with the attempt count and backoff shape overridden from
+// RETRY_MAX_ATTEMPTS, RETRY_INITIAL_BACKOFF_MS, RETRY_MAX_BACKOFF_MS, RETRY_BACKOFF_MULTIPLE and RETRY_JITTER_FRACTION
+// An unset variable keeps its default, as does a malformed one, with a warning; a MaxAttempts below 1 or a
+// JitterFraction outside [0, 1] is returned as an error instead. RETRY_MAX_ATTEMPTS=1 disables retries
+func LoadRetryConfigFromEnv() (RetryConfig, error) {
+	cfg := DefaultRetryConfig()
+	cfg.MaxAttempts = retryEnv("RETRY_MAX_ATTEMPTS", cfg.MaxAttempts, strconv.Atoi)
+	cfg.InitialBackoff = retryEnv("RETRY_INITIAL_BACKOFF_MS", cfg.InitialBackoff, parseMillis)
+	cfg.MaxBackoff = retryEnv("RETRY_MAX_BACKOFF_MS", cfg.MaxBackoff, parseMillis)
+	cfg.BackoffMultiple = retryEnv("RETRY_BACKOFF_MULTIPLE", cfg.BackoffMultiple, parseFloat)
+	cfg.JitterFraction = retryEnv("RETRY_JITTER_FRACTION", cfg.JitterFraction, parseFloat)
+
+	var errs []error
+	if cfg.MaxAttempts < 1 {
+		errs = append(errs, errors.New("RETRY_MAX_ATTEMPTS must be at least 1"))
+	}
+	if cfg.JitterFraction < 0 || cfg.JitterFraction > 1 {
+		errs = append(errs, errors.New("RETRY_JITTER_FRACTION must be in [0, 1]"))
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// retryEnv parses the named variable, keeping def when it's unset or malformed
+func retryEnv[T any](name string, def T, parse func(string) (T, error)) T {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := parse(strings.TrimSpace(raw))
+	if err != nil {
+		log.Printf("WARNING: ignoring malformed %s=%q, using the default %v", name, raw, def)
+		return def
+	}
+	return v
+}
+
+func parseMillis(s string) (time.Duration, error) {
+	ms, err := strconv.Atoi(s)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return 0, fmt.Errorf("not a finite number: %s", s)
+	}
+	return f, err
+}
+
+// RetryRequest describes the call being retried, since repeating a non-idempotent request could apply it twice
+type RetryRequest struct {
+	Method         string
+	IdempotencyKey string // Makes any method, e.g. POST, safe to repeat when the downstream deduplicates on it
+}
+
+// allowsRetry reports whether req may be sent more than once under this policy
+func (cfg RetryConfig) allowsRetry(req RetryRequest) bool {
+	if req.IdempotencyKey != "" {
+		return true
+	}
+	for _, method := range cfg.SafeMethods {
+		if strings.EqualFold(method, req.Method) {
+			return true
+		}
 	}
+	return false
+}
+
+// RetryPolicies gives each downstream endpoint its own retry policy
+// e.g. a cheap, safe lookup can retry harder than an expensive, side-effecting charge
+// Merchants can also be assigned a named policy, e.g. more attempts for one whose downstream is flaky
+type RetryPolicies struct {
+	Default   RetryConfig
+	Endpoints map[string]RetryConfig // Endpoints without an entry use Default
+
+	Named     map[string]RetryConfig // Policies merchants can be assigned by name
+	Merchants map[string]string      // Merchant ID → policy name in Named
+}
+
+// For returns the retry policy for the named endpoint
+func (p RetryPolicies) For(endpoint string) RetryConfig {
+	if cfg, ok := p.Endpoints[endpoint]; ok {
+		return cfg
+	}
+	return p.Default
+}
+
+// ForMerchant returns the retry policy for a merchant's call to endpoint and the policy's name, for spans:
+// the merchant's assigned policy, else the endpoint's ("endpoint:<name>"), else the default ("default")
+func (p RetryPolicies) ForMerchant(endpoint, merchantID string) (RetryConfig, string) {
+	if name, ok := p.Merchants[merchantID]; ok {
+		if cfg, ok := p.Named[name]; ok {
+			return cfg, name
+		}
+	}
+	if cfg, ok := p.Endpoints[endpoint]; ok {
+		return cfg, "endpoint:" + endpoint
+	}
+	return p.Default, "default"
 }
 
 // RetryableHTTPCall executes an HTTP call with exponential backoff and jitter
-// Retries on transient failures: 5xx, 429, and network errors
-// Does NOT retry on 4xx client errors (except 429) as they indicate bad requests
-func RetryableHTTPCall(ctx context.Context, span trace.Span, cfg RetryConfig, fn func(context.Context) (*http.Response, error)) (*http.Response, error) {
+// By default retries on transient failures: 500/502/503/504, 429, and network errors
+// Does NOT retry on 4xx client errors (except 429) as they indicate bad requests,
+// nor on 501/505 which are permanent server-side conditions; cfg.IsRetryable replaces this rule
+// Only requests cfg deems idempotent are retried; any other request gets a single attempt
+// Returns the response of a successful or non-retryable attempt, which the caller must close. Giving up on a
+// retryable failure, whatever stopped the retries, always returns a nil response, its body already closed, and an
+// error wrapping the last attempt's error or status
+func RetryableHTTPCall(ctx context.Context, span trace.Span, cfg RetryConfig, req RetryRequest, fn func(context.Context) (*http.Response, error)) (*http.Response, error) {
 	var lastErr error
 	var resp *http.Response
+	metrics := metricsOrNoop(cfg.Metrics)
+	safe := cfg.allowsRetry(req)
+	span.SetAttributes(attribute.String("retry.method", req.Method))
+	cfg.Budget.Deposit()
+	if cfg.Adaptive != nil {
+		disabled, rate := cfg.Adaptive.State()
+		span.SetAttributes(
+			attribute.Bool("retry.adaptive.disabled", disabled),
+			attribute.Float64("retry.adaptive.success_rate", rate),
+		)
+	}
+
+	// Attribute latency to backoff vs. actual work, recorded on every exit path
+	var totalBackoff time.Duration
+	var sleeps int
+	start := time.Now()
+	timer := StageTimerFromContext(ctx)
+	summary := DecisionSummaryFromContext(ctx)
+	defer func() {
+		span.SetAttributes(
+			attribute.Int64("retry.total_backoff_ms", totalBackoff.Milliseconds()),
+			attribute.Int("retry.sleep_count", sleeps),
+			attribute.Int64("retry.elapsed_ms", time.Since(start).Milliseconds()),
+		)
+		if sleeps > 0 {
+			timer.Record("retry_backoff", totalBackoff)
+		}
+	}()
 
 	for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
+		// A concurrent request with the same idempotency key may have succeeded while we backed off; don't charge the downstream again
+		if attempt > 0 {
+			if cached, ok := cachedResult(ctx, cfg.Idempotency); ok {
+				span.SetAttributes(attribute.Bool("retry.short_circuited", true))
+				recordDecision(span, PatternRetry, DecisionExhaust, "completed_elsewhere")
+				return nil, &CompletedElsewhereError{Response: cached}
+			}
+		}
+
 		// Add attempt number to span for debugging
 		span.SetAttributes(attribute.Int("retry.attempt", attempt))
 
-		// Execute the function
-		resp, lastErr = fn(ctx)
+		// Execute the function, cut off at the total deadline however long the caller's context allows
+		attemptCtx, cancelAttempt := ctx, context.CancelFunc(func() {})
+		if cfg.MaxElapsedTime > 0 {
+			attemptCtx, cancelAttempt = context.WithDeadline(ctx, start.Add(cfg.MaxElapsedTime))
+		}
+		stop := timer.Time(fmt.Sprintf("attempt_%d", attempt+1))
+		resp, lastErr = fn(attemptCtx)
+		stop()
+		resp = cancelOnClose(resp, cancelAttempt)
+		retryable := DefaultIsRetryable(resp, lastErr)
+		if cfg.IsRetryable != nil {
+			retryable = classifyBuffered(cfg.IsRetryable, resp, lastErr)
+		}
+		cfg.Adaptive.Record(!retryable)
 
-		// Success case
-		if lastErr == nil && resp != nil && resp.StatusCode < 500 && resp.StatusCode != 429 {
-			if attempt > 0 {
+		// Success or permanent failure: return without retrying
+		if !retryable {
+			if lastErr == nil && attempt > 0 {
 				span.SetAttributes(attribute.Bool("retry.succeeded", true))
 			}
-			return resp, nil
+			// Read the body while the attempt's deadline still applies, then release the attempt, so a caller that
+			// never closes the response holds nothing open until MaxElapsedTime runs out
+			if cfg.MaxElapsedTime > 0 {
+				if err := bufferBody(resp); err != nil && lastErr == nil {
+					return nil, fmt.Errorf("reading response: %w", err)
+				}
+			}
+			return resp, lastErr
+		}
+
+		// Sending a non-idempotent request again could repeat its side effect, so surface the transient failure as is
+		if !safe {
+			span.SetAttributes(attribute.Bool("retry.unsafe_method", true))
+			recordDecision(span, PatternRetry, DecisionExhaust, "unsafe_method")
+			discardResponse(resp)
+			return nil, fmt.Errorf("not retried, %s request isn't idempotent: %w", req.Method, lastFailure(resp, lastErr))
+		}
+
+		// The downstream is failing nearly every call, so another attempt would only add load
+		if disabled, _ := cfg.Adaptive.State(); disabled && attempt < cfg.MaxAttempts-1 {
+			span.SetAttributes(attribute.Bool("retry.adaptive.skipped", true))
+			recordDecision(span, PatternRetry, DecisionExhaust, "adaptive_disabled")
+			span.SetStatus(codes.Error, "retries disabled by adaptive retry")
+			discardResponse(resp)
+			return nil, fmt.Errorf("retries disabled, downstream success rate too low: %w", lastFailure(resp, lastErr))
+		}
+
+		// Every call shares the budget, so during an outage retries stay a fraction of traffic instead of multiplying it
+		if attempt < cfg.MaxAttempts-1 && !cfg.Budget.Withdraw() {
+			span.AddEvent("retry_budget_exhausted", trace.WithAttributes(attribute.Int("retry.attempt", attempt)))
+			recordDecision(span, PatternRetry, DecisionExhaust, "budget_exhausted")
+			span.SetStatus(codes.Error, "retry budget exhausted")
+			discardResponse(resp)
+			return nil, fmt.Errorf("retry budget exhausted after %d attempts: %w", attempt+1, lastFailure(resp, lastErr))
 		}
 
 		// Record retry reason
+		if attempt < cfg.MaxAttempts-1 {
+			summary.AddRetry()
+			if lastErr != nil {
+				metrics.IncRetry("error")
+				recordDecision(span, PatternRetry, DecisionAttempt, "error")
+			} else {
+				metrics.IncRetry("status")
+				recordDecision(span, PatternRetry, DecisionAttempt, "status_"+strconv.Itoa(resp.StatusCode))
+			}
+		}
 		if lastErr != nil {
 			span.AddEvent("retry_due_to_error", trace.WithAttributes(
 				attribute.String("error", lastErr.Error()),
@@ -72,12 +320,47 @@ func RetryableHTTPCall(ctx context.Context, span trace.Span, cfg RetryConfig, fn
 		// Don't sleep after last attempt
 		if attempt < cfg.MaxAttempts-1 {
 			backoff := calculateBackoff(cfg, attempt)
+
+			// A server-provided Retry-After replaces our computed backoff, unless it's malformed, but never waits past
+			// MaxBackoff: a caller shouldn't stall longer than the policy allows. Past MaxRetryAfter the server is
+			// signalling an outage rather than throttling, so another attempt that soon is pointless; give up instead
+			if delay, ok := retryAfter(span, cfg, metrics, resp, time.Now()); ok {
+				span.SetAttributes(attribute.Int("retry.retry_after_requested_ms", int(delay.Milliseconds())))
+				if delay > cfg.MaxRetryAfter {
+					span.SetAttributes(attribute.String("retry.delay_limit", "fail_fast"))
+					recordDecision(span, PatternRetry, DecisionExhaust, "retry_after_exceeded")
+					span.SetStatus(codes.Error, "retry-after exceeds ceiling")
+					return nil, fmt.Errorf("%w: server asked for %s, ceiling is %s", ErrRetryAfterExceeded, delay, cfg.MaxRetryAfter)
+				}
+				if delay > cfg.MaxBackoff {
+					span.SetAttributes(attribute.String("retry.delay_limit", "max_backoff"))
+				} else {
+					span.SetAttributes(attribute.String("retry.delay_limit", "retry_after"))
+				}
+				backoff = min(delay, cfg.MaxBackoff)
+				span.SetAttributes(attribute.Int("retry.retry_after_ms", int(backoff.Milliseconds())))
+			}
+
 			span.SetAttributes(attribute.Int("retry.backoff_ms", int(backoff.Milliseconds())))
 
+			// The next attempt couldn't even start within the total budget, so give up now rather than sleep first
+			if cfg.MaxElapsedTime > 0 && time.Since(start)+backoff > cfg.MaxElapsedTime {
+				span.SetAttributes(attribute.Bool("retry.max_elapsed_exceeded", true))
+				recordDecision(span, PatternRetry, DecisionExhaust, "max_elapsed")
+				span.SetStatus(codes.Error, "retry max elapsed time exceeded")
+				return nil, fmt.Errorf("retry stopped after %d attempts, next backoff would exceed %s: %w", attempt+1, cfg.MaxElapsedTime, lastFailure(resp, lastErr))
+			}
+
+			sleeps++
+			sleepStart := time.Now()
 			select {
 			case <-time.After(backoff):
 				// Continue to next attempt
+				totalBackoff += time.Since(sleepStart)
+				metrics.ObserveBackoff(time.Since(sleepStart))
 			case <-ctx.Done():
+				totalBackoff += time.Since(sleepStart)
+				recordDecision(span, PatternRetry, DecisionExhaust, "cancelled")
 				span.SetStatus(codes.Error, "context cancelled during retry backoff")
 				return nil, fmt.Errorf("retry cancelled: %w", ctx.Err())
 			}
@@ -86,12 +369,194 @@ func RetryableHTTPCall(ctx context.Context, span trace.Span, cfg RetryConfig, fn
 
 	// All retries exhausted
 	span.SetAttributes(attribute.Bool("retry.exhausted", true))
+	recordDecision(span, PatternRetry, DecisionExhaust, "max_attempts")
 	span.SetStatus(codes.Error, "all retry attempts failed")
 
-	if lastErr != nil {
-		return nil, fmt.Errorf("retry exhausted after %d attempts: %w", cfg.MaxAttempts, lastErr)
+	return nil, fmt.Errorf("retry exhausted after %d attempts: %w", cfg.MaxAttempts, lastFailure(resp, lastErr))
+}
+
+// lastFailure describes the final attempt of a call that ran out of retries; its response, if any, was already closed
+// to retry, so only its status survives
+func lastFailure(resp *http.Response, err error) error {
+	switch {
+	case err != nil:
+		return err
+	case resp != nil:
+		return fmt.Errorf("downstream returned %d", resp.StatusCode)
+	default:
+		return errors.New("no response")
+	}
+}
+
+// discardResponse closes the body of a failed attempt the call is giving up on; lastFailure keeps its status
+func discardResponse(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
 	}
-	return resp, nil
+}
+
+// cancelOnClose ties an attempt's context to its response, releasing it once the body is closed, or at once if
+// there's no body to read
+func cancelOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil || resp.Body == nil {
+		cancel()
+		return resp
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+// bufferBody replaces resp's body with an in-memory copy and closes the original, cancelling its attempt's context
+func bufferBody(resp *http.Response) error {
+	if resp == nil || resp.Body == nil {
+		return nil
+	}
+	buf, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(buf))
+	return err
+}
+
+// cancelBody cancels its attempt's context on Close
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// cachedResult returns the stored response for the request's idempotency key, if the request has one and it's stored
+func cachedResult(ctx context.Context, store *IdempotencyStore) (*IdempotentResponse, bool) {
+	key := IdempotencyKeyFromContext(ctx)
+	if store == nil || key == "" {
+		return nil, false
+	}
+	return store.Get(key)
+}
+
+// classifyBodyLimit bounds how much of a response body is buffered for a custom classifier
+const classifyBodyLimit = 64 << 10 // 64KB
+
+// classifyBuffered runs classify with resp.Body swapped for a buffered copy of its start, so a classifier reading it
+// doesn't consume the body, then restores a body yielding the whole of it
+func classifyBuffered(classify func(*http.Response, error) bool, resp *http.Response, err error) bool {
+	if resp == nil || resp.Body == nil {
+		return classify(resp, err)
+	}
+	// A read error only cuts the buffer short; the caller sees it again reading the rest of the body
+	buf, _ := io.ReadAll(io.LimitReader(resp.Body, classifyBodyLimit))
+	body := resp.Body
+	resp.Body = io.NopCloser(bytes.NewReader(buf))
+	retryable := classify(resp, err)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), body), body}
+	return retryable
+}
+
+// DefaultIsRetryable is the default classifier deciding whether an attempt's outcome is transient
+// A response takes precedence over the error since callers may return both for non-2xx statuses
+// Custom classifiers can fall back to it for the cases they don't handle
+func DefaultIsRetryable(resp *http.Response, err error) bool {
+	if resp != nil {
+		return isRetryableStatus(resp.StatusCode)
+	}
+	// A recovered panic is a bug, not a transient failure
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return false
+	}
+	// No response at all means a network-level failure
+	return err != nil
+}
+
+// isRetryableStatus reports whether a status code indicates a transient failure
+// 501 (Not Implemented) and 505 (HTTP Version Not Supported) will never succeed on retry
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reasons a Retry-After header is malformed; all but retryAfterImplausible are ignored
+const (
+	retryAfterNonNumeric  = "non_numeric" // Neither delta-seconds nor an HTTP-date
+	retryAfterNegative    = "negative"
+	retryAfterImplausible = "implausible" // Beyond MaxPlausibleRetryAfter, or too large to represent at all
+)
+
+// retryAfter extracts the server-requested delay from a Retry-After header, typically sent with 429 or 503
+// The caller caps the delay at MaxBackoff
+// A malformed value is recorded on the span, logged and metered, then ignored so the computed backoff applies, except
+// an implausibly large one: it's returned as is so the caller fails fast, as for any delay past MaxRetryAfter
+func retryAfter(span trace.Span, cfg RetryConfig, metrics MetricsSink, resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	delay, malformed := parseRetryAfter(value, now, cfg.MaxPlausibleRetryAfter)
+	if malformed != "" {
+		// The value comes from the downstream, so bound what ends up in logs and traces
+		if len(value) > 64 {
+			value = value[:64]
+		}
+		span.AddEvent("retry_after_malformed", trace.WithAttributes(
+			attribute.String("retry.retry_after_value", value),
+			attribute.String("reason", malformed),
+		))
+		metrics.IncMalformedRetryAfter(malformed)
+		// Asking for that long says the downstream is down, not throttling; retrying soon would only hammer it
+		if malformed == retryAfterImplausible {
+			log.Printf("Implausible Retry-After %q; failing fast", value)
+			return delay, true
+		}
+		log.Printf("Ignoring malformed Retry-After %q (%s); using computed backoff", value, malformed)
+		return 0, false
+	}
+	return delay, true
+}
+
+// parseRetryAfter parses delta-seconds ("120") and HTTP-date ("Wed, 21 Oct 2015 07:28:00 GMT") forms
+// It returns the delay, or the reason the value is malformed; a date in the past means retry now
+// An implausible delay still comes back, saturated at the largest duration if it can't be represented
+func parseRetryAfter(value string, now time.Time, maxPlausible time.Duration) (time.Duration, string) {
+	value = strings.TrimSpace(value)
+	var delay time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		switch {
+		case strings.HasPrefix(value, "-"):
+			return 0, retryAfterNegative
+		// Multiplying out would overflow time.Duration and wrap to a negative delay, i.e. no sleep at all
+		case err != nil || seconds > int64(math.MaxInt64/time.Second):
+			return math.MaxInt64, retryAfterImplausible
+		}
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = max(date.Sub(now), 0) // Sub saturates rather than overflowing for far-off dates
+	} else {
+		return 0, retryAfterNonNumeric
+	}
+
+	if maxPlausible > 0 && delay > maxPlausible {
+		return delay, retryAfterImplausible
+	}
+	return delay, ""
 }
 
 // calculateBackoff computes exponential backoff with jitter
@@ -105,6 +570,11 @@ func calculateBackoff(cfg RetryConfig, attempt int) time.Duration {
 		backoff = float64(cfg.MaxBackoff)
 	}
 
+	// Deterministic mode and zero jitter never touch the RNG, so sleeps are exactly reproducible
+	if cfg.Deterministic || cfg.JitterFraction == 0 {
+		return time.Duration(backoff)
+	}
+
 	// Add jitter: ±jitterFraction of backoff
 	jitterRange := backoff * cfg.JitterFraction
 	jitter := (rand.Float64() * 2 * jitterRange) - jitterRange
@@ -0,0 +1,126 @@
+package reliability
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RetryBudgetConfig caps retries at a fraction of traffic, so an outage can't multiply load by MaxAttempts
+// Unlike adaptive disablement it doesn't wait for the success rate to collapse: retries beyond the budget are
+// refused at once, while those within it still ride out isolated failures
+type RetryBudgetConfig struct {
+	Enabled      bool    `json:"enabled"`
+	Ratio        float64 `json:"ratio"`          // Retries earned per call, e.g. 0.1 allows retrying one call in ten
+	MinPerSecond float64 `json:"min_per_second"` // Retries allowed per second whatever the traffic, so a quiet service can still retry
+	MaxTokens    float64 `json:"max_tokens"`     // Most retries saved up, bounding the burst after a quiet spell
+}
+
+// DefaultRetryBudgetConfig returns the budget off, allowing retries of 10% of calls when enabled
+func DefaultRetryBudgetConfig() RetryBudgetConfig {
+	return RetryBudgetConfig{
+		Enabled:      false,
+		Ratio:        0.1,
+		MinPerSecond: 1,
+		MaxTokens:    10,
+	}
+}
+
+// RetryBudget is a token bucket shared by every call it guards: each call deposits Ratio tokens, time adds
+// MinPerSecond, and each retry withdraws one
+// All methods are safe on a nil receiver, which always allows retries
+type RetryBudget struct {
+	mu     sync.Mutex
+	cfg    RetryBudgetConfig
+	tokens float64
+	last   time.Time // When tokens was last refilled
+	now    func() time.Time
+}
+
+// RetryBudgetStatus is the budget's current level and refill rate, for operators watching how close retries are
+// to being refused
+type RetryBudgetStatus struct {
+	Enabled      bool    `json:"enabled"`
+	Tokens       float64 `json:"tokens"` // Retries available right now
+	MaxTokens    float64 `json:"max_tokens"`
+	Ratio        float64 `json:"ratio"`
+	MinPerSecond float64 `json:"min_per_second"`
+}
+
+// NewRetryBudget creates a full budget from cfg, or returns nil when the budget is off
+// The level is reported as the retry.budget.tokens gauge on each metrics collection
+func NewRetryBudget(cfg RetryBudgetConfig) *RetryBudget {
+	if !cfg.Enabled {
+		return nil
+	}
+	b := &RetryBudget{cfg: cfg, tokens: cfg.MaxTokens, last: time.Now(), now: time.Now}
+
+	otel.Meter("order-service").Float64ObservableGauge("retry.budget.tokens",
+		metric.WithDescription("Retries the shared retry budget allows right now; at 0 failed calls aren't retried"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			o.Observe(b.Remaining())
+			return nil
+		}))
+	return b
+}
+
+// Deposit credits the budget for one call, before any of its retries
+func (b *RetryBudget) Deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	b.tokens = min(b.tokens+b.cfg.Ratio, b.cfg.MaxTokens)
+}
+
+// Withdraw takes the token for one retry, reporting false if the budget is exhausted
+func (b *RetryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Remaining returns the retries currently available
+func (b *RetryBudget) Remaining() float64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	return b.tokens
+}
+
+// Status returns the budget's current level and configuration; a nil budget reports itself disabled
+func (b *RetryBudget) Status() RetryBudgetStatus {
+	if b == nil {
+		return RetryBudgetStatus{}
+	}
+	return RetryBudgetStatus{
+		Enabled:      true,
+		Tokens:       b.Remaining(),
+		MaxTokens:    b.cfg.MaxTokens,
+		Ratio:        b.cfg.Ratio,
+		MinPerSecond: b.cfg.MinPerSecond,
+	}
+}
+
+// refillLocked adds the MinPerSecond allowance accrued since the last refill
+func (b *RetryBudget) refillLocked() {
+	now := b.now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.cfg.MinPerSecond, b.cfg.MaxTokens)
+	b.last = now
+}
@@ -0,0 +1,164 @@
+package reliability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeBudgetClock is a settable clock for RetryBudget refills
+type fakeBudgetClock struct{ t time.Time }
+
+func (c *fakeBudgetClock) now() time.Time { return c.t }
+
+func TestRetryBudgetTokens(t *testing.T) {
+	cfg := RetryBudgetConfig{Enabled: true, Ratio: 0.5, MinPerSecond: 2, MaxTokens: 10}
+
+	tests := []struct {
+		name      string
+		deposits  int
+		withdraws int
+		elapsed   time.Duration
+		want      float64
+	}{
+		{name: "starts full", want: 10},
+		{name: "retries draw it down", withdraws: 4, want: 6},
+		{name: "calls earn tokens back", withdraws: 4, deposits: 2, want: 7},
+		{name: "time refills it", withdraws: 6, elapsed: 1500 * time.Millisecond, want: 7},
+		{name: "refill stops at max", withdraws: 2, elapsed: time.Minute, want: 10},
+		{name: "drained budget refuses more", withdraws: 15, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeBudgetClock{t: time.Unix(1000, 0)}
+			b := NewRetryBudget(cfg)
+			b.now, b.last = clock.now, clock.t
+
+			for i := 0; i < tt.withdraws; i++ {
+				b.Withdraw()
+			}
+			for i := 0; i < tt.deposits; i++ {
+				b.Deposit()
+			}
+			clock.t = clock.t.Add(tt.elapsed)
+
+			status := b.Status()
+			if status.Tokens != tt.want {
+				t.Errorf("Tokens = %v, want %v", status.Tokens, tt.want)
+			}
+			if !status.Enabled || status.Ratio != cfg.Ratio || status.MinPerSecond != cfg.MinPerSecond {
+				t.Errorf("Status() = %+v, want the configured rates", status)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetStatusDrainsWithRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	clock := &fakeBudgetClock{t: time.Unix(1000, 0)}
+	b := NewRetryBudget(RetryBudgetConfig{Enabled: true, Ratio: 0, MinPerSecond: 1, MaxTokens: 5})
+	b.now, b.last = clock.now, clock.t
+
+	cfg := RetryConfig{MaxAttempts: 3, MaxRetryAfter: time.Second, Deterministic: true, SafeMethods: []string{http.MethodGet}, Budget: b}
+	span := trace.SpanFromContext(context.Background())
+	call := func(ctx context.Context) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		return http.DefaultClient.Do(req)
+	}
+
+	for _, want := range []float64{3, 1, 0} {
+		resp, _ := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, call)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if got := b.Status().Tokens; got != want {
+			t.Fatalf("Tokens after call = %v, want %v", got, want)
+		}
+	}
+
+	clock.t = clock.t.Add(3 * time.Second)
+	if got := b.Status().Tokens; got != 3 {
+		t.Errorf("Tokens after 3s = %v, want 3", got)
+	}
+}
+
+func TestRetryBudgetStatusNil(t *testing.T) {
+	var b *RetryBudget
+	if got := b.Status(); got != (RetryBudgetStatus{}) {
+		t.Errorf("nil Status() = %+v, want disabled", got)
+	}
+}
+
+func TestRetryBudgetSuppressesRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		budget        bool
+		wantAttempts  []int32 // Per call, in order, against a downstream that always fails
+		wantExhausted []bool  // Whether each call recorded retry_budget_exhausted
+	}{
+		{name: "no budget retries every call in full", wantAttempts: []int32{3, 3, 3, 3}, wantExhausted: []bool{false, false, false, false}},
+		// 3 tokens: the first call spends 2, the second gets 1 retry, then calls run once
+		{name: "drained budget stops retrying", budget: true, wantAttempts: []int32{3, 2, 1, 1}, wantExhausted: []bool{false, true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			var budget *RetryBudget
+			if tt.budget {
+				clock := &fakeBudgetClock{t: time.Unix(1000, 0)} // Frozen, so nothing refills mid-test
+				budget = NewRetryBudget(RetryBudgetConfig{Enabled: true, MaxTokens: 3})
+				budget.now, budget.last = clock.now, clock.t
+			}
+			// Calls alternate between two policies, as endpoints and merchants do; both draw on the one budget
+			policies := []RetryConfig{
+				{MaxAttempts: 3, MaxRetryAfter: time.Second, Deterministic: true, SafeMethods: []string{http.MethodGet}, Budget: budget},
+				{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, BackoffMultiple: 2,
+					MaxRetryAfter: time.Second, SafeMethods: []string{http.MethodGet}, Budget: budget},
+			}
+
+			for i := range tt.wantAttempts {
+				recorder := tracetest.NewSpanRecorder()
+				_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+				attempts.Store(0)
+				resp, err := RetryableHTTPCall(context.Background(), span, policies[i%2], RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+				span.End()
+				if resp != nil {
+					resp.Body.Close()
+					t.Errorf("call %d returned a %d response, want only an error once it gives up", i+1, resp.StatusCode)
+				}
+				if err == nil || !strings.Contains(err.Error(), "downstream returned 503") {
+					t.Errorf("call %d error = %v, want one carrying the last 503", i+1, err)
+				}
+
+				if got := attempts.Load(); got != tt.wantAttempts[i] {
+					t.Errorf("call %d made %d attempts, want %d", i+1, got, tt.wantAttempts[i])
+				}
+				exhausted := slices.ContainsFunc(recorder.Ended()[0].Events(), func(e sdktrace.Event) bool {
+					return e.Name == "retry_budget_exhausted"
+				})
+				if exhausted != tt.wantExhausted[i] {
+					t.Errorf("call %d retry_budget_exhausted = %v, want %v", i+1, exhausted, tt.wantExhausted[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,723 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordedSpan starts a span whose attributes can be read back once ended
+func recordedSpan(t *testing.T) (trace.Span, func() map[attribute.Key]attribute.Value) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+	return span, func() map[attribute.Key]attribute.Value {
+		span.End()
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range recorder.Ended()[0].Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		return attrs
+	}
+}
+
+// getCall returns a call issuing GET requests to url
+func getCall(url string) func(context.Context) (*http.Response, error) {
+	return func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		return http.DefaultClient.Do(req)
+	}
+}
+
+func TestRetryAfterCappedAtMaxBackoff(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    string
+		maxBackoff    time.Duration
+		maxRetryAfter time.Duration
+		wantErr       error
+		wantLimit     string
+		wantSleptMs   int64 // retry.retry_after_ms, the delay actually waited
+		wantAttempts  int32
+	}{
+		{name: "within max backoff is honored", retryAfter: "1", maxBackoff: 2 * time.Second, maxRetryAfter: 5 * time.Second,
+			wantLimit: "retry_after", wantSleptMs: 1000, wantAttempts: 2},
+		{name: "above max backoff is clamped and retried", retryAfter: "3", maxBackoff: 20 * time.Millisecond, maxRetryAfter: 5 * time.Second,
+			wantLimit: "max_backoff", wantSleptMs: 20, wantAttempts: 2},
+		{name: "above the ceiling fails fast", retryAfter: "10", maxBackoff: 20 * time.Millisecond, maxRetryAfter: 5 * time.Second,
+			wantErr: ErrRetryAfterExceeded, wantLimit: "fail_fast", wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     2,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      tt.maxBackoff,
+				BackoffMultiple: 2,
+				MaxRetryAfter:   tt.maxRetryAfter,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+			}
+			span, attrs := recordedSpan(t)
+			start := time.Now()
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			elapsed := time.Since(start)
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if elapsed > tt.maxBackoff+time.Second {
+				t.Errorf("took %v, want at most the max backoff %v plus slack", elapsed, tt.maxBackoff)
+			}
+			got := attrs()
+			if limit := got["retry.delay_limit"].AsString(); limit != tt.wantLimit {
+				t.Errorf("retry.delay_limit = %q, want %q", limit, tt.wantLimit)
+			}
+			if tt.wantErr == nil && got["retry.retry_after_ms"].AsInt64() != tt.wantSleptMs {
+				t.Errorf("retry.retry_after_ms = %d, want %d", got["retry.retry_after_ms"].AsInt64(), tt.wantSleptMs)
+			}
+		})
+	}
+}
+
+func TestRetryClassifierReadsBody(t *testing.T) {
+	// Retries a 400 whose body carries a temporary_hold code, deferring to the default rule otherwise
+	temporaryHold := func(resp *http.Response, err error) bool {
+		if resp != nil && resp.StatusCode == http.StatusBadRequest {
+			body, _ := io.ReadAll(resp.Body)
+			return strings.Contains(string(body), `"temporary_hold"`)
+		}
+		return DefaultIsRetryable(resp, err)
+	}
+
+	tests := []struct {
+		name         string
+		classify     func(*http.Response, error) bool
+		status       int
+		body         string
+		wantAttempts int32
+	}{
+		{name: "temporary hold is retried", classify: temporaryHold, status: http.StatusBadRequest,
+			body: `{"code":"temporary_hold"}`, wantAttempts: 3},
+		{name: "other 400 isn't retried", classify: temporaryHold, status: http.StatusBadRequest,
+			body: `{"code":"invalid_amount"}`, wantAttempts: 1},
+		{name: "custom classifier falls back to default for 503", classify: temporaryHold, status: http.StatusServiceUnavailable,
+			body: "busy", wantAttempts: 3},
+		{name: "default classifier doesn't retry 400", status: http.StatusBadRequest,
+			body: `{"code":"temporary_hold"}`, wantAttempts: 1},
+		{name: "default classifier retries 503", status: http.StatusServiceUnavailable, body: "busy", wantAttempts: 3},
+		{name: "default classifier doesn't retry 501", status: http.StatusNotImplemented, body: "nope", wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     3,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      time.Millisecond,
+				BackoffMultiple: 1,
+				MaxRetryAfter:   time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+				IsRetryable:     tt.classify,
+			}
+			span := trace.SpanFromContext(context.Background())
+			resp, _ := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			// A response not retried reaches the caller with its whole body, even after the classifier read it
+			if tt.wantAttempts > 1 {
+				return
+			}
+			defer resp.Body.Close()
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("body after classifying = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestClassifyBufferedKeepsLongBodies(t *testing.T) {
+	body := strings.Repeat("x", classifyBodyLimit+100)
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(strings.NewReader(body))}
+
+	var seen int
+	classifyBuffered(func(resp *http.Response, err error) bool {
+		b, _ := io.ReadAll(resp.Body)
+		seen = len(b)
+		return false
+	}, resp, nil)
+
+	if seen != classifyBodyLimit {
+		t.Errorf("classifier read %d bytes, want the %d buffered", seen, classifyBodyLimit)
+	}
+	if rest, _ := io.ReadAll(resp.Body); len(rest) != len(body) {
+		t.Errorf("caller read %d bytes, want all %d", len(rest), len(body))
+	}
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		delay        time.Duration // Server response time
+		status       int
+		maxAttempts  int
+		maxElapsed   time.Duration
+		wantAttempts int32
+		wantMax      time.Duration // Longest the call may take
+		wantErr      error
+	}{
+		{name: "slow attempt cut off at the deadline", delay: 500 * time.Millisecond, status: http.StatusOK, maxAttempts: 3,
+			maxElapsed: 50 * time.Millisecond, wantAttempts: 1, wantMax: 300 * time.Millisecond, wantErr: context.DeadlineExceeded},
+		{name: "backoff past the deadline stops retries", status: http.StatusServiceUnavailable, maxAttempts: 10,
+			maxElapsed: 50 * time.Millisecond, wantAttempts: 2, wantMax: 300 * time.Millisecond},
+		{name: "retries within the deadline continue", status: http.StatusServiceUnavailable, maxAttempts: 2,
+			maxElapsed: 5 * time.Second, wantAttempts: 2, wantMax: time.Second},
+		{name: "no deadline leaves max attempts", status: http.StatusServiceUnavailable, maxAttempts: 3,
+			wantAttempts: 3, wantMax: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+					return
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     tt.maxAttempts,
+				InitialBackoff:  30 * time.Millisecond,
+				MaxBackoff:      time.Second,
+				BackoffMultiple: 2,
+				MaxRetryAfter:   time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+				MaxElapsedTime:  tt.maxElapsed,
+			}
+			span := trace.SpanFromContext(context.Background())
+			start := time.Now()
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			elapsed := time.Since(start)
+
+			// Running out of time or attempts is an error, never a response whose body was already closed
+			if err == nil || resp != nil {
+				t.Fatalf("RetryableHTTPCall() = %v, %v, want only an error", resp, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if elapsed > tt.wantMax {
+				t.Errorf("took %v, want at most %v", elapsed, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRetryReturnedResponseReleasesAttempt(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "success", status: http.StatusOK, body: "charged"},
+		{name: "permanent failure", status: http.StatusBadRequest, body: "bad amount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			var attemptCtx context.Context
+			call := getCall(server.URL)
+			cfg := RetryConfig{MaxAttempts: 2, MaxBackoff: time.Millisecond, MaxRetryAfter: time.Second, MaxElapsedTime: time.Minute}
+			resp, err := RetryableHTTPCall(context.Background(), trace.SpanFromContext(context.Background()), cfg,
+				RetryRequest{Method: http.MethodGet}, func(ctx context.Context) (*http.Response, error) {
+					attemptCtx = ctx
+					return call(ctx)
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Released before the caller closes the body, rather than once MaxElapsedTime runs out
+			if !errors.Is(attemptCtx.Err(), context.Canceled) {
+				t.Errorf("attempt context error = %v, want it cancelled once the call returns", attemptCtx.Err())
+			}
+			defer resp.Body.Close()
+			if body, err := io.ReadAll(resp.Body); err != nil || string(body) != tt.body {
+				t.Errorf("body = %q, %v, want %q readable after the call returns", body, err, tt.body)
+			}
+		})
+	}
+}
+
+func TestDefaultRetryableStatuses(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantAttempts int32
+	}{
+		{status: http.StatusInternalServerError, wantAttempts: 3},
+		{status: http.StatusNotImplemented, wantAttempts: 1},
+		{status: http.StatusBadGateway, wantAttempts: 3},
+		{status: http.StatusServiceUnavailable, wantAttempts: 3},
+		{status: http.StatusGatewayTimeout, wantAttempts: 3},
+		{status: http.StatusHTTPVersionNotSupported, wantAttempts: 1},
+		{status: http.StatusBadRequest, wantAttempts: 1},
+		{status: http.StatusOK, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     3,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      time.Millisecond,
+				BackoffMultiple: 1,
+				MaxRetryAfter:   time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+			}
+			resp, _ := RetryableHTTPCall(context.Background(), trace.SpanFromContext(context.Background()), cfg,
+				RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if got, want := DefaultIsRetryable(&http.Response{StatusCode: tt.status}, nil), tt.wantAttempts > 1; got != want {
+				t.Errorf("DefaultIsRetryable(%d) = %v, want %v", tt.status, got, want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterDateAgainstCeiling(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    func(now time.Time) string
+		wantErr       error
+		wantLimit     string
+		wantRequested time.Duration // retry.retry_after_requested_ms, give or take the date's second resolution
+		wantSleptMs   int64         // retry.retry_after_ms, the delay actually waited
+	}{
+		{name: "date in the past retries at once", retryAfter: func(now time.Time) string {
+			return now.Add(-time.Minute).UTC().Format(http.TimeFormat)
+		}, wantLimit: "retry_after"},
+		{name: "date below the ceiling waits only the max backoff", retryAfter: func(now time.Time) string {
+			return now.Add(3 * time.Second).UTC().Format(http.TimeFormat)
+		}, wantLimit: "max_backoff", wantRequested: 3 * time.Second, wantSleptMs: 50},
+		{name: "date beyond the ceiling fails fast", retryAfter: func(now time.Time) string {
+			return now.Add(time.Hour).UTC().Format(http.TimeFormat)
+		}, wantErr: ErrRetryAfterExceeded, wantLimit: "fail_fast", wantRequested: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter(time.Now()))
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     2,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      50 * time.Millisecond,
+				BackoffMultiple: 2,
+				MaxRetryAfter:   5 * time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+			}
+			span, attrs := recordedSpan(t)
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			got := attrs()
+			if limit := got["retry.delay_limit"].AsString(); limit != tt.wantLimit {
+				t.Errorf("retry.delay_limit = %q, want %q", limit, tt.wantLimit)
+			}
+			requested := time.Duration(got["retry.retry_after_requested_ms"].AsInt64()) * time.Millisecond
+			if requested < tt.wantRequested-time.Second || requested > tt.wantRequested {
+				t.Errorf("retry.retry_after_requested_ms = %v, want about %v", requested, tt.wantRequested)
+			}
+			if tt.wantErr == nil && got["retry.retry_after_ms"].AsInt64() != tt.wantSleptMs {
+				t.Errorf("retry.retry_after_ms = %d, want %d", got["retry.retry_after_ms"].AsInt64(), tt.wantSleptMs)
+			}
+		})
+	}
+}
+
+func TestRetryTotalBackoff(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int32 // 503s before the downstream recovers
+		maxAttempts int
+		wantSleeps  int64
+		wantBackoff time.Duration // Sum of the deterministic backoffs: 20ms, then 40ms, then 80ms
+	}{
+		{name: "first attempt succeeds", failures: 0, maxAttempts: 4},
+		{name: "one retry", failures: 1, maxAttempts: 4, wantSleeps: 1, wantBackoff: 20 * time.Millisecond},
+		{name: "three retries", failures: 3, maxAttempts: 4, wantSleeps: 3, wantBackoff: 140 * time.Millisecond},
+		{name: "no sleep after the last attempt", failures: 10, maxAttempts: 3, wantSleeps: 2, wantBackoff: 60 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			cfg := RetryConfig{
+				MaxAttempts:     tt.maxAttempts,
+				InitialBackoff:  20 * time.Millisecond,
+				MaxBackoff:      time.Second,
+				BackoffMultiple: 2,
+				MaxRetryAfter:   time.Second,
+				Deterministic:   true,
+				SafeMethods:     []string{http.MethodGet},
+			}
+			span, attrs := recordedSpan(t)
+			resp, _ := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			got := attrs()
+			if sleeps := got["retry.sleep_count"].AsInt64(); sleeps != tt.wantSleeps {
+				t.Errorf("retry.sleep_count = %d, want %d", sleeps, tt.wantSleeps)
+			}
+			// Sleeps overrun their timer slightly, never undershoot it
+			total := time.Duration(got["retry.total_backoff_ms"].AsInt64()) * time.Millisecond
+			if total < tt.wantBackoff || total > tt.wantBackoff+50*time.Millisecond {
+				t.Errorf("retry.total_backoff_ms = %v, want the %v slept", total, tt.wantBackoff)
+			}
+			if elapsed := time.Duration(got["retry.elapsed_ms"].AsInt64()) * time.Millisecond; elapsed < total {
+				t.Errorf("retry.elapsed_ms = %v, want at least the %v backoff", elapsed, total)
+			}
+		})
+	}
+}
+
+func TestRetryShortCircuitsOnConcurrentCompletion(t *testing.T) {
+	tests := []struct {
+		name         string
+		requestKey   string // Idempotency key on the retrying request's context
+		completedKey string // Key a concurrent request completes under during the first attempt; empty if none does
+		wantAttempts int32
+		wantOrderID  string // Order of the cached result returned; empty if the retry ran its course
+	}{
+		{name: "concurrent completion stops the retry", requestKey: "k1", completedKey: "k1", wantAttempts: 1, wantOrderID: "order-other"},
+		{name: "nothing completed keeps retrying", requestKey: "k1", wantAttempts: 3},
+		{name: "completion under another key is ignored", requestKey: "k1", completedKey: "k2", wantAttempts: 3},
+		{name: "request without a key never checks", completedKey: "k1", wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(0, 0)
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The other request finishes while this one's first attempt is failing
+				if attempts.Add(1) == 1 && tt.completedKey != "" {
+					store.Set(tt.completedKey, &IdempotentResponse{OrderID: "order-other", MerchantID: "merchant_123", Status: "completed", CreatedAt: time.Now()})
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			if tt.requestKey != "" {
+				ctx = WithIdempotencyKey(ctx, tt.requestKey)
+			}
+			span, attrs := recordedSpan(t)
+			cfg := RetryConfig{MaxAttempts: 3, Deterministic: true, SafeMethods: []string{http.MethodGet}, Idempotency: store}
+			resp, err := RetryableHTTPCall(ctx, span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			var completed *CompletedElsewhereError
+			if errors.As(err, &completed) != (tt.wantOrderID != "") {
+				t.Fatalf("error = %v, want CompletedElsewhereError %v", err, tt.wantOrderID != "")
+			}
+			if completed != nil && completed.Response.OrderID != tt.wantOrderID {
+				t.Errorf("cached order = %s, want %s", completed.Response.OrderID, tt.wantOrderID)
+			}
+			if got := attrs()["retry.short_circuited"].AsBool(); got != (tt.wantOrderID != "") {
+				t.Errorf("retry.short_circuited = %v, want %v", got, tt.wantOrderID != "")
+			}
+		})
+	}
+}
+
+func TestRetryOnlySafeMethods(t *testing.T) {
+	defaults := DefaultRetryConfig().SafeMethods
+	tests := []struct {
+		name         string
+		safeMethods  []string
+		req          RetryRequest
+		wantAttempts int32
+	}{
+		{name: "GET retried", safeMethods: defaults, req: RetryRequest{Method: http.MethodGet}, wantAttempts: 3},
+		{name: "HEAD retried", safeMethods: defaults, req: RetryRequest{Method: http.MethodHead}, wantAttempts: 3},
+		{name: "PUT retried", safeMethods: defaults, req: RetryRequest{Method: http.MethodPut}, wantAttempts: 3},
+		{name: "DELETE retried", safeMethods: defaults, req: RetryRequest{Method: http.MethodDelete}, wantAttempts: 3},
+		{name: "keyless POST not retried", safeMethods: defaults, req: RetryRequest{Method: http.MethodPost}, wantAttempts: 1},
+		{name: "POST with an idempotency key retried", safeMethods: defaults,
+			req: RetryRequest{Method: http.MethodPost, IdempotencyKey: "order:1"}, wantAttempts: 3},
+		{name: "method matched case-insensitively", safeMethods: defaults, req: RetryRequest{Method: "get"}, wantAttempts: 3},
+		{name: "method left out of the configured set", safeMethods: []string{http.MethodHead}, req: RetryRequest{Method: http.MethodGet}, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			span, attrs := recordedSpan(t)
+			cfg := RetryConfig{MaxAttempts: 3, Deterministic: true, SafeMethods: tt.safeMethods}
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, tt.req, func(ctx context.Context) (*http.Response, error) {
+				req, err := http.NewRequestWithContext(ctx, strings.ToUpper(tt.req.Method), server.URL, nil)
+				if err != nil {
+					return nil, err
+				}
+				return http.DefaultClient.Do(req)
+			})
+			if resp != nil {
+				resp.Body.Close()
+				t.Errorf("got a %d response, want only an error once the call gives up", resp.StatusCode)
+			}
+			if err == nil || !strings.Contains(err.Error(), "downstream returned 503") {
+				t.Errorf("error = %v, want one carrying the last 503", err)
+			}
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			recorded := attrs()
+			if got := recorded["retry.unsafe_method"].AsBool(); got != (tt.wantAttempts == 1) {
+				t.Errorf("retry.unsafe_method = %v, want %v", got, tt.wantAttempts == 1)
+			}
+			if got := recorded["retry.method"].AsString(); got != tt.req.Method {
+				t.Errorf("retry.method = %q, want %q", got, tt.req.Method)
+			}
+		})
+	}
+}
+
+func TestCalculateBackoffDeterministic(t *testing.T) {
+	base := RetryConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: time.Second, BackoffMultiple: 2, JitterFraction: 0.5}
+	tests := []struct {
+		name   string
+		modify func(cfg *RetryConfig)
+		want   []time.Duration // Backoff before each retry, from the first
+	}{
+		{name: "deterministic ignores jitter", modify: func(cfg *RetryConfig) { cfg.Deterministic = true },
+			want: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}},
+		{name: "zero jitter is exact too", modify: func(cfg *RetryConfig) { cfg.JitterFraction = 0 },
+			want: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}},
+		{name: "capped at max backoff", modify: func(cfg *RetryConfig) { cfg.Deterministic, cfg.MaxBackoff = true, 30*time.Millisecond },
+			want: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}},
+		{name: "other multiples", modify: func(cfg *RetryConfig) { cfg.Deterministic, cfg.BackoffMultiple = true, 3 },
+			want: []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 90 * time.Millisecond, 270 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.modify(&cfg)
+			// Repeated so a stray RNG call would show up as a mismatch
+			for run := 0; run < 20; run++ {
+				for attempt, want := range tt.want {
+					if got := calculateBackoff(cfg, attempt); got != want {
+						t.Fatalf("run %d: calculateBackoff(attempt %d) = %v, want exactly %v", run, attempt, got, want)
+					}
+				}
+			}
+		})
+	}
+
+	// With jitter on, the same attempt varies within ±JitterFraction
+	seen := make(map[time.Duration]bool)
+	for run := 0; run < 50; run++ {
+		got := calculateBackoff(base, 1)
+		if got < 10*time.Millisecond || got > 30*time.Millisecond {
+			t.Fatalf("jittered backoff = %v, want within 20ms ± 50%%", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) == 1 {
+		t.Error("jittered backoff was identical on every run, want it randomized outside deterministic mode")
+	}
+}
+
+func TestMalformedRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantReason string // Empty when the value is honored
+		wantErr    error  // Set when the call fails fast instead of falling back to the computed backoff
+	}{
+		{name: "well-formed zero is honored", retryAfter: "0"},
+		{name: "negative falls back", retryAfter: "-30", wantReason: "negative"},
+		{name: "non-numeric falls back", retryAfter: "soon", wantReason: "non_numeric"},
+		{name: "garbled date falls back", retryAfter: "Wed, 99 Foo 2015 07:28:00 GMT", wantReason: "non_numeric"},
+		{name: "just past the plausible maximum fails fast", retryAfter: "86401", wantReason: "implausible", wantErr: ErrRetryAfterExceeded},
+		{name: "beyond the plausible maximum fails fast", retryAfter: "172800", wantReason: "implausible", wantErr: ErrRetryAfterExceeded},
+		{name: "overflowing a duration fails fast", retryAfter: "9223372036854775807", wantReason: "implausible", wantErr: ErrRetryAfterExceeded},
+		{name: "overflowing int64 fails fast", retryAfter: "99999999999999999999999", wantReason: "implausible", wantErr: ErrRetryAfterExceeded},
+		{name: "far-future date fails fast", retryAfter: "Fri, 31 Dec 9999 23:59:59 GMT", wantReason: "implausible", wantErr: ErrRetryAfterExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+
+			sink := &fakeSink{}
+			cfg := RetryConfig{
+				MaxAttempts:            2,
+				InitialBackoff:         5 * time.Millisecond,
+				MaxBackoff:             5 * time.Millisecond,
+				BackoffMultiple:        2,
+				MaxRetryAfter:          time.Hour, // So only malformed values, not the ceiling, stop a long sleep
+				MaxPlausibleRetryAfter: 24 * time.Hour,
+				Deterministic:          true,
+				SafeMethods:            []string{http.MethodGet},
+				Metrics:                sink,
+			}
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+
+			start := time.Now()
+			resp, err := RetryableHTTPCall(context.Background(), span, cfg, RetryRequest{Method: http.MethodGet}, getCall(server.URL))
+			elapsed := time.Since(start)
+			span.End()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			wantAttempts := int32(2)
+			if tt.wantErr != nil {
+				wantAttempts = 1
+			}
+			if got := attempts.Load(); got != wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, wantAttempts)
+			}
+			if elapsed > 500*time.Millisecond {
+				t.Errorf("took %v, want no sleep on the header", elapsed)
+			}
+
+			var reasons []string
+			for _, event := range recorder.Ended()[0].Events() {
+				if event.Name != "retry_after_malformed" {
+					continue
+				}
+				for _, kv := range event.Attributes {
+					if kv.Key == "reason" {
+						reasons = append(reasons, kv.Value.AsString())
+					}
+				}
+			}
+			var metered []string
+			for _, event := range sink.events {
+				if reason, ok := strings.CutPrefix(event, "malformed_retry_after:"); ok {
+					metered = append(metered, reason)
+				}
+			}
+			var want []string
+			if tt.wantReason != "" {
+				want = []string{tt.wantReason}
+			}
+			if !slices.Equal(reasons, want) || !slices.Equal(metered, want) {
+				t.Errorf("span reasons = %v, metered = %v, want %v", reasons, metered, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// selfTestTimeout bounds the whole self-test, so a bulkhead that can never admit fails startup instead of hanging it
+const selfTestTimeout = 5 * time.Second
+
+// errSelfTestStub is the failure returned by the stub call
+var errSelfTestStub = errors.New("self-test stub failure")
+
+// SelfTest runs a stub call through a fresh bulkhead, circuit breaker and each retry policy built from the given config,
+// confirming a slot is admitted, a single failure doesn't open the circuit and a transient failure is retried
+// It uses its own instances and no network, so it's safe to run at startup before traffic arrives
+func SelfTest(ctx context.Context, policies RetryPolicies, breaker CircuitBreakerConfig, bulkhead BulkheadConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	// Don't page anyone about the self-test's own breaker
+	breaker.Name = "selftest"
+	breaker.WebhookURL = ""
+
+	cb := NewCircuitBreaker(breaker, nil)
+	span := trace.SpanFromContext(ctx)
+	_ = cb.Execute(span, func() error { return errSelfTestStub })
+	if state := cb.State(); state != gobreaker.StateClosed {
+		return fmt.Errorf("circuit breaker is %s after a single failure; check CB_CONSECUTIVE_FAILURES, CB_CONSECUTIVE_ERRORS, CB_MIN_REQUESTS and CB_FAILURE_RATIO", state)
+	}
+
+	endpoints := make([]string, 0, len(policies.Endpoints))
+	for endpoint := range policies.Endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	if err := selfTestPath(ctx, policies.Default, cb, NewBulkhead(bulkhead, nil)); err != nil {
+		return fmt.Errorf("default retry policy: %w", err)
+	}
+	for _, endpoint := range endpoints {
+		if err := selfTestPath(ctx, policies.Endpoints[endpoint], cb, NewBulkhead(bulkhead, nil)); err != nil {
+			return fmt.Errorf("retry policy for %s: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// selfTestPath sends a stub call that fails once with a 503 through bulkhead, breaker and retry, as a payment call is
+func selfTestPath(ctx context.Context, retry RetryConfig, cb *CircuitBreaker, bh *Bulkhead) error {
+	// Only the shape of the policy is under test; keep the stub out of live metrics and adaptive state
+	retry.Metrics = nil
+	retry.Adaptive = nil
+
+	attempts := 0
+	stub := func(context.Context) (*http.Response, error) {
+		attempts++
+		if attempts == 1 && retry.MaxAttempts > 1 {
+			// Retry-After: 0 skips the configured backoff so the self-test stays quick
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": []string{"0"}},
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+	err := bh.Execute(ctx, span, func(ctx context.Context) error {
+		return cb.Execute(span, func() error {
+			resp, err := RetryableHTTPCall(ctx, span, retry, RetryRequest{Method: http.MethodGet}, stub)
+			if err != nil {
+				return err
+			}
+			if resp == nil {
+				return fmt.Errorf("retry made no attempts (max attempts %d)", retry.MaxAttempts)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("stub call ended with status %d", resp.StatusCode)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if want := min(retry.MaxAttempts, 2); attempts != want {
+		return fmt.Errorf("retry made %d attempts at a transient failure, expected %d", attempts, want)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package reliability
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfTestDetectsBrokenConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		breaker  func(*CircuitBreakerConfig)
+		bulkhead func(*BulkheadConfig)
+		retry    func(*RetryConfig)
+		endpoint map[string]func(*RetryConfig) // Per-endpoint policies, each derived from the default
+		wantErr  string                        // Substring of the failure; empty if the self-test passes
+	}{
+		{name: "defaults pass"},
+		{name: "per-endpoint policies pass", endpoint: map[string]func(*RetryConfig){
+			"charge": func(c *RetryConfig) { c.MaxAttempts = 1 },
+			"health": func(c *RetryConfig) { c.MaxAttempts = 5 },
+		}},
+		{name: "breaker trips on the first failure", breaker: func(c *CircuitBreakerConfig) { c.ConsecutiveFailures = 1 },
+			wantErr: "after a single failure"},
+		{name: "breaker trips on any failure ratio", breaker: func(c *CircuitBreakerConfig) { c.FailureRatio, c.MinRequests = 0.01, 1 },
+			wantErr: "after a single failure"},
+		{name: "retry makes no attempts", retry: func(c *RetryConfig) { c.MaxAttempts = 0 }, wantErr: "after 0 attempts"},
+		{name: "retry refuses GETs", retry: func(c *RetryConfig) { c.SafeMethods = nil }, wantErr: "isn't idempotent: downstream returned 503"},
+		{name: "bulkhead admitting through overflow passes", bulkhead: func(c *BulkheadConfig) { c.MaxConcurrent, c.OverflowSlots = 1, 1 }},
+		{name: "broken endpoint policy is named", endpoint: map[string]func(*RetryConfig){
+			"charge": func(c *RetryConfig) { c.MaxAttempts = 0 },
+		}, wantErr: "retry policy for charge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := DefaultCircuitBreakerConfig()
+			if tt.breaker != nil {
+				tt.breaker(&breaker)
+			}
+			bulkhead := DefaultBulkheadConfig()
+			if tt.bulkhead != nil {
+				tt.bulkhead(&bulkhead)
+			}
+			policies := RetryPolicies{Default: DefaultRetryConfig(), Endpoints: make(map[string]RetryConfig)}
+			if tt.retry != nil {
+				tt.retry(&policies.Default)
+			}
+			for endpoint, configure := range tt.endpoint {
+				policy := policies.Default
+				configure(&policy)
+				policies.Endpoints[endpoint] = policy
+			}
+
+			// Well short of the self-test's own timeout, so a wiring bug that hangs fails the test quickly
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := SelfTest(ctx, policies, breaker, bulkhead)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("SelfTest() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SelfTest() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
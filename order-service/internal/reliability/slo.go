@@ -0,0 +1,126 @@
+package reliability
+
+import (
+	"sync"
+	"time"
+)
+
+// sloBucketSize is the granularity of the rolling window
+// Outcomes are aggregated per bucket so memory stays constant regardless of request rate
+const sloBucketSize = 10 * time.Second
+
+// SLOTracker tracks request outcomes over rolling windows to compute error-budget burn rate
+// Burn rate = observed error rate / allowed error rate (1 - target)
+// A burn rate of 1 consumes the budget exactly over the SLO period; >1 exhausts it early
+type SLOTracker struct {
+	mu      sync.Mutex
+	target  float64
+	windows []time.Duration
+	buckets []sloBucket
+	now     func() time.Time
+}
+
+// sloBucket holds outcome counts for one bucketSize slice of time
+type sloBucket struct {
+	epoch   int64 // Bucket index since Unix epoch, used to detect stale buckets
+	success int64
+	errors  int64
+}
+
+// SLOStatus is a point-in-time view of the SLO across all tracked windows
+type SLOStatus struct {
+	Target    float64     `json:"target"`
+	ErrorRate float64     `json:"error_rate"` // Error rate over the shortest window
+	Windows   []SLOWindow `json:"windows"`
+}
+
+// SLOWindow reports outcomes and burn rate for a single rolling window
+type SLOWindow struct {
+	Window    string  `json:"window"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	BurnRate  float64 `json:"burn_rate"`
+}
+
+// NewSLOTracker creates a tracker for the given availability target (e.g. 0.999)
+// Windows should be ordered shortest first, following the multi-window burn-rate alerting pattern
+func NewSLOTracker(target float64, windows ...time.Duration) *SLOTracker {
+	if len(windows) == 0 {
+		windows = []time.Duration{5 * time.Minute, 1 * time.Hour}
+	}
+
+	longest := windows[0]
+	for _, w := range windows {
+		if w > longest {
+			longest = w
+		}
+	}
+
+	return &SLOTracker{
+		target:  target,
+		windows: windows,
+		buckets: make([]sloBucket, int(longest/sloBucketSize)+1),
+		now:     time.Now,
+	}
+}
+
+// Record adds a single request outcome to the current bucket
+func (t *SLOTracker) Record(success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	epoch := t.now().UnixNano() / int64(sloBucketSize)
+	b := &t.buckets[epoch%int64(len(t.buckets))]
+	if b.epoch != epoch {
+		// Bucket belongs to an older rotation of the ring; reset it
+		*b = sloBucket{epoch: epoch}
+	}
+
+	if success {
+		b.success++
+	} else {
+		b.errors++
+	}
+}
+
+// Status computes the error rate and burn rate for each tracked window
+func (t *SLOTracker) Status() SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.now().UnixNano() / int64(sloBucketSize)
+	budget := 1 - t.target
+
+	status := SLOStatus{Target: t.target}
+	for i, w := range t.windows {
+		span := int64(w / sloBucketSize)
+
+		var success, errors int64
+		for _, b := range t.buckets {
+			if b.epoch > current-span && b.epoch <= current {
+				success += b.success
+				errors += b.errors
+			}
+		}
+
+		window := SLOWindow{
+			Window:   w.String(),
+			Requests: success + errors,
+			Errors:   errors,
+		}
+		if window.Requests > 0 {
+			window.ErrorRate = float64(errors) / float64(window.Requests)
+		}
+		if budget > 0 {
+			window.BurnRate = window.ErrorRate / budget
+		}
+
+		if i == 0 {
+			status.ErrorRate = window.ErrorRate
+		}
+		status.Windows = append(status.Windows, window)
+	}
+
+	return status
+}
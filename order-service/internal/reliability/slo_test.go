@@ -0,0 +1,73 @@
+package reliability
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSLOTrackerBurnRate(t *testing.T) {
+	type outcomes struct {
+		ago     time.Duration // How long before the status is read
+		success int
+		errors  int
+	}
+	tests := []struct {
+		name      string
+		target    float64
+		recorded  []outcomes
+		wantRates []float64 // Error rate per window, shortest first
+		wantBurn  []float64
+	}{
+		{name: "no traffic", target: 0.99, wantRates: []float64{0, 0}, wantBurn: []float64{0, 0}},
+		{name: "errors at exactly the budget burn at 1", target: 0.99,
+			recorded:  []outcomes{{ago: time.Minute, success: 99, errors: 1}},
+			wantRates: []float64{0.01, 0.01}, wantBurn: []float64{1, 1}},
+		{name: "recent spike burns faster in the short window", target: 0.99,
+			recorded: []outcomes{
+				{ago: 30 * time.Minute, success: 300},
+				{ago: time.Minute, success: 90, errors: 10},
+			},
+			wantRates: []float64{0.1, 0.025}, wantBurn: []float64{10, 2.5}},
+		{name: "outcomes older than the longest window are dropped", target: 0.9,
+			recorded: []outcomes{
+				{ago: 2 * time.Hour, errors: 100},
+				{ago: time.Minute, success: 8, errors: 2},
+			},
+			wantRates: []float64{0.2, 0.2}, wantBurn: []float64{2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			tracker := NewSLOTracker(tt.target, 5*time.Minute, time.Hour)
+			for _, o := range tt.recorded {
+				tracker.now = func() time.Time { return now.Add(-o.ago) }
+				for i := 0; i < o.success; i++ {
+					tracker.Record(true)
+				}
+				for i := 0; i < o.errors; i++ {
+					tracker.Record(false)
+				}
+			}
+			tracker.now = func() time.Time { return now }
+
+			status := tracker.Status()
+			if len(status.Windows) != len(tt.wantBurn) {
+				t.Fatalf("got %d windows, want %d", len(status.Windows), len(tt.wantBurn))
+			}
+			if !approxEqual(status.ErrorRate, tt.wantRates[0]) {
+				t.Errorf("error rate = %v, want the shortest window's %v", status.ErrorRate, tt.wantRates[0])
+			}
+			for i, w := range status.Windows {
+				if !approxEqual(w.ErrorRate, tt.wantRates[i]) || !approxEqual(w.BurnRate, tt.wantBurn[i]) {
+					t.Errorf("window %s: error rate %v, burn rate %v, want %v, %v",
+						w.Window, w.ErrorRate, w.BurnRate, tt.wantRates[i], tt.wantBurn[i])
+				}
+			}
+		})
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,126 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StageTimer aggregates time spent in each stage of a request against its latency budget
+// Stages with the same name accumulate, e.g. repeated bulkhead waits across failover endpoints
+// All methods are safe on a nil receiver so instrumented code needn't check whether timing is enabled
+type StageTimer struct {
+	mu     sync.Mutex
+	start  time.Time
+	stages []StageTiming // In order of first occurrence
+	now    func() time.Time
+}
+
+// StageTiming is the accumulated duration of one named stage
+type StageTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// NewStageTimer creates a timer whose total is measured from now
+func NewStageTimer() *StageTimer {
+	return &StageTimer{start: time.Now(), now: time.Now}
+}
+
+// Record adds d to the named stage
+func (t *StageTimer) Record(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.stages {
+		if t.stages[i].Name == name {
+			t.stages[i].Duration += d
+			return
+		}
+	}
+	t.stages = append(t.stages, StageTiming{Name: name, Duration: d})
+}
+
+// Time starts timing the named stage and returns a func that records it, for use with defer
+func (t *StageTimer) Time(name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := t.now()
+	return func() { t.Record(name, t.now().Sub(start)) }
+}
+
+// Stages returns a snapshot of the recorded stages
+func (t *StageTimer) Stages() []StageTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]StageTiming(nil), t.stages...)
+}
+
+// Total returns the time elapsed since the timer was created
+func (t *StageTimer) Total() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.now().Sub(t.start)
+}
+
+// SetSpanAttributes records each stage as latency.<stage>_ms plus the total and unaccounted remainder
+func (t *StageTimer) SetSpanAttributes(span trace.Span) {
+	if t == nil {
+		return
+	}
+	total := t.Total()
+	accounted := time.Duration(0)
+	for _, s := range t.Stages() {
+		span.SetAttributes(attribute.Float64("latency."+s.Name+"_ms", millis(s.Duration)))
+		accounted += s.Duration
+	}
+	span.SetAttributes(
+		attribute.Float64("latency.total_ms", millis(total)),
+		attribute.Float64("latency.unaccounted_ms", millis(total-accounted)),
+	)
+}
+
+// ServerTiming formats the stages as a Server-Timing header value, e.g. "validation;dur=0.4, persist;dur=10.2, total;dur=42.1"
+func (t *StageTimer) ServerTiming() string {
+	if t == nil {
+		return ""
+	}
+	stages := t.Stages()
+	parts := make([]string, 0, len(stages)+1)
+	for _, s := range stages {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.1f", s.Name, millis(s.Duration)))
+	}
+	parts = append(parts, fmt.Sprintf("total;dur=%.1f", millis(t.Total())))
+	return strings.Join(parts, ", ")
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type stageTimerKey struct{}
+
+// WithStageTimer returns a context carrying the request's stage timer
+func WithStageTimer(ctx context.Context, t *StageTimer) context.Context {
+	return context.WithValue(ctx, stageTimerKey{}, t)
+}
+
+// StageTimerFromContext returns the request's stage timer, or nil if the request isn't timed
+func StageTimerFromContext(ctx context.Context) *StageTimer {
+	t, _ := ctx.Value(stageTimerKey{}).(*StageTimer)
+	return t
+}
@@ -0,0 +1,100 @@
+package reliability
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestStageTimer(t *testing.T) {
+	// Steps: a stage name is timed for the given duration; an empty name is untimed work between stages
+	type step struct {
+		stage string
+		d     time.Duration
+	}
+	tests := []struct {
+		name             string
+		steps            []step
+		wantStages       []StageTiming
+		wantServerTiming string
+		wantUnaccounted  float64
+	}{
+		{
+			name:             "each stage recorded in order",
+			steps:            []step{{"validation", time.Millisecond}, {"bulkhead_wait", 2 * time.Millisecond}, {"attempt_1", 30 * time.Millisecond}, {"persist", 5 * time.Millisecond}},
+			wantStages:       []StageTiming{{"validation", time.Millisecond}, {"bulkhead_wait", 2 * time.Millisecond}, {"attempt_1", 30 * time.Millisecond}, {"persist", 5 * time.Millisecond}},
+			wantServerTiming: "validation;dur=1.0, bulkhead_wait;dur=2.0, attempt_1;dur=30.0, persist;dur=5.0, total;dur=38.0",
+		},
+		{
+			name:             "repeated stage accumulates",
+			steps:            []step{{"bulkhead_wait", 2 * time.Millisecond}, {"attempt_1", 10 * time.Millisecond}, {"bulkhead_wait", 3 * time.Millisecond}},
+			wantStages:       []StageTiming{{"bulkhead_wait", 5 * time.Millisecond}, {"attempt_1", 10 * time.Millisecond}},
+			wantServerTiming: "bulkhead_wait;dur=5.0, attempt_1;dur=10.0, total;dur=15.0",
+		},
+		{
+			name:             "untimed work is unaccounted",
+			steps:            []step{{"validation", time.Millisecond}, {"", 4 * time.Millisecond}, {"persist", 2 * time.Millisecond}},
+			wantStages:       []StageTiming{{"validation", time.Millisecond}, {"persist", 2 * time.Millisecond}},
+			wantServerTiming: "validation;dur=1.0, persist;dur=2.0, total;dur=7.0",
+			wantUnaccounted:  4,
+		},
+		{
+			name:             "no stages",
+			wantServerTiming: "total;dur=0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			timer := NewStageTimer()
+			timer.start, timer.now = now, func() time.Time { return now }
+
+			for _, s := range tt.steps {
+				stop := timer.Time(s.stage)
+				now = now.Add(s.d)
+				if s.stage != "" {
+					stop()
+				}
+			}
+
+			got := timer.Stages()
+			if len(got) != len(tt.wantStages) {
+				t.Fatalf("stages = %v, want %v", got, tt.wantStages)
+			}
+			for i := range got {
+				if got[i] != tt.wantStages[i] {
+					t.Errorf("stage %d = %v, want %v", i, got[i], tt.wantStages[i])
+				}
+			}
+			if got := timer.ServerTiming(); got != tt.wantServerTiming {
+				t.Errorf("ServerTiming() = %q, want %q", got, tt.wantServerTiming)
+			}
+
+			span, attrs := recordedSpan(t)
+			timer.SetSpanAttributes(span)
+			recorded := attrs()
+			sum := 0.0
+			for _, s := range tt.wantStages {
+				sum += recorded[attribute.Key("latency."+s.Name+"_ms")].AsFloat64()
+			}
+			total := recorded["latency.total_ms"].AsFloat64()
+			unaccounted := recorded["latency.unaccounted_ms"].AsFloat64()
+			if !approxEqual(sum+unaccounted, total) {
+				t.Errorf("stages sum to %vms plus %vms unaccounted, want total %vms", sum, unaccounted, total)
+			}
+			if !approxEqual(unaccounted, tt.wantUnaccounted) {
+				t.Errorf("latency.unaccounted_ms = %v, want %v", unaccounted, tt.wantUnaccounted)
+			}
+		})
+	}
+}
+
+func TestStageTimerNilSafe(t *testing.T) {
+	var timer *StageTimer
+	timer.Time("validation")()
+	timer.Record("persist", time.Second)
+	if timer.Stages() != nil || timer.Total() != 0 || timer.ServerTiming() != "" {
+		t.Error("nil timer recorded something")
+	}
+}
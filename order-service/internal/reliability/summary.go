@@ -0,0 +1,83 @@
+package reliability
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// DecisionSummary counts the reliability decisions taken for one request, for echoing back as debug headers
+// All methods are safe on a nil receiver so instrumented code needn't check whether debug headers are enabled
+type DecisionSummary struct {
+	mu           sync.Mutex
+	retries      int
+	breakerState string // State of the last circuit breaker consulted; empty if none was
+	queued       int
+}
+
+// NewDecisionSummary creates an empty summary
+func NewDecisionSummary() *DecisionSummary {
+	return &DecisionSummary{}
+}
+
+// AddRetry counts one retry of a failed attempt
+func (s *DecisionSummary) AddRetry() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+}
+
+// SetBreakerState records the state of the circuit breaker a call went through; with failover the last one wins
+func (s *DecisionSummary) SetBreakerState(state string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakerState = state
+}
+
+// AddQueued counts one wait in a bulkhead queue for a slot
+func (s *DecisionSummary) AddQueued() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued++
+}
+
+// Headers returns the summary as X-Retry-Count, X-CB-State and X-Bulkhead-Queued
+// X-CB-State is left out when the request never reached a circuit breaker, e.g. an idempotent replay
+func (s *DecisionSummary) Headers() map[string]string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	headers := map[string]string{
+		"X-Retry-Count":     strconv.Itoa(s.retries),
+		"X-Bulkhead-Queued": strconv.Itoa(s.queued),
+	}
+	if s.breakerState != "" {
+		headers["X-CB-State"] = s.breakerState
+	}
+	return headers
+}
+
+type decisionSummaryKey struct{}
+
+// WithDecisionSummary returns a context carrying the request's decision summary
+func WithDecisionSummary(ctx context.Context, s *DecisionSummary) context.Context {
+	return context.WithValue(ctx, decisionSummaryKey{}, s)
+}
+
+// DecisionSummaryFromContext returns the request's decision summary, or nil if the request isn't summarized
+func DecisionSummaryFromContext(ctx context.Context) *DecisionSummary {
+	s, _ := ctx.Value(decisionSummaryKey{}).(*DecisionSummary)
+	return s
+}
@@ -0,0 +1,141 @@
+package reliability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// webhookTimeout bounds each notification so a slow alerting endpoint can't pile up goroutines
+const webhookTimeout = 2 * time.Second
+
+// StateChangeEvent is the payload POSTed to the circuit breaker webhook
+type StateChangeEvent struct {
+	Service   string    `json:"service"`
+	Breaker   string    `json:"breaker"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Transitions coalesced into this one because they came within the minimum interval of the previous notification
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// StateChangeNotifier posts circuit breaker open/close transitions to an alerting webhook
+// Notifications are fire-and-forget: a single attempt with its own short timeout and no retries,
+// and deliberately not routed through a circuit breaker, so alerting can never recurse into itself
+// A flapping breaker is debounced: transitions within minInterval of the last notification are coalesced
+// into one trailing notification carrying the latest state and how many transitions were suppressed
+type StateChangeNotifier struct {
+	url         string
+	service     string
+	minInterval time.Duration
+	httpClient  *http.Client
+
+	mu         sync.Mutex
+	lastSent   time.Time
+	lastState  string            // State in the last notification sent
+	pending    *StateChangeEvent // Latest coalesced transition awaiting the trailing flush
+	suppressed int
+	flushTimer *time.Timer
+	send       func(StateChangeEvent)
+}
+
+// NewStateChangeNotifier creates a notifier posting to url on behalf of service, at most once per minInterval
+func NewStateChangeNotifier(url, service string, minInterval time.Duration) *StateChangeNotifier {
+	n := &StateChangeNotifier{
+		url:         url,
+		service:     service,
+		minInterval: minInterval,
+		httpClient:  &http.Client{Timeout: webhookTimeout},
+	}
+	n.send = func(event StateChangeEvent) { go n.post(event) }
+	return n
+}
+
+// OnStateChange matches gobreaker's Settings.OnStateChange and never blocks the caller
+// Only transitions into open or closed are reported; half-open probes are too noisy for alerting
+func (n *StateChangeNotifier) OnStateChange(name string, from, to gobreaker.State) {
+	if to != gobreaker.StateOpen && to != gobreaker.StateClosed {
+		return
+	}
+
+	now := time.Now()
+	event := StateChangeEvent{
+		Service:   n.service,
+		Breaker:   name,
+		From:      from.String(),
+		To:        to.String(),
+		Timestamp: now.UTC(),
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.pending == nil && now.Sub(n.lastSent) >= n.minInterval {
+		n.lastSent = now
+		n.lastState = event.To
+		n.send(event)
+		return
+	}
+
+	// Too soon after the last notification: keep only the latest transition and report it once the interval is up
+	if n.pending != nil {
+		n.suppressed++
+	}
+	event.From = n.lastState // Report the change relative to what alerting last saw
+	n.pending = &event
+	if n.flushTimer == nil {
+		n.flushTimer = time.AfterFunc(n.lastSent.Add(n.minInterval).Sub(now), n.flush)
+	}
+}
+
+// flush sends the coalesced transition with a count of the transitions it replaced
+func (n *StateChangeNotifier) flush() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	event := *n.pending
+	event.Suppressed = n.suppressed
+	if event.Suppressed > 0 {
+		log.Printf("circuit breaker %s: suppressed %d state change notifications within %s", event.Breaker, event.Suppressed, n.minInterval)
+	}
+
+	n.pending = nil
+	n.suppressed = 0
+	n.flushTimer = nil
+	n.lastSent = time.Now()
+	n.lastState = event.To
+	n.send(event)
+}
+
+// post delivers a single notification; failures are logged and dropped
+func (n *StateChangeNotifier) post(event StateChangeEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(event)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("circuit breaker webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		log.Printf("circuit breaker webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("circuit breaker webhook returned %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,160 @@
+package reliability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// webhookStub serves a stub alerting endpoint, delivering each notification it receives on the returned channel
+func webhookStub(t *testing.T) (string, <-chan StateChangeEvent) {
+	t.Helper()
+	events := make(chan StateChangeEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		var event StateChangeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decoding webhook payload: %v", err)
+		}
+		events <- event
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, events
+}
+
+func TestCircuitBreakerWebhook(t *testing.T) {
+	errDownstream := errors.New("payment service returned 500")
+
+	// Outcomes: e is an error, s a success, w waits out the open timeout
+	tests := []struct {
+		name     string
+		outcomes string
+		want     []StateChangeEvent // Only From and To are compared
+	}{
+		{name: "opening is reported", outcomes: "ee", want: []StateChangeEvent{{From: "closed", To: "open"}}},
+		{name: "closing is reported, half-open isn't", outcomes: "eews", want: []StateChangeEvent{
+			{From: "closed", To: "open"},
+			{From: "half-open", To: "closed"},
+		}},
+		{name: "no transition, no notification", outcomes: "ese"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, events := webhookStub(t)
+			cb := NewCircuitBreaker(CircuitBreakerConfig{
+				Name:                "payment-service",
+				MaxRequests:         1,
+				Timeout:             20 * time.Millisecond,
+				ConsecutiveFailures: 2,
+				FailureRatio:        1,
+				MinRequests:         100,
+				WebhookURL:          url,
+			}, nil)
+			span := trace.SpanFromContext(context.Background())
+
+			start := time.Now().UTC()
+			for _, outcome := range tt.outcomes {
+				switch outcome {
+				case 'w':
+					time.Sleep(30 * time.Millisecond)
+				case 'e':
+					cb.Execute(span, func() error { return errDownstream })
+				case 's':
+					cb.Execute(span, func() error { return nil })
+				}
+			}
+
+			for i, want := range tt.want {
+				select {
+				case got := <-events:
+					if got.Service != "order-service" || got.Breaker != "payment-service" {
+						t.Errorf("notification %d from service %q breaker %q, want order-service payment-service", i, got.Service, got.Breaker)
+					}
+					if got.From != want.From || got.To != want.To {
+						t.Errorf("notification %d = %s -> %s, want %s -> %s", i, got.From, got.To, want.From, want.To)
+					}
+					if got.Timestamp.Before(start.Add(-time.Second)) || got.Timestamp.After(time.Now().Add(time.Second)) {
+						t.Errorf("notification %d timestamp %v isn't around the transition", i, got.Timestamp)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("notification %d (%s -> %s) never arrived", i, want.From, want.To)
+				}
+			}
+			select {
+			case got := <-events:
+				t.Errorf("unexpected notification %s -> %s", got.From, got.To)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestStateChangeNotifierDebouncesFlapping(t *testing.T) {
+	const minInterval = 50 * time.Millisecond
+
+	// Transitions: o opens, c closes, h goes half-open, w waits out the minimum interval
+	tests := []struct {
+		name        string
+		transitions string
+		want        []StateChangeEvent // From, To and Suppressed are compared
+	}{
+		{name: "single transition sent at once", transitions: "o", want: []StateChangeEvent{{From: "closed", To: "open"}}},
+		{name: "spaced transitions all sent", transitions: "owcwo", want: []StateChangeEvent{
+			{From: "closed", To: "open"},
+			{From: "open", To: "closed"},
+			{From: "closed", To: "open"},
+		}},
+		{name: "one quick follow-up trails without suppression", transitions: "oc", want: []StateChangeEvent{
+			{From: "closed", To: "open"},
+			{From: "open", To: "closed"},
+		}},
+		{name: "rapid flapping coalesced", transitions: "ococoho", want: []StateChangeEvent{
+			{From: "closed", To: "open"},
+			{From: "open", To: "open", Suppressed: 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewStateChangeNotifier("http://alerts.invalid", "order-service", minInterval)
+			sent := make(chan StateChangeEvent, 10)
+			n.send = func(event StateChangeEvent) { sent <- event }
+
+			prev := gobreaker.StateClosed
+			for _, transition := range tt.transitions {
+				to := map[rune]gobreaker.State{'o': gobreaker.StateOpen, 'c': gobreaker.StateClosed, 'h': gobreaker.StateHalfOpen}[transition]
+				if transition == 'w' {
+					time.Sleep(2 * minInterval)
+					continue
+				}
+				n.OnStateChange("payment-service", prev, to)
+				prev = to
+			}
+
+			for i, want := range tt.want {
+				select {
+				case got := <-sent:
+					if got.From != want.From || got.To != want.To || got.Suppressed != want.Suppressed {
+						t.Errorf("notification %d = %s -> %s suppressing %d, want %s -> %s suppressing %d",
+							i, got.From, got.To, got.Suppressed, want.From, want.To, want.Suppressed)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("notification %d (%s -> %s) never sent", i, want.From, want.To)
+				}
+			}
+			select {
+			case got := <-sent:
+				t.Errorf("unexpected notification %s -> %s", got.From, got.To)
+			case <-time.After(2 * minInterval):
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrInvalidAmount is returned for amounts that are not a finite, positive number
+// NaN, ±Inf and negative zero can corrupt ledgers and some of them slip past the gt=0 binding rule
+var ErrInvalidAmount = errors.New("amount must be a finite number greater than zero")
+
+// ErrAmountPrecision is returned for amounts with more decimal places than the precision policy allows
+var ErrAmountPrecision = errors.New("amount has more decimal places than allowed")
+
+// ValidateAmount rejects NaN, infinite and negative-zero amounts
+// Ordinary zero and negative amounts are left to the binding rules
+func ValidateAmount(amount float64) error {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || (amount == 0 && math.Signbit(amount)) {
+		return ErrInvalidAmount
+	}
+	return nil
+}
+
+// How amounts with more decimal places than allowed are handled; both services must use the same mode
+const (
+	PrecisionAllow         = "allow"           // Pass the amount through unchanged
+	PrecisionReject        = "reject"          // Fail with ErrAmountPrecision
+	PrecisionRoundHalfEven = "round_half_even" // Round to the nearest allowed value, ties to even (banker's rounding)
+	PrecisionTruncate      = "truncate"        // Drop the extra digits
+)
+
+// AmountPrecision limits the decimal places of an amount, e.g. 2 for cents
+type AmountPrecision struct {
+	Mode     string
+	Decimals int
+}
+
+// Apply returns the amount adjusted to the allowed precision
+// The amount is handled as the decimal the client wrote, so 2.675 rounds to 2.68 rather than by its binary approximation
+// An amount that would round or truncate to zero is rejected, since it's no longer a chargeable value
+func (p AmountPrecision) Apply(amount float64) (float64, error) {
+	if p.Mode == PrecisionAllow || p.Mode == "" || decimalPlaces(amount) <= p.Decimals {
+		return amount, nil
+	}
+	if p.Mode == PrecisionReject {
+		return 0, ErrAmountPrecision
+	}
+
+	// Shortest decimal that round-trips, so the value is exactly what the client sent
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.Decimals)), nil)
+	r.Mul(r, new(big.Rat).SetInt(scale))
+
+	units, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if p.Mode == PrecisionRoundHalfEven {
+		half := new(big.Int).Lsh(rem, 1).CmpAbs(r.Denom())
+		if half > 0 || (half == 0 && units.Bit(0) == 1) {
+			units.Add(units, big.NewInt(int64(r.Sign())))
+		}
+	}
+	if units.Sign() == 0 {
+		return 0, ErrAmountPrecision
+	}
+
+	adjusted, _ := new(big.Rat).SetFrac(units, scale).Float64()
+	return adjusted, nil
+}
+
+// decimalPlaces counts the digits after the decimal point in the shortest representation of amount
+func decimalPlaces(amount float64) int {
+	s := strconv.FormatFloat(amount, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// AmountAdjustment reports an order amount changed to fit the precision policy
+type AmountAdjustment struct {
+	OriginalAmount float64 `json:"original_amount"`
+	Amount         float64 `json:"amount"`
+	Mode           string  `json:"mode"`
+}
+
+// adjustAmount applies the precision policy to the order amount, recording the original and adjusted amounts on the span
+func (s *OrderService) adjustAmount(span trace.Span, req CreateOrderRequest) (CreateOrderRequest, *AmountAdjustment, error) {
+	adjusted, err := s.amountPrecision.Apply(req.Amount)
+	if err != nil {
+		span.SetAttributes(attribute.String("amount.precision_mode", s.amountPrecision.Mode))
+		return req, nil, fmt.Errorf("%w: %v allows %d", err, req.Amount, s.amountPrecision.Decimals)
+	}
+	if adjusted == req.Amount {
+		return req, nil, nil
+	}
+
+	adjustment := &AmountAdjustment{OriginalAmount: req.Amount, Amount: adjusted, Mode: s.amountPrecision.Mode}
+	span.SetAttributes(
+		attribute.String("amount.precision_mode", adjustment.Mode),
+		attribute.Float64("amount.original", adjustment.OriginalAmount),
+		attribute.Float64("amount.adjusted", adjustment.Amount),
+	)
+	req.Amount = adjusted
+	return req, adjustment, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+)
+
+func TestAmountPrecisionModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		amount      float64
+		wantErr     error
+		wantCharged float64 // Amount sent to payment; 0 if nothing was charged
+		wantAdjust  bool    // The response reports an amount_adjustment
+	}{
+		{name: "allow passes the amount through", mode: PrecisionAllow, amount: 99.999, wantCharged: 99.999},
+		{name: "reject", mode: PrecisionReject, amount: 99.999, wantErr: ErrAmountPrecision},
+		{name: "round half even rounds up", mode: PrecisionRoundHalfEven, amount: 99.999, wantCharged: 100, wantAdjust: true},
+		{name: "round half even tie to even", mode: PrecisionRoundHalfEven, amount: 2.665, wantCharged: 2.66, wantAdjust: true},
+		{name: "round half even tie decided by the decimal, not its binary form", mode: PrecisionRoundHalfEven, amount: 2.675,
+			wantCharged: 2.68, wantAdjust: true},
+		{name: "truncate", mode: PrecisionTruncate, amount: 99.999, wantCharged: 99.99, wantAdjust: true},
+		{name: "truncated to zero is rejected", mode: PrecisionTruncate, amount: 0.009, wantErr: ErrAmountPrecision},
+		{name: "within precision is untouched", mode: PrecisionReject, amount: 99.99, wantCharged: 99.99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var charged atomic.Value
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Amount float64 `json:"amount"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				charged.Store(body.Amount)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.AmountPrecisionMode = tt.mode
+			cfg.AmountDecimals = 2
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: tt.amount, Currency: "USD"}, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			got, _ := charged.Load().(float64)
+			if got != tt.wantCharged {
+				t.Errorf("charged %v, want %v", got, tt.wantCharged)
+			}
+			if resp == nil {
+				return
+			}
+
+			adj := resp.Adjustment
+			if (adj != nil) != tt.wantAdjust {
+				t.Fatalf("amount_adjustment = %+v, want present %v", adj, tt.wantAdjust)
+			}
+			if adj != nil && *adj != (AmountAdjustment{OriginalAmount: tt.amount, Amount: tt.wantCharged, Mode: tt.mode}) {
+				t.Errorf("amount_adjustment = %+v, want %v adjusted to %v by %s", *adj, tt.amount, tt.wantCharged, tt.mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrIdempotencyConflict is returned when an idempotency key is reused for a different order
+var ErrIdempotencyConflict = errors.New("idempotency key already used for a different request")
+
+// AuditLogger records security-relevant events to a sink kept apart from the application log
+// Implementations must be safe for concurrent use
+type AuditLogger interface {
+	IdempotencyConflict(ctx context.Context, event IdempotencyConflictEvent)
+}
+
+// IdempotencyConflictEvent describes an idempotency key reused with a different payload
+// Repeated conflicts from one merchant usually mean a client bug in key generation, or someone probing keys
+type IdempotencyConflictEvent struct {
+	MerchantID        string // Merchant that sent the conflicting request
+	Key               string
+	Fingerprint       string // Of the conflicting request
+	StoredMerchantID  string // Merchant whose request the key was first used for
+	StoredFingerprint string
+	StoredOrderID     string
+}
+
+// OpenAuditLog returns an audit logger writing JSON lines to dest: "stdout", "stderr" or a file path (appended to)
+// An empty dest discards audit events
+func OpenAuditLog(dest string) (AuditLogger, error) {
+	switch dest {
+	case "":
+		return noopAuditLogger{}, nil
+	case "stdout":
+		return NewJSONAuditLogger(os.Stdout), nil
+	case "stderr":
+		return NewJSONAuditLogger(os.Stderr), nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return NewJSONAuditLogger(f), nil
+}
+
+// JSONAuditLogger writes each audit event as one JSON object per line
+type JSONAuditLogger struct {
+	logger *slog.Logger
+}
+
+// NewJSONAuditLogger creates an audit logger writing to w
+func NewJSONAuditLogger(w io.Writer) *JSONAuditLogger {
+	return &JSONAuditLogger{logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+// IdempotencyConflict records the conflict with the trace ID, so the request can be found in the trace backend
+func (l *JSONAuditLogger) IdempotencyConflict(ctx context.Context, event IdempotencyConflictEvent) {
+	l.logger.LogAttrs(ctx, slog.LevelWarn, "idempotency_key_conflict",
+		slog.String("merchant_id", event.MerchantID),
+		slog.String("idempotency_key", event.Key),
+		slog.String("fingerprint", event.Fingerprint),
+		slog.String("stored_merchant_id", event.StoredMerchantID),
+		slog.String("stored_fingerprint", event.StoredFingerprint),
+		slog.String("stored_order_id", event.StoredOrderID),
+		slog.String("trace_id", trace.SpanContextFromContext(ctx).TraceID().String()),
+	)
+}
+
+// noopAuditLogger discards audit events
+type noopAuditLogger struct{}
+
+func (noopAuditLogger) IdempotencyConflict(context.Context, IdempotencyConflictEvent) {}
+
+// requestFingerprint returns a short digest of the fields that define an order, to tell a retry from a reused key
+func requestFingerprint(req CreateOrderRequest) string {
+	sum := sha256.Sum256([]byte(req.MerchantID + "\x00" + strconv.FormatFloat(req.Amount, 'f', -1, 64) + "\x00" + req.Currency))
+	return hex.EncodeToString(sum[:8])
+}
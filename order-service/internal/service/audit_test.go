@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestIdempotencyConflictAudited(t *testing.T) {
+	first := CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}
+	tests := []struct {
+		name         string
+		second       CreateOrderRequest // Sent with the same idempotency key as first
+		wantConflict bool
+	}{
+		{name: "same payload replays", second: first},
+		{name: "different amount", second: CreateOrderRequest{MerchantID: "merchant_123", Amount: 99, Currency: "USD"}, wantConflict: true},
+		{name: "different currency", second: CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "EUR"}, wantConflict: true},
+		{name: "another merchant reusing the key", second: CreateOrderRequest{MerchantID: "merchant_456", Amount: 10, Currency: "USD"}, wantConflict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			var audit bytes.Buffer
+			svc := NewOrderService(cfg, NewJSONAuditLogger(&audit))
+			svc.tracer = sdktrace.NewTracerProvider().Tracer("test") // Real trace IDs for the audit record
+
+			firstResp, err := svc.CreateOrder(context.Background(), first, "key-1")
+			if err != nil {
+				t.Fatalf("first CreateOrder() error = %v", err)
+			}
+			_, err = svc.CreateOrder(context.Background(), tt.second, "key-1")
+			if errors.Is(err, ErrIdempotencyConflict) != tt.wantConflict {
+				t.Fatalf("second CreateOrder() error = %v, want conflict %v", err, tt.wantConflict)
+			}
+
+			lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+			if !tt.wantConflict {
+				if audit.Len() > 0 {
+					t.Errorf("audit log = %q, want nothing for a replay", audit.String())
+				}
+				return
+			}
+			if len(lines) != 1 {
+				t.Fatalf("audit log has %d records, want 1: %q", len(lines), audit.String())
+			}
+			var record map[string]string
+			if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+				t.Fatalf("decoding audit record %q: %v", lines[0], err)
+			}
+			want := map[string]string{
+				"level":              "WARN",
+				"msg":                "idempotency_key_conflict",
+				"merchant_id":        tt.second.MerchantID,
+				"idempotency_key":    "key-1",
+				"fingerprint":        requestFingerprint(tt.second),
+				"stored_merchant_id": first.MerchantID,
+				"stored_fingerprint": requestFingerprint(first),
+				"stored_order_id":    firstResp.OrderID,
+			}
+			for field, value := range want {
+				if record[field] != value {
+					t.Errorf("audit %s = %q, want %q", field, record[field], value)
+				}
+			}
+			if traceID, err := trace.TraceIDFromHex(record["trace_id"]); err != nil || !traceID.IsValid() {
+				t.Errorf("audit trace_id = %q, want the request's trace ID", record["trace_id"])
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPaymentBodyStalled is returned when the payment service sent headers but then stopped sending the body
+var ErrPaymentBodyStalled = errors.New("payment response body stalled")
+
+// stallReader closes the underlying body when a single Read waits longer than timeout,
+// so a downstream that sends headers quickly and then stalls can't hold the call until the overall deadline
+type stallReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+// newStallReader wraps body with a per-read deadline; a timeout of 0 returns body unchanged
+func newStallReader(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	return &stallReader{body: body, timeout: timeout}
+}
+
+// Read forwards to the body, aborting it if no bytes arrive within the timeout
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.stalled.Load() {
+		return 0, ErrPaymentBodyStalled
+	}
+	// Closing the body is the only way to unblock a read in progress
+	timer := time.AfterFunc(r.timeout, func() {
+		r.stalled.Store(true)
+		r.body.Close()
+	})
+	n, err := r.body.Read(p)
+	if !timer.Stop() && r.stalled.Load() {
+		return n, ErrPaymentBodyStalled
+	}
+	return n, err
+}
+
+// Close closes the underlying body
+func (r *stallReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPaymentBodyStallAborts(t *testing.T) {
+	tests := []struct {
+		name        string
+		readTimeout time.Duration
+		chunkGap    time.Duration // Pause before each of the three body chunks after the first
+		wantStalled bool
+		wantBody    bool          // The whole error body made it into the error
+		maxElapsed  time.Duration // CreateOrder returns within this
+	}{
+		{name: "stalled body aborts at the read timeout", readTimeout: 50 * time.Millisecond, chunkGap: 2 * time.Second,
+			wantStalled: true, maxElapsed: 500 * time.Millisecond},
+		{name: "slow but steady body is read in full", readTimeout: 100 * time.Millisecond, chunkGap: 20 * time.Millisecond,
+			wantBody: true, maxElapsed: time.Second},
+		{name: "no read timeout waits out the stall", chunkGap: 150 * time.Millisecond, wantBody: true, maxElapsed: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Headers and the first chunk go out at once; the rest trickles in, or never arrives
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				for _, chunk := range []string{"card ", "declined ", "by ", "issuer"} {
+					io.WriteString(w, chunk)
+					w.(http.Flusher).Flush()
+					select {
+					case <-time.After(tt.chunkGap):
+					case <-r.Context().Done():
+						return
+					}
+				}
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.ClientTimeout = 5 * time.Second
+			cfg.Payment.CallTimeout = 5 * time.Second
+			cfg.Payment.BodyReadTimeout = tt.readTimeout
+			cfg.Retry.MaxAttempts = 1
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			start := time.Now()
+			_, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+			elapsed := time.Since(start)
+			if err == nil {
+				t.Fatal("CreateOrder() succeeded, want the payment error")
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("CreateOrder() took %v, want under %v", elapsed, tt.maxElapsed)
+			}
+			if got := strings.Contains(err.Error(), "card declined by issuer"); got != tt.wantBody {
+				t.Errorf("error %q has the whole body = %v, want %v", err, got, tt.wantBody)
+			}
+
+			var stalled bool
+			for _, span := range recorder.Ended() {
+				for _, kv := range span.Attributes() {
+					if kv.Key == "payment.body_stalled" {
+						stalled = kv.Value.AsBool()
+					}
+				}
+			}
+			if stalled != tt.wantStalled {
+				t.Errorf("payment.body_stalled = %v, want %v", stalled, tt.wantStalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/demo/order-service/internal/features"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnsupportedCurrency is returned when the settlement backend doesn't accept the order's currency and it can't be converted
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// ExchangeRateProvider converts between currencies
+// Implementations must be safe for concurrent use
+type ExchangeRateProvider interface {
+	// Rate returns how many units of `to` one unit of `from` buys, or false if the pair is unknown
+	Rate(from, to string) (float64, bool)
+}
+
+// StaticExchangeRates is an immutable table of rates into a single currency
+// Swap in a live rates feed implementing ExchangeRateProvider for production use
+type StaticExchangeRates struct {
+	to    string
+	rates map[string]float64
+}
+
+// NewStaticExchangeRates creates a provider converting into `to`, where rates maps each currency to units of `to` per unit
+func NewStaticExchangeRates(to string, rates map[string]float64) *StaticExchangeRates {
+	return &StaticExchangeRates{to: to, rates: rates}
+}
+
+// Rate returns the configured rate from `from` into the table's currency
+func (r *StaticExchangeRates) Rate(from, to string) (float64, bool) {
+	if to != r.to {
+		return 0, false
+	}
+	rate, ok := r.rates[from]
+	return rate, ok
+}
+
+// CurrencySubstitution records an order converted to the fallback currency
+type CurrencySubstitution struct {
+	OriginalCurrency string  `json:"original_currency"`
+	OriginalAmount   float64 `json:"original_amount"`
+	Currency         string  `json:"currency"`
+	Amount           float64 `json:"amount"`
+	Rate             float64 `json:"rate"`
+}
+
+// resolveCurrency returns the order unchanged if its currency is supported, converted to the fallback currency
+// if the merchant opted in with the currency_fallback flag, and ErrUnsupportedCurrency otherwise
+func (s *OrderService) resolveCurrency(span trace.Span, req CreateOrderRequest) (CreateOrderRequest, *CurrencySubstitution, error) {
+	if s.supportedCurrencies == nil || s.supportedCurrencies[req.Currency] {
+		return req, nil, nil
+	}
+	span.SetAttributes(attribute.Bool("currency.unsupported", true))
+
+	if s.fallbackCurrency == "" || !s.featureFlags.Enabled(req.MerchantID, features.CurrencyFallback) {
+		return req, nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, req.Currency)
+	}
+	rate, ok := s.exchangeRates.Rate(req.Currency, s.fallbackCurrency)
+	if !ok {
+		return req, nil, fmt.Errorf("%w: %s, and no exchange rate to %s", ErrUnsupportedCurrency, req.Currency, s.fallbackCurrency)
+	}
+
+	// Amounts are charged to the cent, so round rather than pass on float noise from the multiplication
+	converted := req
+	converted.Currency = s.fallbackCurrency
+	converted.Amount = math.Round(req.Amount*rate*100) / 100
+	if converted.Amount <= 0 {
+		return req, nil, fmt.Errorf("%w: %s %v is less than one cent in %s", ErrUnsupportedCurrency, req.Currency, req.Amount, s.fallbackCurrency)
+	}
+
+	sub := &CurrencySubstitution{
+		OriginalCurrency: req.Currency,
+		OriginalAmount:   req.Amount,
+		Currency:         converted.Currency,
+		Amount:           converted.Amount,
+		Rate:             rate,
+	}
+	span.AddEvent("currency_substituted", trace.WithAttributes(
+		attribute.String("currency.original", sub.OriginalCurrency),
+		attribute.Float64("currency.original_amount", sub.OriginalAmount),
+		attribute.Float64("currency.rate", rate),
+	))
+	span.SetAttributes(
+		attribute.Bool("currency.substituted", true),
+		attribute.String("order.currency", converted.Currency),
+		attribute.Float64("order.amount", converted.Amount),
+	)
+	return converted, sub, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/features"
+)
+
+func TestCurrencyFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		merchantID   string
+		currency     string
+		amount       float64
+		wantErr      bool
+		wantCharge   *CurrencySubstitution // Currency and amount sent to payment; nil if nothing was charged
+		wantOriginal bool                  // The response records the substitution
+	}{
+		{name: "supported currency charged as is", merchantID: "merchant_123", currency: "EUR", amount: 10,
+			wantCharge: &CurrencySubstitution{Currency: "EUR", Amount: 10}},
+		{name: "opted-in merchant converted to the fallback", merchantID: "fallback_ok", currency: "GBP", amount: 10,
+			wantCharge: &CurrencySubstitution{Currency: "USD", Amount: 12.7}, wantOriginal: true},
+		{name: "conversion rounded to the cent", merchantID: "fallback_ok", currency: "JPY", amount: 1234,
+			wantCharge: &CurrencySubstitution{Currency: "USD", Amount: 8.27}, wantOriginal: true},
+		{name: "merchant not opted in is rejected", merchantID: "merchant_123", currency: "GBP", amount: 10, wantErr: true},
+		{name: "no exchange rate is rejected", merchantID: "fallback_ok", currency: "CHF", amount: 10, wantErr: true},
+		{name: "converts to less than a cent is rejected", merchantID: "fallback_ok", currency: "JPY", amount: 0.5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var charged []CurrencySubstitution
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Currency string  `json:"currency"`
+					Amount   float64 `json:"amount"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				mu.Lock()
+				charged = append(charged, CurrencySubstitution{Currency: body.Currency, Amount: body.Amount})
+				mu.Unlock()
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.SupportedCurrencies = []string{"USD", "EUR"}
+			cfg.FallbackCurrency = "USD"
+			cfg.ExchangeRates = map[string]float64{"GBP": 1.27, "JPY": 0.0067}
+			cfg.FeatureFlags = map[string][]features.Flag{"fallback_ok": {features.CurrencyFallback}}
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: tt.merchantID, Amount: tt.amount, Currency: tt.currency}, "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCurrency) {
+					t.Errorf("CreateOrder() error = %v, want ErrUnsupportedCurrency", err)
+				}
+			} else if err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case tt.wantCharge == nil && len(charged) > 0:
+				t.Errorf("charged %+v, want nothing charged", charged)
+			case tt.wantCharge != nil && (len(charged) != 1 || charged[0] != *tt.wantCharge):
+				t.Errorf("charged %+v, want one charge of %+v", charged, *tt.wantCharge)
+			}
+			if resp == nil {
+				return
+			}
+
+			sub := resp.Substitution
+			if (sub != nil) != tt.wantOriginal {
+				t.Fatalf("currency_substitution = %+v, want present %v", sub, tt.wantOriginal)
+			}
+			if sub != nil && (sub.OriginalCurrency != tt.currency || sub.OriginalAmount != tt.amount ||
+				sub.Currency != tt.wantCharge.Currency || sub.Amount != tt.wantCharge.Amount) {
+				t.Errorf("currency_substitution = %+v, want %s %v converted to %+v", *sub, tt.currency, tt.amount, *tt.wantCharge)
+			}
+		})
+	}
+}
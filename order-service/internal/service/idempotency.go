@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/demo/order-service/internal/reliability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// replayAlerts counts idempotency keys whose replays crossed the alert threshold, a sign of a client retry storm
+var replayAlerts, _ = otel.Meter("order-service").Int64Counter("idempotency.replay_alerts",
+	metric.WithDescription("Idempotency keys replayed more than IDEMPOTENCY_REPLAY_ALERT_THRESHOLD times"))
+
+// getIdempotent looks up a cached response in an idempotency.get child span, so store latency shows in the trace
+func (s *OrderService) getIdempotent(ctx context.Context, key string) (*reliability.IdempotentResponse, bool) {
+	_, span := s.tracer.Start(ctx, "idempotency.get",
+		trace.WithAttributes(attribute.String("idempotency.key_hash", hashIdempotencyKey(key))),
+	)
+	defer span.End()
+
+	cached, hit := s.idempotencyStore.Get(key)
+	span.SetAttributes(attribute.Bool("idempotency.hit", hit))
+	return cached, hit
+}
+
+// setIdempotent stores a response in an idempotency.set child span
+func (s *OrderService) setIdempotent(ctx context.Context, key string, resp *reliability.IdempotentResponse, ttl time.Duration) {
+	_, span := s.tracer.Start(ctx, "idempotency.set",
+		trace.WithAttributes(
+			attribute.String("idempotency.key_hash", hashIdempotencyKey(key)),
+			attribute.Int64("idempotency.ttl_s", int64(ttl.Seconds())),
+		),
+	)
+	defer span.End()
+
+	s.idempotencyStore.SetWithTTL(key, resp, ttl)
+}
+
+// ExpireIdempotency drops the idempotency protection of an order, so resubmitting it with the same key creates a new order
+// Returns how many entries were removed; 0 if the order was never stored or its entries already expired
+func (s *OrderService) ExpireIdempotency(orderID string) int {
+	removed := s.idempotencyStore.DeleteByOrderID(orderID)
+	if removed > 0 {
+		log.Printf("WARNING: idempotency protection of order %s expired manually (%d entries); resubmissions will create a new order",
+			orderID, removed)
+	}
+	return removed
+}
+
+// recordReplay counts a replay of the key and raises an alert the moment it crosses the replay threshold
+// Alerting once per key keeps a storm from flooding the log with the very requests it's about
+func (s *OrderService) recordReplay(ctx context.Context, span trace.Span, key, merchantID string) {
+	replays := s.idempotencyStore.RecordReplay(key)
+	span.SetAttributes(attribute.Int("idempotency.replay_count", replays))
+	if s.replayAlertThreshold <= 0 || replays != s.replayAlertThreshold+1 {
+		return
+	}
+	span.AddEvent("idempotency_replay_storm")
+	replayAlerts.Add(ctx, 1, metric.WithAttributes(attribute.String("merchant.id", merchantID)))
+	log.Printf("WARNING: idempotency key %s from merchant %s replayed more than %d times; possible client retry storm",
+		hashIdempotencyKey(key), merchantID, s.replayAlertThreshold)
+}
+
+// hashIdempotencyKey returns a short, stable digest of the key for span attributes
+// Child spans may be exported to backends with wider access than the request itself, so the raw key stays off them
+func hashIdempotencyKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// completedConcurrently turns a charge stopped because a concurrent request with the same idempotency key
+// completed first into that request's response, as if this one had been a replay
+// This request's own order is left failed, since the charge belongs to the other order
+func completedConcurrently(span trace.Span, err error) (*CreateOrderResponse, bool) {
+	var completed *reliability.CompletedElsewhereError
+	if !errors.As(err, &completed) {
+		return nil, false
+	}
+	span.AddEvent("idempotent_request_completed_concurrently", trace.WithAttributes(
+		attribute.String("idempotency.order_id", completed.Response.OrderID),
+	))
+	span.SetStatus(codes.Ok, "order completed by a concurrent request")
+	return &CreateOrderResponse{
+		OrderID:   completed.Response.OrderID,
+		Status:    completed.Response.Status,
+		CreatedAt: completed.Response.CreatedAt.Format(time.RFC3339),
+		Replayed:  true,
+	}, true
+}
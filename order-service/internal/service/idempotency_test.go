@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestIdempotencyStoreSpans(t *testing.T) {
+	const key = "client-key-secret-1"
+	tests := []struct {
+		name      string
+		key       string
+		wantSpans []string // idempotency.* spans of the second of two identical requests, with hit or miss for gets
+	}{
+		{name: "replay hits without writing", key: key, wantSpans: []string{"idempotency.get:hit"}},
+		{name: "no key, no store spans", wantSpans: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			req := CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}
+
+			// storeSpans runs one request and returns its idempotency.* spans in the order they ended
+			storeSpans := func() []string {
+				recorder := tracetest.NewSpanRecorder()
+				svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+				if _, err := svc.CreateOrder(context.Background(), req, tt.key); err != nil {
+					t.Fatal(err)
+				}
+
+				var parent string
+				for _, span := range recorder.Ended() {
+					if span.Name() == "createOrder" {
+						parent = span.SpanContext().SpanID().String()
+					}
+				}
+				var names []string
+				for _, span := range recorder.Ended() {
+					if !strings.HasPrefix(span.Name(), "idempotency.") {
+						continue
+					}
+					if span.Parent().SpanID().String() != parent {
+						t.Errorf("%s isn't a child of createOrder", span.Name())
+					}
+					name := span.Name()
+					for _, kv := range span.Attributes() {
+						switch {
+						case kv.Value.AsString() == tt.key:
+							t.Errorf("%s carries the raw idempotency key in %s", span.Name(), kv.Key)
+						case kv.Key == "idempotency.key_hash" && kv.Value.AsString() != hashIdempotencyKey(tt.key):
+							t.Errorf("%s key hash = %s, want %s", span.Name(), kv.Value.AsString(), hashIdempotencyKey(tt.key))
+						case kv.Key == "idempotency.hit" && kv.Value.AsBool():
+							name += ":hit"
+						case kv.Key == "idempotency.hit":
+							name += ":miss"
+						}
+					}
+					names = append(names, name)
+				}
+				return names
+			}
+
+			first := storeSpans()
+			if tt.key != "" && !slices.Equal(first, []string{"idempotency.get:miss", "idempotency.set"}) {
+				t.Errorf("first request spans = %v, want a missed get then a set", first)
+			}
+			if second := storeSpans(); !slices.Equal(second, tt.wantSpans) {
+				t.Errorf("second request spans = %v, want %v", second, tt.wantSpans)
+			}
+		})
+	}
+}
+
+func TestReplayStormAlert(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  int
+		replays    int
+		wantAlerts int
+	}{
+		{name: "at the threshold stays quiet", threshold: 5, replays: 5},
+		{name: "crossing the threshold alerts once", threshold: 5, replays: 6, wantAlerts: 1},
+		{name: "a storm still alerts once", threshold: 5, replays: 40, wantAlerts: 1},
+		{name: "disabled", replays: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.IdempotencyReplayAlertThreshold = tt.threshold
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			req := CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}
+			if _, err := svc.CreateOrder(context.Background(), req, "storm-key"); err != nil {
+				t.Fatal(err)
+			}
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// Replays arrive together, as they would from a retrying client fleet
+			var wg sync.WaitGroup
+			for i := 0; i < tt.replays; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := svc.CreateOrder(context.Background(), req, "storm-key"); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			var alerts int
+			var counts []int64
+			for _, span := range recorder.Ended() {
+				for _, event := range span.Events() {
+					if event.Name == "idempotency_replay_storm" {
+						alerts++
+					}
+				}
+				for _, kv := range span.Attributes() {
+					if kv.Key == "idempotency.replay_count" {
+						counts = append(counts, kv.Value.AsInt64())
+					}
+				}
+			}
+			if alerts != tt.wantAlerts {
+				t.Errorf("storm events = %d, want %d", alerts, tt.wantAlerts)
+			}
+			if got := strings.Count(logs.String(), "possible client retry storm"); got != tt.wantAlerts {
+				t.Errorf("storm warnings logged = %d, want %d: %q", got, tt.wantAlerts, logs.String())
+			}
+			if strings.Contains(logs.String(), "storm-key") {
+				t.Errorf("warning %q carries the raw idempotency key", logs.String())
+			}
+
+			// Every replay was counted exactly once, even when racing
+			slices.Sort(counts)
+			for i, count := range counts {
+				if count != int64(i+1) {
+					t.Fatalf("replay counts = %v, want 1 through %d", counts, tt.replays)
+				}
+			}
+			if len(counts) != tt.replays {
+				t.Errorf("got %d replay counts, want %d", len(counts), tt.replays)
+			}
+		})
+	}
+}
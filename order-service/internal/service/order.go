@@ -4,43 +4,210 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/features"
 	"github.com/demo/order-service/internal/reliability"
 	"github.com/demo/order-service/internal/tracing"
 	"github.com/google/uuid"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
 )
 
 // OrderService handles order creation with reliability patterns
 type OrderService struct {
-	paymentURL       string
+	defaultRoute     *paymentRoute
+	currencyRoutes   map[string]*paymentRoute // Currency-specific payment backends, e.g. EUR settlement
+	paymentTimeout   time.Duration
+	maxErrorBody     int64         // Cap on bytes read from a payment error response
+	bodyReadTimeout  time.Duration // Longest wait for the next chunk of a payment response body; 0 disables
 	httpClient       *http.Client
-	circuitBreaker   *reliability.CircuitBreaker
-	bulkhead         *reliability.Bulkhead
-	retryConfig      reliability.RetryConfig
+	retryPolicies    reliability.RetryPolicies
+	orderRetry       reliability.OperationRetryConfig
+	hedgingConfig    reliability.HedgingConfig
 	idempotencyStore *reliability.IdempotencyStore
+	orders           *OrderStore
+	persistDown      func() bool       // Rolls whether a write hits the simulated database outage
+	writeBehind      *writeBehindQueue // nil when write-behind persistence is disabled
+	sloTracker       *reliability.SLOTracker
+	paymentHealth    *reliability.HealthChecker
+	featureFlags     features.Provider
+	priorityMerchant map[string]bool
+	stepUpThreshold  float64 // 0 disables step-up authentication
+	stepUps          *stepUpStore
 	tracer           trace.Tracer
+	audit            AuditLogger
+
+	supportedCurrencies map[string]bool // nil accepts every currency
+	fallbackCurrency    string          // Unsupported currencies convert to this for opted-in merchants; empty disables
+	exchangeRates       ExchangeRateProvider
+
+	amountPrecision AmountPrecision // Must match the payment service's AMOUNT_PRECISION_MODE and AMOUNT_DECIMALS
+	skipCancelled   bool            // Return at once when the context is already cancelled on entry
+
+	webhooks *webhookNotifier // nil when WEBHOOK_SECRET is unset, so callback URLs are refused
+
+	replayAlertThreshold int // Replays of one idempotency key tolerated before alerting; 0 disables
+
+	retryBudget *reliability.RetryBudget // Shared by every retry policy; nil when RETRY_BUDGET_ENABLED is off
+}
+
+// paymentEndpoint is one payment service instance with its own circuit breaker,
+// so an outage in one zone doesn't trip the circuit for the others
+type paymentEndpoint struct {
+	url            string
+	circuitBreaker *reliability.CircuitBreaker
+}
+
+// paymentRoute is a payment backend with its own bulkhead, so a slow backend for one currency
+// can't exhaust concurrency for the others
+type paymentRoute struct {
+	name      string             // "default" or the currency code
+	endpoints []*paymentEndpoint // Tried in order; later entries are fallbacks
+	bulkhead  *reliability.Bulkhead
+}
+
+// newPaymentRoute creates a route with a circuit breaker per endpoint and a dedicated bulkhead
+func newPaymentRoute(name string, urls []string, cfg *config.Config, metrics reliability.MetricsSink) *paymentRoute {
+	route := &paymentRoute{
+		name:      name,
+		endpoints: make([]*paymentEndpoint, 0, len(urls)),
+		bulkhead:  reliability.NewBulkhead(cfg.Bulkhead, metrics),
+	}
+	for _, url := range urls {
+		cbConfig := cfg.CircuitBreaker
+		cbConfig.Name = url
+		route.endpoints = append(route.endpoints, &paymentEndpoint{
+			url:            url,
+			circuitBreaker: reliability.NewCircuitBreaker(cbConfig, metrics),
+		})
+	}
+	return route
 }
 
 // NewOrderService creates a new order service with configured reliability patterns
-func NewOrderService(paymentURL string) *OrderService {
-	return &OrderService{
-		paymentURL: paymentURL,
+// Security-relevant events such as idempotency key conflicts go to audit
+func NewOrderService(cfg *config.Config, audit AuditLogger) *OrderService {
+	metrics := newMetricsSink(cfg.MetricsSink)
+	// One tracker for every endpoint: it judges the payment service as a whole, unlike the per-endpoint breakers
+	adaptive := reliability.NewAdaptiveRetry(cfg.AdaptiveRetry)
+	budget := reliability.NewRetryBudget(cfg.RetryBudget)
+	// Retries check the store between attempts so they stop once a concurrent request with the same key completes
+	idempotencyStore := reliability.NewIdempotencyStore(cfg.IdempotencyMaxKeys, cfg.IdempotencyEntryBytes)
+	retry := cfg.Retry
+	retry.Metrics = metrics
+	retry.Adaptive = adaptive
+	retry.Budget = budget
+	retry.Idempotency = idempotencyStore
+	retryEndpoints := make(map[string]reliability.RetryConfig, len(cfg.RetryEndpoints))
+	for endpoint, policy := range cfg.RetryEndpoints {
+		policy.Metrics = metrics
+		policy.Adaptive = adaptive
+		policy.Budget = budget
+		policy.Idempotency = idempotencyStore
+		retryEndpoints[endpoint] = policy
+	}
+	namedRetry := make(map[string]reliability.RetryConfig, len(cfg.RetryPolicies))
+	for name, policy := range cfg.RetryPolicies {
+		policy.Metrics = metrics
+		policy.Adaptive = adaptive
+		policy.Budget = budget
+		policy.Idempotency = idempotencyStore
+		namedRetry[name] = policy
+	}
+
+	s := &OrderService{
+		defaultRoute:   newPaymentRoute("default", cfg.Payment.URLs, cfg, metrics),
+		currencyRoutes: make(map[string]*paymentRoute, len(cfg.Payment.URLByCurrency)),
+		paymentTimeout: cfg.Payment.CallTimeout,
+		maxErrorBody:   cfg.Payment.MaxErrorBodyBytes,
+
+		bodyReadTimeout: cfg.Payment.BodyReadTimeout,
 		httpClient: &http.Client{
-			Timeout: 2 * time.Second, // Overall client timeout
+			Timeout:   cfg.Payment.ClientTimeout, // Overall client timeout
+			Transport: paymentTransport(cfg.Payment),
 		},
-		circuitBreaker:   reliability.NewCircuitBreaker(),
-		bulkhead:         reliability.NewBulkhead(10), // Max 10 concurrent payment calls
-		retryConfig:      reliability.DefaultRetryConfig(),
-		idempotencyStore: reliability.NewIdempotencyStore(),
+		retryPolicies: reliability.RetryPolicies{
+			Default:   retry,
+			Endpoints: retryEndpoints,
+			Named:     namedRetry,
+			Merchants: cfg.RetryPolicyByMerchant,
+		},
+		orderRetry:       cfg.OrderRetry,
+		hedgingConfig:    cfg.Hedging,
+		idempotencyStore: idempotencyStore,
+		orders:           NewOrderStore(cfg.CancelledOrderRetention),
+		sloTracker:       reliability.NewSLOTracker(cfg.SLOTarget, 5*time.Minute, 1*time.Hour),
+		featureFlags:     features.NewStaticProvider(cfg.FeatureFlags),
+		priorityMerchant: make(map[string]bool, len(cfg.PriorityMerchants)),
+		stepUpThreshold:  cfg.StepUpThreshold,
+		stepUps:          newStepUpStore(cfg.StepUpChallengeTTL),
 		tracer:           tracing.GetTracer("order-service"),
+		audit:            audit,
+
+		amountPrecision: AmountPrecision{Mode: cfg.AmountPrecisionMode, Decimals: cfg.AmountDecimals},
+		skipCancelled:   cfg.SkipCancelled,
 	}
+	persistErrorPct := cfg.Persistence.ErrorPercentage
+	s.persistDown = func() bool { return persistErrorPct > 0 && rand.Float64()*100 < persistErrorPct }
+	s.webhooks = newWebhookNotifier(cfg.Webhook, s.tracer)
+	s.replayAlertThreshold = cfg.IdempotencyReplayAlertThreshold
+	s.retryBudget = budget
+	for _, merchantID := range cfg.PriorityMerchants {
+		s.priorityMerchant[merchantID] = true
+	}
+	if len(cfg.SupportedCurrencies) > 0 {
+		s.supportedCurrencies = make(map[string]bool, len(cfg.SupportedCurrencies))
+		for _, currency := range cfg.SupportedCurrencies {
+			s.supportedCurrencies[currency] = true
+		}
+		s.fallbackCurrency = cfg.FallbackCurrency
+		s.exchangeRates = NewStaticExchangeRates(cfg.FallbackCurrency, cfg.ExchangeRates)
+	}
+	for currency, url := range cfg.Payment.URLByCurrency {
+		s.currencyRoutes[currency] = newPaymentRoute(currency, []string{url}, cfg, metrics)
+	}
+	if cfg.Persistence.WriteBehind {
+		s.writeBehind = newWriteBehindQueue(cfg.Persistence.WriteBehindQueue, cfg.Persistence.WriteBehindBackoff, s.flushWriteBehind)
+	}
+	s.paymentHealth = reliability.NewHealthChecker(s.probePaymentHealth, cfg.Readiness.CacheTTL, cfg.Readiness.JitterFraction)
+
+	return s
+}
+
+// newMetricsSink returns the sink named by METRICS_SINK, already validated by config.Load
+func newMetricsSink(name string) reliability.MetricsSink {
+	if name == "otel" {
+		return reliability.NewOTelMetricsSink(otel.Meter("order-service"))
+	}
+	return reliability.NoopMetricsSink{}
+}
+
+// paymentTransport returns an HTTP transport enforcing the configured TLS minimum version and cipher suites
+// and bounding how many requests HTTP/2 multiplexing lets through to each payment host
+func paymentTransport(cfg config.PaymentConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Already validated by config.Load; a nil config falls back to Go's defaults
+	transport.TLSClientConfig, _ = cfg.TLS.Config()
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+
+	// Only fails if HTTP/2 is already configured, which a fresh clone never is
+	if h2, err := http2.ConfigureTransports(transport); err == nil {
+		h2.StrictMaxConcurrentStreams = cfg.StrictStreamLimit
+	}
+	return transport
 }
 
 // CreateOrderRequest represents the incoming order request
@@ -48,17 +215,41 @@ type CreateOrderRequest struct {
 	MerchantID string  `json:"merchant_id" binding:"required"`
 	Amount     float64 `json:"amount" binding:"required,gt=0"`
 	Currency   string  `json:"currency" binding:"required"`
+
+	// Optional https URL POSTed a signed order.completed webhook once the order completes
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 // CreateOrderResponse represents the order creation response
 type CreateOrderResponse struct {
-	OrderID   string `json:"order_id"`
-	Status    string `json:"status"`
-	CreatedAt string `json:"created_at"`
+	OrderID        string `json:"order_id"`
+	Status         string `json:"status"`                    // "completed" or "stepup_required"
+	ChallengeToken string `json:"challenge_token,omitempty"` // Present with stepup_required; pass to POST /orders/:id/confirm
+	CreatedAt      string `json:"created_at"`
+	Replayed       bool   `json:"-"` // Served from the idempotency store rather than processed
+
+	// Present when the order was converted from an unsupported currency to the fallback currency
+	Substitution *CurrencySubstitution `json:"currency_substitution,omitempty"`
+	// Present when the amount was rounded or truncated to the allowed precision
+	Adjustment *AmountAdjustment `json:"amount_adjustment,omitempty"`
 }
 
 // CreateOrder orchestrates the order creation workflow with reliability patterns
-func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest, idempotencyKey string) (*CreateOrderResponse, error) {
+func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest, idempotencyKey string) (_ *CreateOrderResponse, err error) {
+	// The client may have gone before we started; don't spend a payment call on a response nobody will read
+	// Checked ahead of the SLO record since nothing was attempted
+	if s.skipCancelled && ctx.Err() != nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("ctx.cancelled_at_entry", true))
+		return nil, ctx.Err()
+	}
+
+	// Every outcome counts against the error budget, including idempotent replays, except currencies we can't settle,
+	// reused keys, over-precise amounts and callbacks we can't send
+	defer func() {
+		s.sloTracker.Record(err == nil || errors.Is(err, ErrUnsupportedCurrency) || errors.Is(err, ErrIdempotencyConflict) ||
+			errors.Is(err, ErrAmountPrecision) || errors.Is(err, ErrCallbacksDisabled))
+	}()
+
 	// Start parent span for the entire order creation flow
 	ctx, span := s.tracer.Start(ctx, "createOrder",
 		trace.WithAttributes(
@@ -69,77 +260,388 @@ func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest,
 	)
 	defer span.End()
 
+	// Attach the per-stage latency breakdown once every stage has finished
+	defer reliability.StageTimerFromContext(ctx).SetSpanAttributes(span)
+
+	// VIP merchants are admitted from the reserved bulkhead pool under saturation
+	if s.priorityMerchant[req.MerchantID] {
+		ctx = reliability.WithPriority(ctx, reliability.PriorityHigh)
+	}
+
+	if active := s.featureFlags.Active(req.MerchantID); len(active) > 0 {
+		span.SetAttributes(attribute.StringSlice("feature_flags", features.Strings(active)))
+	}
+
 	// Check idempotency: if we've seen this key before, return cached response
+	// The fingerprint is of the request as sent, so a retry matches even if the order is later converted
+	fingerprint := requestFingerprint(req)
 	if idempotencyKey != "" {
 		span.SetAttributes(attribute.String("idempotency.key", idempotencyKey))
-		if cached, exists := s.idempotencyStore.Get(idempotencyKey); exists {
+		if cached, exists := s.getIdempotent(ctx, idempotencyKey); exists {
+			// Replaying another order's result would hide a client bug or let one key probe another's order
+			if cached.Fingerprint != "" && cached.Fingerprint != fingerprint {
+				s.audit.IdempotencyConflict(ctx, IdempotencyConflictEvent{
+					MerchantID:        req.MerchantID,
+					Key:               idempotencyKey,
+					Fingerprint:       fingerprint,
+					StoredMerchantID:  cached.MerchantID,
+					StoredFingerprint: cached.Fingerprint,
+					StoredOrderID:     cached.OrderID,
+				})
+				span.AddEvent("idempotency_conflict")
+				span.SetStatus(codes.Error, ErrIdempotencyConflict.Error())
+				return nil, ErrIdempotencyConflict
+			}
 			span.AddEvent("idempotent_request_cached")
+			s.recordReplay(ctx, span, idempotencyKey, req.MerchantID)
 			return &CreateOrderResponse{
 				OrderID:   cached.OrderID,
 				Status:    cached.Status,
 				CreatedAt: cached.CreatedAt.Format(time.RFC3339),
+				Replayed:  true,
 			}, nil
 		}
 	}
 
+	// Refuse a callback up front rather than charge an order whose completion we couldn't report
+	if req.CallbackURL != "" && s.webhooks == nil {
+		span.SetStatus(codes.Error, ErrCallbacksDisabled.Error())
+		return nil, ErrCallbacksDisabled
+	}
+
+	// Amounts with more decimal places than allowed are rejected or adjusted, the same way the payment service would
+	req, adjustment, err := s.adjustAmount(span, req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// Currencies the settlement backend can't take are converted for opted-in merchants, otherwise rejected
+	req, substitution, err := s.resolveCurrency(span, req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
 	// Generate order ID
 	orderID := uuid.New().String()
 	span.SetAttributes(attribute.String("order.id", orderID))
 
-	// Call payment service with all reliability patterns
-	if err := s.callPaymentService(ctx, orderID, req); err != nil {
+	order, err := s.orders.Create(orderID, req)
+	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return nil, fmt.Errorf("payment failed: %w", err)
+		return nil, err
 	}
 
-	// Persist order (simulated with a span)
-	if err := s.persistOrder(ctx, orderID, req); err != nil {
+	// Large orders are held uncharged until the customer completes step-up authentication
+	stepUp := s.requiresStepUp(req)
+	span.SetAttributes(attribute.Bool("stepup.required", stepUp))
+	if stepUp {
+		span.SetAttributes(attribute.Float64("stepup.threshold", s.stepUpThreshold))
+		token, err := s.stepUps.hold(orderID, &pendingStepUp{
+			req:            req,
+			idempotencyKey: idempotencyKey,
+			fingerprint:    fingerprint,
+			ttl:            reliability.IdempotencyTTLFromContext(ctx),
+		})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to issue step-up challenge: %w", err)
+		}
+		span.AddEvent("stepup_challenge_issued")
+		span.SetStatus(codes.Ok, "order awaiting step-up")
+		return &CreateOrderResponse{
+			OrderID:        orderID,
+			Status:         StatusStepUpRequired,
+			ChallengeToken: token,
+			CreatedAt:      order.CreatedAt.Format(time.RFC3339),
+			Substitution:   substitution,
+			Adjustment:     adjustment,
+		}, nil
+	}
+
+	// Retrying the whole flow is safe: the order ID and payment key stay fixed, so the payment service dedups the charge
+	paymentKey := paymentIdempotencyKey(idempotencyKey, orderID)
+	err = reliability.RetryOperation(ctx, span, s.orderRetry, isTransientOrderError, func(ctx context.Context) error {
+		return s.chargeOrder(ctx, span, orderID, paymentKey, req)
+	})
+	if resp, ok := completedConcurrently(span, err); ok {
+		return resp, nil
+	}
+	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return nil, fmt.Errorf("failed to persist order: %w", err)
+		return nil, err
 	}
 
-	// Create response
+	// Create response; the stored entry shares the same timestamp so replays report the original creation time
+	createdAt := order.CreatedAt
 	response := &CreateOrderResponse{
-		OrderID:   orderID,
-		Status:    "completed",
-		CreatedAt: time.Now().Format(time.RFC3339),
+		OrderID:      orderID,
+		Status:       string(OrderCompleted),
+		CreatedAt:    createdAt.Format(time.RFC3339),
+		Substitution: substitution,
+		Adjustment:   adjustment,
 	}
 
 	// Store for idempotency
 	if idempotencyKey != "" {
-		s.idempotencyStore.Set(idempotencyKey, &reliability.IdempotentResponse{
-			OrderID:   orderID,
-			Status:    "completed",
-			CreatedAt: time.Now(),
-		})
+		ttl := reliability.IdempotencyTTLFromContext(ctx)
+		span.SetAttributes(attribute.Int64("idempotency.ttl_s", int64(ttl.Seconds())))
+		s.setIdempotent(ctx, idempotencyKey, &reliability.IdempotentResponse{
+			OrderID:     orderID,
+			MerchantID:  req.MerchantID,
+			Status:      string(OrderCompleted),
+			CreatedAt:   createdAt,
+			Fingerprint: fingerprint,
+		}, ttl)
 	}
 
+	s.notifyCompleted(ctx, orderID, req, time.Now())
+
 	span.SetStatus(codes.Ok, "order created successfully")
 	return response, nil
 }
 
+// chargeOrder calls the payment service and persists the order, tracking its status through charging to completed or failed
+func (s *OrderService) chargeOrder(ctx context.Context, span trace.Span, orderID, paymentKey string, req CreateOrderRequest) error {
+	if err := s.transitionOrder(span, orderID, OrderCharging); err != nil {
+		return err
+	}
+
+	// Call payment service with all reliability patterns
+	if err := s.callPaymentService(ctx, orderID, paymentKey, req); err != nil {
+		s.transitionOrder(span, orderID, OrderFailed)
+		return fmt.Errorf("payment failed: %w", err)
+	}
+
+	// Persist order (simulated with a span)
+	if err := s.persistOrder(ctx, orderID, req); err != nil {
+		// The customer has been charged, so queue the write rather than fail the order, unless the queue is full
+		if s.writeBehind != nil {
+			if err = s.queueWriteBehind(ctx, span, orderID, req, err); err == nil {
+				return nil
+			}
+		}
+		s.transitionOrder(span, orderID, OrderFailed)
+		return fmt.Errorf("failed to persist order: %w", err)
+	}
+
+	return s.transitionOrder(span, orderID, OrderCompleted)
+}
+
+// isTransientOrderError reports whether a failed order attempt may succeed if the whole flow is retried
+// Open circuits, exceeded Retry-After ceilings, panics and lifecycle conflicts won't clear within the request,
+// and a charge a concurrent request already completed needs no retry
+func isTransientOrderError(err error) bool {
+	var panicErr *reliability.PanicError
+	var completed *reliability.CompletedElsewhereError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, reliability.ErrRetryAfterExceeded):
+		return false
+	case errors.Is(err, ErrInvalidTransition), errors.As(err, &panicErr):
+		return false
+	case errors.As(err, &completed):
+		return false
+	}
+	return true
+}
+
+// transitionOrder moves the order to status `to` and records the change on the span
+func (s *OrderService) transitionOrder(span trace.Span, orderID string, to OrderStatus) error {
+	if _, err := s.orders.Transition(orderID, to); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	span.AddEvent("order_status_changed", trace.WithAttributes(attribute.String("order.status", string(to))))
+	return nil
+}
+
+// IdempotencyStats reports the idempotency store's size and estimated memory footprint
+func (s *OrderService) IdempotencyStats() reliability.IdempotencyStats {
+	return s.idempotencyStore.Stats()
+}
+
+// RetryBudgetStatus reports the shared retry budget's current level and refill rate
+func (s *OrderService) RetryBudgetStatus() reliability.RetryBudgetStatus {
+	return s.retryBudget.Status()
+}
+
+// GetOrder returns the order with the given ID, or ErrOrderNotFound
+func (s *OrderService) GetOrder(id string) (Order, error) {
+	order, ok := s.orders.Get(id)
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// CancelOrder cancels an order that hasn't been charged yet, e.g. one held for step-up authentication
+// The order stays queryable as a tombstone for CANCELLED_ORDER_RETENTION; fails with ErrOrderNotFound for an unknown
+// order and ErrInvalidTransition once charging has begun
+func (s *OrderService) CancelOrder(ctx context.Context, orderID string) (Order, error) {
+	_, span := s.tracer.Start(ctx, "cancelOrder",
+		trace.WithAttributes(attribute.String("order.id", orderID)),
+	)
+	defer span.End()
+
+	order, err := s.orders.Transition(orderID, OrderCancelled)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return Order{}, err
+	}
+	span.AddEvent("order_status_changed", trace.WithAttributes(attribute.String("order.status", string(OrderCancelled))))
+	span.SetStatus(codes.Ok, "order cancelled")
+	return order, nil
+}
+
+// ListOrders returns a page of recent orders, newest first; see OrderStore.List
+func (s *OrderService) ListOrders(limit int, cursor string) ([]Order, string, error) {
+	return s.orders.List(limit, cursor)
+}
+
+// SLOStatus returns the current error rate and burn rate across the rolling windows
+func (s *OrderService) SLOStatus() reliability.SLOStatus {
+	return s.sloTracker.Status()
+}
+
+// PaymentHealth reports whether the payment service is reachable, using a cached result within the TTL
+func (s *OrderService) PaymentHealth(ctx context.Context) reliability.HealthStatus {
+	return s.paymentHealth.Check(ctx)
+}
+
+// probePaymentHealth checks payment endpoints in order; any healthy endpoint is enough to serve traffic
+func (s *OrderService) probePaymentHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var lastErr error
+	for _, endpoint := range s.defaultRoute.endpoints {
+		if lastErr = s.probeEndpointHealth(ctx, endpoint.url); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// probeEndpointHealth calls a single payment service health endpoint, retrying under the health endpoint's policy
+func (s *OrderService) probeEndpointHealth(ctx context.Context, baseURL string) error {
+	span := trace.SpanFromContext(ctx)
+	resp, err := reliability.RetryableHTTPCall(ctx, span, s.retryPolicies.For(config.RetryEndpointHealth), reliability.RetryRequest{Method: http.MethodGet}, func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/health", nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.httpClient.Do(req)
+	})
+	if err != nil {
+		return fmt.Errorf("payment health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// paymentIdempotencyKey derives the key sent to the payment service for a logical order
+// It reuses the client's key when present so client-level retries also map to a single charge
+func paymentIdempotencyKey(clientKey, orderID string) string {
+	if clientKey != "" {
+		return "order:" + clientKey
+	}
+	return "order:" + orderID
+}
+
 // callPaymentService calls the payment service with timeout, retry, circuit breaker, and bulkhead
-func (s *OrderService) callPaymentService(ctx context.Context, orderID string, req CreateOrderRequest) error {
+// paymentKey is sent unchanged on every attempt and failover so the payment service can dedup ambiguous timeouts
+func (s *OrderService) callPaymentService(ctx context.Context, orderID, paymentKey string, req CreateOrderRequest) error {
 	ctx, span := s.tracer.Start(ctx, "callPayment")
 	defer span.End()
+	span.SetAttributes(attribute.String("payment.idempotency_key", paymentKey))
 
-	// Set payment call timeout (must complete within 500ms budget)
-	paymentCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	// Set payment call timeout (must complete within the configured budget, 500ms by default)
+	paymentCtx, cancel := context.WithTimeout(ctx, s.paymentTimeout)
 	defer cancel()
-	span.SetAttributes(attribute.Int("timeout_ms", 500))
+	span.SetAttributes(attribute.Int("timeout_ms", int(s.paymentTimeout.Milliseconds())))
+
+	// Merchants can be assigned their own policy; those that prefer fail-fast over added latency get a single attempt
+	retryConfig, policyName := s.retryPolicies.ForMerchant(config.RetryEndpointCharge, req.MerchantID)
+	span.SetAttributes(
+		attribute.String("retry.policy", policyName),
+		attribute.Int("retry.max_attempts", retryConfig.MaxAttempts),
+	)
+	if s.featureFlags.Enabled(req.MerchantID, features.DisableRetries) {
+		retryConfig.MaxAttempts = 1
+		span.SetAttributes(attribute.Bool("retry.disabled_by_flag", true))
+	}
+
+	// Route by currency, falling back to the default backend for currencies without a dedicated one
+	route, ok := s.currencyRoutes[req.Currency]
+	if !ok {
+		route = s.defaultRoute
+	}
+	span.SetAttributes(attribute.String("payment.route", route.name))
 
 	// Apply bulkhead: limit concurrent payment calls to protect resources
-	err := s.bulkhead.Execute(ctx, span, func(ctx context.Context) error {
-		// Apply circuit breaker: fail fast if payment service is down
-		return s.circuitBreaker.Execute(span, func() error {
-			// Apply retry with exponential backoff: handle transient failures
-			_, err := reliability.RetryableHTTPCall(paymentCtx, span, s.retryConfig, func(ctx context.Context) (*http.Response, error) {
-				return s.doPaymentRequest(ctx, span, orderID, req)
+	err := route.bulkhead.Execute(ctx, span, func(ctx context.Context) error {
+		var lastErr error
+		for i, endpoint := range route.endpoints {
+			if i > 0 {
+				// Primary failed or its circuit is open: fail over within the remaining budget
+				if paymentCtx.Err() != nil {
+					break
+				}
+				span.AddEvent("payment_failover", trace.WithAttributes(
+					attribute.String("payment.endpoint", endpoint.url),
+					attribute.String("error", lastErr.Error()),
+				))
+			}
+
+			// Apply circuit breaker: fail fast if this payment endpoint is down
+			reliability.DecisionSummaryFromContext(ctx).SetBreakerState(endpoint.circuitBreaker.State().String())
+			var completed *reliability.CompletedElsewhereError
+			lastErr = endpoint.circuitBreaker.Execute(span, func() error {
+				// Apply retry with exponential backoff: handle transient failures
+				// The charge is a POST, repeatable only because paymentKey dedups it downstream
+				charge := reliability.RetryRequest{Method: http.MethodPost, IdempotencyKey: paymentKey}
+				resp, err := reliability.RetryableHTTPCall(paymentCtx, span, retryConfig, charge, func(ctx context.Context) (*http.Response, error) {
+					// Optionally race a second copy of a slow attempt; safe because paymentKey dedups the charge
+					return reliability.HedgedHTTPCall(ctx, span, s.hedgingConfig, func(ctx context.Context) (*http.Response, error) {
+						return s.doPaymentRequest(ctx, span, endpoint.url, orderID, paymentKey, req)
+					})
+				})
+				if resp != nil {
+					resp.Body.Close()
+				}
+				// A concurrent request finishing the charge says nothing bad about this endpoint
+				if errors.As(err, &completed) {
+					return nil
+				}
+				return err
 			})
-			return err
-		})
+			if completed != nil {
+				return completed
+			}
+			if lastErr == nil {
+				span.SetAttributes(
+					attribute.String("payment.endpoint", endpoint.url),
+					attribute.Int("payment.endpoint_index", i),
+				)
+				return nil
+			}
+		}
+		return lastErr
 	})
 
+	var completed *reliability.CompletedElsewhereError
+	if errors.As(err, &completed) {
+		span.SetStatus(codes.Ok, "payment completed by a concurrent request")
+		return err
+	}
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -150,7 +652,7 @@ func (s *OrderService) callPaymentService(ctx context.Context, orderID string, r
 }
 
 // doPaymentRequest performs the actual HTTP call to payment service
-func (s *OrderService) doPaymentRequest(ctx context.Context, span trace.Span, orderID string, req CreateOrderRequest) (*http.Response, error) {
+func (s *OrderService) doPaymentRequest(ctx context.Context, span trace.Span, baseURL, orderID, paymentKey string, req CreateOrderRequest) (*http.Response, error) {
 	// Create payment request payload
 	paymentReq := map[string]interface{}{
 		"order_id":    orderID,
@@ -160,12 +662,19 @@ func (s *OrderService) doPaymentRequest(ctx context.Context, span trace.Span, or
 	}
 
 	body, _ := json.Marshal(paymentReq)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.paymentURL+"/charge", bytes.NewBuffer(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/charge", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Idempotency-Key", paymentKey)
+
+	// Propagate our remaining budget so the payment service can drop work we've already given up on
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set("X-Deadline-Unix-Ms", strconv.FormatInt(deadline.UnixMilli(), 10))
+		span.SetAttributes(attribute.Int64("budget.propagated_ms", time.Until(deadline).Milliseconds()))
+	}
 
 	// Propagate trace context to payment service (W3C Trace Context)
 	// This ensures the payment service's spans are linked to this trace
@@ -177,29 +686,61 @@ func (s *OrderService) doPaymentRequest(ctx context.Context, span trace.Span, or
 		span.RecordError(err)
 		return nil, fmt.Errorf("payment request failed: %w", err)
 	}
+	recordRateLimit(span, baseURL, resp)
 
 	// Check for successful response
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
+		// Bound the read so a misbehaving downstream can't exhaust memory with a huge error body,
+		// nor hold the call by stalling partway through it
+		reader := newStallReader(resp.Body, s.bodyReadTimeout)
+		body, readErr := io.ReadAll(io.LimitReader(reader, s.maxErrorBody+1))
+		reader.Close()
 		span.SetAttributes(attribute.Int("payment.status_code", resp.StatusCode))
-		return resp, fmt.Errorf("payment service returned %d: %s", resp.StatusCode, string(body))
+		if errors.Is(readErr, ErrPaymentBodyStalled) {
+			span.SetAttributes(attribute.Bool("payment.body_stalled", true))
+			span.RecordError(readErr)
+		}
+
+		// Leave what was read for the retry classifier, which may key on an error code in the body
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		detail := string(body)
+		if int64(len(body)) > s.maxErrorBody {
+			detail = string(body[:s.maxErrorBody]) + "...(truncated)"
+			span.SetAttributes(attribute.Bool("payment.error_body_truncated", true))
+		}
+		return resp, fmt.Errorf("payment service returned %d: %s", resp.StatusCode, detail)
 	}
 
+	// The success body isn't needed; leave an empty one so the response can still be read and closed
 	resp.Body.Close()
+	resp.Body = http.NoBody
 	return resp, nil
 }
 
+// errPersistenceUnavailable is the simulated failure injected by PERSIST_ERROR_PCT
+var errPersistenceUnavailable = errors.New("persistence backend unavailable")
+
 // persistOrder simulates persisting the order to a database
 func (s *OrderService) persistOrder(ctx context.Context, orderID string, req CreateOrderRequest) error {
 	_, span := s.tracer.Start(ctx, "persistOrder",
 		trace.WithAttributes(attribute.String("order.id", orderID)),
 	)
 	defer span.End()
+	if key := reliability.IdempotencyKeyFromContext(ctx); key != "" {
+		span.SetAttributes(attribute.String("idempotency.key_hash", hashIdempotencyKey(key)))
+	}
+	defer reliability.StageTimerFromContext(ctx).Time("persist")()
 
 	// Simulate database write latency
 	time.Sleep(10 * time.Millisecond)
 
+	// Simulate the database being unavailable
+	if s.persistDown() {
+		span.SetStatus(codes.Error, errPersistenceUnavailable.Error())
+		return errPersistenceUnavailable
+	}
+
 	span.SetStatus(codes.Ok, "order persisted")
 	return nil
 }
@@ -0,0 +1,739 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/features"
+	"github.com/demo/order-service/internal/reliability"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+)
+
+func TestDisableRetriesFlag(t *testing.T) {
+	tests := []struct {
+		name         string
+		merchantID   string
+		wantAttempts int32
+	}{
+		{name: "flagged merchant fails fast", merchantID: "fail_fast", wantAttempts: 1},
+		{name: "other merchants are retried", merchantID: "merchant_123", wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Retry.MaxAttempts = 3
+			cfg.FeatureFlags = map[string][]features.Flag{"fail_fast": {features.DisableRetries}}
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			req := CreateOrderRequest{MerchantID: tt.merchantID, Amount: 10, Currency: "USD"}
+			if _, err := svc.CreateOrder(context.Background(), req, ""); err == nil {
+				t.Fatal("CreateOrder() succeeded against a failing payment service")
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("payment attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPaymentFailover(t *testing.T) {
+	tests := []struct {
+		name          string
+		primary       int // Status the primary answers; 0 means it's unreachable
+		secondary     int
+		orders        int
+		wantPrimary   int32 // Calls reaching the primary across all orders
+		wantSecondary int32
+		wantErr       bool
+	}{
+		{name: "primary healthy", primary: http.StatusOK, secondary: http.StatusOK, orders: 1, wantPrimary: 1},
+		{name: "primary failing, secondary serves", primary: http.StatusServiceUnavailable, secondary: http.StatusOK,
+			orders: 1, wantPrimary: 2, wantSecondary: 1},
+		{name: "primary unreachable, secondary serves", secondary: http.StatusOK, orders: 1, wantSecondary: 1},
+		{name: "primary circuit open skips it", primary: http.StatusServiceUnavailable, secondary: http.StatusOK,
+			orders: 3, wantPrimary: 2, wantSecondary: 3},
+		{name: "both down", primary: http.StatusServiceUnavailable, secondary: http.StatusServiceUnavailable,
+			orders: 1, wantPrimary: 2, wantSecondary: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryCalls, secondaryCalls atomic.Int32
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				primaryCalls.Add(1)
+				w.WriteHeader(tt.primary)
+			}))
+			defer primary.Close()
+			if tt.primary == 0 {
+				primary.Close()
+			}
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				secondaryCalls.Add(1)
+				w.WriteHeader(tt.secondary)
+			}))
+			defer secondary.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{primary.URL, secondary.URL}
+			cfg.Retry.MaxAttempts = 2
+			cfg.CircuitBreaker.ConsecutiveFailures = 1
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			for i := 0; i < tt.orders; i++ {
+				_, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("order %d: CreateOrder() error = %v, want error %v", i, err, tt.wantErr)
+				}
+			}
+			if got := primaryCalls.Load(); got != tt.wantPrimary {
+				t.Errorf("primary calls = %d, want %d", got, tt.wantPrimary)
+			}
+			if got := secondaryCalls.Load(); got != tt.wantSecondary {
+				t.Errorf("secondary calls = %d, want %d", got, tt.wantSecondary)
+			}
+		})
+	}
+}
+
+func TestPaymentErrorBodyCapped(t *testing.T) {
+	const limit = 1024
+
+	tests := []struct {
+		name          string
+		bodySize      int
+		wantTruncated bool
+	}{
+		{name: "small body kept whole", bodySize: 100},
+		{name: "body at the cap kept whole", bodySize: limit},
+		{name: "body over the cap truncated", bodySize: limit + 1, wantTruncated: true},
+		{name: "huge body truncated without buffering it", bodySize: 64 << 20, wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := bytes.Repeat([]byte("x"), 32<<10)
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				for left := tt.bodySize; left > 0; left -= len(chunk) {
+					if _, err := w.Write(chunk[:min(left, len(chunk))]); err != nil {
+						return // The client stopped reading
+					}
+				}
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.MaxErrorBodyBytes = limit
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			resp, err := svc.doPaymentRequest(context.Background(), trace.SpanFromContext(context.Background()),
+				payment.URL, "order-1", "key-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"})
+			runtime.ReadMemStats(&after)
+			if err == nil {
+				t.Fatal("doPaymentRequest() succeeded on a 400")
+			}
+
+			truncated := strings.HasSuffix(err.Error(), "...(truncated)")
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if detail := strings.Count(err.Error(), "x"); detail != min(tt.bodySize, limit) {
+				t.Errorf("error carries %d body bytes, want %d", detail, min(tt.bodySize, limit))
+			}
+			if body, _ := io.ReadAll(resp.Body); len(body) > limit+1 {
+				t.Errorf("body left for the classifier is %d bytes, want at most %d", len(body), limit+1)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+				t.Errorf("reading the error allocated %d bytes, want it bounded well below the %d byte body", allocated, tt.bodySize)
+			}
+		})
+	}
+}
+
+func TestPaymentRetriesReuseIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		clientKey string
+		slowAsks  int32 // Leading attempts that charge but answer too late for the client
+		wantAsks  int32
+	}{
+		{name: "first attempt charged but timed out", slowAsks: 1, wantAsks: 2},
+		{name: "two ambiguous timeouts then an answer", slowAsks: 2, wantAsks: 3},
+		{name: "client key carried through", clientKey: "client-key-1", slowAsks: 2, wantAsks: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The payment side charges once per idempotency key and replays that charge to every later attempt
+			var mu sync.Mutex
+			var asks atomic.Int32
+			keys := make(map[string]string) // Idempotency key to transaction ID
+			charges := 0
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := asks.Add(1)
+				key := r.Header.Get("Idempotency-Key")
+				mu.Lock()
+				if _, charged := keys[key]; !charged {
+					charges++
+					keys[key] = fmt.Sprintf("txn-%d", charges)
+				}
+				txn := keys[key]
+				mu.Unlock()
+				if n <= tt.slowAsks {
+					time.Sleep(150 * time.Millisecond) // Charged, but the client gives up first
+				}
+				fmt.Fprintf(w, `{"transaction_id":%q,"status":"approved"}`, txn)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.ClientTimeout = 50 * time.Millisecond
+			cfg.Payment.CallTimeout = 2 * time.Second
+			cfg.Retry.MaxAttempts = 3
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, tt.clientKey)
+			if err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+			if got := asks.Load(); got != tt.wantAsks {
+				t.Errorf("payment attempts = %d, want %d", got, tt.wantAsks)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if charges != 1 || len(keys) != 1 {
+				t.Fatalf("%d charges under %d idempotency keys, want 1 charge under 1 key", charges, len(keys))
+			}
+			// Derived from the client's key when there is one, so client retries map to the same charge too
+			want := "order:" + resp.OrderID
+			if tt.clientKey != "" {
+				want = "order:" + tt.clientKey
+			}
+			if _, ok := keys[want]; !ok {
+				t.Errorf("payment keys = %v, want %q", keys, want)
+			}
+		})
+	}
+}
+
+func TestHedgedChargeChargesOnce(t *testing.T) {
+	tests := []struct {
+		name            string
+		hedging         bool
+		primaryDelay    time.Duration // How long the first request takes to answer, after charging
+		wantAsks        int32
+		wantBothReached bool
+		wantWinner      string // hedge.winner on the callPayment span; empty if no hedge was fired
+	}{
+		{name: "slow primary raced by a hedge", hedging: true, primaryDelay: 150 * time.Millisecond, wantAsks: 2, wantBothReached: true, wantWinner: "hedge"},
+		{name: "fast primary beats the hedge delay", hedging: true, wantAsks: 1},
+		{name: "hedging off", primaryDelay: 150 * time.Millisecond, wantAsks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The payment side charges once per idempotency key and replays that charge to every later request
+			var mu sync.Mutex
+			var asks atomic.Int32
+			keys := make(map[string]string) // Idempotency key to transaction ID
+			charges := 0
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := asks.Add(1)
+				key := r.Header.Get("Idempotency-Key")
+				mu.Lock()
+				if _, charged := keys[key]; !charged {
+					charges++
+					keys[key] = fmt.Sprintf("txn-%d", charges)
+				}
+				txn := keys[key]
+				mu.Unlock()
+				if n == 1 {
+					time.Sleep(tt.primaryDelay) // Charged, but still answering when the hedge fires
+				}
+				fmt.Fprintf(w, `{"transaction_id":%q,"status":"approved"}`, txn)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Payment.ClientTimeout = time.Second
+			cfg.Payment.CallTimeout = 2 * time.Second
+			cfg.Hedging = reliability.HedgingConfig{Enabled: tt.hedging, Delay: 20 * time.Millisecond}
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			if _, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, ""); err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+			if got := asks.Load(); got != tt.wantAsks {
+				t.Errorf("payment requests = %d, want %d", got, tt.wantAsks)
+			}
+			mu.Lock()
+			if charges != 1 || len(keys) != 1 {
+				t.Errorf("%d charges under %d idempotency keys, want 1 charge under 1 key", charges, len(keys))
+			}
+			mu.Unlock()
+
+			var bothReached bool
+			var winner string
+			for _, span := range recorder.Ended() {
+				if span.Name() != "callPayment" {
+					continue
+				}
+				for _, kv := range span.Attributes() {
+					switch kv.Key {
+					case "hedge.both_reached":
+						bothReached = kv.Value.AsBool()
+					case "hedge.winner":
+						winner = kv.Value.AsString()
+					}
+				}
+			}
+			if bothReached != tt.wantBothReached {
+				t.Errorf("hedge.both_reached = %v, want %v", bothReached, tt.wantBothReached)
+			}
+			if winner != tt.wantWinner {
+				t.Errorf("hedge.winner = %q, want %q", winner, tt.wantWinner)
+			}
+		})
+	}
+}
+
+func TestPaymentTransportStreamLimit(t *testing.T) {
+	const requests, serverStreams = 6, 2
+	tests := []struct {
+		name         string
+		strict       bool
+		maxConns     int
+		wantInFlight int32
+	}{
+		{name: "strict limit queues on one connection", strict: true, wantInFlight: serverStreams},
+		{name: "strict limit stays on one connection despite room for more", strict: true, maxConns: 2, wantInFlight: serverStreams},
+		{name: "lenient limit dials past it", wantInFlight: requests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var inFlight, peak int32
+			var http1 atomic.Bool
+			release := make(chan struct{})
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.ProtoMajor != 2 {
+					http1.Store(true)
+				}
+				mu.Lock()
+				inFlight++
+				peak = max(peak, inFlight)
+				mu.Unlock()
+				<-release
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}))
+			server.EnableHTTP2 = true
+			if err := http2.ConfigureServer(server.Config, &http2.Server{MaxConcurrentStreams: serverStreams}); err != nil {
+				t.Fatal(err)
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			cfg := config.Default()
+			cfg.Payment.StrictStreamLimit = tt.strict
+			cfg.Payment.MaxConnsPerHost = tt.maxConns
+			transport := paymentTransport(cfg.Payment)
+			transport.TLSClientConfig.InsecureSkipVerify = true // httptest's self-signed certificate
+			client := &http.Client{Transport: transport}
+			defer transport.CloseIdleConnections()
+
+			var wg sync.WaitGroup
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := client.Get(server.URL)
+					if err != nil {
+						t.Errorf("GET: %v", err)
+						return
+					}
+					resp.Body.Close()
+				}()
+			}
+
+			// Give every request the chance to reach the server before any is answered
+			peakNow := func() int32 {
+				mu.Lock()
+				defer mu.Unlock()
+				return peak
+			}
+			deadline := time.Now().Add(time.Second)
+			for peakNow() < tt.wantInFlight && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if http1.Load() {
+				t.Fatal("request served over HTTP/1, want HTTP/2")
+			}
+			if got := peakNow(); got != tt.wantInFlight {
+				t.Errorf("peak requests in flight = %d, want %d", got, tt.wantInFlight)
+			}
+		})
+	}
+}
+
+func TestPaymentRouteByCurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		currencies  []string // One order per entry, in turn
+		eurDown     bool     // The EUR backend answers 503, tripping its circuit breaker
+		wantDefault int32
+		wantEUR     int32
+		wantRoutes  []string // payment.route of each order
+		wantErrs    []bool
+	}{
+		{name: "currency-matched route", currencies: []string{"EUR"}, wantEUR: 1, wantRoutes: []string{"EUR"}, wantErrs: []bool{false}},
+		{name: "default for the default currency", currencies: []string{"USD"}, wantDefault: 1, wantRoutes: []string{"default"}, wantErrs: []bool{false}},
+		{name: "default for an unrouted currency", currencies: []string{"GBP"}, wantDefault: 1, wantRoutes: []string{"default"}, wantErrs: []bool{false}},
+		{name: "open EUR circuit leaves the default route alone", currencies: []string{"EUR", "EUR", "USD"}, eurDown: true,
+			wantDefault: 1, wantEUR: 1, wantRoutes: []string{"EUR", "EUR", "default"}, wantErrs: []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var defaultCalls, eurCalls atomic.Int32
+			defaultBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defaultCalls.Add(1)
+			}))
+			defer defaultBackend.Close()
+			eurBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				eurCalls.Add(1)
+				if tt.eurDown {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer eurBackend.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{defaultBackend.URL}
+			cfg.Payment.URLByCurrency = map[string]string{"EUR": eurBackend.URL}
+			cfg.Retry.MaxAttempts = 1
+			cfg.CircuitBreaker.ConsecutiveFailures = 1
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			for i, currency := range tt.currencies {
+				_, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: currency}, "")
+				if (err != nil) != tt.wantErrs[i] {
+					t.Fatalf("%s order: CreateOrder() error = %v, want error %v", currency, err, tt.wantErrs[i])
+				}
+			}
+
+			if got := defaultCalls.Load(); got != tt.wantDefault {
+				t.Errorf("default backend calls = %d, want %d", got, tt.wantDefault)
+			}
+			if got := eurCalls.Load(); got != tt.wantEUR {
+				t.Errorf("EUR backend calls = %d, want %d", got, tt.wantEUR)
+			}
+			var routes []string
+			for _, span := range recorder.Ended() {
+				for _, kv := range span.Attributes() {
+					if span.Name() == "callPayment" && kv.Key == "payment.route" {
+						routes = append(routes, kv.Value.AsString())
+					}
+				}
+			}
+			if !slices.Equal(routes, tt.wantRoutes) {
+				t.Errorf("payment.route = %v, want %v", routes, tt.wantRoutes)
+			}
+		})
+	}
+}
+
+func TestOrderRetryAfterTransientPersistFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		persistFails int // Writes that hit the simulated outage before the database recovers
+		wantErr      bool
+		wantWrites   int
+		wantStatus   OrderStatus
+	}{
+		{name: "retried then succeeds", maxAttempts: 3, persistFails: 1, wantWrites: 2, wantStatus: OrderCompleted},
+		{name: "succeeds on the last attempt", maxAttempts: 3, persistFails: 2, wantWrites: 3, wantStatus: OrderCompleted},
+		{name: "attempts run out", maxAttempts: 2, persistFails: 5, wantErr: true, wantWrites: 2, wantStatus: OrderFailed},
+		{name: "order retries disabled", maxAttempts: 1, persistFails: 1, wantErr: true, wantWrites: 1, wantStatus: OrderFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The payment service dedups on the key, as the real one does, so a repeated charge is replayed
+			var mu sync.Mutex
+			charged := make(map[string]int)
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				charged[r.Header.Get("Idempotency-Key")]++
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.OrderRetry.MaxAttempts = tt.maxAttempts
+			cfg.OrderRetry.Backoff = time.Millisecond
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			writes, fails := 0, tt.persistFails
+			svc.persistDown = func() bool {
+				writes++
+				fails--
+				return fails >= 0
+			}
+
+			resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateOrder() error = %v, want error %v", err, tt.wantErr)
+			}
+			if writes != tt.wantWrites {
+				t.Errorf("persist attempts = %d, want %d", writes, tt.wantWrites)
+			}
+			if len(charged) != 1 {
+				t.Errorf("charges used %d idempotency keys %v, want every attempt on one key", len(charged), charged)
+			}
+			if resp == nil {
+				return
+			}
+			if order, _ := svc.orders.Get(resp.OrderID); order.Status != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyPerEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoints   map[string]int // Max attempts configured per endpoint
+		wantCharges int32
+		wantHealth  int32
+	}{
+		{name: "unmapped endpoints use the default", wantCharges: 2, wantHealth: 2},
+		{name: "charge fails fast", endpoints: map[string]int{config.RetryEndpointCharge: 1}, wantCharges: 1, wantHealth: 2},
+		{name: "health retries harder", endpoints: map[string]int{config.RetryEndpointHealth: 4}, wantCharges: 2, wantHealth: 4},
+		{name: "both overridden", endpoints: map[string]int{config.RetryEndpointCharge: 3, config.RetryEndpointHealth: 1}, wantCharges: 3, wantHealth: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var charges, health atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/charge":
+					charges.Add(1)
+				case "/health":
+					health.Add(1)
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Retry.MaxAttempts = 2
+			cfg.Retry.InitialBackoff = time.Millisecond
+			cfg.Retry.MaxBackoff = time.Millisecond
+			cfg.CircuitBreaker.ConsecutiveFailures = 100
+			cfg.RetryEndpoints = make(map[string]reliability.RetryConfig)
+			for endpoint, attempts := range tt.endpoints {
+				policy := cfg.Retry
+				policy.MaxAttempts = attempts
+				cfg.RetryEndpoints[endpoint] = policy
+			}
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+			if _, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, ""); err == nil {
+				t.Error("CreateOrder() succeeded against a failing payment service")
+			}
+			if err := svc.probeEndpointHealth(context.Background(), payment.URL); err == nil {
+				t.Error("probeEndpointHealth() succeeded against a failing payment service")
+			}
+			if got := charges.Load(); got != tt.wantCharges {
+				t.Errorf("charge attempts = %d, want %d", got, tt.wantCharges)
+			}
+			if got := health.Load(); got != tt.wantHealth {
+				t.Errorf("health attempts = %d, want %d", got, tt.wantHealth)
+			}
+		})
+	}
+}
+
+func TestCreateOrderCancelledOnEntry(t *testing.T) {
+	tests := []struct {
+		name          string
+		skipCancelled bool
+		cancel        bool
+		wantSkipped   bool // Returned before calling payment, with ctx.cancelled_at_entry on the span
+	}{
+		{name: "cancelled context returns at once", skipCancelled: true, cancel: true, wantSkipped: true},
+		{name: "live context is handled", skipCancelled: true},
+		{name: "check disabled", cancel: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.SkipCancelled = tt.skipCancelled
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// Stands in for the server span the handler's middleware would have started
+			ctx, span := tracer.Start(context.Background(), "POST /orders")
+			ctx, cancel := context.WithCancel(ctx)
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			start := time.Now()
+			_, err := svc.CreateOrder(ctx, CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+			elapsed := time.Since(start)
+			span.End()
+
+			if tt.cancel != (err != nil) {
+				t.Fatalf("CreateOrder() error = %v, want failure %v", err, tt.cancel)
+			}
+			if tt.wantSkipped {
+				if err != context.Canceled {
+					t.Errorf("CreateOrder() error = %v, want context.Canceled", err)
+				}
+				if elapsed > 50*time.Millisecond {
+					t.Errorf("CreateOrder() took %v, want an immediate return", elapsed)
+				}
+			}
+			if tt.wantSkipped && calls.Load() > 0 {
+				t.Errorf("payment called %d times, want none", calls.Load())
+			}
+
+			// The server span ends last
+			var flagged bool
+			for _, kv := range recorder.Ended()[len(recorder.Ended())-1].Attributes() {
+				if kv.Key == "ctx.cancelled_at_entry" {
+					flagged = kv.Value.AsBool()
+				}
+			}
+			if flagged != tt.wantSkipped {
+				t.Errorf("ctx.cancelled_at_entry = %v, want %v", flagged, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyByMerchant(t *testing.T) {
+	// Every charge fails, so each merchant's attempts show the policy it was given
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MerchantID string `json:"merchant_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		attempts[body.MerchantID]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer payment.Close()
+
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	cfg.CircuitBreaker.ConsecutiveFailures = 100 // Keep one merchant's failures from short-circuiting the next
+	cfg.Retry.InitialBackoff = time.Millisecond
+	cfg.Retry.MaxBackoff = 2 * time.Millisecond
+	cfg.Retry.MaxAttempts = 3
+	aggressive, failFast, charge := cfg.Retry, cfg.Retry, cfg.Retry
+	aggressive.MaxAttempts = 6
+	failFast.MaxAttempts = 1
+	charge.MaxAttempts = 2
+	cfg.RetryPolicies = map[string]reliability.RetryConfig{"aggressive": aggressive, "fail_fast": failFast}
+	cfg.RetryPolicyByMerchant = map[string]string{"merchant_flaky": "aggressive", "merchant_strict": "fail_fast"}
+	svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+	recorder := tracetest.NewSpanRecorder()
+	svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	tests := []struct {
+		name         string
+		merchantID   string
+		endpoints    map[string]reliability.RetryConfig // Endpoint policies in force for this merchant's order
+		wantPolicy   string
+		wantAttempts int
+	}{
+		{name: "flaky merchant retries harder", merchantID: "merchant_flaky", wantPolicy: "aggressive", wantAttempts: 6},
+		{name: "strict merchant fails fast", merchantID: "merchant_strict", wantPolicy: "fail_fast", wantAttempts: 1},
+		{name: "unassigned merchant gets the default", merchantID: "merchant_123", wantPolicy: "default", wantAttempts: 3},
+		{name: "merchant policy beats the endpoint's", merchantID: "merchant_strict",
+			endpoints: map[string]reliability.RetryConfig{config.RetryEndpointCharge: charge}, wantPolicy: "fail_fast", wantAttempts: 1},
+		{name: "unassigned merchant gets the endpoint's", merchantID: "merchant_456",
+			endpoints: map[string]reliability.RetryConfig{config.RetryEndpointCharge: charge}, wantPolicy: "endpoint:charge", wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc.retryPolicies.Endpoints = tt.endpoints
+			mu.Lock()
+			clear(attempts)
+			mu.Unlock()
+			start := len(recorder.Ended())
+
+			req := CreateOrderRequest{MerchantID: tt.merchantID, Amount: 10, Currency: "USD"}
+			if _, err := svc.CreateOrder(context.Background(), req, ""); err == nil {
+				t.Fatal("CreateOrder() succeeded against a failing payment service")
+			}
+			mu.Lock()
+			got := attempts[tt.merchantID]
+			mu.Unlock()
+			if got != tt.wantAttempts {
+				t.Errorf("payment attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			var policy string
+			for _, span := range recorder.Ended()[start:] {
+				for _, kv := range span.Attributes() {
+					if span.Name() == "callPayment" && kv.Key == "retry.policy" {
+						policy = kv.Value.AsString()
+					}
+				}
+			}
+			if policy != tt.wantPolicy {
+				t.Errorf("retry.policy = %q, want %q", policy, tt.wantPolicy)
+			}
+		})
+	}
+}
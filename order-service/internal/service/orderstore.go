@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// orderRetention is how long orders stay queryable in the in-memory store after their last change
+// Cancelled orders are kept as tombstones for their own, configurable retention instead
+const orderRetention = 7 * 24 * time.Hour
+
+// OrderStatus is a stage in an order's lifecycle
+type OrderStatus string
+
+const (
+	OrderCreated        OrderStatus = "created"         // Accepted, not yet charged (includes orders awaiting step-up)
+	OrderCharging       OrderStatus = "charging"        // Payment call in progress
+	OrderPendingPersist OrderStatus = "pending_persist" // Charged, queued for write-behind persistence; reported as completed
+	OrderCompleted      OrderStatus = "completed"       // Charged and persisted
+	OrderFailed         OrderStatus = "failed"          // Charge or persistence failed
+	OrderCancelled      OrderStatus = "cancelled"       // Cancelled before charging
+	OrderRefunded       OrderStatus = "refunded"        // Charged, then refunded
+)
+
+// orderTransitions lists the statuses each status may move to
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderCreated:        {OrderCharging, OrderCancelled},
+	OrderCharging:       {OrderCompleted, OrderFailed, OrderPendingPersist},
+	OrderPendingPersist: {OrderCompleted, OrderFailed}, // Failed only when the write-behind queue is full
+	OrderCompleted:      {OrderRefunded},
+	OrderFailed:         {OrderCharging}, // Charged again by an order-level retry or a repeated step-up confirm
+}
+
+// CanTransition reports whether an order may move from one status to another
+func (from OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrOrderNotFound is returned when the store has no order with the given ID
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrInvalidTransition is returned when an order can't move to the requested status from its current one
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// ErrInvalidCursor is returned when a pagination cursor wasn't issued by List
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	// ErrInvalidLimit is returned when List is asked for fewer than one order
+	ErrInvalidLimit = errors.New("limit must be at least 1")
+)
+
+// Order is the stored state of one order
+type Order struct {
+	ID         string      `json:"order_id"`
+	MerchantID string      `json:"merchant_id"`
+	Amount     float64     `json:"amount"`
+	Currency   string      `json:"currency"`
+	Status     OrderStatus `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	PurgeAt    *time.Time  `json:"purge_at,omitempty"` // Set once cancelled: when the tombstone is swept
+}
+
+// OrderStore tracks each order's status and enforces valid lifecycle transitions
+// In production, use a database so order state survives restarts and spans replicas
+type OrderStore struct {
+	mu     sync.RWMutex
+	orders map[string]*Order
+
+	cancelledRetention time.Duration // How long cancelled orders are kept as tombstones for audit
+}
+
+// NewOrderStore creates an in-memory order store that keeps cancelled orders as tombstones for cancelledRetention
+func NewOrderStore(cancelledRetention time.Duration) *OrderStore {
+	store := &OrderStore{
+		orders:             make(map[string]*Order),
+		cancelledRetention: cancelledRetention,
+	}
+
+	// Start background cleanup goroutine to prevent memory leaks
+	go store.cleanup()
+
+	return store
+}
+
+// Create adds a new order in the created status
+func (s *OrderStore) Create(id string, req CreateOrderRequest) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orders[id]; exists {
+		return Order{}, fmt.Errorf("order %s already exists", id)
+	}
+	now := time.Now()
+	order := &Order{
+		ID:         id,
+		MerchantID: req.MerchantID,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		Status:     OrderCreated,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	s.orders[id] = order
+	return *order, nil
+}
+
+// Get returns a snapshot of the order
+func (s *OrderStore) Get(id string) (Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, exists := s.orders[id]
+	if !exists {
+		return Order{}, false
+	}
+	return *order, true
+}
+
+// List returns up to limit orders, newest first, starting after cursor (empty for the first page)
+// The cursor encodes the last order's creation time and ID rather than an offset, so orders created
+// between pages don't shift later pages; next is empty once there are no more orders
+// Fails with ErrInvalidLimit for a limit below 1
+func (s *OrderStore) List(limit int, cursor string) (orders []Order, next string, err error) {
+	if limit < 1 {
+		return nil, "", ErrInvalidLimit
+	}
+	var after *Order
+	if cursor != "" {
+		if after, err = decodeOrderCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	s.mu.RLock()
+	orders = make([]Order, 0, len(s.orders))
+	for _, order := range s.orders {
+		if after == nil || orderBefore(after, order) {
+			orders = append(orders, *order)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(orders, func(i, j int) bool { return orderBefore(&orders[i], &orders[j]) })
+	if len(orders) > limit {
+		orders = orders[:limit]
+		next = encodeOrderCursor(orders[limit-1])
+	}
+	return orders, next, nil
+}
+
+// orderBefore reports whether a lists before b: newer first, ties broken by ID so the order is total
+func orderBefore(a, b *Order) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// encodeOrderCursor returns an opaque cursor positioned just after order
+func encodeOrderCursor(order Order) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(order.CreatedAt.UnixNano(), 10) + ":" + order.ID))
+}
+
+// decodeOrderCursor returns the position encoded by encodeOrderCursor as a key-only order
+func decodeOrderCursor(cursor string) (*Order, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Order{ID: id, CreatedAt: time.Unix(0, n)}, nil
+}
+
+// Transition moves the order to status `to`, failing with ErrInvalidTransition if that isn't allowed from its current status
+// The check and update are atomic, so concurrent transitions (e.g. cancel racing a charge) can't both succeed
+func (s *OrderStore) Transition(id string, to OrderStatus) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, exists := s.orders[id]
+	if !exists {
+		return Order{}, ErrOrderNotFound
+	}
+	if !order.Status.CanTransition(to) {
+		return *order, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, to)
+	}
+	order.Status = to
+	order.UpdatedAt = time.Now()
+	if to == OrderCancelled {
+		purgeAt := order.UpdatedAt.Add(s.cancelledRetention)
+		order.PurgeAt = &purgeAt
+	}
+	return *order, nil
+}
+
+// cleanup periodically removes stale orders and expired tombstones
+// A short tombstone retention is swept at that interval so tombstones don't linger long past it
+func (s *OrderStore) cleanup() {
+	interval := 1 * time.Hour
+	if s.cancelledRetention > 0 && s.cancelledRetention < interval {
+		interval = s.cancelledRetention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.removeStale(time.Now())
+	}
+}
+
+// removeStale deletes tombstones past their purge time and other orders that haven't changed within orderRetention
+// Orders mid-charge are kept so the in-flight payment can still record its outcome
+func (s *OrderStore) removeStale(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now.Add(-orderRetention)
+	for id, order := range s.orders {
+		switch {
+		case order.Status == OrderCancelled:
+			if !now.Before(*order.PurgeAt) {
+				delete(s.orders, id)
+			}
+		case order.Status != OrderCharging && order.UpdatedAt.Before(cutoff):
+			delete(s.orders, id)
+		}
+	}
+}
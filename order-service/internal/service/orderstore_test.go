@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrderStoreCancelCreatesTombstone(t *testing.T) {
+	const retention = 48 * time.Hour
+
+	tests := []struct {
+		name    string
+		from    []OrderStatus // Transitions applied after creation, before cancelling
+		wantErr error
+	}{
+		{name: "created order is tombstoned"},
+		{name: "charging order can't be cancelled", from: []OrderStatus{OrderCharging}, wantErr: ErrInvalidTransition},
+		{name: "completed order can't be cancelled", from: []OrderStatus{OrderCharging, OrderCompleted}, wantErr: ErrInvalidTransition},
+		{name: "cancelled order can't be cancelled again", from: []OrderStatus{OrderCancelled}, wantErr: ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewOrderStore(retention)
+			if _, err := store.Create("order-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, status := range tt.from {
+				if _, err := store.Transition("order-1", status); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			before := time.Now()
+			order, err := store.Transition("order-1", OrderCancelled)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transition() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if order.Status != OrderCancelled || order.PurgeAt == nil {
+				t.Fatalf("order = %+v, want a cancelled tombstone with purge_at", order)
+			}
+			if order.PurgeAt.Before(before.Add(retention)) {
+				t.Errorf("purge_at = %v, want at least %v after cancelling", order.PurgeAt, retention)
+			}
+			if got, ok := store.Get("order-1"); !ok || got.Status != OrderCancelled {
+				t.Errorf("Get() = %+v, %v, want the tombstone", got, ok)
+			}
+		})
+	}
+}
+
+func TestOrderStoreRemoveStalePurgesTombstones(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		sweepIn   time.Duration // Sweep time relative to the cancellation
+		wantFound bool
+	}{
+		{name: "kept within retention", retention: time.Hour, sweepIn: 59 * time.Minute, wantFound: true},
+		{name: "purged once retention elapses", retention: time.Hour, sweepIn: time.Hour, wantFound: false},
+		{name: "kept past the live order retention", retention: 30 * 24 * time.Hour, sweepIn: 8 * 24 * time.Hour, wantFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewOrderStore(tt.retention)
+			if _, err := store.Create("order-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err != nil {
+				t.Fatal(err)
+			}
+			order, err := store.Transition("order-1", OrderCancelled)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store.removeStale(order.UpdatedAt.Add(tt.sweepIn))
+			if _, found := store.Get("order-1"); found != tt.wantFound {
+				t.Errorf("found after sweep = %v, want %v", found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestOrderStoreTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []OrderStatus // Transitions applied in turn after creation
+		wantFail int           // Index of the transition that's rejected; -1 if the whole path is valid
+	}{
+		{name: "charged and completed", path: []OrderStatus{OrderCharging, OrderCompleted}, wantFail: -1},
+		{name: "completed then refunded", path: []OrderStatus{OrderCharging, OrderCompleted, OrderRefunded}, wantFail: -1},
+		{name: "write-behind persistence", path: []OrderStatus{OrderCharging, OrderPendingPersist, OrderCompleted}, wantFail: -1},
+		{name: "failed then charged again", path: []OrderStatus{OrderCharging, OrderFailed, OrderCharging, OrderCompleted}, wantFail: -1},
+		{name: "cancelled before charging", path: []OrderStatus{OrderCancelled}, wantFail: -1},
+		{name: "refund of an uncharged order", path: []OrderStatus{OrderRefunded}, wantFail: 0},
+		{name: "refund of a failed order", path: []OrderStatus{OrderCharging, OrderFailed, OrderRefunded}, wantFail: 2},
+		{name: "refund twice", path: []OrderStatus{OrderCharging, OrderCompleted, OrderRefunded, OrderRefunded}, wantFail: 3},
+		{name: "completed without charging", path: []OrderStatus{OrderCompleted}, wantFail: 0},
+		{name: "charge a cancelled order", path: []OrderStatus{OrderCancelled, OrderCharging}, wantFail: 1},
+		{name: "charge a completed order again", path: []OrderStatus{OrderCharging, OrderCompleted, OrderCharging}, wantFail: 2},
+		{name: "back to created", path: []OrderStatus{OrderCharging, OrderCreated}, wantFail: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewOrderStore(time.Hour)
+			if _, err := store.Create("order-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := OrderCreated
+			for i, to := range tt.path {
+				order, err := store.Transition("order-1", to)
+				if i == tt.wantFail {
+					if !errors.Is(err, ErrInvalidTransition) {
+						t.Fatalf("transition %d (%s -> %s): err = %v, want %v", i, want, to, err, ErrInvalidTransition)
+					}
+					// A rejected transition leaves the order as it was
+					if order.Status != want {
+						t.Errorf("after rejected transition status = %s, want %s", order.Status, want)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("transition %d (%s -> %s): %v", i, want, to, err)
+				}
+				want = to
+			}
+			if got, _ := store.Get("order-1"); got.Status != want {
+				t.Errorf("stored status = %s, want %s", got.Status, want)
+			}
+		})
+	}
+}
+
+func TestOrderStoreTransitionUnknownOrder(t *testing.T) {
+	store := NewOrderStore(time.Hour)
+	if _, err := store.Transition("missing", OrderCharging); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Transition() error = %v, want %v", err, ErrOrderNotFound)
+	}
+	if _, err := store.Create("order-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("order-1", CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err == nil {
+		t.Error("Create() accepted a duplicate order ID")
+	}
+}
+
+func TestOrderStoreListLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		wantErr  error
+		wantLen  int
+		wantNext bool
+	}{
+		{name: "zero is rejected", limit: 0, wantErr: ErrInvalidLimit},
+		{name: "negative is rejected", limit: -1, wantErr: ErrInvalidLimit},
+		{name: "one returns a page and a cursor", limit: 1, wantLen: 1, wantNext: true},
+		{name: "above the count returns everything", limit: 5, wantLen: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewOrderStore(time.Hour)
+			for _, id := range []string{"order-1", "order-2"} {
+				if _, err := store.Create(id, CreateOrderRequest{MerchantID: "m", Amount: 10, Currency: "USD"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			orders, next, err := store.List(tt.limit, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("List(%d) error = %v, want %v", tt.limit, err, tt.wantErr)
+			}
+			if len(orders) != tt.wantLen || (next != "") != tt.wantNext {
+				t.Errorf("List(%d) = %d orders, next %q, want %d orders, next set %v", tt.limit, len(orders), next, tt.wantLen, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// rateLimitHeaders are the payment service's advertised throttling budget, in the order recorded
+var rateLimitHeaders = []struct {
+	header    string
+	attribute string
+}{
+	{"X-RateLimit-Limit", "payment.ratelimit.limit"},
+	{"X-RateLimit-Remaining", "payment.ratelimit.remaining"},
+	{"X-RateLimit-Reset", "payment.ratelimit.reset_s"},
+}
+
+// recordRateLimit surfaces the payment service's X-RateLimit-* headers on the span
+// A throttled response is also logged, since it means the order service is sending faster than the payment service admits
+func recordRateLimit(span trace.Span, baseURL string, resp *http.Response) {
+	seen := false
+	for _, h := range rateLimitHeaders {
+		value, err := strconv.ParseInt(resp.Header.Get(h.header), 10, 64)
+		if err != nil {
+			continue // Absent when the payment service has no limiter configured
+		}
+		span.SetAttributes(attribute.Int64(h.attribute, value))
+		seen = true
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		span.AddEvent("payment_rate_limited")
+		if seen {
+			log.Printf("payment service %s throttled a charge: limit %s per window, resets in %ss",
+				baseURL, resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Reset"))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecordRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		headers     map[string]string
+		wantAttrs   map[string]int64
+		wantLimited bool
+	}{
+		{name: "budget surfaced on the span", status: http.StatusOK,
+			headers:   map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "42", "X-RateLimit-Reset": "7"},
+			wantAttrs: map[string]int64{"payment.ratelimit.limit": 100, "payment.ratelimit.remaining": 42, "payment.ratelimit.reset_s": 7}},
+		{name: "throttled charge", status: http.StatusTooManyRequests,
+			headers:     map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "3"},
+			wantAttrs:   map[string]int64{"payment.ratelimit.limit": 100, "payment.ratelimit.remaining": 0, "payment.ratelimit.reset_s": 3},
+			wantLimited: true},
+		{name: "no limiter configured", status: http.StatusOK, wantAttrs: map[string]int64{}},
+		{name: "malformed header skipped", status: http.StatusOK,
+			headers:   map[string]string{"X-RateLimit-Limit": "lots", "X-RateLimit-Remaining": "5"},
+			wantAttrs: map[string]int64{"payment.ratelimit.remaining": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, value := range tt.headers {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer payment.Close()
+			resp, err := http.Get(payment.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "charge")
+			recordRateLimit(span, payment.URL, resp)
+			span.End()
+
+			ended := recorder.Ended()[0]
+			got := make(map[string]int64)
+			for _, kv := range ended.Attributes() {
+				got[string(kv.Key)] = kv.Value.AsInt64()
+			}
+			if len(got) != len(tt.wantAttrs) {
+				t.Errorf("attributes = %v, want %v", got, tt.wantAttrs)
+			}
+			for key, want := range tt.wantAttrs {
+				if value, ok := got[key]; !ok || value != want {
+					t.Errorf("%s = %d (set %v), want %d", key, value, ok, want)
+				}
+			}
+			limited := false
+			for _, event := range ended.Events() {
+				limited = limited || event.Name == "payment_rate_limited"
+			}
+			if limited != tt.wantLimited {
+				t.Errorf("payment_rate_limited event = %v, want %v", limited, tt.wantLimited)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// seedStatuses are the statuses a seeded order may have; mid-charge ones are left out since no payment call would
+// ever settle them
+var seedStatuses = []OrderStatus{OrderCreated, OrderCompleted, OrderFailed, OrderCancelled, OrderRefunded}
+
+// seedOrder is one record of an ORDER_SEED_FILE; status defaults to created and created_at to the load time
+type seedOrder struct {
+	ID         string      `json:"order_id"`
+	MerchantID string      `json:"merchant_id"`
+	Amount     float64     `json:"amount"`
+	Currency   string      `json:"currency"`
+	Status     OrderStatus `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// SeedOrders loads the orders in the JSON array at path into the order store, so demos have data to query at once
+// Records that are malformed, invalid or reuse an ID are skipped with a warning; only an unreadable file or one that
+// isn't a JSON array is an error. Returns how many orders were seeded
+func (s *OrderService) SeedOrders(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("reading order seed file: %w", err)
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return 0, fmt.Errorf("order seed file %s: expected a JSON array of orders: %w", path, err)
+	}
+
+	seeded := 0
+	now := time.Now()
+	for i, raw := range records {
+		var record seedOrder
+		if err := json.Unmarshal(raw, &record); err != nil {
+			log.Printf("WARNING: skipping order seed record %d: %v", i, err)
+			continue
+		}
+		if err := s.orders.seed(record, now); err != nil {
+			log.Printf("WARNING: skipping order seed record %d (%q): %v", i, record.ID, err)
+			continue
+		}
+		seeded++
+	}
+	return seeded, nil
+}
+
+// seed adds an order as it stood at the time of seeding, rather than as newly created
+func (s *OrderStore) seed(record seedOrder, now time.Time) error {
+	if record.Status == "" {
+		record.Status = OrderCreated
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	switch {
+	case record.ID == "":
+		return errors.New("order_id is required")
+	case record.MerchantID == "":
+		return errors.New("merchant_id is required")
+	case record.Currency == "":
+		return errors.New("currency is required")
+	case ValidateAmount(record.Amount) != nil || record.Amount <= 0:
+		return ErrInvalidAmount
+	case !slices.Contains(seedStatuses, record.Status):
+		return fmt.Errorf("status %q can't be seeded, expected one of %v", record.Status, seedStatuses)
+	}
+
+	order := &Order{
+		ID:         record.ID,
+		MerchantID: record.MerchantID,
+		Amount:     record.Amount,
+		Currency:   record.Currency,
+		Status:     record.Status,
+		CreatedAt:  record.CreatedAt,
+		UpdatedAt:  now,
+	}
+	if order.Status == OrderCancelled {
+		purgeAt := now.Add(s.cancelledRetention)
+		order.PurgeAt = &purgeAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.orders[order.ID]; exists {
+		return fmt.Errorf("order %s already exists", order.ID)
+	}
+	s.orders[order.ID] = order
+	return nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/demo/order-service/internal/reliability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StatusStepUpRequired is returned for orders held until the customer completes step-up authentication
+const StatusStepUpRequired = "stepup_required"
+
+var (
+	// ErrStepUpNotFound is returned when no pending step-up exists for the order, or it has expired
+	ErrStepUpNotFound = errors.New("no pending step-up for this order")
+	// ErrStepUpInvalidToken is returned when the challenge token doesn't match the pending step-up
+	ErrStepUpInvalidToken = errors.New("invalid step-up challenge token")
+)
+
+// pendingStepUp is an order held before charging until its challenge token is presented
+type pendingStepUp struct {
+	req            CreateOrderRequest
+	token          string
+	idempotencyKey string
+	fingerprint    string        // Of the original request, before any currency conversion
+	ttl            time.Duration // Idempotency retention requested with the original order
+	expiresAt      time.Time
+}
+
+// stepUpStore holds orders awaiting step-up confirmation
+// In production, use Redis or a database so challenges survive restarts and span replicas
+type stepUpStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingStepUp
+	ttl     time.Duration
+}
+
+// newStepUpStore creates an in-memory store whose challenges expire after ttl
+func newStepUpStore(ttl time.Duration) *stepUpStore {
+	s := &stepUpStore{
+		pending: make(map[string]*pendingStepUp),
+		ttl:     ttl,
+	}
+
+	// Start background cleanup goroutine to prevent memory leaks
+	go s.cleanup()
+
+	return s
+}
+
+// hold stores the order and returns the challenge token the customer must present to confirm it
+func (s *stepUpStore) hold(orderID string, p *pendingStepUp) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	p.token = hex.EncodeToString(buf)
+	p.expiresAt = time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[orderID] = p
+	return p.token, nil
+}
+
+// claim removes and returns the pending order if token matches, so concurrent confirms charge once
+func (s *stepUpStore) claim(orderID, token string) (*pendingStepUp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, exists := s.pending[orderID]
+	if !exists || time.Now().After(p.expiresAt) {
+		return nil, ErrStepUpNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(p.token), []byte(token)) != 1 {
+		return nil, ErrStepUpInvalidToken
+	}
+	delete(s.pending, orderID)
+	return p, nil
+}
+
+// release puts a claimed order back so the customer can retry after a failed charge
+func (s *stepUpStore) release(orderID string, p *pendingStepUp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[orderID] = p
+}
+
+// cleanup removes expired challenges to prevent unbounded growth
+func (s *stepUpStore) cleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for orderID, p := range s.pending {
+			if now.After(p.expiresAt) {
+				delete(s.pending, orderID)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// requiresStepUp reports whether the order amount exceeds the configured step-up threshold
+func (s *OrderService) requiresStepUp(req CreateOrderRequest) bool {
+	return s.stepUpThreshold > 0 && req.Amount > s.stepUpThreshold
+}
+
+// ConfirmOrder completes an order held for step-up authentication once the challenge token is presented
+// A failed charge leaves the challenge pending so the customer can confirm again
+func (s *OrderService) ConfirmOrder(ctx context.Context, orderID, token string) (_ *CreateOrderResponse, err error) {
+	// A rejected token is the customer's mistake, not ours, so only charge failures burn the error budget
+	defer func() {
+		s.sloTracker.Record(err == nil || errors.Is(err, ErrStepUpNotFound) || errors.Is(err, ErrStepUpInvalidToken))
+	}()
+
+	ctx, span := s.tracer.Start(ctx, "confirmOrder",
+		trace.WithAttributes(attribute.String("order.id", orderID)),
+	)
+	defer span.End()
+
+	p, err := s.stepUps.claim(orderID, token)
+	if err != nil {
+		span.SetAttributes(attribute.String("stepup.result", "rejected"))
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.String("stepup.result", "verified"),
+		attribute.String("merchant.id", p.req.MerchantID),
+		attribute.Float64("order.amount", p.req.Amount),
+	)
+
+	if p.idempotencyKey != "" {
+		ctx = reliability.WithIdempotencyKey(ctx, p.idempotencyKey)
+	}
+	if err := s.chargeOrder(ctx, span, orderID, paymentIdempotencyKey(p.idempotencyKey, orderID), p.req); err != nil {
+		if resp, ok := completedConcurrently(span, err); ok {
+			return resp, nil
+		}
+		// Confirming again is safe since the payment key is stable; an order no longer chargeable (e.g. cancelled) is dropped
+		if !errors.Is(err, ErrInvalidTransition) {
+			s.stepUps.release(orderID, p)
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	order, _ := s.orders.Get(orderID)
+	if p.idempotencyKey != "" {
+		// Retries of the original POST /orders now replay the completed order
+		s.setIdempotent(ctx, p.idempotencyKey, &reliability.IdempotentResponse{
+			OrderID:     orderID,
+			MerchantID:  p.req.MerchantID,
+			Status:      string(OrderCompleted),
+			CreatedAt:   order.CreatedAt,
+			Fingerprint: p.fingerprint,
+		}, p.ttl)
+	}
+
+	s.notifyCompleted(ctx, orderID, p.req, time.Now())
+
+	span.SetStatus(codes.Ok, "order confirmed")
+	return &CreateOrderResponse{
+		OrderID:   orderID,
+		Status:    string(OrderCompleted),
+		CreatedAt: order.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/demo/order-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStepUpThreshold(t *testing.T) {
+	tests := []struct {
+		name         string
+		amount       float64
+		failCharges  int32 // Payment answers the first this many charges with a 400
+		wantStepUp   bool
+		wantConfirms []string // Outcome of each confirm with the issued token, in turn: ok, failed or not_found
+		wantCharges  int32
+	}{
+		{name: "below threshold charges directly", amount: 50, wantCharges: 1},
+		{name: "at threshold charges directly", amount: 100, wantCharges: 1},
+		{name: "above threshold steps up then confirms", amount: 150, wantStepUp: true,
+			wantConfirms: []string{"ok", "not_found"}, wantCharges: 1},
+		{name: "failed confirm can be retried", amount: 150, failCharges: 1, wantStepUp: true,
+			wantConfirms: []string{"failed", "ok"}, wantCharges: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var charges atomic.Int32
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if charges.Add(1) <= tt.failCharges {
+					w.WriteHeader(http.StatusBadRequest) // Not retried, so one confirm is one charge
+				}
+			}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.StepUpThreshold = 100
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: tt.amount, Currency: "USD"}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantStatus := string(OrderCompleted)
+			if tt.wantStepUp {
+				wantStatus = StatusStepUpRequired
+			}
+			if resp.Status != wantStatus || (resp.ChallengeToken != "") != tt.wantStepUp {
+				t.Fatalf("CreateOrder() = %+v, want status %s with a challenge token %v", resp, wantStatus, tt.wantStepUp)
+			}
+			if tt.wantStepUp && charges.Load() != 0 {
+				t.Fatal("order held for step-up was charged before confirmation")
+			}
+			for _, span := range recorder.Ended() {
+				for _, kv := range span.Attributes() {
+					if span.Name() == "createOrder" && kv.Key == "stepup.required" && kv.Value.AsBool() != tt.wantStepUp {
+						t.Errorf("stepup.required = %v, want %v", kv.Value.AsBool(), tt.wantStepUp)
+					}
+				}
+			}
+
+			if tt.wantStepUp {
+				if _, err := svc.ConfirmOrder(context.Background(), resp.OrderID, "wrong-token"); !errors.Is(err, ErrStepUpInvalidToken) {
+					t.Errorf("confirm with a wrong token: err = %v, want %v", err, ErrStepUpInvalidToken)
+				}
+			}
+			for i, want := range tt.wantConfirms {
+				confirmed, err := svc.ConfirmOrder(context.Background(), resp.OrderID, resp.ChallengeToken)
+				switch want {
+				case "ok":
+					if err != nil || confirmed.Status != string(OrderCompleted) {
+						t.Fatalf("confirm %d = %+v, %v; want completed", i, confirmed, err)
+					}
+				case "failed":
+					if err == nil || errors.Is(err, ErrStepUpNotFound) {
+						t.Errorf("confirm %d: err = %v, want the charge failure", i, err)
+					}
+				case "not_found":
+					if !errors.Is(err, ErrStepUpNotFound) {
+						t.Errorf("confirm %d: err = %v, want %v", i, err, ErrStepUpNotFound)
+					}
+				}
+			}
+			if got := charges.Load(); got != tt.wantCharges {
+				t.Errorf("charges = %d, want %d", got, tt.wantCharges)
+			}
+		})
+	}
+}
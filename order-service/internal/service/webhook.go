@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/reliability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrInvalidCallbackURL is returned for a callback_url that isn't an absolute https URL
+	ErrInvalidCallbackURL = errors.New("callback_url must be an absolute https URL")
+	// ErrCallbacksDisabled is returned for orders with a callback_url when no WEBHOOK_SECRET is configured to sign them
+	ErrCallbacksDisabled = errors.New("order callbacks are not enabled")
+)
+
+// webhookDeliveries counts completion webhooks by outcome: delivered or failed
+var webhookDeliveries, _ = otel.Meter("order-service").Int64Counter("order.webhook_deliveries",
+	metric.WithDescription("Order completion webhooks by delivery outcome"))
+
+// ValidateCallbackURL rejects callback URLs that aren't absolute https URLs
+// Webhooks carry order details, so they are never sent in the clear
+func ValidateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ErrInvalidCallbackURL
+	}
+	return nil
+}
+
+// WebhookEvent is the body POSTed to an order's callback_url once it completes
+type WebhookEvent struct {
+	Event       string  `json:"event"` // Always "order.completed"
+	OrderID     string  `json:"order_id"`
+	MerchantID  string  `json:"merchant_id"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Status      string  `json:"status"`
+	CompletedAt string  `json:"completed_at"`
+}
+
+// webhookNotifier delivers signed completion webhooks in the background, retrying failed deliveries
+// Deliveries in progress are lost if the process exits; in production, enqueue them on a durable queue
+type webhookNotifier struct {
+	client *http.Client
+	secret []byte
+	retry  reliability.RetryConfig
+	tracer trace.Tracer
+}
+
+// newWebhookNotifier returns a notifier signing with cfg.Secret, or nil when no secret is configured
+func newWebhookNotifier(cfg config.WebhookConfig, tracer trace.Tracer) *webhookNotifier {
+	if cfg.Secret == "" {
+		return nil
+	}
+	retry := reliability.DefaultRetryConfig()
+	retry.MaxAttempts = cfg.MaxAttempts
+	retry.InitialBackoff = cfg.Backoff
+	retry.MaxBackoff = max(cfg.Backoff, 30*time.Second)
+	retry.MaxRetryAfter = max(retry.MaxBackoff, retry.MaxRetryAfter)
+
+	return &webhookNotifier{
+		client: &http.Client{
+			Timeout: cfg.Timeout, // Per attempt
+			// A redirect could send the signed payload somewhere else, possibly over plain http
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		secret: []byte(cfg.Secret),
+		retry:  retry,
+		tracer: tracer,
+	}
+}
+
+// notify delivers event to callbackURL without blocking the caller
+// The delivery span is a new trace linked to the order's, since it outlives the request
+func (n *webhookNotifier) notify(ctx context.Context, callbackURL string, event WebhookEvent) {
+	origin := trace.SpanContextFromContext(ctx)
+	go func() {
+		ctx, span := n.tracer.Start(context.Background(), "deliverWebhook",
+			trace.WithLinks(trace.Link{SpanContext: origin}),
+			trace.WithAttributes(attribute.String("order.id", event.OrderID)),
+		)
+		defer span.End()
+
+		outcome := "delivered"
+		if err := n.deliver(ctx, span, callbackURL, event); err != nil {
+			outcome = "failed"
+			span.SetStatus(codes.Error, err.Error())
+			log.Printf("Webhook delivery for order %s failed: %v", event.OrderID, err)
+		} else {
+			span.SetStatus(codes.Ok, "webhook delivered")
+		}
+		span.SetAttributes(attribute.String("webhook.outcome", outcome))
+		webhookDeliveries.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+	}()
+}
+
+// deliver POSTs the signed event, retrying transient failures under the notifier's retry policy
+// Every attempt carries the same X-Webhook-Id so receivers can drop duplicates
+func (n *webhookNotifier) deliver(ctx context.Context, span trace.Span, callbackURL string, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	webhookID := event.OrderID + ":" + event.Event
+
+	req := reliability.RetryRequest{Method: http.MethodPost, IdempotencyKey: webhookID}
+	resp, err := reliability.RetryableHTTPCall(ctx, span, n.retry, req, func(ctx context.Context) (*http.Response, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		// Sign each attempt afresh so receivers can reject stale replays by timestamp
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("X-Webhook-Id", webhookID)
+		httpReq.Header.Set("X-Webhook-Timestamp", timestamp)
+		httpReq.Header.Set("X-Webhook-Signature", "sha256="+n.sign(timestamp, body))
+		return n.client.Do(httpReq)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("webhook.status_code", resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" under the webhook secret
+func (n *webhookNotifier) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyCompleted sends the order's completion webhook if it asked for one
+func (s *OrderService) notifyCompleted(ctx context.Context, orderID string, req CreateOrderRequest, completedAt time.Time) {
+	if req.CallbackURL == "" || s.webhooks == nil {
+		return
+	}
+	s.webhooks.notify(ctx, req.CallbackURL, WebhookEvent{
+		Event:       "order.completed",
+		OrderID:     orderID,
+		MerchantID:  req.MerchantID,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Status:      string(OrderCompleted),
+		CompletedAt: completedAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCompletionWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int // Attempts answered with 503 before the receiver accepts
+		maxAttempts  int
+		wantAttempts int
+		wantOutcome  string
+	}{
+		{name: "delivered first time", maxAttempts: 3, wantAttempts: 1, wantOutcome: "delivered"},
+		{name: "retried until accepted", failures: 2, maxAttempts: 3, wantAttempts: 3, wantOutcome: "delivered"},
+		{name: "gives up after max attempts", failures: 5, maxAttempts: 2, wantAttempts: 2, wantOutcome: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type delivery struct {
+				header http.Header
+				body   []byte
+			}
+			var mu sync.Mutex
+			var deliveries []delivery
+			receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				deliveries = append(deliveries, delivery{header: r.Header.Clone(), body: body})
+				n := len(deliveries)
+				mu.Unlock()
+				if n <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer receiver.Close()
+			payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payment.Close()
+
+			cfg := config.Default()
+			cfg.Payment.URLs = []string{payment.URL}
+			cfg.Webhook.Secret = "whsec_test"
+			cfg.Webhook.MaxAttempts = tt.maxAttempts
+			cfg.Webhook.Backoff = time.Millisecond
+			cfg.Webhook.Timeout = time.Second
+			svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+			recorder := tracetest.NewSpanRecorder()
+			svc.webhooks.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			svc.webhooks.client.Transport = receiver.Client().Transport // Trusts the test certificate
+
+			req := CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD", CallbackURL: receiver.URL + "/hooks"}
+			resp, err := svc.CreateOrder(context.Background(), req, "")
+			if err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+
+			// Delivery runs in the background; its span ends once it's done
+			var outcome string
+			for deadline := time.Now().Add(5 * time.Second); outcome == "" && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				for _, span := range recorder.Ended() {
+					for _, kv := range span.Attributes() {
+						if span.Name() == "deliverWebhook" && kv.Key == "webhook.outcome" {
+							outcome = kv.Value.AsString()
+						}
+					}
+				}
+			}
+			if outcome != tt.wantOutcome {
+				t.Errorf("webhook.outcome = %q, want %q", outcome, tt.wantOutcome)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(deliveries) != tt.wantAttempts {
+				t.Fatalf("receiver got %d attempts, want %d", len(deliveries), tt.wantAttempts)
+			}
+			for i, d := range deliveries {
+				if id := d.header.Get("X-Webhook-Id"); id != resp.OrderID+":order.completed" {
+					t.Errorf("attempt %d X-Webhook-Id = %q, want the same ID on every attempt", i+1, id)
+				}
+				mac := hmac.New(sha256.New, []byte(cfg.Webhook.Secret))
+				mac.Write([]byte(d.header.Get("X-Webhook-Timestamp") + "."))
+				mac.Write(d.body)
+				if sig := d.header.Get("X-Webhook-Signature"); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+					t.Errorf("attempt %d X-Webhook-Signature = %q doesn't verify", i+1, sig)
+				}
+				var event WebhookEvent
+				if err := json.Unmarshal(d.body, &event); err != nil {
+					t.Fatalf("decoding attempt %d: %v", i+1, err)
+				}
+				if event.Event != "order.completed" || event.OrderID != resp.OrderID || event.Amount != req.Amount {
+					t.Errorf("attempt %d event = %+v, want order.completed for %s", i+1, event, resp.OrderID)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "https://merchant.example/hooks"},
+		{url: "http://merchant.example/hooks", wantErr: ErrInvalidCallbackURL},
+		{url: "/hooks", wantErr: ErrInvalidCallbackURL},
+		{url: "https:///hooks", wantErr: ErrInvalidCallbackURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := ValidateCallbackURL(tt.url); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateCallbackURL(%q) = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallbackRefusedWithoutSecret(t *testing.T) {
+	var charges atomic.Int32
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { charges.Add(1) }))
+	defer payment.Close()
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+
+	req := CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD", CallbackURL: "https://merchant.example/hooks"}
+	if _, err := svc.CreateOrder(context.Background(), req, ""); !errors.Is(err, ErrCallbacksDisabled) {
+		t.Errorf("CreateOrder() error = %v, want %v", err, ErrCallbacksDisabled)
+	}
+	if n := charges.Load(); n != 0 {
+		t.Errorf("payment charged %d times, want none for a refused callback", n)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/demo/order-service/internal/reliability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrWriteBehindFull is returned when persistence failed and the write-behind queue has no room for the order
+var ErrWriteBehindFull = errors.New("write-behind queue full")
+
+// pendingPersist is a charged order waiting for persistence
+type pendingPersist struct {
+	orderID        string
+	req            CreateOrderRequest
+	idempotencyKey string            // Client's key, restored on the flush context
+	origin         trace.SpanContext // Request that charged the order, linked from the flush span
+}
+
+// writeBehindQueue holds charged orders whose persistence failed and retries them in the background
+// Queued orders are lost if the process exits; in production, back the queue with a durable log
+type writeBehindQueue struct {
+	queue   chan pendingPersist
+	backoff time.Duration
+	flush   func(pendingPersist) error
+}
+
+// newWriteBehindQueue creates a queue of at most size orders, retrying flush every backoff until it succeeds
+func newWriteBehindQueue(size int, backoff time.Duration, flush func(pendingPersist) error) *writeBehindQueue {
+	q := &writeBehindQueue{
+		queue:   make(chan pendingPersist, size),
+		backoff: backoff,
+		flush:   flush,
+	}
+
+	// Start background flusher goroutine to drain queued orders once persistence recovers
+	go q.run()
+
+	return q
+}
+
+// enqueue adds the order without blocking, failing with ErrWriteBehindFull when the queue is at capacity
+func (q *writeBehindQueue) enqueue(p pendingPersist) error {
+	select {
+	case q.queue <- p:
+		return nil
+	default:
+		return ErrWriteBehindFull
+	}
+}
+
+// depth returns the number of orders waiting to be persisted
+func (q *writeBehindQueue) depth() int {
+	return len(q.queue)
+}
+
+// run persists queued orders in arrival order
+// A failing order blocks those behind it, which is fine since they share the unavailable backend
+func (q *writeBehindQueue) run() {
+	for p := range q.queue {
+		for q.flush(p) != nil {
+			time.Sleep(q.backoff)
+		}
+	}
+}
+
+// queueWriteBehind accepts a charged order whose persistence failed, marking it pending_persist
+// The order is marked before it's queued so the flusher can't complete it first; if the queue is full it's left for the caller to fail
+func (s *OrderService) queueWriteBehind(ctx context.Context, span trace.Span, orderID string, req CreateOrderRequest, persistErr error) error {
+	if err := s.transitionOrder(span, orderID, OrderPendingPersist); err != nil {
+		return err
+	}
+	p := pendingPersist{
+		orderID:        orderID,
+		req:            req,
+		idempotencyKey: reliability.IdempotencyKeyFromContext(ctx),
+		origin:         span.SpanContext(),
+	}
+	if err := s.writeBehind.enqueue(p); err != nil {
+		span.SetAttributes(attribute.Bool("write_behind.shed", true))
+		return errors.Join(persistErr, err)
+	}
+	span.RecordError(persistErr)
+	span.SetAttributes(
+		attribute.Bool("write_behind.queued", true),
+		attribute.Int("write_behind.depth", s.writeBehind.depth()),
+	)
+	return nil
+}
+
+// flushWriteBehind makes one attempt to persist a queued order, completing it on success
+func (s *OrderService) flushWriteBehind(p pendingPersist) error {
+	ctx, span := s.tracer.Start(context.Background(), "flushWriteBehind",
+		trace.WithLinks(trace.Link{SpanContext: p.origin}),
+		trace.WithAttributes(attribute.String("order.id", p.orderID)),
+	)
+	defer span.End()
+	if p.idempotencyKey != "" {
+		ctx = reliability.WithIdempotencyKey(ctx, p.idempotencyKey)
+	}
+
+	if err := s.persistOrder(ctx, p.orderID, p.req); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if err := s.transitionOrder(span, p.orderID, OrderCompleted); err != nil {
+		// Already moved on (e.g. evicted from the store); it's persisted either way, so stop retrying
+		span.SetStatus(codes.Error, err.Error())
+		return nil
+	}
+	span.SetStatus(codes.Ok, "order persisted")
+	return nil
+}
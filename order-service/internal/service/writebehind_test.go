@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/order-service/internal/config"
+	"github.com/demo/order-service/internal/reliability"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newWriteBehindService creates a service queueing up to queueSize orders while down reports the database unavailable
+func newWriteBehindService(t *testing.T, queueSize int, down *atomic.Bool) *OrderService {
+	t.Helper()
+	payment := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(payment.Close)
+
+	cfg := config.Default()
+	cfg.Payment.URLs = []string{payment.URL}
+	cfg.Persistence.WriteBehind = true
+	cfg.Persistence.WriteBehindQueue = queueSize
+	cfg.Persistence.WriteBehindBackoff = 5 * time.Millisecond
+	svc := NewOrderService(cfg, NewJSONAuditLogger(io.Discard))
+	svc.persistDown = down.Load
+	return svc
+}
+
+// waitForStatus polls until the order reaches want, failing the test after a second
+func waitForStatus(t *testing.T, svc *OrderService, orderID string, want OrderStatus) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		order, _ := svc.orders.Get(orderID)
+		if order.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("order %s status = %s, want %s", orderID, order.Status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWriteBehindQueuedThenFlushed(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	svc := newWriteBehindService(t, 10, &down)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		resp, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+		if err != nil {
+			t.Fatalf("order %d: CreateOrder() = %v, want success while persistence is down", i, err)
+		}
+		ids = append(ids, resp.OrderID)
+	}
+	for _, id := range ids {
+		if order, _ := svc.orders.Get(id); order.Status != OrderPendingPersist {
+			t.Errorf("order %s status = %s before recovery, want %s", id, order.Status, OrderPendingPersist)
+		}
+	}
+
+	down.Store(false)
+	for _, id := range ids {
+		waitForStatus(t, svc, id, OrderCompleted)
+	}
+	if depth := svc.writeBehind.depth(); depth != 0 {
+		t.Errorf("queue depth = %d after flushing, want 0", depth)
+	}
+}
+
+func TestWriteBehindQueueFull(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueSize int
+		orders    int
+		wantShed  int
+	}{
+		{name: "room for every order", queueSize: 3, orders: 3},
+		// The flusher holds one order while retrying it, and the queue holds the rest
+		{name: "overflow is shed", queueSize: 1, orders: 4, wantShed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var down atomic.Bool
+			down.Store(true)
+			svc := newWriteBehindService(t, tt.queueSize, &down)
+			defer down.Store(false) // Lets the flusher drain once the test is done
+
+			shed := 0
+			for i := 0; i < tt.orders; i++ {
+				_, err := svc.CreateOrder(context.Background(), CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "")
+				if i == 0 {
+					// Wait for the flusher to take the first order, so the queue's capacity is all that's left
+					for svc.writeBehind.depth() > 0 {
+						time.Sleep(time.Millisecond)
+					}
+				}
+				if err == nil {
+					continue
+				}
+				if !errors.Is(err, ErrWriteBehindFull) {
+					t.Fatalf("order %d: CreateOrder() = %v, want success or ErrWriteBehindFull", i, err)
+				}
+				shed++
+			}
+			if shed != tt.wantShed {
+				t.Errorf("shed %d orders, want %d", shed, tt.wantShed)
+			}
+
+			// Shed orders fail; the rest wait for the database
+			orders, _, err := svc.orders.List(tt.orders, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses := make(map[OrderStatus]int)
+			for _, order := range orders {
+				statuses[order.Status]++
+			}
+			if statuses[OrderFailed] != tt.wantShed || statuses[OrderPendingPersist] != tt.orders-tt.wantShed {
+				t.Errorf("order statuses = %v, want %d failed and %d pending_persist", statuses, tt.wantShed, tt.orders-tt.wantShed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyReachesPersistence(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		writeBehind bool // The first write fails, so the order is persisted by the write-behind flush
+	}{
+		{name: "persisted inline", key: "client-key-1"},
+		{name: "persisted by the write-behind flush", key: "client-key-2", writeBehind: true},
+		{name: "no key sent"},
+		{name: "no key sent, write-behind", writeBehind: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var down atomic.Bool
+			down.Store(tt.writeBehind)
+			svc := newWriteBehindService(t, 10, &down)
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// Set by the handler in production; CreateOrder takes the key as an argument too
+			ctx := context.Background()
+			if tt.key != "" {
+				ctx = reliability.WithIdempotencyKey(ctx, tt.key)
+			}
+			resp, err := svc.CreateOrder(ctx, CreateOrderRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, tt.key)
+			if err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+			down.Store(false)
+			waitForStatus(t, svc, resp.OrderID, OrderCompleted)
+
+			want := ""
+			if tt.key != "" {
+				want = hashIdempotencyKey(tt.key)
+			}
+			flushes := make(map[trace.SpanID]bool)
+			for _, span := range recorder.Ended() {
+				if span.Name() == "flushWriteBehind" {
+					flushes[span.SpanContext().SpanID()] = true
+				}
+			}
+			var flushed bool
+			for _, span := range recorder.Ended() {
+				if span.Name() != "persistOrder" {
+					continue
+				}
+				got := ""
+				for _, kv := range span.Attributes() {
+					if kv.Key == "idempotency.key_hash" {
+						got = kv.Value.AsString()
+					}
+				}
+				if got != want {
+					t.Errorf("persistOrder idempotency.key_hash = %q, want %q", got, want)
+				}
+				if flushes[span.Parent().SpanID()] {
+					flushed = true
+				}
+			}
+			if flushed != tt.writeBehind {
+				t.Errorf("persisted by a write-behind flush = %v, want %v", flushed, tt.writeBehind)
+			}
+		})
+	}
+}
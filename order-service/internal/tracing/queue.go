@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// dropWarnInterval spaces out the warning logged while spans are being dropped
+const dropWarnInterval = time.Minute
+
+// droppedSpans counts finished spans discarded because the export queue was full
+var droppedSpans, _ = otel.Meter("order-service").Int64Counter("tracing.dropped_spans",
+	metric.WithDescription("Finished spans dropped because the export queue was full"))
+
+// boundedBatcher puts a counted admission limit in front of the SDK's batch span processor, which would
+// otherwise drop spans silently once its queue is full
+// A span is pending from OnEnd until its batch is handed to the exporter, so the batcher's queue never holds
+// more than the limit and the batcher, set to block on a full queue, never actually blocks
+type boundedBatcher struct {
+	sdktrace.SpanProcessor
+
+	limit    int64
+	pending  atomic.Int64
+	dropped  atomic.Int64
+	lastWarn atomic.Int64 // Unix nanoseconds of the last drop warning
+}
+
+// newBoundedBatcher wraps exporter in a batch processor admitting at most queueSize pending spans
+func newBoundedBatcher(exporter sdktrace.SpanExporter, queueSize int) *boundedBatcher {
+	b := &boundedBatcher{limit: int64(queueSize)}
+	b.SpanProcessor = sdktrace.NewBatchSpanProcessor(&releasingExporter{SpanExporter: exporter, pending: &b.pending},
+		sdktrace.WithMaxQueueSize(queueSize),
+		sdktrace.WithBlocking(),
+	)
+	return b
+}
+
+// OnEnd queues the span for export, or drops and counts it if the queue is full
+func (b *boundedBatcher) OnEnd(s sdktrace.ReadOnlySpan) {
+	// Unsampled spans are never exported, so they mustn't hold a slot
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if b.pending.Add(1) > b.limit {
+		b.pending.Add(-1)
+		b.drop()
+		return
+	}
+	b.SpanProcessor.OnEnd(s)
+}
+
+// drop counts a dropped span and, at most once per dropWarnInterval, tells operators what to change
+func (b *boundedBatcher) drop() {
+	total := b.dropped.Add(1)
+	droppedSpans.Add(context.Background(), 1)
+
+	now := time.Now().UnixNano()
+	last := b.lastWarn.Load()
+	if now-last < int64(dropWarnInterval) || !b.lastWarn.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("WARNING: trace export queue full, %d spans dropped so far; raise TRACE_QUEUE_SIZE (now %d) for bursts, "+
+		"or lower TRACE_SAMPLE_RATIO if the span volume is sustained", total, b.limit)
+}
+
+// releasingExporter frees a batch's admission slots as the batch processor hands it over for export
+type releasingExporter struct {
+	sdktrace.SpanExporter
+	pending *atomic.Int64
+}
+
+func (e *releasingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.pending.Add(-int64(len(spans)))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// dropMeter sums what's added to tracing.dropped_spans; every other instrument is a no-op
+type dropMeter struct {
+	noop.Meter
+	total atomic.Int64
+}
+
+func (m *dropMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	if name != "tracing.dropped_spans" {
+		return noop.Int64Counter{}, nil
+	}
+	return dropCounter{meter: m}, nil
+}
+
+type dropCounter struct {
+	noop.Int64Counter
+	meter *dropMeter
+}
+
+func (c dropCounter) Add(_ context.Context, n int64, _ ...metric.AddOption) { c.meter.total.Add(n) }
+
+type dropMeterProvider struct {
+	noop.MeterProvider
+	meter *dropMeter
+}
+
+func (p dropMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter { return p.meter }
+
+// useDropMeter installs a dropMeter globally, once per process: the package's counter was created against the
+// global provider, which forwards only to the first provider installed
+var useDropMeter = sync.OnceValue(func() *dropMeter {
+	meter := &dropMeter{}
+	otel.SetMeterProvider(dropMeterProvider{meter: meter})
+	return meter
+})
+
+// gatedExporter counts exported spans, holding each export until the gate opens
+type gatedExporter struct {
+	gate     chan struct{}
+	exported atomic.Int64
+}
+
+func (e *gatedExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	<-e.gate
+	e.exported.Add(int64(len(spans)))
+	return nil
+}
+
+func (e *gatedExporter) Shutdown(context.Context) error { return nil }
+
+func TestBoundedBatcherCountsDrops(t *testing.T) {
+	counter := useDropMeter()
+
+	tests := []struct {
+		name      string
+		queueSize int
+		spans     int
+		sampler   sdktrace.Sampler
+		wantDrops bool
+	}{
+		{name: "burst within the queue", queueSize: 64, spans: 40, sampler: sdktrace.AlwaysSample()},
+		{name: "burst overflows a stalled queue", queueSize: 4, spans: 40, sampler: sdktrace.AlwaysSample(), wantDrops: true},
+		{name: "unsampled spans take no slots", queueSize: 4, spans: 40, sampler: sdktrace.NeverSample()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+			before := counter.total.Load()
+
+			// The exporter stalls, as a slow collector would, so the queue only drains once the burst is over
+			exporter := &gatedExporter{gate: make(chan struct{})}
+			batcher := newBoundedBatcher(exporter, tt.queueSize)
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(batcher), sdktrace.WithSampler(tt.sampler))
+			tracer := provider.Tracer("test")
+			var wg sync.WaitGroup
+			for i := 0; i < tt.spans; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, span := tracer.Start(context.Background(), "burst")
+					span.End()
+				}()
+			}
+			wg.Wait()
+			close(exporter.gate)
+			if err := provider.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			dropped := batcher.dropped.Load()
+			if (dropped > 0) != tt.wantDrops {
+				t.Fatalf("dropped %d spans, want drops %v", dropped, tt.wantDrops)
+			}
+			if got := counter.total.Load() - before; got != dropped {
+				t.Errorf("tracing.dropped_spans grew by %d, want %d", got, dropped)
+			}
+			sampled := int64(tt.spans)
+			if tt.sampler == sdktrace.NeverSample() {
+				sampled = 0
+			}
+			if got := exporter.exported.Load() + dropped; got != sampled {
+				t.Errorf("exported %d + dropped %d = %d, want every sampled span accounted for (%d)",
+					exporter.exported.Load(), dropped, got, sampled)
+			}
+			if got := strings.Count(logs.String(), "trace export queue full"); got != min(int(dropped), 1) {
+				t.Errorf("logged %d queue-full warnings for %d drops, want at most one", got, dropped)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package tracing
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/demo/order-service/internal/config"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
@@ -12,11 +14,13 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // InitTracer initializes the OpenTelemetry tracer with OTLP exporter
 // This enables distributed tracing across microservices using W3C Trace Context
-func InitTracer(serviceName, collectorEndpoint string) (func(context.Context) error, error) {
+// Extra processors see every span in-process alongside the exporter, e.g. to keep a local audit log
+func InitTracer(serviceName, collectorEndpoint string, cfg config.TracingConfig, processors ...sdktrace.SpanProcessor) (func(context.Context) error, error) {
 	ctx := context.Background()
 
 	// Create OTLP trace exporter that sends spans to otel-collector
@@ -40,11 +44,23 @@ func InitTracer(serviceName, collectorEndpoint string) (func(context.Context) er
 	}
 
 	// Create tracer provider with batch span processor for efficiency
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+	// A full export queue either drops spans, counted so operators know to resize or sample, or applies backpressure
+	var batcher sdktrace.SpanProcessor
+	if cfg.Overflow == "block" {
+		batcher = sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithMaxQueueSize(cfg.QueueSize), sdktrace.WithBlocking())
+	} else {
+		batcher = newBoundedBatcher(exporter, cfg.QueueSize)
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(batcher),
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()), // Sample all traces for demo
-	)
+		// Continued traces follow the caller's decision so a trace is never recorded in only some services
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	for _, p := range processors {
+		opts = append(opts, sdktrace.WithSpanProcessor(p))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 
 	// Set global tracer provider and propagator
 	otel.SetTracerProvider(tp)
@@ -59,6 +75,29 @@ func InitTracer(serviceName, collectorEndpoint string) (func(context.Context) er
 	}, nil
 }
 
+// InitNoopTracer installs a no-op tracer provider for running without a collector
+// Spans are still created by instrumented code but discarded at zero cost
+func InitNoopTracer() func(context.Context) error {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(context.Context) error { return nil }
+}
+
+// InitTracerOrNoop runs init, falling back to InitNoopTracer with a warning if it fails and failOpen is set
+// Without failOpen the error is returned so the caller can refuse to start
+func InitTracerOrNoop(failOpen bool, init func() (func(context.Context) error, error)) (func(context.Context) error, error) {
+	shutdown, err := init()
+	if err == nil {
+		return shutdown, nil
+	}
+	if !failOpen {
+		return nil, err
+	}
+	// Fail open: a collector outage at boot shouldn't keep the service down
+	log.Printf("WARNING: failed to initialize tracer, continuing without tracing: %v", err)
+	return InitNoopTracer(), nil
+}
+
 // GetTracer returns a tracer for the given instrumentation scope
 func GetTracer(name string) trace.Tracer {
 	return otel.Tracer(name)
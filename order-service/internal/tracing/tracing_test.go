@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestInitTracerOrNoop(t *testing.T) {
+	errCollector := errors.New("collector unreachable")
+
+	tests := []struct {
+		name         string
+		failOpen     bool
+		initErr      error
+		wantErr      error
+		wantProvider string // "sdk" when init's provider is installed, "noop" for the fallback
+	}{
+		{name: "init succeeds", wantProvider: "sdk"},
+		{name: "init succeeds with fail-open", failOpen: true, wantProvider: "sdk"},
+		{name: "init fails without fail-open", initErr: errCollector, wantErr: errCollector, wantProvider: "sdk"},
+		{name: "init fails with fail-open", failOpen: true, initErr: errCollector, wantProvider: "noop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Whatever was installed before the call stays in place unless init or the fallback replaces it
+			sdkProvider := sdktrace.NewTracerProvider()
+			defer sdkProvider.Shutdown(context.Background())
+			otel.SetTracerProvider(sdkProvider)
+
+			shutdown, err := InitTracerOrNoop(tt.failOpen, func() (func(context.Context) error, error) {
+				if tt.initErr != nil {
+					return nil, tt.initErr
+				}
+				return sdkProvider.Shutdown, nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InitTracerOrNoop() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && shutdown == nil {
+				t.Error("InitTracerOrNoop() returned no shutdown function")
+			}
+			provider := "sdk"
+			if _, ok := otel.GetTracerProvider().(noop.TracerProvider); ok {
+				provider = "noop"
+			}
+			if provider != tt.wantProvider {
+				t.Errorf("global tracer provider = %s, want %s", provider, tt.wantProvider)
+			}
+		})
+	}
+}
@@ -3,23 +3,33 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/demo/payment-service/internal/config"
 	"github.com/demo/payment-service/internal/handler"
 	"github.com/demo/payment-service/internal/service"
 	"github.com/demo/payment-service/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"golang.org/x/net/http2"
 )
 
 func main() {
+	// Load configuration from environment
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize OpenTelemetry tracing
-	collectorEndpoint := getEnv("OTEL_COLLECTOR_ENDPOINT", "otel-collector:4317")
-	shutdown, err := tracing.InitTracer("payment-service", collectorEndpoint)
+	collectorEndpoint := cfg.CollectorEndpoint
+	shutdown, err := tracing.InitTracerOrNoop(cfg.TracingFailOpen, func() (func(context.Context) error, error) {
+		return tracing.InitTracer("payment-service", collectorEndpoint)
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
@@ -32,38 +42,97 @@ func main() {
 	log.Println("OpenTelemetry initialized, sending traces to", collectorEndpoint)
 
 	// Log fault injection settings
-	if delayMS := os.Getenv("PAYMENT_DELAY_MS"); delayMS != "" {
-		log.Printf("Fault injection: PAYMENT_DELAY_MS=%s", delayMS)
+	if cfg.Faults.DelayMS > 0 {
+		log.Printf("Fault injection: PAYMENT_DELAY_MS=%d", cfg.Faults.DelayMS)
+	}
+	if cfg.Faults.ErrorPercentage > 0 {
+		log.Printf("Fault injection: PAYMENT_ERROR_PCT=%g%%", cfg.Faults.ErrorPercentage)
+	}
+	if cfg.Faults.RateLimitPercentage > 0 {
+		log.Printf("Fault injection: RATE_LIMIT_PCT=%g%%", cfg.Faults.RateLimitPercentage)
 	}
-	if errorPct := os.Getenv("PAYMENT_ERROR_PCT"); errorPct != "" {
-		log.Printf("Fault injection: PAYMENT_ERROR_PCT=%s%%", errorPct)
+	if cfg.RateLimit.Requests > 0 {
+		log.Printf("Rate limiting POST /charge to %d requests per %s", cfg.RateLimit.Requests, cfg.RateLimit.Window)
 	}
-	if rateLimitPct := os.Getenv("RATE_LIMIT_PCT"); rateLimitPct != "" {
-		log.Printf("Fault injection: RATE_LIMIT_PCT=%s%%", rateLimitPct)
+	if cfg.Faults.AllowHeaders {
+		log.Printf("Fault injection: ALLOW_FAULT_HEADERS=true (X-Fault-Delay-Ms and X-Fault-Error honored per request)")
+	}
+	if cfg.Shadow.URL != "" {
+		log.Printf("Shadow mode: mirroring %g%% of charges to %s", cfg.Shadow.Percentage, cfg.Shadow.URL)
 	}
 
 	// Create Gin router with OpenTelemetry middleware
 	router := gin.Default()
 	router.Use(otelgin.Middleware("payment-service"))
 
+	// Count in-flight requests so a shutdown that times out reports how many were cut off
+	inFlight := handler.NewInFlightTracker()
+	router.Use(inFlight.Middleware())
+
 	// Initialize service and handlers
-	paymentService := service.NewPaymentService()
-	paymentHandler := handler.NewPaymentHandler(paymentService)
+	paymentService := service.NewPaymentService(cfg)
+	paymentHandler := handler.NewPaymentHandler(paymentService, cfg)
 
 	// Register routes
-	router.POST("/charge", paymentHandler.Charge)
+	charge := []gin.HandlerFunc{handler.RequireJSON(cfg.StrictContentType), paymentHandler.Charge}
+	if cfg.RateLimit.Requests > 0 {
+		// Checked first so throttled requests cost nothing and every response carries the X-RateLimit-* budget
+		charge = append([]gin.HandlerFunc{handler.NewRateLimiter(cfg.RateLimit.Requests, cfg.RateLimit.Window).Middleware()}, charge...)
+	}
+	router.POST("/charge", charge...)
 	router.GET("/health", paymentHandler.Health)
+	router.GET("/version", handler.Version("payment-service"))
+
+	// Admin endpoints expose internals and are opt-in
+	if cfg.AdminEnabled {
+		adminHandler := handler.NewAdminHandler(cfg)
+		admin := router.Group("/admin")
+		admin.GET("/config", adminHandler.Config)
+	}
 
 	// Start HTTP server with graceful shutdown
-	port := getEnv("PORT", "8081")
+	port := cfg.Port
+	tlsConfig, err := cfg.TLS.Config()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: router,
+		Addr:      ":" + port,
+		Handler:   router,
+		TLSConfig: tlsConfig, // Handshakes below the minimum version are rejected
+
+		// Bound slow or idle clients so they can't tie up connections indefinitely
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// A single HTTP/2 connection could otherwise carry unbounded concurrent requests past the per-connection limits above
+	if err := http2.ConfigureServer(srv, &http2.Server{
+		MaxConcurrentStreams: uint32(cfg.Server.MaxConcurrentStreams),
+		IdleTimeout:          cfg.Server.IdleTimeout,
+	}); err != nil {
+		log.Fatalf("Failed to configure HTTP/2: %v", err)
+	}
+
+	// Cap simultaneously open connections so a flood can't exhaust file descriptors
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on port %s: %v", port, err)
 	}
+	connLimit := handler.NewConnLimiter(cfg.Server.MaxConnections, cfg.Server.ConnectionWait)
+	listener = connLimit.Wrap(listener)
 
 	go func() {
-		log.Printf("Starting payment-service on port %s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLS.Enabled() {
+			log.Printf("Starting payment-service on port %s (TLS >= %s)", port, cfg.TLS.MinVersion)
+			err = srv.ServeTLS(listener, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			log.Printf("Starting payment-service on port %s", port)
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -72,21 +141,15 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	log.Printf("Shutting down server (%d requests in flight, %d connections rejected over MAX_CONNECTIONS, timeout %s)...",
+		inFlight.Count(), connLimit.Rejected(), cfg.ShutdownTimeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown with %d requests still in flight: %v", inFlight.Count(), err)
 	}
 
 	log.Println("Server exited")
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
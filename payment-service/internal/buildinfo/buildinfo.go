@@ -0,0 +1,32 @@
+package buildinfo
+
+import "runtime"
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/demo/payment-service/internal/buildinfo.Version=1.4.0 -X github.com/demo/payment-service/internal/buildinfo.Commit=$(git rev-parse HEAD)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown" // RFC3339
+)
+
+// Info identifies the running build
+type Info struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info for the named service
+func Get(service string) Info {
+	return Info{
+		Service:   service,
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/demo/payment-service/internal/features"
+)
+
+// Config holds the effective runtime configuration for the payment service
+type Config struct {
+	Port              string `json:"port"`
+	CollectorEndpoint string `json:"otel_collector_endpoint"`
+	TracingFailOpen   bool   `json:"tracing_fail_open"` // Start with a no-op tracer if tracing init fails
+	AdminEnabled      bool   `json:"admin_enabled"`
+	StrictContentType bool   `json:"strict_content_type"` // Reject requests to /charge not sent as application/json
+
+	// Return at once from requests whose context is already cancelled on arrival, e.g. the client hung up while queued
+	SkipCancelled bool `json:"skip_cancelled"`
+
+	// How long shutdown waits for in-flight requests to drain before forcing connections closed
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
+	Server          ServerConfig  `json:"server"`
+
+	// Allowance for clock skew when checking a caller's X-Deadline-Unix-Ms on arrival
+	DeadlineSkewTolerance time.Duration `json:"deadline_skew_tolerance"`
+
+	// How long a duplicate charge waits for an in-flight charge with the same idempotency key
+	IdempotencyWaitTimeout time.Duration `json:"idempotency_wait_timeout"`
+
+	// What happens to a charge for an order ID already charged that the idempotency key didn't dedup: allow, warn or reject
+	DuplicateOrderPolicy string `json:"duplicate_order_policy"`
+
+	// What happens to a charge without an order_id: reject, or generate one so a partially rolled out caller keeps working
+	MissingOrderIDPolicy string `json:"missing_order_id_policy"`
+
+	// What happens to amounts with more than AmountDecimals decimal places: allow, reject, round_half_even or truncate
+	// Both services must agree so an amount isn't rounded one way here and rejected or rounded another way downstream
+	AmountPrecisionMode string `json:"amount_precision_mode"`
+	AmountDecimals      int    `json:"amount_decimals"`
+
+	Gateway   GatewayConfig   `json:"gateway"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	TLS          TLSConfig                  `json:"tls"`
+	Faults       FaultConfig                `json:"faults"`
+	Shadow       ShadowConfig               `json:"shadow"`
+	FeatureFlags map[string][]features.Flag `json:"feature_flags"`
+}
+
+// GatewayConfig bounds calls to the external payment gateway
+type GatewayConfig struct {
+	Timeout       time.Duration `json:"timeout"`        // Upper bound on a gateway call, with or without a caller budget
+	BudgetReserve time.Duration `json:"budget_reserve"` // Share of the caller's budget held back for our own response
+	MaxConcurrent int           `json:"max_concurrent"` // Calls the simulated gateway accepts at once; 0 is unbounded
+	QueueTimeout  time.Duration `json:"queue_timeout"`  // How long a call waits for a free slot; 0 rejects at once when saturated
+}
+
+// RateLimitConfig sizes the POST /charge rate limiter
+type RateLimitConfig struct {
+	Requests int           `json:"requests"` // Requests admitted per window; 0 disables the limiter
+	Window   time.Duration `json:"window"`
+}
+
+// FaultConfig holds fault injection settings used to simulate real-world failures
+type FaultConfig struct {
+	DelayMS             int     `json:"delay_ms"`       // Artificial delay in milliseconds
+	ErrorPercentage     float64 `json:"error_pct"`      // Percentage of requests that should error (0-100)
+	RateLimitPercentage float64 `json:"rate_limit_pct"` // Percentage of requests rejected with 429 (0-100)
+	MerchantPercentage  float64 `json:"merchant_pct"`   // Percentage of merchants, picked by ID hash, the faults above apply to (0-100)
+	AllowHeaders        bool    `json:"allow_headers"`  // Honor per-request X-Fault-* debug headers
+}
+
+// ShadowConfig holds settings for mirroring charges to a shadow gateway
+type ShadowConfig struct {
+	URL        string  `json:"url" redact:"url"`
+	Percentage float64 `json:"pct"` // Percentage of charges mirrored (0-100)
+}
+
+// ServerConfig bounds how long a client may hold an HTTP connection, so slow or idle clients can't exhaust it
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout"` // Closes connections that never finish their headers (slowloris)
+	ReadTimeout       time.Duration `json:"read_timeout"`        // Whole request including body
+	WriteTimeout      time.Duration `json:"write_timeout"`       // From end of request headers to end of response
+	IdleTimeout       time.Duration `json:"idle_timeout"`        // Keep-alive connections waiting for the next request
+
+	// HTTP/2 multiplexes requests over one connection, so connection limits alone no longer bound concurrency
+	MaxConcurrentStreams int `json:"max_concurrent_streams"` // Streams one HTTP/2 connection may have open; HTTP/2 needs TLS
+
+	// Caps simultaneously open TCP connections; excess connections wait ConnectionWait for a slot, then are closed
+	MaxConnections int           `json:"max_connections"` // 0 disables
+	ConnectionWait time.Duration `json:"connection_wait"`
+}
+
+// Default returns the configuration used when no environment overrides are set
+func Default() *Config {
+	return &Config{
+		Port:                   "8081",
+		ShutdownTimeout:        5 * time.Second,
+		CollectorEndpoint:      "otel-collector:4317",
+		DeadlineSkewTolerance:  100 * time.Millisecond,
+		IdempotencyWaitTimeout: 2 * time.Second,
+		DuplicateOrderPolicy:   "warn",
+		MissingOrderIDPolicy:   "reject",
+		AmountPrecisionMode:    "allow",
+		AmountDecimals:         2,
+		SkipCancelled:          true,
+		Server: ServerConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+
+			MaxConcurrentStreams: 100,
+
+			ConnectionWait: 1 * time.Second,
+		},
+		Gateway: GatewayConfig{
+			Timeout:       1 * time.Second,
+			BudgetReserve: 10 * time.Millisecond,
+		},
+		Faults:       FaultConfig{MerchantPercentage: 100},
+		RateLimit:    RateLimitConfig{Window: 1 * time.Second},
+		TLS:          TLSConfig{MinVersion: "1.2"},
+		FeatureFlags: make(map[string][]features.Flag),
+	}
+}
+
+// Load reads configuration from environment variables over the defaults and validates it
+// Malformed values are reported as errors rather than silently falling back to zero
+func Load() (*Config, error) {
+	cfg := Default()
+	env := &envLoader{}
+
+	cfg.Port = env.string("PORT", cfg.Port)
+	cfg.CollectorEndpoint = env.string("OTEL_COLLECTOR_ENDPOINT", cfg.CollectorEndpoint)
+	cfg.TracingFailOpen = env.bool("TRACING_FAIL_OPEN", cfg.TracingFailOpen)
+	cfg.AdminEnabled = env.bool("ADMIN_ENDPOINTS_ENABLED", cfg.AdminEnabled)
+	cfg.StrictContentType = env.bool("STRICT_CONTENT_TYPE", cfg.StrictContentType)
+	cfg.SkipCancelled = env.bool("SKIP_CANCELLED_REQUESTS", cfg.SkipCancelled)
+	cfg.ShutdownTimeout = env.seconds("SHUTDOWN_TIMEOUT_SECONDS", cfg.ShutdownTimeout)
+	cfg.Server.ReadHeaderTimeout = env.millis("SERVER_READ_HEADER_TIMEOUT_MS", cfg.Server.ReadHeaderTimeout)
+	cfg.Server.ReadTimeout = env.millis("SERVER_READ_TIMEOUT_MS", cfg.Server.ReadTimeout)
+	cfg.Server.WriteTimeout = env.millis("SERVER_WRITE_TIMEOUT_MS", cfg.Server.WriteTimeout)
+	cfg.Server.IdleTimeout = env.millis("SERVER_IDLE_TIMEOUT_MS", cfg.Server.IdleTimeout)
+	cfg.Server.MaxConcurrentStreams = env.int("SERVER_MAX_CONCURRENT_STREAMS", cfg.Server.MaxConcurrentStreams)
+	cfg.Server.MaxConnections = env.int("MAX_CONNECTIONS", cfg.Server.MaxConnections)
+	cfg.Server.ConnectionWait = env.millis("MAX_CONNECTIONS_WAIT_MS", cfg.Server.ConnectionWait)
+	cfg.DeadlineSkewTolerance = env.millis("DEADLINE_SKEW_TOLERANCE_MS", cfg.DeadlineSkewTolerance)
+	cfg.IdempotencyWaitTimeout = env.millis("IDEMPOTENCY_WAIT_TIMEOUT_MS", cfg.IdempotencyWaitTimeout)
+	cfg.DuplicateOrderPolicy = env.string("DUPLICATE_ORDER_POLICY", cfg.DuplicateOrderPolicy)
+	cfg.MissingOrderIDPolicy = env.string("MISSING_ORDER_ID_POLICY", cfg.MissingOrderIDPolicy)
+	cfg.AmountPrecisionMode = env.string("AMOUNT_PRECISION_MODE", cfg.AmountPrecisionMode)
+	cfg.AmountDecimals = env.int("AMOUNT_DECIMALS", cfg.AmountDecimals)
+	cfg.Gateway.Timeout = env.millis("GATEWAY_TIMEOUT_MS", cfg.Gateway.Timeout)
+	cfg.Gateway.BudgetReserve = env.millis("GATEWAY_BUDGET_RESERVE_MS", cfg.Gateway.BudgetReserve)
+	cfg.Gateway.MaxConcurrent = env.int("GATEWAY_MAX_CONCURRENT", cfg.Gateway.MaxConcurrent)
+	cfg.Gateway.QueueTimeout = env.millis("GATEWAY_QUEUE_TIMEOUT_MS", cfg.Gateway.QueueTimeout)
+	cfg.RateLimit.Requests = env.int("RATE_LIMIT_REQUESTS", cfg.RateLimit.Requests)
+	cfg.RateLimit.Window = env.millis("RATE_LIMIT_WINDOW_MS", cfg.RateLimit.Window)
+
+	cfg.TLS.MinVersion = env.string("TLS_MIN_VERSION", cfg.TLS.MinVersion)
+	cfg.TLS.CipherSuites = env.list("TLS_CIPHER_SUITES", cfg.TLS.CipherSuites)
+	cfg.TLS.CertFile = env.string("TLS_CERT_FILE", cfg.TLS.CertFile)
+	cfg.TLS.KeyFile = env.string("TLS_KEY_FILE", cfg.TLS.KeyFile)
+
+	cfg.Faults.DelayMS = env.int("PAYMENT_DELAY_MS", cfg.Faults.DelayMS)
+	cfg.Faults.ErrorPercentage = env.float("PAYMENT_ERROR_PCT", cfg.Faults.ErrorPercentage)
+	cfg.Faults.RateLimitPercentage = env.float("RATE_LIMIT_PCT", cfg.Faults.RateLimitPercentage)
+	cfg.Faults.MerchantPercentage = env.float("FAULT_MERCHANT_PCT", cfg.Faults.MerchantPercentage)
+	cfg.Faults.AllowHeaders = env.bool("ALLOW_FAULT_HEADERS", cfg.Faults.AllowHeaders)
+
+	cfg.Shadow.URL = env.string("SHADOW_GATEWAY_URL", cfg.Shadow.URL)
+	cfg.Shadow.Percentage = env.float("SHADOW_PCT", cfg.Shadow.Percentage)
+
+	// Per-merchant feature flags as JSON: {"merchant_123": ["enable_3ds"]}
+	if spec := os.Getenv("MERCHANT_FEATURE_FLAGS"); spec != "" {
+		if err := json.Unmarshal([]byte(spec), &cfg.FeatureFlags); err != nil {
+			env.errs = append(env.errs, fmt.Errorf("MERCHANT_FEATURE_FLAGS: %w", err))
+		}
+	}
+
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that all values are within usable ranges
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT_SECONDS must be positive"))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 || c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_READ_HEADER_TIMEOUT_MS, SERVER_READ_TIMEOUT_MS, SERVER_WRITE_TIMEOUT_MS and SERVER_IDLE_TIMEOUT_MS must be positive"))
+	}
+	if c.Server.MaxConnections < 0 || c.Server.ConnectionWait < 0 {
+		errs = append(errs, errors.New("MAX_CONNECTIONS and MAX_CONNECTIONS_WAIT_MS must not be negative"))
+	}
+	if c.Server.MaxConcurrentStreams <= 0 {
+		errs = append(errs, errors.New("SERVER_MAX_CONCURRENT_STREAMS must be positive"))
+	}
+	if c.DeadlineSkewTolerance < 0 {
+		errs = append(errs, errors.New("DEADLINE_SKEW_TOLERANCE_MS must not be negative"))
+	}
+	if c.IdempotencyWaitTimeout <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_WAIT_TIMEOUT_MS must be positive"))
+	}
+	switch c.DuplicateOrderPolicy {
+	case "allow", "warn", "reject":
+	default:
+		errs = append(errs, fmt.Errorf("DUPLICATE_ORDER_POLICY must be allow, warn or reject, got %q", c.DuplicateOrderPolicy))
+	}
+	switch c.MissingOrderIDPolicy {
+	case "reject", "generate":
+	default:
+		errs = append(errs, fmt.Errorf("MISSING_ORDER_ID_POLICY must be reject or generate, got %q", c.MissingOrderIDPolicy))
+	}
+	switch c.AmountPrecisionMode {
+	case "allow", "reject", "round_half_even", "truncate":
+	default:
+		errs = append(errs, fmt.Errorf("AMOUNT_PRECISION_MODE must be allow, reject, round_half_even or truncate, got %q", c.AmountPrecisionMode))
+	}
+	if c.AmountDecimals < 0 || c.AmountDecimals > 8 {
+		errs = append(errs, errors.New("AMOUNT_DECIMALS must be between 0 and 8"))
+	}
+	if c.Gateway.Timeout <= 0 {
+		errs = append(errs, errors.New("GATEWAY_TIMEOUT_MS must be positive"))
+	}
+	if c.Gateway.BudgetReserve < 0 {
+		errs = append(errs, errors.New("GATEWAY_BUDGET_RESERVE_MS must not be negative"))
+	}
+	if c.Gateway.MaxConcurrent < 0 {
+		errs = append(errs, errors.New("GATEWAY_MAX_CONCURRENT must not be negative"))
+	}
+	if c.Gateway.QueueTimeout < 0 {
+		errs = append(errs, errors.New("GATEWAY_QUEUE_TIMEOUT_MS must not be negative"))
+	}
+	if c.RateLimit.Requests < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_REQUESTS must not be negative"))
+	}
+	if c.RateLimit.Window <= 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_WINDOW_MS must be positive"))
+	}
+	if _, err := c.TLS.Config(); err != nil {
+		errs = append(errs, err)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.Faults.DelayMS < 0 {
+		errs = append(errs, errors.New("PAYMENT_DELAY_MS must not be negative"))
+	}
+	if !isPercentage(c.Faults.ErrorPercentage) {
+		errs = append(errs, errors.New("PAYMENT_ERROR_PCT must be between 0 and 100"))
+	}
+	if !isPercentage(c.Faults.RateLimitPercentage) {
+		errs = append(errs, errors.New("RATE_LIMIT_PCT must be between 0 and 100"))
+	}
+	if !isPercentage(c.Faults.MerchantPercentage) {
+		errs = append(errs, errors.New("FAULT_MERCHANT_PCT must be between 0 and 100"))
+	}
+	if c.Shadow.URL != "" {
+		if u, err := url.Parse(c.Shadow.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, errors.New("SHADOW_GATEWAY_URL must be an absolute URL"))
+		}
+	}
+	if !isPercentage(c.Shadow.Percentage) {
+		errs = append(errs, errors.New("SHADOW_PCT must be between 0 and 100"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func isPercentage(v float64) bool {
+	return v >= 0 && v <= 100
+}
+
+// Redacted returns the configuration as a JSON-friendly map with secrets masked
+func (c *Config) Redacted() map[string]any {
+	return export(c)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string // Substrings every one of which the error must contain; empty expects success
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults when unset",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != "8081" || cfg.Faults.ErrorPercentage != 0 || cfg.Gateway.Timeout != time.Second ||
+					cfg.DuplicateOrderPolicy != "warn" {
+					t.Errorf("config = %+v, want the defaults", cfg)
+				}
+			},
+		},
+		{
+			name: "valid overrides apply",
+			env: map[string]string{
+				"PORT":                   "9000",
+				"PAYMENT_DELAY_MS":       "250",
+				"PAYMENT_ERROR_PCT":      "12.5",
+				"GATEWAY_TIMEOUT_MS":     "300",
+				"DUPLICATE_ORDER_POLICY": "reject",
+				"ALLOW_FAULT_HEADERS":    "true",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != "9000" || cfg.Faults.DelayMS != 250 || cfg.Faults.ErrorPercentage != 12.5 ||
+					cfg.Gateway.Timeout != 300*time.Millisecond || cfg.DuplicateOrderPolicy != "reject" || !cfg.Faults.AllowHeaders {
+					t.Errorf("config = %+v, want the overrides", cfg)
+				}
+			},
+		},
+		{name: "typo'd percentage", env: map[string]string{"PAYMENT_ERROR_PCT": "abc"}, wantErr: []string{`PAYMENT_ERROR_PCT="abc"`}},
+		{name: "malformed bool", env: map[string]string{"ALLOW_FAULT_HEADERS": "yes please"}, wantErr: []string{`ALLOW_FAULT_HEADERS="yes please"`}},
+		{name: "percentage out of range", env: map[string]string{"PAYMENT_ERROR_PCT": "150"}, wantErr: []string{"PAYMENT_ERROR_PCT"}},
+		{name: "unknown policy", env: map[string]string{"DUPLICATE_ORDER_POLICY": "ignore"}, wantErr: []string{"DUPLICATE_ORDER_POLICY must be"}},
+		{
+			name:    "every malformed variable is reported",
+			env:     map[string]string{"PAYMENT_DELAY_MS": "slow", "GATEWAY_TIMEOUT_MS": "1s"},
+			wantErr: []string{`PAYMENT_DELAY_MS="slow"`, `GATEWAY_TIMEOUT_MS="1s"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load()
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("Load() succeeded, want an error containing %q", tt.wantErr)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Load() error = %v, want it to contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestServerIdleTimeoutClosesKeepAlive(t *testing.T) {
+	tests := []struct {
+		name       string
+		idle       time.Duration // Pause between two requests on one keep-alive connection
+		wantReused bool
+	}{
+		{name: "reused within the idle timeout", idle: 20 * time.Millisecond, wantReused: true},
+		{name: "closed once idle too long", idle: 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default().Server
+			cfg.IdleTimeout = 100 * time.Millisecond
+
+			// Configured the way cmd/main.go configures the real server
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+			server.Config.ReadTimeout = cfg.ReadTimeout
+			server.Config.WriteTimeout = cfg.WriteTimeout
+			server.Config.IdleTimeout = cfg.IdleTimeout
+			server.Start()
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+			reader := bufio.NewReader(conn)
+
+			// get sends a request on the connection, reporting whether the server answered it
+			get := func() bool {
+				if _, err := io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n"); err != nil {
+					return false
+				}
+				resp, err := http.ReadResponse(reader, nil)
+				if err != nil {
+					return false
+				}
+				resp.Body.Close()
+				return true
+			}
+
+			if !get() {
+				t.Fatal("first request on the connection failed")
+			}
+			time.Sleep(tt.idle)
+			if reused := get(); reused != tt.wantReused {
+				t.Errorf("second request answered = %v, want %v", reused, tt.wantReused)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secret values in exported config
+const redactedValue = "[REDACTED]"
+
+// export converts a config struct into a JSON-friendly map for the admin endpoint
+// Field names come from json tags; durations render as strings ("500ms") and func fields are skipped
+// Fields tagged `redact:"true"` are masked entirely; `redact:"url"` masks only URL credentials
+func export(v any) map[string]any {
+	return exportStruct(reflect.Indirect(reflect.ValueOf(v)))
+}
+
+func exportStruct(v reflect.Value) map[string]any {
+	out := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if value, ok := exportValue(v.Field(i), field.Tag.Get("redact")); ok {
+			out[name] = value
+		}
+	}
+	return out
+}
+
+func exportValue(v reflect.Value, redact string) (any, bool) {
+	switch {
+	case v.Kind() == reflect.Func || v.Kind() == reflect.Chan:
+		return nil, false
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(v.Int()).String(), true
+	case v.Kind() == reflect.Struct:
+		return exportStruct(v), true
+	case v.Kind() == reflect.String && redact == "true":
+		if v.String() == "" {
+			return "", true
+		}
+		return redactedValue, true
+	case v.Kind() == reflect.String && redact == "url":
+		return redactURL(v.String()), true
+	default:
+		return v.Interface(), true
+	}
+}
+
+// redactURL masks the password in a URL's userinfo, leaving the rest readable
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSMinVersionRejectsOldClients(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           TLSConfig
+		clientMax     uint16
+		clientCiphers []uint16
+		wantHandshake bool
+	}{
+		{name: "TLS 1.1 client below a 1.2 minimum", cfg: TLSConfig{MinVersion: "1.2"}, clientMax: tls.VersionTLS11},
+		{name: "TLS 1.2 client at a 1.2 minimum", cfg: TLSConfig{MinVersion: "1.2"}, clientMax: tls.VersionTLS12, wantHandshake: true},
+		{name: "TLS 1.3 client above a 1.2 minimum", cfg: TLSConfig{MinVersion: "1.2"}, clientMax: tls.VersionTLS13, wantHandshake: true},
+		{name: "TLS 1.2 client below a 1.3 minimum", cfg: TLSConfig{MinVersion: "1.3"}, clientMax: tls.VersionTLS12},
+		{name: "cipher outside the allowlist",
+			cfg:       TLSConfig{MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+			clientMax: tls.VersionTLS12, clientCiphers: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}},
+		{name: "cipher in the allowlist",
+			cfg:       TLSConfig{MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}},
+			clientMax: tls.VersionTLS12, clientCiphers: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, wantHandshake: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverTLS, err := tt.cfg.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = serverTLS
+			server.StartTLS()
+			defer server.Close()
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, // httptest's self-signed certificate
+				MinVersion:         tls.VersionTLS10,
+				MaxVersion:         tt.clientMax,
+				CipherSuites:       tt.clientCiphers,
+			}}}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if handshake := err == nil; handshake != tt.wantHandshake {
+				t.Errorf("handshake succeeded = %v, want %v (err %v)", handshake, tt.wantHandshake, err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigRejectsBadSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+	}{
+		{name: "unknown version", cfg: TLSConfig{MinVersion: "1.4"}},
+		{name: "empty version", cfg: TLSConfig{}},
+		{name: "unknown cipher", cfg: TLSConfig{MinVersion: "1.2", CipherSuites: []string{"TLS_MADE_UP"}}},
+		{name: "insecure cipher", cfg: TLSConfig{MinVersion: "1.2", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.Config(); err == nil {
+				t.Errorf("Config() accepted %+v", tt.cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package features
+
+import "sort"
+
+// Flag names a per-merchant behavior toggle
+type Flag string
+
+const (
+	// Enable3DS adds a simulated 3-D Secure verification step before charging
+	Enable3DS Flag = "enable_3ds"
+	// SkipFraudCheck bypasses the fraud screening step for trusted merchants
+	SkipFraudCheck Flag = "skip_fraud_check"
+)
+
+// Provider resolves which flags are enabled for a merchant
+// Implementations must be safe for concurrent use; unknown merchants have all flags off
+type Provider interface {
+	Enabled(merchantID string, flag Flag) bool
+	Active(merchantID string) []Flag
+}
+
+// StaticProvider is an immutable in-memory Provider backed by a merchant → flags map
+// Swap in a remote-config implementation of Provider for runtime toggling
+type StaticProvider struct {
+	flags map[string]map[Flag]bool
+}
+
+// NewStaticProvider creates a provider from a merchant → enabled flags map
+func NewStaticProvider(merchantFlags map[string][]Flag) *StaticProvider {
+	p := &StaticProvider{flags: make(map[string]map[Flag]bool, len(merchantFlags))}
+	for merchantID, flags := range merchantFlags {
+		set := make(map[Flag]bool, len(flags))
+		for _, f := range flags {
+			set[f] = true
+		}
+		p.flags[merchantID] = set
+	}
+	return p
+}
+
+// Enabled reports whether flag is on for the merchant
+func (p *StaticProvider) Enabled(merchantID string, flag Flag) bool {
+	return p.flags[merchantID][flag]
+}
+
+// Active returns the merchant's enabled flags in sorted order for stable span attributes
+func (p *StaticProvider) Active(merchantID string) []Flag {
+	active := make([]Flag, 0, len(p.flags[merchantID]))
+	for f, on := range p.flags[merchantID] {
+		if on {
+			active = append(active, f)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i] < active[j] })
+	return active
+}
+
+// Strings converts flags to plain strings, e.g. for span attributes
+func Strings(flags []Flag) []string {
+	out := make([]string, len(flags))
+	for i, f := range flags {
+		out[i] = string(f)
+	}
+	return out
+}
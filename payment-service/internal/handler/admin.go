@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/demo/payment-service/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operational endpoints, registered only when ADMIN_ENDPOINTS_ENABLED=true
+type AdminHandler struct {
+	cfg *config.Config
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		cfg: cfg,
+	}
+}
+
+// Config handles GET /admin/config, returning the effective configuration with secrets redacted
+func (h *AdminHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cfg.Redacted())
+}
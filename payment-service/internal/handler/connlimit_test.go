@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterListener(t *testing.T) {
+	tests := []struct {
+		name         string
+		max          int
+		dials        int
+		closeFirst   bool // The first accepted connection is closed once all are dialed, freeing its slot
+		wantAccepted int
+		wantRejected int64
+	}{
+		{name: "unlimited accepts everything", dials: 5, wantAccepted: 5},
+		{name: "excess over the cap is rejected", max: 2, dials: 5, wantAccepted: 2, wantRejected: 3},
+		{name: "closing a connection frees its slot", max: 2, dials: 3, closeFirst: true, wantAccepted: 3, wantRejected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A generous wait so the third connection in the close case is held rather than rejected
+			wait := time.Duration(0)
+			if tt.closeFirst {
+				wait = time.Second
+			}
+			limiter := NewConnLimiter(tt.max, wait)
+			limited := limiter.Wrap(ln)
+			defer limited.Close()
+			if tt.max == 0 && limited != ln {
+				t.Error("Wrap() with no limit should return the listener unchanged")
+			}
+
+			accepted := make(chan net.Conn, tt.dials)
+			go func() {
+				for {
+					conn, err := limited.Accept()
+					if err != nil {
+						return
+					}
+					accepted <- conn
+				}
+			}()
+
+			for i := 0; i < tt.dials; i++ {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+			}
+
+			var conns []net.Conn
+			timeout := time.After(200 * time.Millisecond) // Long enough for any connection over the expected count to show up
+		collect:
+			for len(conns) < tt.wantAccepted+1 {
+				select {
+				case conn := <-accepted:
+					defer conn.Close()
+					conns = append(conns, conn)
+					if tt.closeFirst && len(conns) == tt.max {
+						conns[0].Close()
+						conns[0].Close() // The server may close twice; the slot is freed once
+					}
+				case <-timeout:
+					break collect
+				}
+			}
+
+			if len(conns) != tt.wantAccepted {
+				t.Errorf("accepted %d connections, want %d", len(conns), tt.wantAccepted)
+			}
+			if got := limiter.Rejected(); got != tt.wantRejected {
+				t.Errorf("Rejected() = %d, want %d", got, tt.wantRejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireJSON rejects requests whose Content-Type isn't application/json with 415 Unsupported Media Type
+// Parameters such as charset are allowed; when strict is false every request passes through
+func RequireJSON(strict bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strict || c.ContentType() == gin.MIMEJSON {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": fmt.Sprintf("Content-Type must be %s, got %q", gin.MIMEJSON, c.GetHeader("Content-Type")),
+		})
+	}
+}
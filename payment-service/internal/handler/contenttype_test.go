@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+	"github.com/demo/payment-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestChargeContentType(t *testing.T) {
+	const charge = `{"order_id":"order-1","merchant_id":"merchant_123","currency":"USD","amount":19.99}`
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "JSON charged", strict: true, contentType: "application/json", body: charge, wantStatus: http.StatusOK},
+		{name: "form rejected", strict: true, contentType: "application/x-www-form-urlencoded",
+			body: "order_id=order-1&merchant_id=merchant_123&currency=USD&amount=19.99", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "plain text rejected", strict: true, contentType: "text/plain", body: charge, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "no content type rejected", strict: true, body: charge, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "lenient mode still binds plain-text JSON", contentType: "text/plain", body: charge, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.StrictContentType = tt.strict
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/charge", RequireJSON(cfg.StrictContentType), NewPaymentHandler(service.NewPaymentService(cfg), cfg).Charge)
+
+			req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
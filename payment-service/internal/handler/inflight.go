@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightTracker counts requests currently being handled, so shutdown can report what it cut off
+type InFlightTracker struct {
+	count atomic.Int64
+}
+
+// NewInFlightTracker creates a tracker with no requests in flight
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{}
+}
+
+// Middleware counts each request from arrival until its handler returns
+func (t *InFlightTracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.count.Add(1)
+		defer t.count.Add(-1)
+		c.Next()
+	}
+}
+
+// Count returns the number of requests currently in flight
+func (t *InFlightTracker) Count() int64 {
+	return t.count.Load()
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInFlightTracker(t *testing.T) {
+	tests := []struct {
+		name       string
+		concurrent int
+		panics     bool // The handler panics, recovered by gin.Recovery outside the tracker
+	}{
+		{name: "single request", concurrent: 1},
+		{name: "concurrent requests", concurrent: 8},
+		{name: "panicking handler", concurrent: 2, panics: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inFlight := NewInFlightTracker()
+			arrived := make(chan struct{})
+			release := make(chan struct{})
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(gin.Recovery(), inFlight.Middleware())
+			router.POST("/charge", func(c *gin.Context) {
+				arrived <- struct{}{}
+				<-release
+				if tt.panics {
+					panic("gateway exploded")
+				}
+				c.Status(http.StatusOK)
+			})
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.concurrent; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/charge", nil))
+				}()
+			}
+			for i := 0; i < tt.concurrent; i++ {
+				<-arrived
+			}
+			if got := inFlight.Count(); got != int64(tt.concurrent) {
+				t.Errorf("in flight while handling = %d, want %d", got, tt.concurrent)
+			}
+
+			close(release)
+			wg.Wait()
+			if got := inFlight.Count(); got != 0 {
+				t.Errorf("in flight once handled = %d, want 0", got)
+			}
+		})
+	}
+}
@@ -1,47 +1,101 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
+	"github.com/demo/payment-service/internal/config"
 	"github.com/demo/payment-service/internal/service"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PaymentHandler handles HTTP requests for payments
 type PaymentHandler struct {
-	paymentService *service.PaymentService
-	rateLimitPct   float64
+	paymentService    *service.PaymentService
+	rateLimitPct      float64
+	faultMerchantPct  float64 // Share of merchants the simulated 429s apply to
+	allowFaultHeaders bool    // Honor X-Fault-* debug headers; never enable in production
+	skewTolerance     time.Duration
 }
 
 // NewPaymentHandler creates a new payment handler
-func NewPaymentHandler(paymentService *service.PaymentService) *PaymentHandler {
-	rateLimitPct, _ := strconv.ParseFloat(os.Getenv("RATE_LIMIT_PCT"), 64)
+func NewPaymentHandler(paymentService *service.PaymentService, cfg *config.Config) *PaymentHandler {
 	return &PaymentHandler{
-		paymentService: paymentService,
-		rateLimitPct:   rateLimitPct,
+		paymentService:    paymentService,
+		rateLimitPct:      cfg.Faults.RateLimitPercentage,
+		faultMerchantPct:  cfg.Faults.MerchantPercentage,
+		allowFaultHeaders: cfg.Faults.AllowHeaders,
+		skewTolerance:     cfg.DeadlineSkewTolerance,
 	}
 }
 
 // Charge handles POST /charge
+// Honors the Idempotency-Key header to deduplicate retried charges
 func (h *PaymentHandler) Charge(c *gin.Context) {
-	// Simulate rate limiting (429 responses)
-	if h.rateLimitPct > 0 && rand.Float64()*100 < h.rateLimitPct {
+	// Don't spend work on a request the caller has already given up on
+	ctx, cancel, ok := h.applyDeadline(c)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var req service.ChargeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		// Negative zero and NaN fail gt=0 too, but get a dedicated 422 so the cause is clear
+		if !rejectInvalidAmount(c, req.Amount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if rejectInvalidAmount(c, req.Amount) {
+		return
+	}
+
+	// Simulate rate limiting (429 responses); checked after binding so it can target the FAULT_MERCHANT_PCT subset
+	if h.rateLimitPct > 0 && service.InFaultSubset(req.MerchantID, h.faultMerchantPct) && rand.Float64()*100 < h.rateLimitPct {
 		c.JSON(http.StatusTooManyRequests, gin.H{
 			"error": "rate limit exceeded",
 		})
 		return
 	}
 
-	var req service.ChargeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if h.allowFaultHeaders {
+		override, ok, err := faultOverrideFromHeaders(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if ok {
+			ctx = service.WithFaultOverride(ctx, override)
+		}
+	}
+
+	// Callers send a stable Idempotency-Key across retries so an ambiguous timeout can't double-charge
+	resp, err := h.paymentService.ProcessCharge(ctx, req, c.GetHeader("Idempotency-Key"))
+	if errors.Is(err, service.ErrChargeInProgress) || errors.Is(err, service.ErrDuplicateOrder) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrMissingOrderID) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	resp, err := h.paymentService.ProcessCharge(c.Request.Context(), req)
+	if errors.Is(err, service.ErrAmountPrecision) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrGatewayBusy) {
+		// Transient: the order service retries 503s, so saturation propagates up the chain as backpressure
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -50,7 +104,78 @@ func (h *PaymentHandler) Charge(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// applyDeadline honors the caller's X-Deadline-Unix-Ms, rejecting requests that expired before arrival
+// Deadlines up to skewTolerance in the past are still admitted, since host clocks are never perfectly in sync
+func (h *PaymentHandler) applyDeadline(c *gin.Context) (context.Context, context.CancelFunc, bool) {
+	ctx := c.Request.Context()
+	raw := c.GetHeader("X-Deadline-Unix-Ms")
+	if raw == "" {
+		return ctx, func() {}, true
+	}
+
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("X-Deadline-Unix-Ms: expected Unix milliseconds, got %q", raw)})
+		return nil, nil, false
+	}
+
+	span := trace.SpanFromContext(ctx)
+	deadline := time.UnixMilli(ms)
+	remaining := time.Until(deadline)
+	span.SetAttributes(attribute.Int64("deadline.remaining_ms", remaining.Milliseconds()))
+
+	if remaining <= 0 {
+		if -remaining > h.skewTolerance {
+			span.SetAttributes(attribute.Bool("deadline.expired_on_arrival", true))
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "deadline expired before arrival"})
+			return nil, nil, false
+		}
+		// Within tolerance: likely clock skew rather than a genuinely expired request
+		span.SetAttributes(
+			attribute.Bool("deadline.skew_tolerance_applied", true),
+			attribute.Int64("deadline.skew_tolerance_ms", h.skewTolerance.Milliseconds()),
+		)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline.Add(h.skewTolerance))
+	return ctx, cancel, true
+}
+
+// faultOverrideFromHeaders parses X-Fault-Delay-Ms and X-Fault-Error into a per-request fault override
+func faultOverrideFromHeaders(c *gin.Context) (service.FaultOverride, bool, error) {
+	var override service.FaultOverride
+	delay, fail := c.GetHeader("X-Fault-Delay-Ms"), c.GetHeader("X-Fault-Error")
+	if delay == "" && fail == "" {
+		return override, false, nil
+	}
+
+	if delay != "" {
+		ms, err := strconv.Atoi(delay)
+		if err != nil || ms < 0 {
+			return override, false, fmt.Errorf("X-Fault-Delay-Ms: expected a non-negative integer, got %q", delay)
+		}
+		override.DelayMS = ms
+	}
+	if fail != "" {
+		b, err := strconv.ParseBool(fail)
+		if err != nil {
+			return override, false, fmt.Errorf("X-Fault-Error: expected a boolean, got %q", fail)
+		}
+		override.Error = b
+	}
+	return override, true, nil
+}
+
 // Health handles GET /health
 func (h *PaymentHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 }
+
+// rejectInvalidAmount responds 422 if the amount is NaN, infinite or negative zero
+func rejectInvalidAmount(c *gin.Context, amount float64) bool {
+	if err := service.ValidateAmount(amount); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/demo/payment-service/internal/config"
+	"github.com/demo/payment-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newChargeRouter serves POST /charge from a payment service built from cfg
+func newChargeRouter(cfg *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/charge", NewPaymentHandler(service.NewPaymentService(cfg), cfg).Charge)
+	return router
+}
+
+func TestChargeRejectsNonFiniteAmounts(t *testing.T) {
+	tests := []struct {
+		amount     string // Raw JSON for the amount field
+		wantStatus int
+	}{
+		{amount: `-0`, wantStatus: http.StatusUnprocessableEntity},
+		{amount: `-0.0`, wantStatus: http.StatusUnprocessableEntity},
+		{amount: `1e999`, wantStatus: http.StatusUnprocessableEntity}, // Overflows to +Inf
+		{amount: `-1e999`, wantStatus: http.StatusUnprocessableEntity},
+		{amount: `"NaN"`, wantStatus: http.StatusBadRequest},
+		{amount: `"Infinity"`, wantStatus: http.StatusBadRequest},
+		{amount: `0`, wantStatus: http.StatusBadRequest}, // Ordinary zero is left to binding's gt=0
+		{amount: `19.99`, wantStatus: http.StatusOK},
+	}
+	router := newChargeRouter(config.Default())
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			body := `{"order_id":"order-1","merchant_id":"merchant_123","currency":"USD","amount":` + tt.amount + `}`
+			req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestFaultHeadersApplyOnlyToFlaggedRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowHeaders bool
+		headers      map[string]string
+		wantStatus   int
+		wantDelay    time.Duration // Least time the flagged request should take
+	}{
+		{name: "error header fails the request", allowHeaders: true, headers: map[string]string{"X-Fault-Error": "true"}, wantStatus: http.StatusInternalServerError},
+		{name: "delay header slows the request", allowHeaders: true, headers: map[string]string{"X-Fault-Delay-Ms": "100"}, wantStatus: http.StatusOK, wantDelay: 100 * time.Millisecond},
+		{name: "delay then error", allowHeaders: true, headers: map[string]string{"X-Fault-Delay-Ms": "100", "X-Fault-Error": "1"}, wantStatus: http.StatusInternalServerError, wantDelay: 100 * time.Millisecond},
+		{name: "error header false is a no-op", allowHeaders: true, headers: map[string]string{"X-Fault-Error": "false"}, wantStatus: http.StatusOK},
+		{name: "malformed delay is rejected", allowHeaders: true, headers: map[string]string{"X-Fault-Delay-Ms": "-5"}, wantStatus: http.StatusBadRequest},
+		{name: "headers ignored unless allowed", headers: map[string]string{"X-Fault-Error": "true", "X-Fault-Delay-Ms": "100"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Faults.AllowHeaders = tt.allowHeaders
+			router := newChargeRouter(cfg)
+
+			// charge sends one charge for its own order, with the given debug headers
+			charge := func(orderID string, headers map[string]string) (int, time.Duration) {
+				body := fmt.Sprintf(`{"order_id":%q,"merchant_id":"merchant_123","currency":"USD","amount":19.99}`, orderID)
+				req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				for k, v := range headers {
+					req.Header.Set(k, v)
+				}
+				rec := httptest.NewRecorder()
+				start := time.Now()
+				router.ServeHTTP(rec, req)
+				return rec.Code, time.Since(start)
+			}
+
+			status, elapsed := charge("order-flagged", tt.headers)
+			if status != tt.wantStatus {
+				t.Errorf("flagged request status = %d, want %d", status, tt.wantStatus)
+			}
+			if elapsed < tt.wantDelay {
+				t.Errorf("flagged request took %v, want at least %v", elapsed, tt.wantDelay)
+			}
+
+			// Neighbouring traffic on the same service is untouched
+			status, elapsed = charge("order-unflagged", nil)
+			if status != http.StatusOK {
+				t.Errorf("unflagged request status = %d, want 200", status)
+			}
+			if elapsed >= 100*time.Millisecond {
+				t.Errorf("unflagged request took %v, want no injected delay", elapsed)
+			}
+		})
+	}
+}
+
+func TestDeadlineSkewTolerance(t *testing.T) {
+	tests := []struct {
+		name         string
+		tolerance    time.Duration
+		deadline     time.Duration // Relative to arrival, negative when the caller's clock runs behind ours
+		wantAdmitted bool
+		wantStatus   int  // Response when refused
+		wantApplied  bool // deadline.skew_tolerance_applied recorded
+	}{
+		{name: "future deadline", tolerance: 100 * time.Millisecond, deadline: time.Second, wantAdmitted: true},
+		{name: "skew within tolerance", tolerance: 100 * time.Millisecond, deadline: -50 * time.Millisecond, wantAdmitted: true, wantApplied: true},
+		{name: "skew beyond tolerance", tolerance: 100 * time.Millisecond, deadline: -500 * time.Millisecond, wantStatus: http.StatusGatewayTimeout},
+		{name: "no tolerance", deadline: -50 * time.Millisecond, wantStatus: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.DeadlineSkewTolerance = tt.tolerance
+			h := NewPaymentHandler(service.NewPaymentService(cfg), cfg)
+
+			recorder := tracetest.NewSpanRecorder()
+			reqCtx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "charge")
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/charge", nil).WithContext(reqCtx)
+			deadline := time.Now().Add(tt.deadline)
+			c.Request.Header.Set("X-Deadline-Unix-Ms", strconv.FormatInt(deadline.UnixMilli(), 10))
+
+			ctx, cancel, admitted := h.applyDeadline(c)
+			span.End()
+			if admitted != tt.wantAdmitted {
+				t.Fatalf("admitted = %v, want %v", admitted, tt.wantAdmitted)
+			}
+			if admitted {
+				defer cancel()
+				// Work gets the tolerance on top of the caller's deadline, so skew can't cut it short either
+				got, ok := ctx.Deadline()
+				want := deadline.Truncate(time.Millisecond).Add(tt.tolerance)
+				if !ok || got.Sub(want).Abs() > time.Millisecond {
+					t.Errorf("context deadline = %v, want %v", got, want)
+				}
+			} else if c.Writer.Status() != tt.wantStatus {
+				t.Errorf("status = %d, want %d", c.Writer.Status(), tt.wantStatus)
+			}
+
+			attrs := make(map[attribute.Key]attribute.Value)
+			for _, kv := range recorder.Ended()[0].Attributes() {
+				attrs[kv.Key] = kv.Value
+			}
+			if got := attrs["deadline.skew_tolerance_applied"].AsBool(); got != tt.wantApplied {
+				t.Errorf("deadline.skew_tolerance_applied = %v, want %v", got, tt.wantApplied)
+			}
+			if got := attrs["deadline.expired_on_arrival"].AsBool(); got != !tt.wantAdmitted {
+				t.Errorf("deadline.expired_on_arrival = %v, want %v", got, !tt.wantAdmitted)
+			}
+		})
+	}
+}
+
+func TestChargeInProgressConflict(t *testing.T) {
+	cfg := config.Default()
+	cfg.Faults.DelayMS = 200
+	cfg.IdempotencyWaitTimeout = 20 * time.Millisecond
+	router := newChargeRouter(cfg)
+
+	// charge sends the same keyed charge as every other call
+	charge := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(`{"order_id":"order-1","merchant_id":"merchant_123","currency":"USD","amount":19.99}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "order:order-1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	leader := make(chan int)
+	go func() { leader <- charge() }()
+	time.Sleep(50 * time.Millisecond)
+	if status := charge(); status != http.StatusConflict {
+		t.Errorf("duplicate during a slow charge = %d, want 409", status)
+	}
+	if status := <-leader; status != http.StatusOK {
+		t.Errorf("original charge = %d, want 200", status)
+	}
+	if status := charge(); status != http.StatusOK {
+		t.Errorf("duplicate after the charge completed = %d, want the 200 replayed", status)
+	}
+}
+
+func TestChargeGatewayBusy(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		wantBusy      bool
+	}{
+		{name: "saturated gateway answers 503", maxConcurrent: 1, wantBusy: true},
+		{name: "unbounded gateway admits every charge", maxConcurrent: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Gateway.MaxConcurrent = tt.maxConcurrent
+			server := httptest.NewServer(newChargeRouter(cfg))
+			defer server.Close()
+
+			// A burst of charges arriving together, each holding the gateway for its simulated latency
+			const burst = 8
+			type reply struct {
+				status int
+				body   string
+			}
+			replies := make(chan reply, burst)
+			var wg sync.WaitGroup
+			for i := 0; i < burst; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					body := fmt.Sprintf(`{"order_id":"order-%d","merchant_id":"merchant_123","currency":"USD","amount":10}`, i)
+					resp, err := http.Post(server.URL+"/charge", "application/json", strings.NewReader(body))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					defer resp.Body.Close()
+					raw, _ := io.ReadAll(resp.Body)
+					replies <- reply{resp.StatusCode, string(raw)}
+				}(i)
+			}
+			wg.Wait()
+			close(replies)
+
+			busy := 0
+			for r := range replies {
+				switch r.status {
+				case http.StatusOK:
+				case http.StatusServiceUnavailable:
+					busy++
+					if !strings.Contains(r.body, "payment gateway busy") {
+						t.Errorf("503 body = %s, want the gateway-busy error", r.body)
+					}
+				default:
+					t.Errorf("status = %d, want 200 or 503; body %s", r.status, r.body)
+				}
+			}
+			if (busy > 0) != tt.wantBusy || busy == burst {
+				t.Errorf("%d of %d charges rejected as busy, want busy %v with at least one admitted", busy, burst, tt.wantBusy)
+			}
+		})
+	}
+}
+
+func TestChargeMissingOrderID(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		orderID    string // Omitted from the body when empty
+		wantStatus int
+		wantError  string // Substring of the error returned
+	}{
+		{name: "reject explains what's missing", policy: service.MissingOrderIDReject, wantStatus: http.StatusBadRequest,
+			wantError: "order service must send the ID of the order being charged"},
+		{name: "generate charges anyway", policy: service.MissingOrderIDGenerate, wantStatus: http.StatusOK},
+		{name: "present ID under reject", policy: service.MissingOrderIDReject, orderID: "order-1", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.MissingOrderIDPolicy = tt.policy
+			server := httptest.NewServer(newChargeRouter(cfg))
+			defer server.Close()
+
+			body := `{"merchant_id":"merchant_123","currency":"USD","amount":10}`
+			if tt.orderID != "" {
+				body = `{"order_id":"` + tt.orderID + `","merchant_id":"merchant_123","currency":"USD","amount":10}`
+			}
+			resp, err := http.Post(server.URL+"/charge", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("POST /charge = %d %s, want %d", resp.StatusCode, got, tt.wantStatus)
+			}
+			if !strings.Contains(string(got), tt.wantError) {
+				t.Errorf("body %s doesn't explain the error %q", got, tt.wantError)
+			}
+		})
+	}
+}
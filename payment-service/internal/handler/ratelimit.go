@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateLimiter admits at most limit requests per fixed window and advertises the remaining budget
+// via X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset so clients can self-throttle
+// In production, share the counter through Redis so the limit spans replicas
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int
+}
+
+// NewRateLimiter creates a limiter admitting limit requests per window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+	}
+}
+
+// take consumes one request from the current window
+// Returns whether it was admitted, the requests left afterwards and the time until the window resets
+func (l *RateLimiter) take() (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.used = 0
+	}
+	reset := l.windowStart.Add(l.window).Sub(now)
+
+	if l.used >= l.limit {
+		return false, 0, reset
+	}
+	l.used++
+	return true, l.limit - l.used, reset
+}
+
+// Middleware sets the X-RateLimit-* headers on every response and rejects requests over the limit with 429
+// X-RateLimit-Reset is the number of seconds until the window resets, rounded up
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admitted, remaining, reset := l.take()
+		resetSeconds := strconv.Itoa(int(math.Ceil(reset.Seconds())))
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(l.limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", resetSeconds)
+
+		span := trace.SpanFromContext(c.Request.Context())
+		span.SetAttributes(attribute.Int("ratelimit.remaining", remaining))
+
+		if !admitted {
+			span.SetAttributes(attribute.Bool("ratelimit.limited", true))
+			c.Header("Retry-After", resetSeconds)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
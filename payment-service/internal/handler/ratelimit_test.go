@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterHeaders(t *testing.T) {
+	type response struct {
+		status    int
+		remaining string
+	}
+	tests := []struct {
+		name     string
+		limit    int
+		window   time.Duration
+		pauseAt  int // Request before which the test waits out the window; 0 never waits
+		requests int
+		want     []response
+	}{
+		{name: "remaining decrements to the limit", limit: 3, window: time.Minute, requests: 5, want: []response{
+			{http.StatusOK, "2"}, {http.StatusOK, "1"}, {http.StatusOK, "0"},
+			{http.StatusTooManyRequests, "0"}, {http.StatusTooManyRequests, "0"},
+		}},
+		{name: "budget restored once the window resets", limit: 1, window: 50 * time.Millisecond, pauseAt: 2, requests: 3, want: []response{
+			{http.StatusOK, "0"}, {http.StatusTooManyRequests, "0"}, {http.StatusOK, "0"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/charge", NewRateLimiter(tt.limit, tt.window).Middleware(), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"status": "success"})
+			})
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			windowSeconds := int(math.Ceil(tt.window.Seconds()))
+			for i, want := range tt.want {
+				if tt.pauseAt > 0 && i == tt.pauseAt {
+					time.Sleep(tt.window)
+				}
+				resp, err := http.Post(server.URL+"/charge", "application/json", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+
+				if resp.StatusCode != want.status {
+					t.Errorf("request %d: status = %d, want %d", i, resp.StatusCode, want.status)
+				}
+				if got := resp.Header.Get("X-RateLimit-Limit"); got != strconv.Itoa(tt.limit) {
+					t.Errorf("request %d: X-RateLimit-Limit = %q, want %d", i, got, tt.limit)
+				}
+				if got := resp.Header.Get("X-RateLimit-Remaining"); got != want.remaining {
+					t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i, got, want.remaining)
+				}
+				reset, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+				if err != nil || reset < 0 || reset > windowSeconds {
+					t.Errorf("request %d: X-RateLimit-Reset = %q, want seconds within the %s window", i, resp.Header.Get("X-RateLimit-Reset"), tt.window)
+				}
+				if limited := resp.Header.Get("Retry-After") != ""; limited != (want.status == http.StatusTooManyRequests) {
+					t.Errorf("request %d: Retry-After = %q, want it only on 429", i, resp.Header.Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/demo/payment-service/internal/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+// Version handles GET /version, reporting which build is running for deploy verification
+func Version(service string) gin.HandlerFunc {
+	info := buildinfo.Get(service)
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, info)
+	}
+}
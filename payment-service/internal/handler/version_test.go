@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/demo/payment-service/internal/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+func TestVersionReportsBuildFields(t *testing.T) {
+	defer func(v, c string) { buildinfo.Version, buildinfo.Commit = v, c }(buildinfo.Version, buildinfo.Commit)
+	buildinfo.Version, buildinfo.Commit = "2.0.1", "52558a2"
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/version", Version("payment-service"))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/version")
+	if err != nil {
+		t.Fatalf("GET /version: %v", err)
+	}
+	defer resp.Body.Close()
+	var info buildinfo.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+
+	tests := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{field: "service", got: info.Service, want: "payment-service"},
+		{field: "version", got: info.Version, want: "2.0.1"},
+		{field: "commit", got: info.Commit, want: "52558a2"},
+		{field: "build_time", got: info.BuildTime, want: "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+	if info.GoVersion == "" {
+		t.Error("go_version is empty")
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessChargeAmountPrecision(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		amount       float64
+		wantErr      error
+		wantAmount   float64
+		wantAdjusted bool // amount.original and amount.adjusted are on the span
+	}{
+		{name: "allow", mode: PrecisionAllow, amount: 12.345, wantAmount: 12.345},
+		{name: "reject", mode: PrecisionReject, amount: 12.345, wantErr: ErrAmountPrecision},
+		{name: "round half even", mode: PrecisionRoundHalfEven, amount: 12.345, wantAmount: 12.34, wantAdjusted: true},
+		{name: "round half even away from a tie", mode: PrecisionRoundHalfEven, amount: 12.3451, wantAmount: 12.35, wantAdjusted: true},
+		{name: "truncate", mode: PrecisionTruncate, amount: 12.349, wantAmount: 12.34, wantAdjusted: true},
+		{name: "rounded to zero", mode: PrecisionRoundHalfEven, amount: 0.004, wantErr: ErrAmountPrecision},
+		{name: "exact amount under reject", mode: PrecisionReject, amount: 12.34, wantAmount: 12.34},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.AmountPrecisionMode = tt.mode
+			cfg.AmountDecimals = 2
+			svc := NewPaymentService(cfg)
+			svc.errorPercentage = 0
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			req := ChargeRequest{OrderID: "order-1", MerchantID: "merchant_123", Amount: tt.amount, Currency: "USD"}
+			resp, err := svc.ProcessCharge(context.Background(), req, "key-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessCharge() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && resp.Amount != tt.wantAmount {
+				t.Errorf("charged %v, want %v", resp.Amount, tt.wantAmount)
+			}
+
+			attrs := map[string]float64{}
+			var mode string
+			for _, span := range recorder.Ended() {
+				if span.Name() != "processCharge" {
+					continue
+				}
+				for _, kv := range span.Attributes() {
+					switch kv.Key {
+					case "amount.original", "amount.adjusted":
+						attrs[string(kv.Key)] = kv.Value.AsFloat64()
+					case "amount.precision_mode":
+						mode = kv.Value.AsString()
+					}
+				}
+			}
+			if tt.wantAdjusted {
+				if attrs["amount.original"] != tt.amount || attrs["amount.adjusted"] != tt.wantAmount {
+					t.Errorf("span amount.original = %v, amount.adjusted = %v, want %v and %v",
+						attrs["amount.original"], attrs["amount.adjusted"], tt.amount, tt.wantAmount)
+				}
+			} else if len(attrs) > 0 {
+				t.Errorf("span has %v for an unadjusted amount", attrs)
+			}
+			if (tt.wantAdjusted || tt.wantErr != nil) && mode != tt.mode {
+				t.Errorf("amount.precision_mode = %q, want %q", mode, tt.mode)
+			}
+		})
+	}
+}
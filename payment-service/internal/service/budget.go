@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Budget is the time a downstream call may use, derived from the caller's propagated deadline
+// A zero Deadline means the caller set no budget
+type Budget struct {
+	Deadline time.Time
+}
+
+// BudgetFromContext returns the budget left on ctx, e.g. from the caller's X-Deadline-Unix-Ms
+func BudgetFromContext(ctx context.Context) Budget {
+	deadline, _ := ctx.Deadline()
+	return Budget{Deadline: deadline}
+}
+
+// Set reports whether the caller propagated a budget
+func (b Budget) Set() bool {
+	return !b.Deadline.IsZero()
+}
+
+// Remaining returns the time left before the deadline, which may be negative
+func (b Budget) Remaining() time.Duration {
+	return time.Until(b.Deadline)
+}
+
+// Reserve holds back overhead for our own work after the downstream call returns, so the reply still makes the deadline
+func (b Budget) Reserve(overhead time.Duration) Budget {
+	if !b.Set() {
+		return b
+	}
+	return Budget{Deadline: b.Deadline.Add(-overhead)}
+}
+
+// Context bounds ctx by the budget, or by fallback alone when no budget was propagated
+// The tighter of the two wins, so a generous caller can't stretch a call past its own timeout
+func (b Budget) Context(ctx context.Context, fallback time.Duration) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(fallback)
+	if b.Set() && b.Deadline.Before(deadline) {
+		deadline = b.Deadline
+	}
+	return context.WithDeadline(ctx, deadline)
+}
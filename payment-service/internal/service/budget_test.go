@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/demo/payment-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGatewayCallRespectsRemainingBudget(t *testing.T) {
+	tests := []struct {
+		name          string
+		budget        time.Duration // Caller's remaining budget; 0 propagates none
+		reserve       time.Duration
+		timeout       time.Duration
+		wantGatewayMs [2]int64 // Bounds on the deadline given to the gateway call
+		wantExhausted bool
+	}{
+		{name: "no budget uses the gateway timeout", reserve: 10 * time.Millisecond, timeout: time.Second, wantGatewayMs: [2]int64{950, 1000}},
+		{name: "budget less the reserve", budget: 500 * time.Millisecond, reserve: 100 * time.Millisecond, timeout: time.Second, wantGatewayMs: [2]int64{350, 400}},
+		{name: "timeout tighter than the budget", budget: 5 * time.Second, reserve: 100 * time.Millisecond, timeout: 300 * time.Millisecond, wantGatewayMs: [2]int64{250, 300}},
+		{name: "budget too small for the call", budget: 15 * time.Millisecond, reserve: 10 * time.Millisecond, timeout: time.Second, wantGatewayMs: [2]int64{0, 5}, wantExhausted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Gateway.BudgetReserve = tt.reserve
+			cfg.Gateway.Timeout = tt.timeout
+			svc := NewPaymentService(cfg)
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			ctx := context.Background()
+			if tt.budget > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.budget)
+				defer cancel()
+			}
+			_, err := svc.callPaymentGateway(ctx, ChargeRequest{OrderID: "order-1", MerchantID: "merchant_1", Amount: 10, Currency: "USD"})
+			if tt.wantExhausted != errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("callPaymentGateway() error = %v, want budget exhausted %v", err, tt.wantExhausted)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			attrs := make(map[string]int64)
+			exhausted := false
+			for _, kv := range spans[0].Attributes() {
+				switch kv.Key {
+				case "budget.gateway_ms", "budget.remaining_ms":
+					attrs[string(kv.Key)] = kv.Value.AsInt64()
+				case "budget.exhausted":
+					exhausted = kv.Value.AsBool()
+				}
+			}
+			if got := attrs["budget.gateway_ms"]; got < tt.wantGatewayMs[0] || got > tt.wantGatewayMs[1] {
+				t.Errorf("budget.gateway_ms = %d, want within %v", got, tt.wantGatewayMs)
+			}
+			if _, ok := attrs["budget.remaining_ms"]; ok != (tt.budget > 0) {
+				t.Errorf("budget.remaining_ms recorded = %v, want %v", ok, tt.budget > 0)
+			}
+			if exhausted != tt.wantExhausted {
+				t.Errorf("budget.exhausted = %v, want %v", exhausted, tt.wantExhausted)
+			}
+		})
+	}
+}
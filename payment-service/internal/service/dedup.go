@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// chargeDedupTTL is how long a completed charge is remembered for replay
+const chargeDedupTTL = 24 * time.Hour
+
+// ErrChargeInProgress is returned when a duplicate charge gave up waiting for the original to finish
+var ErrChargeInProgress = errors.New("charge with this idempotency key is still in progress")
+
+// DedupOutcome describes how a call to ChargeDeduper.Do was resolved
+type DedupOutcome string
+
+const (
+	DedupLeader      DedupOutcome = "leader"       // This call executed the charge
+	DedupReplayed    DedupOutcome = "replayed"     // Result of an earlier or concurrent charge was reused
+	DedupWaitTimeout DedupOutcome = "wait_timeout" // Gave up waiting for a concurrent charge
+)
+
+// ChargeDeduper ensures a charge is executed at most once per idempotency key
+// A retry that arrives while the original is still in flight waits up to waitTimeout for its result instead of charging again
+// In production, use Redis or a database so dedup survives restarts and spans replicas
+type ChargeDeduper struct {
+	mu          sync.Mutex
+	entries     map[string]*chargeEntry
+	waitTimeout time.Duration
+}
+
+// chargeEntry tracks one charge attempt; done is closed once resp/err are set
+type chargeEntry struct {
+	done        chan struct{}
+	resp        *ChargeResponse
+	err         error
+	completedAt time.Time
+}
+
+// NewChargeDeduper creates an in-memory charge deduplicator
+// Duplicates wait at most waitTimeout for an in-flight charge before failing with ErrChargeInProgress
+func NewChargeDeduper(waitTimeout time.Duration) *ChargeDeduper {
+	d := &ChargeDeduper{
+		entries:     make(map[string]*chargeEntry),
+		waitTimeout: waitTimeout,
+	}
+
+	// Start background cleanup goroutine to prevent memory leaks
+	go d.cleanup()
+
+	return d
+}
+
+// Do runs charge once per key and returns its result to every caller presenting the same key
+// Failed charges are forgotten so a later retry can try again
+func (d *ChargeDeduper) Do(key string, charge func() (*ChargeResponse, error)) (*ChargeResponse, DedupOutcome, error) {
+	d.mu.Lock()
+	if entry, exists := d.entries[key]; exists {
+		d.mu.Unlock()
+
+		timer := time.NewTimer(d.waitTimeout)
+		defer timer.Stop()
+		select {
+		case <-entry.done:
+		case <-timer.C:
+			// The original is slow; let the caller retry later rather than hold a connection open
+			return nil, DedupWaitTimeout, ErrChargeInProgress
+		}
+
+		if entry.err == nil {
+			return entry.resp, DedupReplayed, nil
+		}
+		// The original failed and was discarded; retry as a fresh charge
+		return d.Do(key, charge)
+	}
+
+	entry := &chargeEntry{done: make(chan struct{})}
+	d.entries[key] = entry
+	d.mu.Unlock()
+
+	entry.resp, entry.err = charge()
+	entry.completedAt = time.Now()
+
+	d.mu.Lock()
+	if entry.err != nil {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+	close(entry.done)
+
+	return entry.resp, DedupLeader, entry.err
+}
+
+// cleanup removes completed entries older than chargeDedupTTL to prevent unbounded growth
+func (d *ChargeDeduper) cleanup() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.mu.Lock()
+		cutoff := time.Now().Add(-chargeDedupTTL)
+		for key, entry := range d.entries {
+			select {
+			case <-entry.done:
+				if entry.completedAt.Before(cutoff) {
+					delete(d.entries, key)
+				}
+			default:
+				// Still in flight
+			}
+		}
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demo/payment-service/internal/config"
+)
+
+func TestRetriedChargeChargesOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		concurrent bool // Retries arrive while the first attempt is still charging, as after a client timeout
+		retries    int
+	}{
+		{name: "retries after the first attempt completed", retries: 3},
+		{name: "retries while the first attempt is in flight", concurrent: true, retries: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Faults.DelayMS = 50 // Keeps the first attempt in flight while concurrent retries arrive
+			svc := NewPaymentService(cfg)
+			req := ChargeRequest{OrderID: "order-1", MerchantID: "merchant_123", Amount: 10, Currency: "USD"}
+			const key = "order:order-1"
+
+			first, err := svc.ProcessCharge(context.Background(), req, key)
+			if !tt.concurrent && err != nil {
+				t.Fatal(err)
+			}
+
+			results := make([]*ChargeResponse, tt.retries)
+			var wg sync.WaitGroup
+			charge := func(i int) {
+				defer wg.Done()
+				resp, err := svc.ProcessCharge(context.Background(), req, key)
+				if err != nil {
+					t.Errorf("retry %d: %v", i, err)
+				}
+				results[i] = resp
+			}
+			if tt.concurrent {
+				first = nil
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					first, _ = svc.ProcessCharge(context.Background(), req, key)
+				}()
+				time.Sleep(10 * time.Millisecond)
+			}
+			for i := range results {
+				wg.Add(1)
+				go charge(i)
+			}
+			wg.Wait()
+
+			if first == nil {
+				t.Fatal("first attempt returned no charge")
+			}
+			for i, resp := range results {
+				if resp == nil || resp.TransactionID != first.TransactionID {
+					t.Errorf("retry %d = %+v, want the original transaction %s replayed", i, resp, first.TransactionID)
+				}
+			}
+		})
+	}
+}
+
+func TestChargeDeduperWaitTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		leaderDelay time.Duration
+		leaderErr   error
+		waitTimeout time.Duration
+		wantOutcome DedupOutcome
+		wantErr     error
+		wantCharges int32
+	}{
+		{name: "waiter times out on a slow leader", leaderDelay: 200 * time.Millisecond, waitTimeout: 20 * time.Millisecond,
+			wantOutcome: DedupWaitTimeout, wantErr: ErrChargeInProgress, wantCharges: 1},
+		{name: "waiter replays a leader finishing in time", leaderDelay: 20 * time.Millisecond, waitTimeout: 200 * time.Millisecond,
+			wantOutcome: DedupReplayed, wantCharges: 1},
+		{name: "waiter charges afresh after a failed leader", leaderDelay: 20 * time.Millisecond, leaderErr: errors.New("gateway error"), waitTimeout: 200 * time.Millisecond,
+			wantOutcome: DedupLeader, wantCharges: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewChargeDeduper(tt.waitTimeout)
+			var charges atomic.Int32
+			started := make(chan struct{})
+			leaderDone := make(chan struct{})
+			go func() {
+				defer close(leaderDone)
+				d.Do("key", func() (*ChargeResponse, error) {
+					charges.Add(1)
+					close(started)
+					time.Sleep(tt.leaderDelay)
+					return &ChargeResponse{TransactionID: "txn-leader"}, tt.leaderErr
+				})
+			}()
+			<-started
+
+			begin := time.Now()
+			resp, outcome, err := d.Do("key", func() (*ChargeResponse, error) {
+				charges.Add(1)
+				return &ChargeResponse{TransactionID: "txn-waiter"}, nil
+			})
+			waited := time.Since(begin)
+			<-leaderDone
+
+			if outcome != tt.wantOutcome || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() = %q, %v; want %q, %v", outcome, err, tt.wantOutcome, tt.wantErr)
+			}
+			if tt.wantOutcome == DedupReplayed && (resp == nil || resp.TransactionID != "txn-leader") {
+				t.Errorf("replayed %+v, want the leader's transaction", resp)
+			}
+			if tt.wantOutcome == DedupWaitTimeout && waited >= tt.leaderDelay {
+				t.Errorf("waited %v, want to give up after about %v rather than wait out the leader", waited, tt.waitTimeout)
+			}
+			if got := charges.Load(); got != tt.wantCharges {
+				t.Errorf("charges = %d, want %d", got, tt.wantCharges)
+			}
+		})
+	}
+}
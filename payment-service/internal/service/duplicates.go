@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrDuplicateOrder is returned when a charge repeats an order ID already charged and the policy is reject
+var ErrDuplicateOrder = errors.New("order already charged")
+
+// Duplicate order policies, chosen with DUPLICATE_ORDER_POLICY
+const (
+	DuplicateOrderAllow  = "allow"  // Order IDs aren't tracked
+	DuplicateOrderWarn   = "warn"   // Duplicates are logged and counted, then charged
+	DuplicateOrderReject = "reject" // Duplicates are logged, counted and refused with ErrDuplicateOrder
+)
+
+// orderLedger remembers which order IDs have been charged, as a last line of defence for charges the
+// idempotency key doesn't dedup: charges sent without a key, or the same order sent under a new key
+// In production, use Redis or a database so the ledger survives restarts and spans replicas
+type orderLedger struct {
+	mu      sync.Mutex
+	charged map[string]time.Time // Order ID → when its charge started
+	policy  string
+
+	duplicates metric.Int64Counter
+}
+
+// newOrderLedger creates a ledger applying policy; the allow policy returns nil, which tracks nothing
+func newOrderLedger(policy string) *orderLedger {
+	if policy == DuplicateOrderAllow {
+		return nil
+	}
+	duplicates, _ := otel.Meter("payment-service").Int64Counter("payment.duplicate_orders",
+		metric.WithDescription("Charges for an order ID that was already charged, by policy"))
+	l := &orderLedger{
+		charged:    make(map[string]time.Time),
+		policy:     policy,
+		duplicates: duplicates,
+	}
+
+	// Start background cleanup goroutine to prevent memory leaks
+	go l.cleanup()
+
+	return l
+}
+
+// claim records the order as charged and reports whether this call did so; a duplicate is logged, counted and,
+// under the reject policy, refused. In-flight charges count, so two concurrent duplicates can't both pass
+func (l *orderLedger) claim(ctx context.Context, span trace.Span, orderID string) (bool, error) {
+	if l == nil {
+		return false, nil
+	}
+
+	l.mu.Lock()
+	first, exists := l.charged[orderID]
+	if !exists {
+		l.charged[orderID] = time.Now()
+	}
+	l.mu.Unlock()
+	if !exists {
+		return true, nil
+	}
+
+	log.Printf("WARNING: duplicate charge for order %s, first charged %s ago (policy %s)", orderID, time.Since(first).Round(time.Millisecond), l.policy)
+	span.SetAttributes(
+		attribute.Bool("order.duplicate", true),
+		attribute.String("order.duplicate_policy", l.policy),
+	)
+	l.duplicates.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("policy", l.policy)))
+	if l.policy == DuplicateOrderReject {
+		return false, ErrDuplicateOrder
+	}
+	return false, nil
+}
+
+// release forgets a claimed order whose charge failed, so it can be charged again
+func (l *orderLedger) release(orderID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.charged, orderID)
+}
+
+// cleanup forgets orders charged longer ago than chargeDedupTTL, matching the idempotency key retention
+func (l *orderLedger) cleanup() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-chargeDedupTTL)
+		l.mu.Lock()
+		for orderID, at := range l.charged {
+			if at.Before(cutoff) {
+				delete(l.charged, orderID)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDuplicateOrderPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		firstFails    bool // The first charge fails, so its order ID is free to charge again
+		wantErr       error
+		wantDuplicate bool // order.duplicate on the second charge's span
+	}{
+		{name: "allow charges again unnoticed", policy: DuplicateOrderAllow},
+		{name: "warn flags and charges again", policy: DuplicateOrderWarn, wantDuplicate: true},
+		{name: "reject refuses the duplicate", policy: DuplicateOrderReject, wantErr: ErrDuplicateOrder, wantDuplicate: true},
+		{name: "failed first charge isn't a duplicate", policy: DuplicateOrderReject, firstFails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.DuplicateOrderPolicy = tt.policy
+			svc := NewPaymentService(cfg)
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// Sent without idempotency keys, so nothing but the order ID ties the two charges together
+			req := ChargeRequest{OrderID: "order-1", MerchantID: "merchant_123", Amount: 10, Currency: "USD"}
+			if tt.firstFails {
+				svc.errorPercentage = 100
+			}
+			if _, err := svc.ProcessCharge(context.Background(), req, ""); (err != nil) != tt.firstFails {
+				t.Fatalf("first charge error = %v, want failure %v", err, tt.firstFails)
+			}
+			svc.errorPercentage = 0
+
+			resp, err := svc.ProcessCharge(context.Background(), req, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("second charge error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && resp.TransactionID == "" {
+				t.Error("second charge returned no transaction")
+			}
+
+			// Spans are recorded as they end, so the last processCharge is the second charge
+			var duplicate bool
+			var policy string
+			for _, span := range recorder.Ended() {
+				if span.Name() != "processCharge" {
+					continue
+				}
+				duplicate, policy = false, ""
+				for _, kv := range span.Attributes() {
+					switch kv.Key {
+					case "order.duplicate":
+						duplicate = kv.Value.AsBool()
+					case "order.duplicate_policy":
+						policy = kv.Value.AsString()
+					}
+				}
+			}
+			if duplicate != tt.wantDuplicate {
+				t.Errorf("order.duplicate = %v, want %v", duplicate, tt.wantDuplicate)
+			}
+			if tt.wantDuplicate && policy != tt.policy {
+				t.Errorf("order.duplicate_policy = %q, want %q", policy, tt.policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// faultMerchantBuckets is how finely FAULT_MERCHANT_PCT splits merchants; 10000 allows hundredths of a percent
+const faultMerchantBuckets = 10000
+
+// InFaultSubset reports whether the merchant is among the pct percent of merchants that receive injected faults
+// Selection hashes the merchant ID, so the same merchants are faulted on every call and every replica
+func InFaultSubset(merchantID string, pct float64) bool {
+	if pct >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(merchantID))
+	return float64(h.Sum32()%faultMerchantBuckets) < pct*faultMerchantBuckets/100
+}
+
+// FaultOverride injects faults into a single charge, on top of the global fault settings
+// Set from debug headers so chaos experiments can target specific requests in a shared environment
+type FaultOverride struct {
+	DelayMS int  // Extra delay for this request only
+	Error   bool // Fail this request with an injected error
+}
+
+type faultOverrideKey struct{}
+
+// WithFaultOverride returns a context carrying per-request fault overrides
+func WithFaultOverride(ctx context.Context, f FaultOverride) context.Context {
+	return context.WithValue(ctx, faultOverrideKey{}, f)
+}
+
+// FaultOverrideFromContext returns the request's fault overrides, if any
+func FaultOverrideFromContext(ctx context.Context) (FaultOverride, bool) {
+	f, ok := ctx.Value(faultOverrideKey{}).(FaultOverride)
+	return f, ok
+}
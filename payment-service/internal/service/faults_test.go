@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+)
+
+func TestFaultMerchantSubsetIsStable(t *testing.T) {
+	const merchants, rounds = 12, 3
+	tests := []struct {
+		name string
+		pct  float64
+	}{
+		{name: "no merchants", pct: 0},
+		{name: "a third of merchants", pct: 33},
+		{name: "every merchant", pct: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every selected merchant's charge fails, so an error means the merchant was faulted
+			cfg := config.Default()
+			cfg.Faults.ErrorPercentage = 100
+			cfg.Faults.MerchantPercentage = tt.pct
+			svc := NewPaymentService(cfg)
+
+			faulted := make(map[string]bool)
+			for round := 0; round < rounds; round++ {
+				for i := 0; i < merchants; i++ {
+					merchantID := fmt.Sprintf("merchant-%d", i)
+					req := ChargeRequest{OrderID: fmt.Sprintf("order-%d-%d", round, i), MerchantID: merchantID, Amount: 10, Currency: "USD"}
+					_, err := svc.ProcessCharge(context.Background(), req, "")
+					got := err != nil
+					if round > 0 && got != faulted[merchantID] {
+						t.Errorf("round %d: %s faulted = %v, was %v in round 0", round, merchantID, got, faulted[merchantID])
+					}
+					faulted[merchantID] = got
+					if want := InFaultSubset(merchantID, tt.pct); got != want {
+						t.Errorf("round %d: %s faulted = %v, InFaultSubset = %v", round, merchantID, got, want)
+					}
+				}
+			}
+
+			// The hash spreads merchants evenly, so the selected share tracks pct
+			selected := 0
+			const population = 10000
+			for i := 0; i < population; i++ {
+				if InFaultSubset(fmt.Sprintf("m-%d", i), tt.pct) {
+					selected++
+				}
+			}
+			if share := float64(selected) * 100 / population; math.Abs(share-tt.pct) > 2 {
+				t.Errorf("selected %.1f%% of merchants, want about %v%%", share, tt.pct)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrGatewayBusy is returned when the simulated gateway is saturated and no slot freed up in time
+var ErrGatewayBusy = errors.New("payment gateway busy")
+
+// gatewaySlots bounds concurrent calls to the simulated gateway, like a real gateway's per-merchant connection limit
+// A nil *gatewaySlots is unbounded
+type gatewaySlots struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// newGatewaySlots returns a limiter for maxConcurrent calls, or nil when maxConcurrent is 0
+func newGatewaySlots(maxConcurrent int, queueTimeout time.Duration) *gatewaySlots {
+	if maxConcurrent == 0 {
+		return nil
+	}
+	return &gatewaySlots{
+		slots:        make(chan struct{}, maxConcurrent),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire takes a slot, waiting up to queueTimeout (and no longer than ctx allows) when all are taken
+// The returned release must be called once the gateway call finishes
+func (g *gatewaySlots) acquire(ctx context.Context, span trace.Span) (release func(), err error) {
+	if g == nil {
+		return func() {}, nil
+	}
+	release = func() { <-g.slots }
+
+	select {
+	case g.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if g.queueTimeout == 0 {
+		span.SetAttributes(attribute.Bool("gateway.busy", true))
+		return nil, ErrGatewayBusy
+	}
+
+	span.SetAttributes(attribute.Bool("gateway.queued", true))
+	timer := time.NewTimer(g.queueTimeout)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	span.SetAttributes(attribute.Bool("gateway.busy", true))
+	return nil, ErrGatewayBusy
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/demo/payment-service/internal/config"
+)
+
+func TestGatewaySaturation(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		queueTimeout  time.Duration
+		freeAfter     time.Duration // When a held slot frees up; 0 holds every slot for the whole test
+		wantErr       error
+		minWait       time.Duration // Least time the charge should spend before failing
+	}{
+		{name: "unbounded gateway never busy", maxConcurrent: 0},
+		{name: "saturated without a queue rejects at once", maxConcurrent: 2, wantErr: ErrGatewayBusy},
+		{name: "queued until a slot frees up", maxConcurrent: 2, queueTimeout: 500 * time.Millisecond, freeAfter: 20 * time.Millisecond},
+		{name: "queue timeout expires", maxConcurrent: 2, queueTimeout: 50 * time.Millisecond, wantErr: ErrGatewayBusy, minWait: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Gateway.MaxConcurrent = tt.maxConcurrent
+			cfg.Gateway.QueueTimeout = tt.queueTimeout
+			svc := NewPaymentService(cfg)
+
+			// Stand in for calls already holding every slot
+			if svc.gatewaySlots != nil {
+				for i := 0; i < tt.maxConcurrent; i++ {
+					svc.gatewaySlots.slots <- struct{}{}
+				}
+				if tt.freeAfter > 0 {
+					time.AfterFunc(tt.freeAfter, func() { <-svc.gatewaySlots.slots })
+				}
+			}
+
+			start := time.Now()
+			_, err := svc.ProcessCharge(context.Background(), ChargeRequest{OrderID: "order-1", MerchantID: "merchant_1", Amount: 10, Currency: "USD"}, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessCharge() error = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Errorf("failed after %s, want it to wait at least %s for a slot", elapsed, tt.minWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrMissingOrderID is returned for a charge without an order_id when the policy is reject
+var ErrMissingOrderID = errors.New("order_id is required: the order service must send the ID of the order being charged")
+
+// Missing order ID policies, chosen with MISSING_ORDER_ID_POLICY
+const (
+	MissingOrderIDReject   = "reject"   // Refused with ErrMissingOrderID
+	MissingOrderIDGenerate = "generate" // Charged under a generated ID, logged and counted; for partial rollouts of a broken caller
+)
+
+// generatedOrderIDPrefix marks IDs this service made up, so they're never mistaken for the order service's own
+const generatedOrderIDPrefix = "gen_"
+
+// missingOrderIDs counts charges that arrived without an order_id, by policy
+var missingOrderIDs, _ = otel.Meter("payment-service").Int64Counter("payment.missing_order_ids",
+	metric.WithDescription("Charges received without an order_id, by MISSING_ORDER_ID_POLICY"))
+
+// resolveOrderID fills in a charge's missing order ID under the generate policy, or refuses it under reject
+// A generated ID is unique per call, so duplicate order detection can't catch retries of such a charge; only the
+// idempotency key dedups them
+func (s *PaymentService) resolveOrderID(ctx context.Context, span trace.Span, req *ChargeRequest) error {
+	if req.OrderID != "" {
+		return nil
+	}
+	span.SetAttributes(
+		attribute.Bool("order.id_missing", true),
+		attribute.String("order.missing_id_policy", s.missingOrderIDPolicy),
+	)
+	missingOrderIDs.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("policy", s.missingOrderIDPolicy)))
+	if s.missingOrderIDPolicy != MissingOrderIDGenerate {
+		return ErrMissingOrderID
+	}
+
+	req.OrderID = generatedOrderIDPrefix + uuid.New().String()
+	span.SetAttributes(attribute.String("order.id", req.OrderID))
+	log.Printf("WARNING: charge for merchant %s arrived without an order_id; charging it as %s", req.MerchantID, req.OrderID)
+	return nil
+}
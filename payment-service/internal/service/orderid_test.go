@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestResolveMissingOrderID(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		wantErr       error
+		wantGenerated bool
+	}{
+		{name: "reject", policy: MissingOrderIDReject, wantErr: ErrMissingOrderID},
+		{name: "generate", policy: MissingOrderIDGenerate, wantGenerated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.MissingOrderIDPolicy = tt.policy
+			svc := NewPaymentService(cfg)
+			svc.errorPercentage = 0
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			// Two charges, so generated IDs can be told apart
+			for _, key := range []string{"key-1", "key-2"} {
+				_, err := svc.ProcessCharge(context.Background(), ChargeRequest{MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, key)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ProcessCharge() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			var ids []string
+			for _, span := range recorder.Ended() {
+				if span.Name() != "processCharge" {
+					continue
+				}
+				attrs := map[string]string{}
+				for _, kv := range span.Attributes() {
+					attrs[string(kv.Key)] = kv.Value.Emit()
+				}
+				if attrs["order.id_missing"] != "true" || attrs["order.missing_id_policy"] != tt.policy {
+					t.Errorf("span attributes %v don't record the missing ID under %s", attrs, tt.policy)
+				}
+				if id := attrs["order.id"]; strings.HasPrefix(id, generatedOrderIDPrefix) {
+					ids = append(ids, id)
+				}
+			}
+			if !tt.wantGenerated {
+				if len(ids) > 0 || logs.Len() > 0 {
+					t.Errorf("generated %v and logged %q under reject", ids, logs.String())
+				}
+				return
+			}
+			if len(ids) != 2 || ids[0] == ids[1] {
+				t.Errorf("generated IDs = %v, want two distinct %s IDs", ids, generatedOrderIDPrefix)
+			}
+			for _, id := range ids {
+				if !strings.Contains(logs.String(), "charging it as "+id) {
+					t.Errorf("no warning logged for %s: %q", id, logs.String())
+				}
+			}
+		})
+	}
+}
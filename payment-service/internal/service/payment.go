@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"os"
-	"strconv"
 	"time"
 
+	"github.com/demo/payment-service/internal/config"
+	"github.com/demo/payment-service/internal/features"
 	"github.com/demo/payment-service/internal/tracing"
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,23 +20,50 @@ type PaymentService struct {
 	tracer          trace.Tracer
 	delayMS         int     // Artificial delay in milliseconds
 	errorPercentage float64 // Percentage of requests that should error (0-100)
+	faultMerchants  float64 // Percentage of merchants the faults above apply to (0-100)
+	shadow          *ShadowGateway
+	featureFlags    features.Provider
+	dedup           *ChargeDeduper
+	orders          *orderLedger // nil when DUPLICATE_ORDER_POLICY is allow
+	gateway         config.GatewayConfig
+	gatewaySlots    *gatewaySlots // nil when GATEWAY_MAX_CONCURRENT is unbounded
+
+	amountPrecision AmountPrecision // Must match the order service's AMOUNT_PRECISION_MODE and AMOUNT_DECIMALS
+	skipCancelled   bool            // Return at once when the context is already cancelled on entry
+
+	missingOrderIDPolicy string // What happens to charges without an order_id: reject or generate
 }
 
 // NewPaymentService creates a payment service with configurable fault injection
-func NewPaymentService() *PaymentService {
-	delayMS, _ := strconv.Atoi(os.Getenv("PAYMENT_DELAY_MS"))
-	errorPct, _ := strconv.ParseFloat(os.Getenv("PAYMENT_ERROR_PCT"), 64)
-
-	return &PaymentService{
+func NewPaymentService(cfg *config.Config) *PaymentService {
+	svc := &PaymentService{
 		tracer:          tracing.GetTracer("payment-service"),
-		delayMS:         delayMS,
-		errorPercentage: errorPct,
+		delayMS:         cfg.Faults.DelayMS,
+		errorPercentage: cfg.Faults.ErrorPercentage,
+		faultMerchants:  cfg.Faults.MerchantPercentage,
+		featureFlags:    features.NewStaticProvider(cfg.FeatureFlags),
+		dedup:           NewChargeDeduper(cfg.IdempotencyWaitTimeout),
+		orders:          newOrderLedger(cfg.DuplicateOrderPolicy),
+		gateway:         cfg.Gateway,
+		gatewaySlots:    newGatewaySlots(cfg.Gateway.MaxConcurrent, cfg.Gateway.QueueTimeout),
+
+		amountPrecision: AmountPrecision{Mode: cfg.AmountPrecisionMode, Decimals: cfg.AmountDecimals},
+		skipCancelled:   cfg.SkipCancelled,
+
+		missingOrderIDPolicy: cfg.MissingOrderIDPolicy,
 	}
+
+	// Optionally mirror a fraction of charges to a shadow gateway for safe rollout testing
+	if cfg.Shadow.URL != "" {
+		svc.shadow = NewShadowGateway(cfg.Shadow.URL, cfg.Shadow.Percentage, svc.tracer)
+	}
+
+	return svc
 }
 
 // ChargeRequest represents a payment charge request
 type ChargeRequest struct {
-	OrderID    string  `json:"order_id" binding:"required"`
+	OrderID    string  `json:"order_id"` // Required unless MISSING_ORDER_ID_POLICY=generate; see resolveOrderID
 	MerchantID string  `json:"merchant_id" binding:"required"`
 	Amount     float64 `json:"amount" binding:"required,gt=0"`
 	Currency   string  `json:"currency" binding:"required"`
@@ -51,7 +78,14 @@ type ChargeResponse struct {
 }
 
 // ProcessCharge processes a payment charge with instrumentation and fault injection
-func (s *PaymentService) ProcessCharge(ctx context.Context, req ChargeRequest) (*ChargeResponse, error) {
+// Charges carrying an idempotency key are executed at most once; retries replay the original result
+func (s *PaymentService) ProcessCharge(ctx context.Context, req ChargeRequest, idempotencyKey string) (resp *ChargeResponse, err error) {
+	// The caller may have given up before we started; charging now would only risk an orphaned charge
+	if s.skipCancelled && ctx.Err() != nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("ctx.cancelled_at_entry", true))
+		return nil, ctx.Err()
+	}
+
 	ctx, span := s.tracer.Start(ctx, "processCharge",
 		trace.WithAttributes(
 			attribute.String("order.id", req.OrderID),
@@ -62,25 +96,145 @@ func (s *PaymentService) ProcessCharge(ctx context.Context, req ChargeRequest) (
 	)
 	defer span.End()
 
+	if err := s.resolveOrderID(ctx, span, &req); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// Shadow once the primary result is decided; runs async and never alters resp/err
+	// Duplicates of an earlier charge are skipped so each charge is only mirrored once
+	duplicate := false
+	if s.shadow != nil {
+		defer func() {
+			if !duplicate {
+				s.shadow.Mirror(span, req, resp, err)
+			}
+		}()
+	}
+
+	if active := s.featureFlags.Active(req.MerchantID); len(active) > 0 {
+		span.SetAttributes(attribute.StringSlice("feature_flags", features.Strings(active)))
+	}
+	if budget := BudgetFromContext(ctx); budget.Set() {
+		span.SetAttributes(attribute.Int64("budget.remaining_ms", budget.Remaining().Milliseconds()))
+	}
+
+	// Over-precise amounts are rejected or adjusted before dedup, so a retry of the same amount replays the same charge
+	adjusted, err := s.amountPrecision.Apply(req.Amount)
+	if err != nil {
+		span.SetAttributes(attribute.String("amount.precision_mode", s.amountPrecision.Mode))
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("%w: %v allows %d", err, req.Amount, s.amountPrecision.Decimals)
+	}
+	if adjusted != req.Amount {
+		span.SetAttributes(
+			attribute.String("amount.precision_mode", s.amountPrecision.Mode),
+			attribute.Float64("amount.original", req.Amount),
+			attribute.Float64("amount.adjusted", adjusted),
+		)
+		req.Amount = adjusted
+	}
+
+	if idempotencyKey == "" {
+		return s.charge(ctx, span, req)
+	}
+
+	span.SetAttributes(attribute.String("idempotency.key", idempotencyKey))
+	start := time.Now()
+	resp, outcome, err := s.dedup.Do(idempotencyKey, func() (*ChargeResponse, error) {
+		return s.charge(ctx, span, req)
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", string(outcome)))
+
+	switch outcome {
+	case DedupReplayed:
+		// The original attempt already charged (possibly after the caller timed out); don't charge twice
+		duplicate = true
+		span.SetAttributes(attribute.Int64("idempotency.wait_ms", time.Since(start).Milliseconds()))
+		span.AddEvent("idempotent_charge_replayed", trace.WithAttributes(
+			attribute.String("transaction.id", resp.TransactionID),
+		))
+		span.SetStatus(codes.Ok, "payment replayed")
+	case DedupWaitTimeout:
+		// Nothing was charged by this call, so there is nothing to shadow
+		duplicate = true
+		span.SetAttributes(attribute.Int64("idempotency.wait_ms", time.Since(start).Milliseconds()))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resp, err
+}
+
+// charge runs the fault injection, validation, fraud, 3DS and gateway steps for a single charge
+func (s *PaymentService) charge(ctx context.Context, span trace.Span, req ChargeRequest) (_ *ChargeResponse, err error) {
+	// Catch order IDs charged twice despite idempotency, e.g. an order service bug or a replay without its key
+	claimed, err := s.orders.claim(ctx, span, req.OrderID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if claimed {
+		defer func() {
+			if err != nil {
+				s.orders.release(req.OrderID)
+			}
+		}()
+	}
+
+	// Global faults hit only a fixed subset of merchants when FAULT_MERCHANT_PCT is below 100
+	faulted := InFaultSubset(req.MerchantID, s.faultMerchants)
+	if s.faultMerchants < 100 {
+		span.SetAttributes(attribute.Bool("fault.merchant_selected", faulted))
+	}
+
 	// Apply artificial delay if configured (for testing timeouts)
-	if s.delayMS > 0 {
+	if faulted && s.delayMS > 0 {
 		span.SetAttributes(attribute.Int("fault.injected_delay_ms", s.delayMS))
 		time.Sleep(time.Duration(s.delayMS) * time.Millisecond)
 	}
 
 	// Apply error injection if configured (for testing retries)
-	if s.errorPercentage > 0 && rand.Float64()*100 < s.errorPercentage {
+	if faulted && s.errorPercentage > 0 && rand.Float64()*100 < s.errorPercentage {
 		span.SetAttributes(attribute.Bool("fault.injected_error", true))
 		span.SetStatus(codes.Error, "injected error for testing")
 		return nil, fmt.Errorf("payment gateway error (injected)")
 	}
 
+	// Apply per-request faults requested via debug headers (only set when ALLOW_FAULT_HEADERS=true)
+	if override, ok := FaultOverrideFromContext(ctx); ok {
+		span.SetAttributes(attribute.Bool("fault.header_override", true))
+		if override.DelayMS > 0 {
+			span.SetAttributes(attribute.Int("fault.header_delay_ms", override.DelayMS))
+			time.Sleep(time.Duration(override.DelayMS) * time.Millisecond)
+		}
+		if override.Error {
+			span.SetAttributes(attribute.Bool("fault.injected_error", true))
+			span.SetStatus(codes.Error, "injected error for testing")
+			return nil, fmt.Errorf("payment gateway error (injected by header)")
+		}
+	}
+
 	// Validate request
 	if err := s.validateRequest(ctx, req); err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
+	// Screen for fraud unless the merchant is trusted to skip it
+	if s.featureFlags.Enabled(req.MerchantID, features.SkipFraudCheck) {
+		span.SetAttributes(attribute.Bool("fraud_check.skipped", true))
+	} else if err := s.checkFraud(ctx, req); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// Run 3-D Secure verification for merchants that opted in
+	if s.featureFlags.Enabled(req.MerchantID, features.Enable3DS) {
+		if err := s.verify3DS(ctx, req); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
 	// Simulate payment gateway call
 	transactionID, err := s.callPaymentGateway(ctx, req)
 	if err != nil {
@@ -107,6 +261,9 @@ func (s *PaymentService) validateRequest(ctx context.Context, req ChargeRequest)
 	// Simulate validation logic
 	time.Sleep(5 * time.Millisecond)
 
+	if err := ValidateAmount(req.Amount); err != nil {
+		return err
+	}
 	if req.Amount <= 0 {
 		return fmt.Errorf("invalid amount: %f", req.Amount)
 	}
@@ -115,13 +272,61 @@ func (s *PaymentService) validateRequest(ctx context.Context, req ChargeRequest)
 	return nil
 }
 
+// checkFraud simulates a fraud screening call
+func (s *PaymentService) checkFraud(ctx context.Context, req ChargeRequest) error {
+	_, span := s.tracer.Start(ctx, "fraudCheck")
+	defer span.End()
+
+	// Simulate fraud scoring latency
+	time.Sleep(3 * time.Millisecond)
+
+	span.SetStatus(codes.Ok, "fraud check passed")
+	return nil
+}
+
+// verify3DS simulates a 3-D Secure cardholder verification
+func (s *PaymentService) verify3DS(ctx context.Context, req ChargeRequest) error {
+	_, span := s.tracer.Start(ctx, "verify3DS")
+	defer span.End()
+
+	// Simulate issuer ACS round trip
+	time.Sleep(15 * time.Millisecond)
+
+	span.SetStatus(codes.Ok, "3DS verification passed")
+	return nil
+}
+
 // callPaymentGateway simulates calling an external payment gateway
+// The call gets whatever is left of the caller's budget after reserving time for our own response
 func (s *PaymentService) callPaymentGateway(ctx context.Context, req ChargeRequest) (string, error) {
-	_, span := s.tracer.Start(ctx, "gatewayCall")
+	ctx, span := s.tracer.Start(ctx, "gatewayCall")
 	defer span.End()
 
+	budget := BudgetFromContext(ctx)
+	if budget.Set() {
+		span.SetAttributes(attribute.Int64("budget.remaining_ms", budget.Remaining().Milliseconds()))
+	}
+	ctx, cancel := budget.Reserve(s.gateway.BudgetReserve).Context(ctx, s.gateway.Timeout)
+	defer cancel()
+	gatewayBudget, _ := ctx.Deadline()
+	span.SetAttributes(attribute.Int64("budget.gateway_ms", time.Until(gatewayBudget).Milliseconds()))
+
+	// A saturated gateway turns callers away rather than accepting unlimited parallel calls
+	release, err := s.gatewaySlots.acquire(ctx, span)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	defer release()
+
 	// Simulate gateway API call latency
-	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+		span.SetAttributes(attribute.Bool("budget.exhausted", true))
+		span.SetStatus(codes.Error, "gateway call exceeded budget")
+		return "", fmt.Errorf("payment gateway call exceeded budget: %w", ctx.Err())
+	}
 
 	transactionID := uuid.New().String()
 	span.SetAttributes(attribute.String("transaction.id", transactionID))
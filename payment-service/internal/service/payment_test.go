@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/demo/payment-service/internal/config"
+	"github.com/demo/payment-service/internal/features"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFeatureFlagsChangeChargePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		flags     []features.Flag
+		wantSpans []string // Steps of the charge that ran
+		skipSpans []string // Steps of the charge that didn't
+	}{
+		{name: "no flags", wantSpans: []string{"validate", "fraudCheck", "gatewayCall"}, skipSpans: []string{"verify3DS"}},
+		{name: "3DS enabled", flags: []features.Flag{features.Enable3DS},
+			wantSpans: []string{"validate", "fraudCheck", "verify3DS", "gatewayCall"}},
+		{name: "fraud check skipped", flags: []features.Flag{features.SkipFraudCheck},
+			wantSpans: []string{"validate", "gatewayCall"}, skipSpans: []string{"fraudCheck", "verify3DS"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.FeatureFlags = map[string][]features.Flag{"flagged": tt.flags}
+			svc := NewPaymentService(cfg)
+			recorder := tracetest.NewSpanRecorder()
+			svc.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			req := ChargeRequest{OrderID: "order-1", MerchantID: "flagged", Amount: 10, Currency: "USD"}
+			if _, err := svc.ProcessCharge(context.Background(), req, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			var ran []string
+			for _, span := range recorder.Ended() {
+				ran = append(ran, span.Name())
+				if span.Name() != "processCharge" {
+					continue
+				}
+				for _, kv := range span.Attributes() {
+					if kv.Key == "feature_flags" && len(kv.Value.AsStringSlice()) != len(tt.flags) {
+						t.Errorf("feature_flags = %v, want %v", kv.Value.AsStringSlice(), tt.flags)
+					}
+				}
+			}
+			for _, name := range tt.wantSpans {
+				if !slices.Contains(ran, name) {
+					t.Errorf("%s didn't run; spans %v", name, ran)
+				}
+			}
+			for _, name := range tt.skipSpans {
+				if slices.Contains(ran, name) {
+					t.Errorf("%s ran, want it skipped", name)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessChargeCancelledOnEntry(t *testing.T) {
+	tests := []struct {
+		name          string
+		skipCancelled bool
+		wantErr       error
+		wantSpans     int // Spans the charge itself started
+	}{
+		{name: "skipped before any span", skipCancelled: true, wantErr: context.Canceled},
+		{name: "check disabled charges anyway", wantSpans: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.SkipCancelled = tt.skipCancelled
+			svc := NewPaymentService(cfg)
+			svc.errorPercentage = 0
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			svc.tracer = tracer
+
+			ctx, server := tracer.Start(context.Background(), "POST /charge")
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err := svc.ProcessCharge(ctx, ChargeRequest{OrderID: "order-1", MerchantID: "merchant_123", Amount: 10, Currency: "USD"}, "key-1")
+			server.End()
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Fatalf("ProcessCharge() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var charged int
+			var flagged bool
+			for _, span := range recorder.Ended() {
+				if span.Name() == "processCharge" {
+					charged++
+				}
+				if span.Name() != "POST /charge" {
+					continue
+				}
+				for _, kv := range span.Attributes() {
+					if kv.Key == "ctx.cancelled_at_entry" {
+						flagged = kv.Value.AsBool()
+					}
+				}
+			}
+			if charged != tt.wantSpans {
+				t.Errorf("processCharge spans = %d, want %d", charged, tt.wantSpans)
+			}
+			if flagged != tt.skipCancelled {
+				t.Errorf("ctx.cancelled_at_entry = %v, want %v", flagged, tt.skipCancelled)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// shadowTimeout bounds each shadow call so a slow shadow target can't pile up goroutines
+const shadowTimeout = 2 * time.Second
+
+// ShadowGateway mirrors a fraction of charges to a secondary gateway for safe comparison
+// Shadow calls run asynchronously after the primary result is decided and never affect the client response
+type ShadowGateway struct {
+	url         string
+	percentage  float64 // Percentage of charges mirrored (0-100)
+	httpClient  *http.Client
+	tracer      trace.Tracer
+	calls       metric.Int64Counter
+	divergences metric.Int64Counter
+}
+
+// NewShadowGateway creates a shadow gateway mirroring percentage% of charges to url
+func NewShadowGateway(url string, percentage float64, tracer trace.Tracer) *ShadowGateway {
+	meter := otel.Meter("payment-service")
+	calls, _ := meter.Int64Counter("payment.shadow.calls",
+		metric.WithDescription("Charges mirrored to the shadow gateway"))
+	divergences, _ := meter.Int64Counter("payment.shadow.divergences",
+		metric.WithDescription("Shadow results that disagreed with the primary result"))
+
+	return &ShadowGateway{
+		url:         url,
+		percentage:  percentage,
+		httpClient:  &http.Client{Timeout: shadowTimeout},
+		tracer:      tracer,
+		calls:       calls,
+		divergences: divergences,
+	}
+}
+
+// Mirror samples the charge and, if selected, replays it against the shadow target in the background
+// The shadow span is linked (not parented) to the primary span since it outlives the request
+func (g *ShadowGateway) Mirror(parent trace.Span, req ChargeRequest, primary *ChargeResponse, primaryErr error) {
+	if g.percentage <= 0 || rand.Float64()*100 >= g.percentage {
+		return
+	}
+	parent.SetAttributes(attribute.Bool("shadow.sampled", true))
+
+	link := trace.Link{SpanContext: parent.SpanContext()}
+	go g.call(link, req, primary, primaryErr)
+}
+
+// call sends the shadow charge and records whether its outcome diverged from the primary
+func (g *ShadowGateway) call(link trace.Link, req ChargeRequest, primary *ChargeResponse, primaryErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	ctx, span := g.tracer.Start(ctx, "shadowCharge",
+		trace.WithLinks(link),
+		trace.WithAttributes(
+			attribute.String("order.id", req.OrderID),
+			attribute.String("shadow.url", g.url),
+		),
+	)
+	defer span.End()
+
+	g.calls.Add(ctx, 1)
+
+	body, _ := json.Marshal(req)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url+"/charge", bytes.NewReader(body))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	primarySuccess := primaryErr == nil
+	primaryStatus := "error"
+	if primary != nil {
+		primaryStatus = primary.Status
+	}
+
+	shadowSuccess := false
+	shadowStatus := "error"
+	resp, err := g.httpClient.Do(httpReq)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		defer resp.Body.Close()
+		span.SetAttributes(attribute.Int("shadow.status_code", resp.StatusCode))
+
+		var shadowResp ChargeResponse
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 && json.NewDecoder(resp.Body).Decode(&shadowResp) == nil {
+			shadowSuccess = true
+			shadowStatus = shadowResp.Status
+		}
+	}
+
+	diverged := primarySuccess != shadowSuccess || primaryStatus != shadowStatus
+	span.SetAttributes(
+		attribute.String("shadow.primary_status", primaryStatus),
+		attribute.String("shadow.result_status", shadowStatus),
+		attribute.Bool("shadow.diverged", diverged),
+	)
+
+	if diverged {
+		g.divergences.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("primary_status", primaryStatus),
+			attribute.String("shadow_status", shadowStatus),
+		))
+		span.AddEvent("shadow_divergence")
+	}
+
+	span.SetStatus(codes.Ok, "shadow call completed")
+}
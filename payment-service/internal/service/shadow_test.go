@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/demo/payment-service/internal/config"
+)
+
+func TestShadowGatewayMirrorsWithoutAlteringResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		percentage   float64
+		shadowStatus int
+		shadowDelay  time.Duration
+		wantMirrored bool
+	}{
+		{name: "agreeing shadow", percentage: 100, shadowStatus: http.StatusOK, wantMirrored: true},
+		{name: "failing shadow", percentage: 100, shadowStatus: http.StatusInternalServerError, wantMirrored: true},
+		{name: "slow shadow", percentage: 100, shadowStatus: http.StatusOK, shadowDelay: 500 * time.Millisecond, wantMirrored: true},
+		{name: "unsampled charge", percentage: 0, shadowStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirrored := make(chan ChargeRequest, 1)
+			shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req ChargeRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				time.Sleep(tt.shadowDelay)
+				w.WriteHeader(tt.shadowStatus)
+				json.NewEncoder(w).Encode(ChargeResponse{TransactionID: "shadow-txn", Status: "approved"})
+				mirrored <- req
+			}))
+			defer shadow.Close()
+
+			cfg := config.Default()
+			cfg.Shadow = config.ShadowConfig{URL: shadow.URL, Percentage: tt.percentage}
+			svc := NewPaymentService(cfg)
+
+			req := ChargeRequest{OrderID: "order-1", MerchantID: "merchant_1", Amount: 42, Currency: "USD"}
+			start := time.Now()
+			resp, err := svc.ProcessCharge(context.Background(), req, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != "approved" || resp.TransactionID == "shadow-txn" || resp.Amount != req.Amount {
+				t.Errorf("response = %+v, want the primary's approved charge", resp)
+			}
+			if elapsed := time.Since(start); elapsed >= tt.shadowDelay && tt.shadowDelay > 0 {
+				t.Errorf("charge took %v, want it not to wait for the shadow's %v", elapsed, tt.shadowDelay)
+			}
+
+			// A charge that wasn't sampled only needs long enough to show nothing was sent
+			wait := 2 * time.Second
+			if !tt.wantMirrored {
+				wait = 200 * time.Millisecond
+			}
+			select {
+			case got := <-mirrored:
+				if !tt.wantMirrored {
+					t.Fatal("shadow was called for an unsampled charge")
+				}
+				if got != req {
+					t.Errorf("shadow received %+v, want %+v", got, req)
+				}
+			case <-time.After(wait):
+				if tt.wantMirrored {
+					t.Fatal("shadow was never called")
+				}
+			}
+		})
+	}
+}
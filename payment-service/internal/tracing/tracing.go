@@ -3,6 +3,7 @@ package tracing
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -12,6 +13,7 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // InitTracer initializes the OpenTelemetry tracer with OTLP exporter
@@ -52,6 +54,28 @@ func InitTracer(serviceName, collectorEndpoint string) (func(context.Context) er
 	}, nil
 }
 
+// InitNoopTracer installs a no-op tracer provider for running without a collector
+func InitNoopTracer() func(context.Context) error {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(context.Context) error { return nil }
+}
+
+// InitTracerOrNoop runs init, falling back to InitNoopTracer with a warning if it fails and failOpen is set
+// Without failOpen the error is returned so the caller can refuse to start
+func InitTracerOrNoop(failOpen bool, init func() (func(context.Context) error, error)) (func(context.Context) error, error) {
+	shutdown, err := init()
+	if err == nil {
+		return shutdown, nil
+	}
+	if !failOpen {
+		return nil, err
+	}
+	// Fail open: a collector outage at boot shouldn't keep the service down
+	log.Printf("WARNING: failed to initialize tracer, continuing without tracing: %v", err)
+	return InitNoopTracer(), nil
+}
+
 func GetTracer(name string) trace.Tracer {
 	return otel.Tracer(name)
 }
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestInitTracerOrNoopFailOpen(t *testing.T) {
+	shutdown, err := InitTracerOrNoop(true, func() (func(context.Context) error, error) {
+		return nil, errors.New("failed to create trace exporter")
+	})
+	if err != nil {
+		t.Fatalf("InitTracerOrNoop() error = %v, want the service to start", err)
+	}
+	if _, ok := otel.GetTracerProvider().(noop.TracerProvider); !ok {
+		t.Errorf("global tracer provider = %T, want the no-op provider", otel.GetTracerProvider())
+	}
+	_, span := GetTracer("payment-service").Start(context.Background(), "processCharge")
+	if span.IsRecording() {
+		t.Error("span is recording, want spans discarded")
+	}
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}